@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"opencloud.eu/groupware-assistant/pkg/inspect"
+)
+
+var changesCmd = &cobra.Command{
+	Use:   "changes",
+	Short: "Print which objects were created, updated and destroyed since a given or saved state",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		types, err := cmd.Flags().GetStringSlice("types")
+		if err != nil {
+			return err
+		}
+		sinceValues, err := cmd.Flags().GetStringSlice("since")
+		if err != nil {
+			return err
+		}
+		stateFile, err := cmd.Flags().GetString("state-file")
+		if err != nil {
+			return err
+		}
+		maxChanges, err := cmd.Flags().GetUint("max-changes")
+		if err != nil {
+			return err
+		}
+
+		since, err := inspect.ParseSince(types, sinceValues)
+		if err != nil {
+			return err
+		}
+
+		config, err := jmapConfig()
+		if err != nil {
+			return err
+		}
+
+		return inspect.Changes(
+			cmd.Context(),
+			JmapUrl,
+			config,
+			AccountId,
+			types,
+			since,
+			stateFile,
+			maxChanges,
+			func(text string) { fmt.Println(text) },
+		)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(changesCmd)
+
+	changesCmd.Flags().StringSlice("types", inspect.DefaultChangesTypes, "Comma-separated list of the types of objects to show the changes of")
+	changesCmd.Flags().StringSlice("since", nil, "State to show the changes since instead of the saved one, either as Type=state, may be repeated, or as a single state along with a single --types")
+	changesCmd.Flags().String("state-file", ".groupware-assistant-state.json", "File to read the states from and to save the new ones to, to show the changes since the last run; empty to not use any")
+	changesCmd.Flags().Uint("max-changes", 0, "Maximum number of changes to fetch per /changes call, which are then fetched page by page; 0 to leave it to the server")
+}
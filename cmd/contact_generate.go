@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
 	"opencloud.eu/groupware-assistant/pkg/generator"
+	"opencloud.eu/groupware-assistant/pkg/jmap"
 )
 
 var contactGenerateCmd = &cobra.Command{
@@ -23,18 +25,19 @@ var contactGenerateCmd = &cobra.Command{
 			return err
 		}
 
-		return generator.GenerateContacts(
-			JmapUrl,
-			Trace,
-			Color,
-			Username,
-			Password,
-			AccountId,
-			empty,
-			addressbookId,
-			count,
-			func(text string) { fmt.Println(text) },
-		)
+		return generate(cmd, generator.RosterContacts, count, func(ctx context.Context, config jmap.Config, username string, accountId string, count uint) error {
+			return generator.GenerateContacts(
+				ctx,
+				JmapUrl,
+				config,
+				Parallel,
+				accountId,
+				empty,
+				addressbookId,
+				count,
+				func(text string) { fmt.Println(text) },
+			)
+		})
 	},
 }
 
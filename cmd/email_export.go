@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"opencloud.eu/groupware-assistant/pkg/inspect"
+)
+
+var emailExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Download the raw messages of emails and write them as .eml files or to an mbox file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mailboxId, err := cmd.Flags().GetString("mailbox-id")
+		if err != nil {
+			return err
+		}
+		mailboxRole, err := cmd.Flags().GetString("mailbox-role")
+		if err != nil {
+			return err
+		}
+		ids, err := cmd.Flags().GetStringSlice("ids")
+		if err != nil {
+			return err
+		}
+		limit, err := cmd.Flags().GetUint("limit")
+		if err != nil {
+			return err
+		}
+		dir, err := cmd.Flags().GetString("dir")
+		if err != nil {
+			return err
+		}
+		mbox, err := cmd.Flags().GetString("mbox")
+		if err != nil {
+			return err
+		}
+
+		// the default role only applies when neither a mailbox ID nor email IDs are given
+		if (mailboxId != "" || len(ids) > 0) && !cmd.Flags().Changed("mailbox-role") {
+			mailboxRole = ""
+		}
+
+		config, err := jmapConfig()
+		if err != nil {
+			return err
+		}
+
+		return inspect.ExportEmails(
+			cmd.Context(),
+			JmapUrl,
+			config,
+			AccountId,
+			mailboxId,
+			mailboxRole,
+			ids,
+			limit,
+			dir,
+			mbox,
+			func(text string) { fmt.Println(text) },
+		)
+	},
+}
+
+func init() {
+	emailCmd.AddCommand(emailExportCmd)
+
+	emailExportCmd.Flags().String("mailbox-id", "", "ID of the JMAP Mailbox to export the emails of")
+	emailExportCmd.Flags().String("mailbox-role", "inbox", "Role of the JMAP Mailbox to export the emails of when no ID is specified")
+	emailExportCmd.Flags().StringSlice("ids", nil, "Comma-separated list of the IDs of the emails to export, instead of those in a mailbox")
+	emailExportCmd.Flags().Uint("limit", 0, "Maximum number of emails to export; 0 to export all of them")
+	emailExportCmd.Flags().String("dir", ".", "Directory to write the <id>.eml files to")
+	emailExportCmd.Flags().String("mbox", "", "File to write all the emails to in the mboxrd format, instead of separate .eml files")
+}
@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
 	"opencloud.eu/groupware-assistant/pkg/generator"
+	"opencloud.eu/groupware-assistant/pkg/jmap"
 )
 
 var emailGenerateCmd = &cobra.Command{
@@ -38,6 +40,10 @@ var emailGenerateCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		spread, err := cmd.Flags().GetString("spread")
+		if err != nil {
+			return err
+		}
 		minThreadSize, err := cmd.Flags().GetUint("min-thread-size")
 		if err != nil {
 			return err
@@ -98,47 +104,108 @@ var emailGenerateCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		distinctAttachments, err := cmd.Flags().GetUint("distinct-attachments")
+		if err != nil {
+			return err
+		}
+		attachmentSizeSpec, err := cmd.Flags().GetString("attachment-size")
+		if err != nil {
+			return err
+		}
+		exceedMaxSizeUpload, err := cmd.Flags().GetBool("exceed-max-size-upload")
+		if err != nil {
+			return err
+		}
 		icalEvery, err := cmd.Flags().GetUint("ical-every")
 		if err != nil {
 			return err
 		}
-
-		if senders == 0 {
-			senders = min(1, count/4)
+		importMessages, err := cmd.Flags().GetBool("import")
+		if err != nil {
+			return err
 		}
+		headers, err := cmd.Flags().GetStringArray("header")
+		if err != nil {
+			return err
+		}
+		pgpSignEvery, err := cmd.Flags().GetUint("pgp-sign-every")
+		if err != nil {
+			return err
+		}
+		pgpEncryptEvery, err := cmd.Flags().GetUint("pgp-encrypt-every")
+		if err != nil {
+			return err
+		}
+		smimeEvery, err := cmd.Flags().GetUint("smime-every")
+		if err != nil {
+			return err
+		}
+		smimeEncryptEvery, err := cmd.Flags().GetUint("smime-encrypt-every")
+		if err != nil {
+			return err
+		}
+		keysDir, err := cmd.Flags().GetString("keys-dir")
+		if err != nil {
+			return err
+		}
+		locales, err := cmd.Flags().GetString("locales")
+		if err != nil {
+			return err
+		}
+
+		return generate(cmd, generator.RosterEmails, count, func(ctx context.Context, config jmap.Config, username string, accountId string, count uint) error {
+			senders := senders
+			if senders == 0 {
+				senders = max(1, count/4)
+			}
+			config.IgnoreUploadLimits = exceedMaxSizeUpload
 
-		return generator.GenerateEmails(
-			JmapUrl,
-			Trace,
-			Color,
-			emojis,
-			Username,
-			Password,
-			AccountId,
-			empty,
-			mailboxId,
-			mailboxRole,
-			domain,
-			count,
-			senders,
-			minThreadSize,
-			maxThreadSize,
-			ccEvery,
-			bccEvery,
-			seenEvery,
-			attachEvery,
-			minAttachments,
-			maxAttachments,
-			attachmentOptionsSpec,
-			forwardedEvery,
-			importantEvery,
-			junkEvery,
-			notJunkEvery,
-			phishingEvery,
-			draftEvery,
-			icalEvery,
-			func(text string) { fmt.Println(text) },
-		)
+			return generator.GenerateEmails(
+				ctx,
+				JmapUrl,
+				config,
+				Parallel,
+				username,
+				accountId,
+				count,
+				generator.EmailOptions{
+					Emojis:              emojis,
+					Empty:               empty,
+					MailboxId:           mailboxId,
+					MailboxRole:         mailboxRole,
+					Spread:              spread,
+					Domain:              domain,
+					Senders:             senders,
+					MinThreadSize:       minThreadSize,
+					MaxThreadSize:       maxThreadSize,
+					CcEvery:             ccEvery,
+					BccEvery:            bccEvery,
+					SeenEvery:           seenEvery,
+					AttachmentEvery:     attachEvery,
+					MinAttachments:      minAttachments,
+					MaxAttachments:      maxAttachments,
+					AttachmentOptions:   attachmentOptionsSpec,
+					DistinctAttachments: distinctAttachments,
+					AttachmentSizes:     attachmentSizeSpec,
+					ForwardedEvery:      forwardedEvery,
+					ImportantEvery:      importantEvery,
+					JunkEvery:           junkEvery,
+					NotJunkEvery:        notJunkEvery,
+					PhishingEvery:       phishingEvery,
+					DraftEvery:          draftEvery,
+					IcalEvery:           icalEvery,
+					Import:              importMessages,
+					Headers:             headers,
+					PgpSignEvery:        pgpSignEvery,
+					PgpEncryptEvery:     pgpEncryptEvery,
+					SmimeEvery:          smimeEvery,
+					SmimeEncryptEvery:   smimeEncryptEvery,
+					KeysDir:             keysDir,
+					Locales:             locales,
+				},
+				func(text string) { fmt.Println(text) },
+			)
+		})
 	},
 }
 
@@ -148,9 +215,10 @@ func init() {
 	emailGenerateCmd.Flags().UintP("count", "c", 20, "How many emails to add to the folder")
 	emailGenerateCmd.Flags().UintP("senders", "s", 0, "How many senders to use, spread randomly across the emails; 0 is the default and is then computed to be <count>/4")
 	emailGenerateCmd.Flags().BoolP("empty", "E", false, "Whether to empty the folder before adding emails to it")
-	emailGenerateCmd.Flags().StringP("domain", "d", "example.com", "The domain to use for all email addresses (From, CC, ...)")
+	emailGenerateCmd.Flags().StringP("domain", "d", "example.com", "The domain to use for all email addresses (From, CC, ...), besides those of the --locales")
 	emailGenerateCmd.Flags().String("mailbox-id", "", "ID of the JMAP Mailbox to use")
 	emailGenerateCmd.Flags().String("mailbox-role", "inbox", "Role of the JMAP Mailbox to use when no ID is specified")
+	emailGenerateCmd.Flags().String("spread", "", "Spread the threads across that mailbox and all the mailboxes without a role, either 'uniform', or 'zipf' or 'zipf:<exponent>' to have a few mailboxes get most of them")
 	emailGenerateCmd.Flags().Uint("min-thread-size", 1, "Minimum number of emails in one thread")
 	emailGenerateCmd.Flags().Uint("max-thread-size", 6, "Maximum number of emails in one thread")
 	emailGenerateCmd.Flags().Uint("cc-every", 3, "Add CC: headers every n emails")
@@ -160,6 +228,9 @@ func init() {
 	emailGenerateCmd.Flags().Uint("min-attachments", 1, "Minimum number of attachments per email")
 	emailGenerateCmd.Flags().Uint("max-attachments", 4, "Maximum number of attachments per email")
 	emailGenerateCmd.Flags().String("attachment-options", "", "Specifies a comma-separated list of numbers of attachments of which a random value is picked for every email; when set, overrides --min-attachments, --max-attachments and --attachment-every")
+	emailGenerateCmd.Flags().Uint("distinct-attachments", 0, "How many different attachments to generate at most, which are then reused across emails and only uploaded once; 0 to make every attachment unique")
+	emailGenerateCmd.Flags().String("attachment-size", "", "Size of the attachments, picked from a comma-separated list of sizes or ranges of sizes, e.g. '100KB..25MB' or '1MiB,10MiB'; by default attachments are small")
+	emailGenerateCmd.Flags().Bool("exceed-max-size-upload", false, "Send attachments that are larger than the server accepts (maxSizeUpload, maxSizeAttachmentsPerEmail) anyway and report how it rejects them")
 	emailGenerateCmd.Flags().Uint("forwarded-every", 4, "Mark emails as forwarded every n emails")
 	emailGenerateCmd.Flags().Uint("important-every", 4, "Mark emails as important every n emails")
 	emailGenerateCmd.Flags().Uint("junk-every", 10, "Mark emails as junk every n emails")
@@ -167,5 +238,13 @@ func init() {
 	emailGenerateCmd.Flags().Uint("phishing-every", 7, "Mark emails as phishing every n emails")
 	emailGenerateCmd.Flags().Uint("draft-every", 10, "Mark emails as draft every n emails")
 	emailGenerateCmd.Flags().Uint("ical-every", 4, "Add ical attachment every n emails")
+	emailGenerateCmd.Flags().Bool("import", false, "Build the MIME message of every email and create it with Email/import, rather than having the server compose it with Email/set")
+	emailGenerateCmd.Flags().StringArray("header", nil, "Add a header field to every email, as 'Name: value'; may be repeated")
+	emailGenerateCmd.Flags().Uint("pgp-sign-every", 0, "Sign emails with OpenPGP (PGP/MIME) every n emails, and publish the public keys of their senders on contacts")
+	emailGenerateCmd.Flags().Uint("pgp-encrypt-every", 0, "Encrypt emails with OpenPGP (PGP/MIME) for the recipient and the sender every n emails")
+	emailGenerateCmd.Flags().Uint("smime-every", 0, "Sign emails with S/MIME every n emails, instead of signing or encrypting them with OpenPGP, and publish the certificates of their senders on contacts")
+	emailGenerateCmd.Flags().Uint("smime-encrypt-every", 0, "Encrypt emails with S/MIME for the recipient and the sender every n emails, instead of signing or encrypting them with OpenPGP")
+	emailGenerateCmd.Flags().String("keys-dir", "", "Directory to write the private OpenPGP key and the S/MIME certificate and key of the recipient, and the certificate of the S/MIME CA to, for those to be imported into a client")
+	emailGenerateCmd.Flags().String("locales", "", "Write the threads in any of a comma-separated list of locales, between people with internationalized addresses: de, fr, ja, zh, ar, he and ru, 'en' for the default English text, or 'all' for all of them but English")
 	emailGenerateCmd.Flags().Bool("emojis", true, "Whether to include emojis in the From name to easily find emails that match certain criteria")
 }
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+
+	"github.com/spf13/cobra"
+	"opencloud.eu/groupware-assistant/pkg/generator"
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+)
+
+var emailSendCmd = &cobra.Command{
+	Use:   "send",
+	Short: "Send emails with EmailSubmission, to the --to addresses or between the users of the --users-file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		count, err := cmd.Flags().GetUint("count")
+		if err != nil {
+			return err
+		}
+		to, err := cmd.Flags().GetStringSlice("to")
+		if err != nil {
+			return err
+		}
+		identityId, err := cmd.Flags().GetString("identity-id")
+		if err != nil {
+			return err
+		}
+		domain, err := cmd.Flags().GetString("domain")
+		if err != nil {
+			return err
+		}
+		ccEvery, err := cmd.Flags().GetUint("cc-every")
+		if err != nil {
+			return err
+		}
+
+		recipients := []mail.Address{}
+		for _, t := range to {
+			a, err := mail.ParseAddress(t)
+			if err != nil {
+				return fmt.Errorf("invalid --to address '%s': %w", t, err)
+			}
+			recipients = append(recipients, *a)
+		}
+		var users []generator.User = nil
+		if UsersFile != "" && len(recipients) < 1 {
+			users, err = generator.LoadRoster(UsersFile)
+			if err != nil {
+				return err
+			}
+		} else if len(recipients) < 1 {
+			return fmt.Errorf("--to is required unless the emails are sent between the users of the --users-file")
+		}
+
+		return generate(cmd, generator.RosterSent, count, func(ctx context.Context, config jmap.Config, username string, accountId string, count uint) error {
+			// without --to, every user of the roster sends emails to the others
+			others := recipients
+			if users != nil {
+				others = []mail.Address{}
+				for _, u := range users {
+					if u.Username != username {
+						others = append(others, generator.UserAddress(u.Username, domain))
+					}
+				}
+			}
+			return generator.SendEmails(
+				ctx,
+				JmapUrl,
+				config,
+				accountId,
+				identityId,
+				others,
+				count,
+				ccEvery,
+				func(text string) { fmt.Println(text) },
+			)
+		})
+	},
+}
+
+func init() {
+	emailCmd.AddCommand(emailSendCmd)
+
+	emailSendCmd.Flags().UintP("count", "c", 10, "How many emails to send")
+	emailSendCmd.Flags().StringSlice("to", nil, "Addresses to send the emails to, may be repeated; by default the other users of the --users-file")
+	emailSendCmd.Flags().String("identity-id", "", "ID of the JMAP Identity to send the emails from, the first one by default")
+	emailSendCmd.Flags().String("domain", "example.com", "Domain of the addresses of the users of the --users-file that are not email addresses")
+	emailSendCmd.Flags().Uint("cc-every", 3, "Send every n-th email to a second recipient in Cc; 0 for none")
+}
@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
 	"opencloud.eu/groupware-assistant/pkg/generator"
+	"opencloud.eu/groupware-assistant/pkg/jmap"
 )
 
 var eventGenerateCmd = &cobra.Command{
@@ -23,18 +25,19 @@ var eventGenerateCmd = &cobra.Command{
 			return err
 		}
 
-		return generator.GenerateEvents(
-			JmapUrl,
-			Trace,
-			Color,
-			Username,
-			Password,
-			AccountId,
-			empty,
-			calendarId,
-			count,
-			func(text string) { fmt.Println(text) },
-		)
+		return generate(cmd, generator.RosterEvents, count, func(ctx context.Context, config jmap.Config, username string, accountId string, count uint) error {
+			return generator.GenerateEvents(
+				ctx,
+				JmapUrl,
+				config,
+				Parallel,
+				accountId,
+				empty,
+				calendarId,
+				count,
+				func(text string) { fmt.Println(text) },
+			)
+		})
 	},
 }
 
@@ -0,0 +1,13 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var identityCmd = &cobra.Command{
+	Use: "identity",
+}
+
+func init() {
+	rootCmd.AddCommand(identityCmd)
+}
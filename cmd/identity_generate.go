@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"opencloud.eu/groupware-assistant/pkg/generator"
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+)
+
+var identityGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Create identities with signatures to send emails from, the first one with the address of the user",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		count, err := cmd.Flags().GetUint("count")
+		if err != nil {
+			return err
+		}
+		domain, err := cmd.Flags().GetString("domain")
+		if err != nil {
+			return err
+		}
+		replyToEvery, err := cmd.Flags().GetUint("reply-to-every")
+		if err != nil {
+			return err
+		}
+
+		return generate(cmd, generator.RosterIdentities, count, func(ctx context.Context, config jmap.Config, username string, accountId string, count uint) error {
+			return generator.GenerateIdentities(
+				ctx,
+				JmapUrl,
+				config,
+				accountId,
+				username,
+				domain,
+				count,
+				replyToEvery,
+				func(text string) { fmt.Println(text) },
+			)
+		})
+	},
+}
+
+func init() {
+	identityCmd.AddCommand(identityGenerateCmd)
+
+	identityGenerateCmd.Flags().UintP("count", "c", 3, "How many identities to create, the ones after the first with a subaddress such as +sales")
+	identityGenerateCmd.Flags().String("domain", "example.com", "Domain of the addresses of the identities, for usernames that are not email addresses")
+	identityGenerateCmd.Flags().Uint("reply-to-every", 2, "Give every n-th identity a reply-to address; 0 for none")
+}
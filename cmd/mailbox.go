@@ -0,0 +1,13 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var mailboxCmd = &cobra.Command{
+	Use: "mailbox",
+}
+
+func init() {
+	rootCmd.AddCommand(mailboxCmd)
+}
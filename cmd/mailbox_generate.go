@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"opencloud.eu/groupware-assistant/pkg/generator"
+)
+
+var mailboxGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Create a tree of project, archive and shared folders",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		parentId, err := cmd.Flags().GetString("parent-id")
+		if err != nil {
+			return err
+		}
+		projects, err := cmd.Flags().GetUint("projects")
+		if err != nil {
+			return err
+		}
+		years, err := cmd.Flags().GetUint("years")
+		if err != nil {
+			return err
+		}
+		depth, err := cmd.Flags().GetUint("depth")
+		if err != nil {
+			return err
+		}
+		unsubscribedEvery, err := cmd.Flags().GetUint("unsubscribed-every")
+		if err != nil {
+			return err
+		}
+
+		if UsersFile != "" {
+			return fmt.Errorf("--users-file is not supported when generating mailboxes")
+		}
+
+		config, err := jmapConfig()
+		if err != nil {
+			return err
+		}
+
+		return generator.GenerateMailboxes(
+			cmd.Context(),
+			JmapUrl,
+			config,
+			AccountId,
+			parentId,
+			projects,
+			years,
+			depth,
+			unsubscribedEvery,
+			func(text string) { fmt.Println(text) },
+		)
+	},
+}
+
+func init() {
+	mailboxCmd.AddCommand(mailboxGenerateCmd)
+
+	mailboxGenerateCmd.Flags().String("parent-id", "", "ID of the JMAP Mailbox to create the folders in, at the top level by default")
+	mailboxGenerateCmd.Flags().Uint("projects", 5, "How many project folders to create, with a few subfolders each")
+	mailboxGenerateCmd.Flags().Uint("years", 5, "How many past years to create archive folders for")
+	mailboxGenerateCmd.Flags().Uint("depth", 6, "How many levels deep the shared folders with unicode names go")
+	mailboxGenerateCmd.Flags().Uint("unsubscribed-every", 4, "Leave every n-th folder unsubscribed; 0 to subscribe to all of them")
+}
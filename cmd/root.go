@@ -1,9 +1,18 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"opencloud.eu/groupware-assistant/pkg/generator"
+	"opencloud.eu/groupware-assistant/pkg/jmap"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -14,29 +23,167 @@ var rootCmd = &cobra.Command{
 creating several types of realistic-ish Groupware data, to populate an
 IMAP and JMAP server in order to develop applications or run tests.
 `,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// the flags are fine once we get here, the usage does not help with any other error
+		cmd.SilenceUsage = true
+	},
 }
 
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// let a second interrupt terminate the process right away
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			os.Exit(130)
+		}
 		os.Exit(1)
 	}
 }
 
 var (
-	JmapUrl   string
-	Username  string
-	Password  string
-	AccountId string
-	Trace     bool
-	Color     bool
+	JmapUrl            string
+	Username           string
+	Password           string
+	Token              string
+	OAuth2TokenUrl     string
+	OAuth2Grant        string
+	OAuth2ClientId     string
+	OAuth2ClientSecret string
+	OAuth2Scopes       string
+	AccountId          string
+	CACerts            []string
+	ClientCert         string
+	ClientKey          string
+	Insecure           bool
+	Retries            uint
+	RetryBackoff       time.Duration
+	RetryMaxBackoff    time.Duration
+	Parallel           uint
+	CopyBlobs          bool
+	UsersFile          string
+	Trace              bool
+	Color              bool
+	TraceFile          string
+	TraceFormat        string
 )
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&JmapUrl, "url", "b", "https://stalwart.opencloud.test", "JMAP base URL")
-	rootCmd.PersistentFlags().StringVarP(&Username, "username", "u", "alan", "JMAP basic authentication username")
-	rootCmd.PersistentFlags().StringVarP(&Password, "password", "p", "demo", "JMAP basic authentication password")
+	rootCmd.PersistentFlags().StringVarP(&Username, "username", "u", "alan", "JMAP basic authentication username, also used for the OAuth2 password grant")
+	rootCmd.PersistentFlags().StringVarP(&Password, "password", "p", "demo", "JMAP basic authentication password, also used for the OAuth2 password grant")
+	rootCmd.PersistentFlags().StringVar(&Token, "token", "", "Static bearer token to authenticate with instead of basic authentication")
+	rootCmd.PersistentFlags().StringVar(&OAuth2TokenUrl, "oauth2-token-url", "", "OAuth2 token endpoint to obtain bearer tokens from instead of using basic authentication")
+	rootCmd.PersistentFlags().StringVar(&OAuth2Grant, "oauth2-grant", jmap.OAuth2PasswordGrant, "OAuth2 grant to use with --oauth2-token-url, either '"+jmap.OAuth2PasswordGrant+"' or '"+jmap.OAuth2ClientCredentialsGrant+"'")
+	rootCmd.PersistentFlags().StringVar(&OAuth2ClientId, "oauth2-client-id", "", "OAuth2 client ID")
+	rootCmd.PersistentFlags().StringVar(&OAuth2ClientSecret, "oauth2-client-secret", "", "OAuth2 client secret, if the client is confidential")
+	rootCmd.PersistentFlags().StringVar(&OAuth2Scopes, "oauth2-scopes", "openid", "Comma-separated list of OAuth2 scopes to request")
 	rootCmd.PersistentFlags().StringVarP(&AccountId, "account-id", "A", "", "JMAP account ID to use, default behavior is to use the default account")
+	rootCmd.PersistentFlags().StringSliceVar(&CACerts, "ca-cert", nil, "PEM file with CA certificates to trust in addition to the system ones, may be repeated")
+	rootCmd.PersistentFlags().StringVar(&ClientCert, "client-cert", "", "PEM file with a client certificate for mutual TLS")
+	rootCmd.PersistentFlags().StringVar(&ClientKey, "client-key", "", "PEM file with the private key of --client-cert, when it is not part of that file")
+	rootCmd.PersistentFlags().BoolVar(&Insecure, "insecure", false, "Do not verify the TLS certificate of the server, e.g. for development setups with self-signed certificates")
+	rootCmd.PersistentFlags().UintVar(&Retries, "retries", 5, "How many times to retry requests that were throttled or failed transiently, 0 to disable retries")
+	rootCmd.PersistentFlags().DurationVar(&RetryBackoff, "retry-backoff", 500*time.Millisecond, "Initial delay before retrying a request, doubled with every attempt unless the server sends a Retry-After header")
+	rootCmd.PersistentFlags().DurationVar(&RetryMaxBackoff, "retry-max-backoff", 30*time.Second, "Maximum delay before retrying a request")
+	rootCmd.PersistentFlags().UintVar(&Parallel, "parallel", 1, "How many objects to build and upload in parallel, they are still created in order, within the limits of the server")
+	rootCmd.PersistentFlags().BoolVar(&CopyBlobs, "copy-blobs", false, "Copy attachments that were uploaded to another account of the session with Blob/copy instead of uploading them again")
+	rootCmd.PersistentFlags().StringVar(&UsersFile, "users-file", "", "CSV or JSON file with the username, password, accountId and the counts of emails, contacts, events, tasks, identities and sent emails of users to generate objects for one after the other, instead of the --username")
 	rootCmd.PersistentFlags().BoolVar(&Trace, "trace", false, "Show JMAP HTTP traffic")
 	rootCmd.PersistentFlags().BoolVar(&Color, "color", true, "Show JMAP HTTP traffic in color")
+	rootCmd.PersistentFlags().StringVar(&TraceFile, "trace-file", "", "Write the JMAP HTTP traffic to this file, with credentials redacted and binary content replaced by its SHA-256")
+	rootCmd.PersistentFlags().StringVar(&TraceFormat, "trace-format", "", "Format of the --trace-file, either '"+jmap.TraceFormatHar+"' (HTTP Archive) or '"+jmap.TraceFormatJsonl+"' (one HAR entry per line), by default derived from its extension")
+}
+
+func jmapConfig() (jmap.Config, error) {
+	return jmapConfigFor(Username, Password)
+}
+
+// jmapConfigFor builds the configuration from the root flags, but with the given credentials
+// for basic authentication and the OAuth2 password grant.
+func jmapConfigFor(username string, password string) (jmap.Config, error) {
+	var auth jmap.Authenticator = nil
+	switch {
+	case Token != "" && OAuth2TokenUrl != "":
+		return jmap.Config{}, fmt.Errorf("--token and --oauth2-token-url are mutually exclusive")
+	case Token != "":
+		auth = jmap.BearerToken{Token: Token}
+	case OAuth2TokenUrl != "":
+		if OAuth2ClientId == "" {
+			return jmap.Config{}, fmt.Errorf("--oauth2-client-id is required with --oauth2-token-url")
+		}
+		var scopes []string = nil
+		if OAuth2Scopes != "" {
+			scopes = strings.Split(OAuth2Scopes, ",")
+		}
+		auth = &jmap.OAuth2{
+			TokenUrl:     OAuth2TokenUrl,
+			Grant:        OAuth2Grant,
+			ClientId:     OAuth2ClientId,
+			ClientSecret: OAuth2ClientSecret,
+			Username:     username,
+			Password:     password,
+			Scopes:       scopes,
+		}
+	default:
+		auth = jmap.BasicAuth{Username: username, Password: password}
+	}
+
+	return jmap.Config{
+		Auth: auth,
+		TLS: jmap.TLSConfig{
+			CACerts:    CACerts,
+			ClientCert: ClientCert,
+			ClientKey:  ClientKey,
+			Insecure:   Insecure,
+		},
+		Retry: jmap.RetryPolicy{
+			MaxRetries: Retries,
+			Backoff:    RetryBackoff,
+			MaxBackoff: RetryMaxBackoff,
+		},
+		Trace:       Trace,
+		Color:       Color,
+		TraceFile:   TraceFile,
+		TraceFormat: TraceFormat,
+		CopyBlobs:   CopyBlobs,
+	}, nil
+}
+
+// generate runs a generator for the user of the root flags, or for every user of the
+// --users-file, with their own credentials and account, and the number of objects of the given
+// kind that the file tells, or count otherwise. The blobs that were uploaded for one user are
+// reused for the others as far as they can access them.
+func generate(cmd *cobra.Command, kind string, count uint, run func(ctx context.Context, config jmap.Config, username string, accountId string, count uint) error) error {
+	if UsersFile == "" {
+		config, err := jmapConfig()
+		if err != nil {
+			return err
+		}
+		return run(cmd.Context(), config, Username, AccountId, count)
+	}
+
+	users, err := generator.LoadRoster(UsersFile)
+	if err != nil {
+		return err
+	}
+	blobs := jmap.NewBlobCache()
+	return generator.ForEachUser(cmd.Context(), users, kind, count, func(text string) { fmt.Println(text) }, func(ctx context.Context, user generator.User, count uint) error {
+		password := user.Password
+		if password == "" {
+			password = Password
+		}
+		config, err := jmapConfigFor(user.Username, password)
+		if err != nil {
+			return err
+		}
+		config.Blobs = blobs
+		return run(ctx, config, user.Username, user.AccountId, count)
+	})
 }
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"opencloud.eu/groupware-assistant/pkg/inspect"
+)
+
+var sessionCmd = &cobra.Command{
+	Use:   "session",
+	Short: "Explain what the JMAP server offers",
+}
+
+var sessionShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the username, accounts, capabilities with their limits, and URLs of the JMAP session",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+
+		config, err := jmapConfig()
+		if err != nil {
+			return err
+		}
+
+		return inspect.ShowSession(
+			cmd.Context(),
+			JmapUrl,
+			config,
+			format,
+			func(text string) { fmt.Println(text) },
+		)
+	},
+}
+
+var sessionCollectionsCmd = &cobra.Command{
+	Use:   "collections",
+	Short: "List the mailboxes, address books, calendars and task lists of an account with their IDs and roles",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		types, err := cmd.Flags().GetStringSlice("types")
+		if err != nil {
+			return err
+		}
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+
+		config, err := jmapConfig()
+		if err != nil {
+			return err
+		}
+
+		return inspect.ShowCollections(
+			cmd.Context(),
+			JmapUrl,
+			config,
+			AccountId,
+			types,
+			format,
+			func(text string) { fmt.Println(text) },
+		)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sessionCmd)
+	sessionCmd.AddCommand(sessionShowCmd)
+	sessionCmd.AddCommand(sessionCollectionsCmd)
+
+	sessionShowCmd.Flags().String("format", inspect.FormatTable, "Output format, either '"+inspect.FormatTable+"' or '"+inspect.FormatJson+"'")
+	sessionCollectionsCmd.Flags().StringSlice("types", inspect.CollectionTypes, "Comma-separated list of the types of collections to list")
+	sessionCollectionsCmd.Flags().String("format", inspect.FormatTable, "Output format, either '"+inspect.FormatTable+"' or '"+inspect.FormatJson+"'")
+}
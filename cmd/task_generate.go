@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
 	"opencloud.eu/groupware-assistant/pkg/generator"
+	"opencloud.eu/groupware-assistant/pkg/jmap"
 )
 
 var taskGenerateCmd = &cobra.Command{
@@ -23,18 +25,19 @@ var taskGenerateCmd = &cobra.Command{
 			return err
 		}
 
-		return generator.GenerateTasks(
-			JmapUrl,
-			Trace,
-			Color,
-			Username,
-			Password,
-			AccountId,
-			empty,
-			tasklistId,
-			count,
-			func(text string) { fmt.Println(text) },
-		)
+		return generate(cmd, generator.RosterTasks, count, func(ctx context.Context, config jmap.Config, username string, accountId string, count uint) error {
+			return generator.GenerateTasks(
+				ctx,
+				JmapUrl,
+				config,
+				Parallel,
+				accountId,
+				empty,
+				tasklistId,
+				count,
+				func(text string) { fmt.Println(text) },
+			)
+		})
 	},
 }
 
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"opencloud.eu/groupware-assistant/pkg/inspect"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Print the state changes that the JMAP server pushes",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		types, err := cmd.Flags().GetStringSlice("types")
+		if err != nil {
+			return err
+		}
+		ping, err := cmd.Flags().GetUint("ping")
+		if err != nil {
+			return err
+		}
+		closeAfterState, err := cmd.Flags().GetBool("close-after-state")
+		if err != nil {
+			return err
+		}
+		changes, err := cmd.Flags().GetBool("changes")
+		if err != nil {
+			return err
+		}
+
+		config, err := jmapConfig()
+		if err != nil {
+			return err
+		}
+
+		return inspect.Watch(
+			cmd.Context(),
+			JmapUrl,
+			config,
+			AccountId,
+			types,
+			ping,
+			closeAfterState,
+			changes,
+			func(text string) { fmt.Println(text) },
+		)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().StringSlice("types", nil, "Comma-separated list of the types of objects to watch, e.g. 'Email,Mailbox'; all of them by default")
+	watchCmd.Flags().Uint("ping", 30, "Ask the server to send a ping every n seconds, to keep the connection alive; 0 to disable pings")
+	watchCmd.Flags().Bool("close-after-state", false, "Ask the server to close the connection after every state change, and connect again")
+	watchCmd.Flags().Bool("changes", false, "Fetch and print the IDs of the objects that were created, updated and destroyed with every state change")
+}
@@ -10,14 +10,15 @@ require (
 
 require (
 	codeberg.org/go-pdf/fpdf v0.11.1
+	github.com/ProtonMail/go-crypto v1.3.0
 	github.com/ProtonMail/gopenpgp/v2 v2.9.0
 	github.com/arran4/golang-ical v0.3.2
 	github.com/brianvoe/gofakeit/v7 v7.8.1
 	github.com/spf13/cobra v1.10.1
+	golang.org/x/net v0.35.0
 )
 
 require (
-	github.com/ProtonMail/go-crypto v1.3.0 // indirect
 	github.com/ProtonMail/go-mime v0.0.0-20230322103455-7d82a3887f2f // indirect
 	github.com/cloudflare/circl v1.6.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
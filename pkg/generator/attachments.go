@@ -0,0 +1,214 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+
+	"codeberg.org/go-pdf/fpdf"
+	"github.com/brianvoe/gofakeit/v7"
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+)
+
+// attachment is the content of an attachment, which may be attached to several emails.
+type attachment struct {
+	content   jmap.Content
+	mimetype  string
+	extension string
+}
+
+// newAttachment generates a text, PDF or image attachment, of the given size unless it is
+// zero.
+//
+// Attachments of a given size are streamed when they are uploaded: text is repeated up to
+// that size, while documents and images are padded with random bytes after their end, which
+// the usual viewers ignore.
+func newAttachment(size int64) attachment {
+	var data []byte = nil
+	a := attachment{}
+	switch rand.IntN(3) {
+	case 0:
+		data = []byte(gofakeit.Paragraph(2+rand.IntN(4), 1+rand.IntN(4), 1+rand.IntN(32), "\n"))
+		a.mimetype, a.extension = "text/plain", ".txt"
+		if size > 0 {
+			a.content = jmap.Content{Size: size, Open: func() (io.Reader, error) {
+				return io.LimitReader(&repeated{data: data}, size), nil
+			}}
+			return a
+		}
+	case 1:
+		pdf := fpdf.New("P", "mm", "A4", "")
+		pdf.AddPage()
+		pdf.SetFont("Arial", "", 12)
+		for range 4 + rand.IntN(5) {
+			pdf.Write(2, gofakeit.Sentence())
+			pdf.Write(2, "\n")
+		}
+		var buf bytes.Buffer
+		pdf.Output(&buf)
+		data = buf.Bytes()
+		a.mimetype, a.extension = "application/pdf", ".pdf"
+	default:
+		switch rand.IntN(2) {
+		case 0:
+			data = gofakeit.ImagePng(512, 512)
+			a.mimetype, a.extension = "image/png", ".png"
+		default:
+			data = gofakeit.ImageJpeg(400, 200)
+			a.mimetype, a.extension = "image/jpeg", ".jpg"
+		}
+	}
+
+	if size <= int64(len(data)) {
+		a.content = jmap.Bytes(data)
+		return a
+	}
+	var seed [32]byte
+	for i := range seed {
+		seed[i] = byte(rand.UintN(256))
+	}
+	a.content = jmap.Content{Size: size, Open: func() (io.Reader, error) {
+		padding := io.LimitReader(rand.NewChaCha8(seed), size-int64(len(data)))
+		return io.MultiReader(bytes.NewReader(data), padding), nil
+	}}
+	return a
+}
+
+// repeated reads its data over and over again.
+type repeated struct {
+	data []byte
+	off  int
+}
+
+func (r *repeated) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		c := copy(p[n:], r.data[r.off:])
+		n += c
+		r.off = (r.off + c) % len(r.data)
+	}
+	return n, nil
+}
+
+// attachments hands out the contents of attachments, of which only up to distinct ones are
+// generated, unless it is zero, after which they are picked from those, for the uploads of
+// their blobs to be reused.
+type attachments struct {
+	m         sync.Mutex
+	distinct  uint
+	sizes     sizes
+	generated uint
+	pool      []attachment
+}
+
+func (p *attachments) next() attachment {
+	p.m.Lock()
+	if p.distinct > 0 && p.generated >= p.distinct && len(p.pool) > 0 {
+		defer p.m.Unlock()
+		return p.pool[rand.IntN(len(p.pool))]
+	}
+	p.generated++
+	p.m.Unlock()
+
+	a := newAttachment(p.sizes.pick())
+	if p.distinct > 0 {
+		p.m.Lock()
+		p.pool = append(p.pool, a)
+		p.m.Unlock()
+	}
+	return a
+}
+
+// attach adds the given number of attachments to the email, some of the images inline, with
+// names from the given function.
+func (p *attachments) attach(b *jmap.EmailBuilder, numAttachments uint, filename func(extension string) string) {
+	for i := range numAttachments {
+		a := p.next()
+		filename := filename(a.extension)
+		if strings.HasPrefix(a.mimetype, "image/") && rand.IntN(2) == 1 {
+			b.AttachInline(a.content, a.mimetype, filename, "c"+strconv.Itoa(int(i)))
+		} else {
+			b.Attach(a.content, a.mimetype, filename)
+		}
+	}
+}
+
+// sizes is a distribution of sizes in bytes, made of ranges of which one is picked with equal
+// probability, and then a size within it.
+type sizes [][2]int64
+
+var sizeUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"KB":  1000,
+	"MB":  1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"KIB": 1 << 10,
+	"MIB": 1 << 20,
+	"GIB": 1 << 30,
+}
+
+// parseSizes parses a comma-separated list of sizes such as "10KB" or of ranges of sizes such
+// as "100KB..25MB", with decimal or binary units.
+func parseSizes(spec string) (sizes, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	result := sizes{}
+	for _, part := range strings.Split(spec, ",") {
+		lower, upper, isRange := strings.Cut(strings.TrimSpace(part), "..")
+		from, err := parseSize(lower)
+		if err != nil {
+			return nil, err
+		}
+		to := from
+		if isRange {
+			if to, err = parseSize(upper); err != nil {
+				return nil, err
+			}
+		}
+		if from > to {
+			return nil, fmt.Errorf("the size range '%s' is empty", part)
+		}
+		result = append(result, [2]int64{from, to})
+	}
+	return result, nil
+}
+
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+	unit, ok := sizeUnits[strings.ToUpper(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("'%s' is not a valid size, the unit must be one of B, KB, MB, GB, KiB, MiB or GiB", s)
+	}
+	value, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("'%s' is not a valid size", s)
+	}
+	return int64(value * float64(unit)), nil
+}
+
+// pick returns a size from the distribution, or zero when there is none.
+func (s sizes) pick() int64 {
+	if len(s) == 0 {
+		return 0
+	}
+	r := s[rand.IntN(len(s))]
+	return r[0] + rand.Int64N(r[1]-r[0]+1)
+}
+
+func (s sizes) max() int64 {
+	result := int64(0)
+	for _, r := range s {
+		result = max(result, r[1])
+	}
+	return result
+}
@@ -1,6 +1,7 @@
 package generator
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"math"
@@ -14,21 +15,23 @@ import (
 	"github.com/ProtonMail/gopenpgp/v2/helper"
 	"github.com/brianvoe/gofakeit/v7"
 	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/models"
 	"opencloud.eu/groupware-assistant/pkg/tools"
 )
 
 func GenerateContacts(
+	ctx context.Context,
 	jmapUrl string,
-	trace bool,
-	color bool,
-	username string,
-	password string,
+	config jmap.Config,
+	parallel uint,
 	accountId string,
 	empty bool,
 	addressbookId string,
 	count uint,
 	printer func(string),
 ) error {
+	created := newSummary("contacts")
+	var j *jmap.Jmap = nil
 	var s *jmap.ContactSender = nil
 	{
 		u, err := url.Parse(jmapUrl)
@@ -36,13 +39,14 @@ func GenerateContacts(
 			return err
 		}
 
-		j, err := jmap.NewJmap(u, username, password, trace, color)
+		j, err = jmap.NewJmap(ctx, u, config)
 		if err != nil {
 			return err
 		}
 		defer j.Close()
+		defer created.report(ctx, printer, j)
 
-		s, err = jmap.NewContactSender(j, accountId, addressbookId)
+		s, err = jmap.NewContactSender(ctx, j, accountId, addressbookId)
 		if err != nil {
 			return err
 		}
@@ -50,218 +54,220 @@ func GenerateContacts(
 	defer s.Close()
 
 	if empty {
-		deleted, err := s.EmptyContacts()
-		if err != nil {
+		result, err := s.EmptyContacts(ctx)
+		if err := reportEmptied(printer, result, err, "contacts", "addressbook"); err != nil {
 			return err
 		}
-		if deleted > 0 {
-			printer(fmt.Sprintf("🗑️ deleted %d contacts", deleted))
-		} else {
-			printer("ℹ️ did not delete any contacts, addressbook is empty")
-		}
 	}
 
-	for i := range count {
-		person := gofakeit.Person()
-		contact := map[string]any{
-			"@type":          "Card",
-			"version":        "1.0",
-			"addressBookIds": tools.ToBoolMap([]string{s.AddressBook()}),
-			"prodId":         tools.ProductName,
-			"language":       tools.PickLanguage(),
-			"kind":           "invidual",
-			"name":           createName(person),
-		}
+	type job struct {
+		i       uint
+		contact models.ContactCard
+	}
+	err := pipeline(ctx, parallel,
+		func(yield func(*job) bool) error {
+			for i := range count {
+				if !yield(&job{i: i}) {
+					break
+				}
+			}
+			return nil
+		},
+		func(_ context.Context, job *job) error {
+			var err error
+			job.contact, err = createContact(s.AddressBook())
+			return err
+		},
+		func(job *job) error {
+			return s.QueueContact(context.WithoutCancel(ctx), job.contact, func(uid string, err error) error {
+				if err != nil {
+					printer(fmt.Sprintf("❌ failed  %*s/%v %s", int(math.Log10(float64(count))+1), strconv.Itoa(int(job.i+1)), count, describeError(err, job.contact)))
+					return err
+				}
+				created.add("contacts", uid)
+				printer(fmt.Sprintf("🧑🏻 created %*s/%v uid=%v", int(math.Log10(float64(count))+1), strconv.Itoa(int(job.i+1)), count, uid))
+				return nil
+			})
+		},
+	)
+	return finish(ctx, err, s.Flush)
+}
 
-		if rand.Intn(3) < 1 {
-			contact["nicknames"] = map[string]map[string]any{id(): createNickName(person)}
-		}
+func createContact(addressbookId string) (models.ContactCard, error) {
+	var err error
+	person := gofakeit.Person()
+	name := createName(person)
+	contact := models.ContactCard{
+		Version:        models.CardVersion,
+		AddressBookIds: tools.ToBoolMap([]string{addressbookId}),
+		ProdId:         tools.ProductName,
+		Language:       tools.PickLanguage(),
+		Kind:           models.CardKindIndividual,
+		Name:           &name,
+	}
 
-		{
-			emails := map[string]map[string]any{}
-			emailId := id()
-			emails[emailId] = createEmail(person, 10)
-			for i := range rand.Intn(3) {
-				emails[id()] = createSecondaryEmail(gofakeit.Email(), i*100)
-			}
-			if len(emails) > 0 {
-				contact["emails"] = emails
-			}
+	if rand.Intn(3) < 1 {
+		contact.Nicknames = map[string]models.Nickname{id(): createNickName(person)}
+	}
+
+	{
+		emails := map[string]models.ContactEmail{}
+		emails[id()] = createEmail(person, 10)
+		for i := range rand.Intn(3) {
+			emails[id()] = createSecondaryEmail(gofakeit.Email(), uint(20+i*10))
 		}
-		if err := propmap(contact, "phones", 0, 2, func(i int, id string) (map[string]any, error) {
-			num := person.Contact.Phone
-			if i > 0 {
-				num = gofakeit.Phone()
-			}
-			var features map[string]bool = nil
-			if rand.Intn(3) < 2 {
-				features = tools.ToBoolMapS("mobile", "voice", "video", "text")
-			} else {
-				features = tools.ToBoolMapS("voice", "main-number")
-			}
-			contexts := map[string]bool{}
-			contexts["work"] = true
-			if rand.Intn(2) < 1 {
-				contexts["private"] = true
-			}
-			return map[string]any{
-				"@type":    "Phone",
-				"number":   "tel:" + "+1" + num,
-				"features": features,
-				"contexts": contexts,
-			}, nil
-		}); err != nil {
-			return err
+		contact.Emails = emails
+	}
+	if contact.Phones, err = propmap(0, 2, func(i int) (models.Phone, error) {
+		num := person.Contact.Phone
+		if i > 0 {
+			num = gofakeit.Phone()
 		}
-		if err := propmap(contact, "addresses", 1, 2, func(i int, id string) (map[string]any, error) {
-			var source *gofakeit.AddressInfo
-			if i == 0 {
-				source = person.Address
-			} else {
-				source = gofakeit.Address()
-			}
-			components := []map[string]string{}
-			m := streetNumberRegex.FindAllStringSubmatch(source.Street, -1)
-			if m != nil {
-				components = append(components, map[string]string{"kind": "name", "value": m[0][2]})
-				components = append(components, map[string]string{"kind": "number", "value": m[0][1]})
-			} else {
-				components = append(components, map[string]string{"kind": "name", "value": source.Street})
-			}
-			components = append(components,
-				map[string]string{"kind": "locality", "value": source.City},
-				map[string]string{"kind": "country", "value": source.Country},
-				map[string]string{"kind": "state", "value": source.State},
-				map[string]string{"kind": "postcode", "value": source.Zip},
-			)
-			return map[string]any{
-				"@type":            "Address",
-				"components":       components,
-				"defaultSeparator": ", ",
-				"isOrdered":        true,
-				"timeZone": tools.PickRandom("America/Adak", "America/Anchorage", "America/Chicago", "America/Denver",
-					"America/Detroit", "America/Indiana/Knox", "America/Kentucky/Louisville", "America/Los_Angeles", "America/New_York"),
-			}, nil
-		}); err != nil {
-			return err
+		var features map[string]bool = nil
+		if rand.Intn(3) < 2 {
+			features = tools.ToBoolMapS("mobile", "voice", "video", "text")
+		} else {
+			features = tools.ToBoolMapS("voice", "main-number")
 		}
-		if err := propmap(contact, "onlineServices", 0, 2, func(i int, id string) (map[string]any, error) {
-			switch rand.Intn(3) {
-			case 0:
-				return map[string]any{
-					"@type":   "OnlineService",
-					"service": "Mastodon",
-					"user":    "@" + person.Contact.Email,
-					"uri":     "https://mastodon.example.com/@" + strings.ToLower(person.FirstName),
-				}, nil
-			case 1:
-				return map[string]any{
-					"@type": "OnlineService",
-					"uri":   "xmpp:" + person.Contact.Email,
-				}, nil
-			default:
-				return map[string]any{
-					"@type":   "OnlineService",
-					"service": "Discord",
-					"user":    person.Contact.Email,
-					"uri":     "https://discord.example.com/user/" + person.Contact.Email,
-				}, nil
-			}
-		}); err != nil {
-			return err
+		contexts := map[string]bool{}
+		contexts["work"] = true
+		if rand.Intn(2) < 1 {
+			contexts["private"] = true
 		}
-
-		if err := propmap(contact, "preferredLanguages", 0, 2, func(i int, id string) (map[string]any, error) {
-			return map[string]any{
-				"@type":    "LanguagePref",
-				"language": tools.PickRandom("en", "fr", "de", "es", "it"),
-				"contexts": tools.ToBoolMap(tools.PickRandoms1("work", "private")),
-				"pref":     i + 1,
-			}, nil
-		}); err != nil {
-			return err
+		return models.Phone{
+			Number:   "tel:" + "+1" + num,
+			Features: features,
+			Contexts: contexts,
+		}, nil
+	}); err != nil {
+		return models.ContactCard{}, err
+	}
+	if contact.Addresses, err = propmap(1, 2, func(i int) (models.Address, error) {
+		var source *gofakeit.AddressInfo
+		if i == 0 {
+			source = person.Address
+		} else {
+			source = gofakeit.Address()
 		}
-
-		{
-			organizations := map[string]map[string]any{}
-			titles := map[string]map[string]any{}
-			for range rand.Intn(2) {
-				orgId := id()
-				org := map[string]any{
-					"@type":    "Organization",
-					"name":     person.Job.Company,
-					"contexts": tools.ToBoolMapS("work"),
-				}
-				title := map[string]any{
-					"@type":          "Title",
-					"kind":           "title",
-					"name":           person.Job.Title,
-					"organizationId": orgId,
-				}
-				organizations[orgId] = org
-				titles[id()] = title
-			}
-			if len(organizations) > 0 {
-				contact["organizations"] = organizations
-				contact["titles"] = titles
-			}
+		components := []models.AddressComponent{}
+		m := streetNumberRegex.FindAllStringSubmatch(source.Street, -1)
+		if m != nil {
+			components = append(components, models.AddressComponent{Kind: "name", Value: m[0][2]})
+			components = append(components, models.AddressComponent{Kind: "number", Value: m[0][1]})
+		} else {
+			components = append(components, models.AddressComponent{Kind: "name", Value: source.Street})
 		}
-
-		if err := propmap(contact, "cryptoKeys", 0, 1, func(i int, id string) (map[string]any, error) {
-			key, err := helper.GenerateKey(person.FirstName+" "+person.LastName, person.Contact.Email, []byte("secret"), "x25519", 0)
-			if err != nil {
-				return nil, err
-			}
-			keyring, err := crypto.NewKeyFromArmoredReader(strings.NewReader(key))
-			if err != nil {
-				return nil, err
-			}
-			pubkey, err := keyring.GetPublicKey()
-			if err != nil {
-				return nil, err
-			}
-			return map[string]any{
-				"@type": "CryptoKey",
-				"uri":   "data:application/pgp-keys;base64," + base64.RawStdEncoding.EncodeToString(pubkey),
+		components = append(components,
+			models.AddressComponent{Kind: "locality", Value: source.City},
+			models.AddressComponent{Kind: "country", Value: source.Country},
+			models.AddressComponent{Kind: "region", Value: source.State},
+			models.AddressComponent{Kind: "postcode", Value: source.Zip},
+		)
+		return models.Address{
+			Components:       components,
+			DefaultSeparator: ", ",
+			IsOrdered:        true,
+			TimeZone: tools.PickRandom("America/Adak", "America/Anchorage", "America/Chicago", "America/Denver",
+				"America/Detroit", "America/Indiana/Knox", "America/Kentucky/Louisville", "America/Los_Angeles", "America/New_York"),
+		}, nil
+	}); err != nil {
+		return models.ContactCard{}, err
+	}
+	if contact.OnlineServices, err = propmap(0, 2, func(i int) (models.OnlineService, error) {
+		switch rand.Intn(3) {
+		case 0:
+			return models.OnlineService{
+				Service: "Mastodon",
+				User:    "@" + person.Contact.Email,
+				Uri:     "https://mastodon.example.com/@" + strings.ToLower(person.FirstName),
+			}, nil
+		case 1:
+			return models.OnlineService{
+				Uri: "xmpp:" + person.Contact.Email,
+			}, nil
+		default:
+			return models.OnlineService{
+				Service: "Discord",
+				User:    person.Contact.Email,
+				Uri:     "https://discord.example.com/user/" + person.Contact.Email,
 			}, nil
-		}); err != nil {
-			return err
 		}
-		if err := propmap(contact, "media", 0, 1, func(i int, id string) (map[string]any, error) {
-			if rand.Intn(2) < 1 {
-				return map[string]any{
-					"@type": "Media",
-					"kind":  "photo",
-					"uri":   "data:image/jpeg;base64," + base64.RawStdEncoding.EncodeToString(gofakeit.ImageJpeg(64, 64)),
-				}, nil
-			} else {
-				return map[string]any{
-					"@type": "Media",
-					"kind":  "photo",
-					"uri":   picsum(128, 128),
-				}, nil
-			}
-		}); err != nil {
-			return err
+	}); err != nil {
+		return models.ContactCard{}, err
+	}
+
+	if contact.PreferredLanguages, err = propmap(0, 2, func(i int) (models.LanguagePref, error) {
+		return models.LanguagePref{
+			Language: tools.PickRandom("en", "fr", "de", "es", "it"),
+			Contexts: tools.ToBoolMap(tools.PickRandoms1("work", "private")),
+			Pref:     uint(i + 1),
+		}, nil
+	}); err != nil {
+		return models.ContactCard{}, err
+	}
+
+	for range rand.Intn(2) {
+		orgId := id()
+		contact.Organizations = map[string]models.Organization{
+			orgId: {
+				Name:     person.Job.Company,
+				Contexts: tools.ToBoolMapS("work"),
+			},
 		}
-		if err := propmap(contact, "links", 0, 1, func(i int, id string) (map[string]any, error) {
-			return map[string]any{
-				"@type": "Link",
-				"kind":  "contact",
-				"uri":   "mailto" + person.Contact.Email,
-				"pref":  (i + 1) * 10,
-			}, nil
-		}); err != nil {
-			return err
+		contact.Titles = map[string]models.Title{
+			id(): {
+				Kind:           "title",
+				Name:           person.Job.Title,
+				OrganizationId: orgId,
+			},
 		}
+	}
 
-		uid, err := s.CreateContact(contact)
+	if contact.CryptoKeys, err = propmap(0, 1, func(i int) (models.CryptoKey, error) {
+		key, err := helper.GenerateKey(person.FirstName+" "+person.LastName, person.Contact.Email, []byte("secret"), "x25519", 0)
 		if err != nil {
-			return err
+			return models.CryptoKey{}, err
+		}
+		keyring, err := crypto.NewKeyFromArmoredReader(strings.NewReader(key))
+		if err != nil {
+			return models.CryptoKey{}, err
 		}
-		printer(fmt.Sprintf("🧑🏻 created %*s/%v uid=%v", int(math.Log10(float64(count))+1), strconv.Itoa(int(i+1)), count, uid))
+		pubkey, err := keyring.GetPublicKey()
+		if err != nil {
+			return models.CryptoKey{}, err
+		}
+		return models.CryptoKey{
+			Uri: "data:application/pgp-keys;base64," + base64.RawStdEncoding.EncodeToString(pubkey),
+		}, nil
+	}); err != nil {
+		return models.ContactCard{}, err
+	}
+	if contact.Media, err = propmap(0, 1, func(i int) (models.Media, error) {
+		if rand.Intn(2) < 1 {
+			return models.Media{
+				Kind: "photo",
+				Uri:  "data:image/jpeg;base64," + base64.RawStdEncoding.EncodeToString(gofakeit.ImageJpeg(64, 64)),
+			}, nil
+		} else {
+			return models.Media{
+				Kind: "photo",
+				Uri:  picsum(128, 128),
+			}, nil
+		}
+	}); err != nil {
+		return models.ContactCard{}, err
 	}
-	return nil
+	if contact.Links, err = propmap(0, 1, func(i int) (models.ContactLink, error) {
+		return models.ContactLink{
+			Kind: "contact",
+			Uri:  "mailto:" + person.Contact.Email,
+			Pref: uint((i + 1) * 10),
+		}, nil
+	}); err != nil {
+		return models.ContactCard{}, err
+	}
+
+	return contact, nil
 }
 
 var streetNumberRegex = regexp.MustCompile(`^(\d+)\s+(.+)$`)
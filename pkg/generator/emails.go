@@ -1,7 +1,8 @@
 package generator
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
@@ -11,46 +12,114 @@ import (
 	"strings"
 	"time"
 
-	"codeberg.org/go-pdf/fpdf"
 	"github.com/brianvoe/gofakeit/v7"
 	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/message"
+	"opencloud.eu/groupware-assistant/pkg/tools"
 )
 
+// parseHeaders parses header fields given as "Name: value", to add to every email.
+func parseHeaders(specs []string) ([]message.Field, error) {
+	headers := []message.Field{}
+	for _, spec := range specs {
+		name, value, ok := strings.Cut(spec, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.IndexFunc(name, func(r rune) bool { return r <= ' ' || r > '~' }) >= 0 {
+			return nil, fmt.Errorf("invalid header '%s', expected 'Name: value'", spec)
+		}
+		headers = append(headers, message.Field{Name: name, Value: strings.TrimSpace(value)})
+	}
+	return headers, nil
+}
+
+// EmailOptions tells GenerateEmails where to put the emails and what they look like, where
+// every n-th email gets a given trait for the "Every" options, and none of them when zero.
+type EmailOptions struct {
+	// whether to include emojis in the From name that tell the traits of every email
+	Emojis bool
+	// whether to empty the mailbox before adding emails to it
+	Empty bool
+	// the mailbox to add the emails to, or the one with the role when no ID is given
+	MailboxId   string
+	MailboxRole string
+	// how to spread the threads across the mailbox and the mailboxes without a role
+	// ("uniform", "zipf" or "zipf:<exponent>"), or empty to keep them in the mailbox
+	Spread string
+	// the domain of the email addresses besides those of the Locales
+	Domain        string
+	Senders       uint
+	MinThreadSize uint
+	MaxThreadSize uint
+
+	CcEvery   uint
+	BccEvery  uint
+	SeenEvery uint
+
+	AttachmentEvery uint
+	MinAttachments  uint
+	MaxAttachments  uint
+	// a comma-separated list of numbers of attachments to pick from for every email, which
+	// overrides AttachmentEvery, MinAttachments and MaxAttachments
+	AttachmentOptions string
+	// how many different attachments to generate at most, 0 to make each one unique
+	DistinctAttachments uint
+	// the sizes of the attachments, as a comma-separated list of sizes or ranges of sizes
+	AttachmentSizes string
+
+	ForwardedEvery uint
+	ImportantEvery uint
+	JunkEvery      uint
+	NotJunkEvery   uint
+	PhishingEvery  uint
+	DraftEvery     uint
+	IcalEvery      uint
+
+	// whether to build the MIME messages and create them with Email/import
+	Import bool
+	// header fields to add to every email, as "Name: value"
+	Headers []string
+
+	PgpSignEvery    uint
+	PgpEncryptEvery uint
+	SmimeEvery      uint
+	// S/MIME encryption for the recipient and the sender every n emails
+	SmimeEncryptEvery uint
+	// directory to write the keys to import into a client to, if any
+	KeysDir string
+	// a comma-separated list of the locales to write the threads in
+	Locales string
+}
+
 func GenerateEmails(
+	ctx context.Context,
 	jmapUrl string,
-	trace bool,
-	color bool,
-	emojis bool,
+	config jmap.Config,
+	parallel uint,
 	username string,
-	password string,
 	accountId string,
-	empty bool,
-	mailboxId string,
-	mailboxRole string,
-	domain string,
 	count uint,
-	senders uint,
-	minThreadSize uint,
-	maxThreadSize uint,
-	ccEvery uint,
-	bccEvery uint,
-	seenEvery uint,
-	attachmentEvery uint,
-	minAttachments uint,
-	maxAttachments uint,
-	attachmentOptionsSpec string,
-	forwardedEvery uint,
-	importantEvery uint,
-	junkEvery uint,
-	notJunkEvery uint,
-	phishingEvery uint,
-	draftEvery uint,
-	icalEvery uint,
+	options EmailOptions,
 	printer func(string),
 ) error {
+	if options.MinThreadSize < 1 || options.MinThreadSize > options.MaxThreadSize {
+		return fmt.Errorf("the thread size must be at least 1 and its minimum (%d) at most its maximum (%d)", options.MinThreadSize, options.MaxThreadSize)
+	}
+	// no attachments are added without a maximum number of them
+	if options.AttachmentOptions == "" && options.MaxAttachments > 0 && options.MinAttachments > options.MaxAttachments {
+		return fmt.Errorf("the minimum number of attachments (%d) must be at most the maximum (%d)", options.MinAttachments, options.MaxAttachments)
+	}
+	headers, err := parseHeaders(options.Headers)
+	if err != nil {
+		return err
+	}
+	languages, err := parseLocales(options.Locales)
+	if err != nil {
+		return err
+	}
+
 	var attachmentOptions []uint = nil
-	if attachmentOptionsSpec != "" {
-		attachmentOptionStrings := strings.Split(attachmentOptionsSpec, ",")
+	if options.AttachmentOptions != "" {
+		attachmentOptionStrings := strings.Split(options.AttachmentOptions, ",")
 		attachmentOptions = make([]uint, len(attachmentOptionStrings))
 		for i, o := range attachmentOptionStrings {
 			value, err := strconv.Atoi(o)
@@ -62,6 +131,20 @@ func GenerateEmails(
 		}
 	}
 
+	attachmentSizes, err := parseSizes(options.AttachmentSizes)
+	if err != nil {
+		return err
+	}
+
+	var keys *keyring = nil
+	kinds := []string{"messages"}
+	if options.PgpSignEvery > 0 || options.PgpEncryptEvery > 0 || options.SmimeEvery > 0 || options.SmimeEncryptEvery > 0 {
+		keys = newKeyring()
+		kinds = append(kinds, "contacts")
+	}
+
+	created := newSummary(kinds...)
+	var j *jmap.Jmap = nil
 	var s *jmap.EmailSender = nil
 	{
 		u, err := url.Parse(jmapUrl)
@@ -69,268 +152,365 @@ func GenerateEmails(
 			return err
 		}
 
-		j, err := jmap.NewJmap(u, username, password, trace, color)
+		j, err = jmap.NewJmap(ctx, u, config)
 		if err != nil {
 			return err
 		}
 		defer j.Close()
+		defer created.report(ctx, printer, j)
 
-		s, err = jmap.NewEmailSender(j, accountId, mailboxId, mailboxRole)
+		s, err = jmap.NewEmailSender(ctx, j, accountId, options.MailboxId, options.MailboxRole)
 		if err != nil {
 			return err
 		}
 	}
 	defer s.Close()
 
-	if empty {
-		deleted, err := s.EmptyEmails()
+	var folders *spread = nil
+	if options.Spread != "" {
+		mailboxIds, err := s.Folders(ctx)
 		if err != nil {
 			return err
 		}
-		if deleted > 0 {
-			printer(fmt.Sprintf("🗑️ deleted %d messages", deleted))
-		} else {
-			printer("ℹ️ did not delete any messages, folder is empty")
+		if folders, err = newSpread(options.Spread, mailboxIds); err != nil {
+			return err
+		}
+	}
+
+	if limit := j.Core().MaxSizeUpload; limit > 0 && uint64(attachmentSizes.max()) > uint64(limit) && !config.IgnoreUploadLimits {
+		return fmt.Errorf("attachments of up to %s were requested, but the server accepts uploads of at most %s (maxSizeUpload)", tools.FormatBytes(uint64(attachmentSizes.max())), tools.FormatBytes(uint64(limit)))
+	}
+
+	if options.Empty {
+		result, err := s.EmptyEmails(ctx)
+		if err := reportEmptied(printer, result, err, "messages", "folder"); err != nil {
+			return err
 		}
 	}
 
 	toName := username
-	toAddress := fmt.Sprintf("%s@%s", username, domain)
+	toAddress := fmt.Sprintf("%s@%s", username, options.Domain)
 	ccName1 := "Team Lead"
-	ccAddress1 := fmt.Sprintf("lead@%s", domain)
+	ccAddress1 := fmt.Sprintf("lead@%s", options.Domain)
 	ccName2 := "Coworker"
-	ccAddress2 := fmt.Sprintf("coworker@%s", domain)
+	ccAddress2 := fmt.Sprintf("coworker@%s", options.Domain)
 	bccName := "HR"
-	bccAddress := fmt.Sprintf("corporate@%s", domain)
+	bccAddress := fmt.Sprintf("corporate@%s", options.Domain)
 
-	sg := newSenderGenerator(senders)
+	sg := newSenderGenerator(options.Senders)
+	pool := &attachments{distinct: options.DistinctAttachments, sizes: attachmentSizes}
 
-	for i := uint(0); i < count; {
-		threadMessageId := fmt.Sprintf("%d.%d@%s", time.Now().Unix(), 1000000+rand.Intn(8999999), domain)
-		threadSubject := strings.Trim(gofakeit.Sentence(), ".") // remove the . at the end, looks weird
-		threadSize := minThreadSize + uint(rand.Intn(int(maxThreadSize-minThreadSize)))
-		lastMessageId := ""
-		lastSubject := ""
-		threadStart := time.Now().Add(time.Duration(-(24*60)-rand.Intn(7*24*60)) * time.Minute)
-		received := threadStart
+	type job struct {
+		n              uint
+		b              *jmap.EmailBuilder
+		subject        string
+		numAttachments uint
+		invitation     string
+		mailboxId      string
+		locale         *locale
+		sender         mail.Address
+		pgpSign        bool
+		pgpEncrypt     bool
+		smime          bool
+		smimeEncrypt   bool
+		// whether the message is built here and imported, which signing and encrypting it needs
+		imported bool
+		// why the server rejected the attachments when sending them regardless of its limits
+		rejected error
+	}
+	err = pipeline(ctx, parallel,
+		func(yield func(*job) bool) error {
+			for i := uint(0); i < count; {
+				threadMessageId := fmt.Sprintf("%d.%d@%s", time.Now().Unix(), 1000000+rand.Intn(8999999), options.Domain)
+				threadSubject := strings.Trim(gofakeit.Sentence(), ".") // remove the . at the end, looks weird
+				reply, forward := "Re: ", "Fwd: "
+				// the threads are in one of the locales, if any, with people of that locale
+				var loc *locale = nil
+				if len(languages) > 0 {
+					loc = languages[rand.Intn(len(languages))]
+				}
+				if loc != nil {
+					threadSubject = loc.subject()
+					reply, forward = loc.reply, loc.forward
+				}
+				threadSize := options.MinThreadSize + uint(rand.Intn(int(options.MaxThreadSize-options.MinThreadSize)+1))
+				lastMessageId := ""
+				lastSubject := ""
+				threadStart := time.Now().Add(time.Duration(-(24*60)-rand.Intn(7*24*60)) * time.Minute)
+				received := threadStart
+				threadMailboxId := ""
+				if folders != nil {
+					threadMailboxId = folders.pick()
+				}
 
-		for t := uint(0); i < count && t < threadSize; t++ {
-			sender, err := sg.nextSender()
-			if err != nil {
-				return err
-			}
-			received = received.Add(time.Duration(rand.Intn(5)) * time.Minute)
+				for t := uint(0); i < count && t < threadSize; t++ {
+					sender, err := sg.nextSender()
+					if err != nil {
+						return err
+					}
+					if loc != nil {
+						sender = loc.sender()
+					}
+					received = received.Add(time.Duration(rand.Intn(5)) * time.Minute)
 
-			b, err := s.NewEmail()
-			if err != nil {
-				return err
-			}
-			b.To(mail.Address{Name: toName, Address: toAddress})
-
-			forwarded := forwardedEvery > 0 && i%forwardedEvery == 0
-			important := importantEvery > 0 && i%importantEvery == 0
-			junk := junkEvery > 0 && i%junkEvery == 0
-			notJunk := notJunkEvery > 0 && i%notJunkEvery == 0
-			if junk {
-				notJunk = false
-			}
-			phishing := phishingEvery > 0 && i%phishingEvery == 0
-			seen := seenEvery > 0 && i%seenEvery == 0
-			draft := draftEvery > 0 && i%draftEvery == 0
-			ical := icalEvery > 0 && i%icalEvery == 0
-
-			subject := ""
-			answered := t < threadSize-1
-			if lastMessageId == "" {
-				// start a new thread
-				b.MessageId(threadMessageId)
-				subject = threadSubject
-				lastMessageId = threadMessageId
-				lastSubject = threadSubject
-			} else {
-				// we're continuing a thread
-				messageId := fmt.Sprintf("%d.%d@%s", time.Now().Unix(), 1000000+rand.Intn(8999999), domain)
-				inReplyTo := ""
-				switch rand.Intn(2) {
-				case 0:
-					// reply to first post in thread
-					if forwarded {
-						subject = "Re: Fwd: " + threadSubject
-					} else {
-						subject = "Re: " + threadSubject
+					b, err := s.NewEmail()
+					if err != nil {
+						return err
 					}
-					inReplyTo = threadMessageId
-				default:
-					// reply to last addition to thread
-					if forwarded {
-						subject = "Re: Fwd: " + lastSubject
-					} else {
-						subject = "Re: " + lastSubject
+					to := []mail.Address{{Name: toName, Address: toAddress}}
+					cc := []mail.Address{{Name: ccName1, Address: ccAddress1}, {Name: ccName2, Address: ccAddress2}}
+					if loc != nil {
+						others := loc.others(3, sender)
+						to = append(to, others[0])
+						cc = others[1:]
+						b.Language(loc.tag, loc.rtl)
+					}
+					b.To(to...)
+					if threadMailboxId != "" {
+						b.Mailbox(threadMailboxId)
 					}
-					inReplyTo = lastMessageId
-				}
-				b.MessageId(messageId)
-				b.InReplyTo(inReplyTo)
-				lastMessageId = messageId
-				lastSubject = subject
-			}
 
-			if answered {
-				b.Answered()
-			}
-			if forwarded {
-				b.Forwarded()
-			}
-			if important {
-				b.Important()
-			}
-			if junk {
-				b.Junk()
-			}
-			if notJunk {
-				b.NotJunk()
-			}
-			if phishing {
-				b.Phishing()
-			}
-			if seen {
-				b.Seen()
-			}
-			if draft {
-				b.Draft()
-			}
+					forwarded := options.ForwardedEvery > 0 && i%options.ForwardedEvery == 0
+					important := options.ImportantEvery > 0 && i%options.ImportantEvery == 0
+					junk := options.JunkEvery > 0 && i%options.JunkEvery == 0
+					notJunk := options.NotJunkEvery > 0 && i%options.NotJunkEvery == 0
+					if junk {
+						notJunk = false
+					}
+					phishing := options.PhishingEvery > 0 && i%options.PhishingEvery == 0
+					seen := options.SeenEvery > 0 && i%options.SeenEvery == 0
+					draft := options.DraftEvery > 0 && i%options.DraftEvery == 0
+					ical := options.IcalEvery > 0 && i%options.IcalEvery == 0
+					// S/MIME rules out OpenPGP, as clients only handle either in one message
+					smime := options.SmimeEvery > 0 && i%options.SmimeEvery == 0
+					smimeEncrypt := options.SmimeEncryptEvery > 0 && i%options.SmimeEncryptEvery == 0
+					pgpSign := options.PgpSignEvery > 0 && i%options.PgpSignEvery == 0 && !smime && !smimeEncrypt
+					pgpEncrypt := options.PgpEncryptEvery > 0 && i%options.PgpEncryptEvery == 0 && !smime && !smimeEncrypt
 
-			if i%ccEvery == 0 {
-				b.CC([]mail.Address{{Name: ccName1, Address: ccAddress1}, {Name: ccName2, Address: ccAddress2}})
-			}
-			if i%bccEvery == 0 {
-				b.BCC([]mail.Address{{Name: bccName, Address: bccAddress}})
-			}
+					subject := ""
+					answered := t < threadSize-1
+					if lastMessageId == "" {
+						// start a new thread
+						b.MessageId(threadMessageId)
+						subject = threadSubject
+						lastMessageId = threadMessageId
+						lastSubject = threadSubject
+					} else {
+						// we're continuing a thread
+						messageId := fmt.Sprintf("%d.%d@%s", time.Now().Unix(), 1000000+rand.Intn(8999999), options.Domain)
+						inReplyTo := ""
+						switch rand.Intn(2) {
+						case 0:
+							// reply to first post in thread
+							if forwarded {
+								subject = reply + forward + threadSubject
+							} else {
+								subject = reply + threadSubject
+							}
+							inReplyTo = threadMessageId
+						default:
+							// reply to last addition to thread
+							if forwarded {
+								subject = reply + forward + lastSubject
+							} else {
+								subject = reply + lastSubject
+							}
+							inReplyTo = lastMessageId
+						}
+						b.MessageId(messageId)
+						b.InReplyTo(inReplyTo)
+						lastMessageId = messageId
+						lastSubject = subject
+					}
 
-			b.ReturnPath(sender.from)
-			b.Received(received.Add(time.Duration(-2) * time.Minute))
-			b.Sent(received)
+					if answered {
+						b.Answered()
+					}
+					if forwarded {
+						b.Forwarded()
+					}
+					if important {
+						b.Important()
+					}
+					if junk {
+						b.Junk()
+					}
+					if notJunk {
+						b.NotJunk()
+					}
+					if phishing {
+						b.Phishing()
+					}
+					if seen {
+						b.Seen()
+					}
+					if draft {
+						b.Draft()
+					}
 
-			numAttachments := uint(0)
-			if attachmentOptions != nil {
-				numAttachments = attachmentOptions[rand.Intn(len(attachmentOptions))]
-			} else if maxAttachments > 0 && i%attachmentEvery == 0 {
-				numAttachments = minAttachments + uint(rand.Intn(int(maxAttachments)+1))
-			}
+					if options.CcEvery > 0 && i%options.CcEvery == 0 {
+						b.CC(cc)
+					}
+					if options.BccEvery > 0 && i%options.BccEvery == 0 {
+						b.BCC([]mail.Address{{Name: bccName, Address: bccAddress}})
+					}
 
-			for a := range numAttachments {
-				switch rand.Intn(3) {
-				case 0:
-					filename := fakeFilename(".txt")
-					attachment := gofakeit.Paragraph(2+rand.Intn(4), 1+rand.Intn(4), 1+rand.Intn(32), "\n")
-					b.Attach([]byte(attachment), "text/plain", filename)
-				case 1:
-					filename := fakeFilename(".pdf")
-					pdf := fpdf.New("P", "mm", "A4", "")
-					pdf.AddPage()
-					pdf.SetFont("Arial", "", 12)
-					for range 4 + rand.Intn(5) {
-						pdf.Write(2, gofakeit.Sentence())
-						pdf.Write(2, "\n")
+					b.ReturnPath(sender.from)
+					for _, h := range headers {
+						b.Header(h.Name, h.Value)
 					}
-					var buf bytes.Buffer
-					pdf.Output(&buf)
-					b.Attach(buf.Bytes(), "application/pdf", filename)
-				default:
-					filename := ""
-					mimetype := ""
-					var image []byte = nil
-					switch rand.Intn(2) {
-					case 0:
-						filename = fakeFilename(".png")
-						mimetype = "image/png"
-						image = gofakeit.ImagePng(512, 512)
-					default:
-						filename = fakeFilename(".jpg")
-						mimetype = "image/jpeg"
-						image = gofakeit.ImageJpeg(400, 200)
+					b.Received(received.Add(time.Duration(-2) * time.Minute))
+					b.Sent(received)
+
+					numAttachments := uint(0)
+					if attachmentOptions != nil {
+						numAttachments = attachmentOptions[rand.Intn(len(attachmentOptions))]
+					} else if options.MaxAttachments > 0 && options.AttachmentEvery > 0 && i%options.AttachmentEvery == 0 {
+						numAttachments = options.MinAttachments + uint(rand.Intn(int(options.MaxAttachments-options.MinAttachments)+1))
 					}
-					switch rand.Intn(2) {
-					case 0:
-						b.Attach(image, mimetype, filename)
-					default:
-						b.AttachInline(image, mimetype, filename, "c"+strconv.Itoa(int(a)))
+
+					invitation := ""
+					if ical {
+						starts := time.Date(received.Year(), received.Month(), received.Day(), 9+rand.Intn(8), rand.Intn(2)*30, 0, 0, received.Location())
+						duration := time.Duration(1+rand.Intn(8)) * 15 * time.Minute
+						numAttendees := 1 + rand.Intn(8)
+						attendees := make([]icalAttendee, numAttendees+1)
+						attendees[0] = icalAttendee{Name: toName, Email: toAddress}
+						for i := 1; i < numAttendees+1; i++ {
+							attendees[i] = icalAttendee{Name: gofakeit.Name(), Email: gofakeit.Email()}
+						}
+						resource := "https://meet.opentalk.eu/room/" + gofakeit.UUID()
+						invitation = toIcal(received, starts, duration, gofakeit.BookTitle(), gofakeit.URL(), gofakeit.Product().Description, "", attendees[rand.Intn(len(attendees))].Name, attendees, resource)
 					}
-				}
-			}
 
-			if ical {
-				starts := time.Date(received.Year(), received.Month(), received.Day(), 9+rand.Intn(8), rand.Intn(2)*30, 0, 0, received.Location())
-				duration := time.Duration(1+rand.Intn(8)) * 15 * time.Minute
-				numAttendees := 1 + rand.Intn(8)
-				attendees := make([]icalAttendee, numAttendees+1)
-				attendees[0] = icalAttendee{Name: toName, Email: toAddress}
-				for i := 1; i < numAttendees+1; i++ {
-					attendees[i] = icalAttendee{Name: gofakeit.Name(), Email: gofakeit.Email()}
-				}
-				resource := "https://meet.opentalk.eu/room/" + gofakeit.UUID()
-				text := toIcal(received, starts, duration, gofakeit.BookTitle(), gofakeit.URL(), gofakeit.Product().Description, "", attendees[rand.Intn(len(attendees))].Name, attendees, resource)
-				b.Attach([]byte(text), "text/calendar", "appointment.ics")
-			}
+					format := formats[int(i)%len(formats)]
+					text := gofakeit.Paragraph(2+rand.Intn(9), 1+rand.Intn(4), 1+rand.Intn(32), "\n")
+					if loc != nil {
+						text = loc.text()
+					}
+					format(text, b)
 
-			format := formats[int(i)%len(formats)]
-			text := gofakeit.Paragraph(2+rand.Intn(9), 1+rand.Intn(4), 1+rand.Intn(32), "\n")
-			format(text, b)
+					b.Subject(subject)
+					b.Sender(sender.ToAddress())
 
-			b.Subject(subject)
-			b.Sender(sender.ToAddress())
+					from := sender.ToAddress()
+					if options.Emojis {
+						markers := []string{}
+						if important {
+							markers = append(markers, "❗")
+						}
+						if junk {
+							markers = append(markers, "🗑️")
+						}
+						if phishing {
+							markers = append(markers, "🐟")
+						}
+						if notJunk {
+							markers = append(markers, "🧼")
+						}
+						if numAttachments > 0 {
+							markers = append(markers, "📎")
+						}
+						if forwarded {
+							markers = append(markers, "➡️")
+						}
+						if answered {
+							markers = append(markers, "💬")
+						}
+						if draft {
+							markers = append(markers, "✏️")
+						}
+						if ical {
+							markers = append(markers, "📅")
+						}
+						if pgpSign || smime {
+							markers = append(markers, "🔏")
+						}
+						if pgpEncrypt || smimeEncrypt {
+							markers = append(markers, "🔐")
+						}
+						if len(markers) > 0 {
+							from.Name = from.Name + " " + strings.Join(markers, "")
+						}
+					}
+					b.From(from)
 
-			from := sender.ToAddress()
-			if emojis {
-				markers := []string{}
-				if important {
-					markers = append(markers, "❗")
-				}
-				if junk {
-					markers = append(markers, "🗑️")
-				}
-				if phishing {
-					markers = append(markers, "🐟")
-				}
-				if notJunk {
-					markers = append(markers, "🧼")
-				}
-				if numAttachments > 0 {
-					markers = append(markers, "📎")
-				}
-				if forwarded {
-					markers = append(markers, "➡️")
-				}
-				if answered {
-					markers = append(markers, "💬")
-				}
-				if draft {
-					markers = append(markers, "✏️")
-				}
-				if ical {
-					markers = append(markers, "📅")
+					if !yield(&job{n: i + 1, b: b, subject: subject, numAttachments: numAttachments, invitation: invitation, mailboxId: threadMailboxId, locale: loc,
+						sender: sender.ToAddress(), pgpSign: pgpSign, pgpEncrypt: pgpEncrypt, smime: smime, smimeEncrypt: smimeEncrypt,
+						imported: options.Import || pgpSign || pgpEncrypt || smime || smimeEncrypt}) {
+						return nil
+					}
+
+					i++
 				}
-				if len(markers) > 0 {
-					from.Name = from.Name + " " + strings.Join(markers, "")
+			}
+			return nil
+		},
+		func(ctx context.Context, job *job) error {
+			filename := fakeFilename
+			if job.locale != nil {
+				filename = job.locale.filename
+			}
+			pool.attach(job.b, job.numAttachments, filename)
+			if job.invitation != "" {
+				job.b.Attach(jmap.Bytes([]byte(job.invitation)), "text/calendar", "appointment.ics")
+			}
+			prepare := s.Prepare
+			if job.imported {
+				prepare = s.PrepareImport
+			}
+			if keys != nil {
+				if err := keys.protect(job.b, job.sender, mail.Address{Name: toName, Address: toAddress}, job.pgpSign, job.pgpEncrypt, job.smime, job.smimeEncrypt); err != nil {
+					return err
 				}
 			}
-			b.From(from)
-
-			uid, err := s.SendEmail(b)
-			if err != nil {
-				return err
+			err := prepare(ctx, job.b)
+			// any HTTP error, as not every server tells why with a problem details object
+			var rejected *jmap.HttpError
+			if config.IgnoreUploadLimits && errors.As(err, &rejected) {
+				job.rejected = err
+				return nil
 			}
-
-			{
+			return err
+		},
+		func(job *job) error {
+			if job.rejected != nil {
+				printer(fmt.Sprintf("🚫 rejected %*s/%v %s", int(math.Log10(float64(count))+1), strconv.Itoa(int(job.n)), count, describeError(job.rejected, nil)))
+				return nil
+			}
+			queue, verb := s.QueueEmail, "📩appended"
+			if job.imported {
+				queue, verb = s.QueueImport, "📥imported"
+			}
+			return queue(context.WithoutCancel(ctx), job.b, func(uid string, err error) error {
+				var tooLarge *jmap.SetError
+				if config.IgnoreUploadLimits && errors.As(err, &tooLarge) && tooLarge.Type == "tooLarge" {
+					printer(fmt.Sprintf("🚫 rejected %*s/%v %s", int(math.Log10(float64(count))+1), strconv.Itoa(int(job.n)), count, describeError(err, nil)))
+					return nil
+				}
+				if err != nil {
+					printer(fmt.Sprintf("❌ failed  %*s/%v %s", int(math.Log10(float64(count))+1), strconv.Itoa(int(job.n)), count, describeError(err, nil)))
+					return err
+				}
 				attachmentStr := ""
-				if numAttachments > 0 {
-					attachmentStr = " " + strings.Repeat("📎", int(numAttachments)) + " "
+				if job.numAttachments > 0 {
+					attachmentStr = " " + strings.Repeat("📎", int(job.numAttachments)) + " "
 				}
-				printer(fmt.Sprintf("📩appended %*s/%v uid=%v%s'%s'", int(math.Log10(float64(count))+1), strconv.Itoa(int(i+1)), count, uid, attachmentStr, subject))
-			}
-
-			i++
-		}
+				mailboxStr := ""
+				if job.mailboxId != "" {
+					mailboxStr = " 📁" + job.mailboxId
+					if attachmentStr == "" {
+						mailboxStr += " "
+					}
+				}
+				created.add("messages", uid)
+				printer(fmt.Sprintf("%s %*s/%v uid=%v%s%s'%s'", verb, int(math.Log10(float64(count))+1), strconv.Itoa(int(job.n)), count, uid, mailboxStr, attachmentStr, job.subject))
+				return nil
+			})
+		},
+	)
+	if err := finish(ctx, err, s.Flush); err != nil || keys == nil {
+		return err
 	}
-	return nil
+	return keys.publish(ctx, j, accountId, toAddress, options.KeysDir, created, printer)
 }
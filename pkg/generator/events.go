@@ -1,6 +1,7 @@
 package generator
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"math/rand/v2"
@@ -11,21 +12,23 @@ import (
 
 	"github.com/brianvoe/gofakeit/v7"
 	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/models"
 	"opencloud.eu/groupware-assistant/pkg/tools"
 )
 
 func GenerateEvents(
+	ctx context.Context,
 	jmapUrl string,
-	trace bool,
-	color bool,
-	username string,
-	password string,
+	config jmap.Config,
+	parallel uint,
 	accountId string,
 	empty bool,
 	calendarId string,
 	count uint,
 	printer func(string),
 ) error {
+	created := newSummary("events")
+	var j *jmap.Jmap = nil
 	var s *jmap.EventSender = nil
 	{
 		u, err := url.Parse(jmapUrl)
@@ -33,13 +36,14 @@ func GenerateEvents(
 			return err
 		}
 
-		j, err := jmap.NewJmap(u, username, password, trace, color)
+		j, err = jmap.NewJmap(ctx, u, config)
 		if err != nil {
 			return err
 		}
 		defer j.Close()
+		defer created.report(ctx, printer, j)
 
-		s, err = jmap.NewEventSender(j, accountId, calendarId)
+		s, err = jmap.NewEventSender(ctx, j, accountId, calendarId)
 		if err != nil {
 			return err
 		}
@@ -47,130 +51,147 @@ func GenerateEvents(
 	defer s.Close()
 
 	if empty {
-		deleted, err := s.EmptyEvents()
-		if err != nil {
+		result, err := s.EmptyEvents(ctx)
+		if err := reportEmptied(printer, result, err, "events", "calendar"); err != nil {
 			return err
 		}
-		if deleted > 0 {
-			printer(fmt.Sprintf("🗑️ deleted %d events", deleted))
-		} else {
-			printer("ℹ️ did not delete any events, calendar is empty")
-		}
 	}
 
-	for i := range count {
-		linkId := id()
-		locationId, location := createLocation()
-		virtualLocationId, virtualLocation := createVirtualLocation()
-		alertId := id()
-		participants, organizerEmail := createParticipants(locationId, virtualLocationId)
-		alertOffset := tools.PickRandom("-PT5M", "-PT10M", "-PT15M")
-		duration := tools.PickRandom("PT30M", "PT45M", "PT1H", "PT90M")
-		tz := tools.PickRandom("Europe/Paris", "Europe/Brussels", "Europe/Berlin")
-		daysDiff := rand.IntN(31) - 15
-		t := time.Now().Add(time.Duration(daysDiff) * time.Hour * 24)
-		h := tools.PickRandom(9, 10, 11, 14, 15, 16, 18)
-		m := tools.PickRandom(0, 30)
-		t = time.Date(t.Year(), t.Month(), t.Day(), h, m, 0, 0, t.Location())
-		start := strings.ReplaceAll(t.Format(time.DateTime), " ", "T")
-		title := gofakeit.Sentence()
-		description := gofakeit.Paragraph()
-		descriptionFormat := tools.PickRandom("text/plain", "text/html")
-		if descriptionFormat == "text/html" {
-			description = tools.ToHtml(description)
-		}
-		status := tools.PickRandom("confirmed", "tentative", "cancelled")
-		freeBusy := tools.PickRandom("busy", "busy", "busy", "busy", "free")
-		privacy := tools.PickRandom("public", "private", "secret")
+	type job struct {
+		i     uint
+		event models.CalendarEvent
+	}
+	err := pipeline(ctx, parallel,
+		func(yield func(*job) bool) error {
+			for i := range count {
+				if !yield(&job{i: i}) {
+					break
+				}
+			}
+			return nil
+		},
+		func(_ context.Context, job *job) error {
+			var err error
+			job.event, err = createEvent(s.CalendarId())
+			return err
+		},
+		func(job *job) error {
+			return s.QueueEvent(context.WithoutCancel(ctx), job.event, func(uid string, err error) error {
+				if err != nil {
+					printer(fmt.Sprintf("❌ failed  %*s/%v %s", int(math.Log10(float64(count))+1), strconv.Itoa(int(job.i+1)), count, describeError(err, job.event)))
+					return err
+				}
+				created.add("events", uid)
+				printer(fmt.Sprintf("🧑🏻 created %*s/%v uid=%v", int(math.Log10(float64(count))+1), strconv.Itoa(int(job.i+1)), count, uid))
+				return nil
+			})
+		},
+	)
+	return finish(ctx, err, s.Flush)
+}
 
-		event := map[string]any{
-			"@type":                  "Event",
-			"calendarIds":            tools.ToBoolMap([]string{s.CalendarId()}),
-			"isDraft":                false,
-			"start":                  start,
-			"duration":               duration,
-			"status":                 status,
-			"uid":                    gofakeit.UUID(),
-			"prodId":                 tools.ProductName,
-			"title":                  title,
-			"description":            description,
-			"descriptionContentType": descriptionFormat,
-			"links": map[string]map[string]any{
-				linkId: {
-					"@type":       "Link",
-					"href":        picsum(300, 200),
-					"rel":         "about",
-					"contentType": "image/jpeg",
-				},
-			},
-			"locale":          tools.PickLanguage(),
-			"keywords":        keywords(),
-			"categories":      categories(),
-			"color":           gofakeit.Color(),
-			"sequence":        0,
-			"showWithoutTime": false,
-			"locations": map[string]Location{
-				locationId: location,
-			},
-			"virtualLocations": map[string]VirtualLocation{
-				virtualLocationId: virtualLocation,
-			},
-			"freeBusyStatus": freeBusy,
-			"privacy":        privacy,
-			"replyTo": map[string]string{
-				"imip": "mailto:" + organizerEmail,
+func createEvent(calendarId string) (models.CalendarEvent, error) {
+	linkId := id()
+	locationId, location := createLocation()
+	virtualLocationId, virtualLocation := createVirtualLocation()
+	alertId := id()
+	participants, organizerEmail := createParticipants(locationId, virtualLocationId)
+	alertOffset := tools.PickRandom("-PT5M", "-PT10M", "-PT15M")
+	duration := tools.PickRandom("PT30M", "PT45M", "PT1H", "PT90M")
+	tz := tools.PickRandom("Europe/Paris", "Europe/Brussels", "Europe/Berlin")
+	daysDiff := rand.IntN(31) - 15
+	t := time.Now().Add(time.Duration(daysDiff) * time.Hour * 24)
+	h := tools.PickRandom(9, 10, 11, 14, 15, 16, 18)
+	m := tools.PickRandom(0, 30)
+	t = time.Date(t.Year(), t.Month(), t.Day(), h, m, 0, 0, t.Location())
+	start := strings.ReplaceAll(t.Format(time.DateTime), " ", "T")
+	title := gofakeit.Sentence()
+	description := gofakeit.Paragraph()
+	descriptionFormat := tools.PickRandom("text/plain", "text/html")
+	if descriptionFormat == "text/html" {
+		description = tools.ToHtml(description)
+	}
+	status := tools.PickRandom("confirmed", "tentative", "cancelled")
+	freeBusy := tools.PickRandom("busy", "busy", "busy", "busy", "free")
+	privacy := tools.PickRandom("public", "private", "secret")
+
+	event := models.CalendarEvent{
+		CalendarIds:            tools.ToBoolMap([]string{calendarId}),
+		IsDraft:                false,
+		Start:                  start,
+		Duration:               duration,
+		Status:                 status,
+		Uid:                    gofakeit.UUID(),
+		ProdId:                 tools.ProductName,
+		Title:                  title,
+		Description:            description,
+		DescriptionContentType: descriptionFormat,
+		Links: map[string]models.Link{
+			linkId: {
+				Href:        picsum(300, 200),
+				Rel:         "about",
+				ContentType: "image/jpeg",
 			},
-			"sentBy":       organizerEmail,
-			"participants": participants,
-			"alerts": map[string]map[string]any{
-				alertId: {
-					"@type": "Alert",
-					"trigger": map[string]any{
-						"@type":      "OffsetTrigger",
-						"offset":     alertOffset,
-						"relativeTo": "start",
-					},
+		},
+		Locale:          tools.PickLanguage(),
+		Keywords:        keywords(),
+		Categories:      categories(),
+		Color:           gofakeit.Color(),
+		Sequence:        0,
+		ShowWithoutTime: false,
+		Locations: map[string]models.Location{
+			locationId: location,
+		},
+		VirtualLocations: map[string]models.VirtualLocation{
+			virtualLocationId: virtualLocation,
+		},
+		FreeBusyStatus: freeBusy,
+		Privacy:        privacy,
+		ReplyTo: map[string]string{
+			"imip": "mailto:" + organizerEmail,
+		},
+		SentBy:       organizerEmail,
+		Participants: participants,
+		Alerts: map[string]models.Alert{
+			alertId: {
+				Trigger: models.OffsetTrigger{
+					Offset:     alertOffset,
+					RelativeTo: "start",
 				},
 			},
-			"timeZone":        tz,
-			"mayInviteSelf":   true,
-			"mayInviteOthers": true,
-			"hideAttendees":   false,
-		}
-
-		recurrenceRule := createRecurrenceRule()
-		if recurrenceRule != nil {
-			event["recurrenceRule"] = recurrenceRule
-		}
+		},
+		TimeZone:        tz,
+		MayInviteSelf:   true,
+		MayInviteOthers: true,
+		HideAttendees:   false,
+	}
 
-		uid, err := s.CreateEvent(event)
-		if err != nil {
-			return err
-		}
-		printer(fmt.Sprintf("🧑🏻 created %*s/%v uid=%v", int(math.Log10(float64(count))+1), strconv.Itoa(int(i+1)), count, uid))
+	recurrenceRule := createRecurrenceRule()
+	if recurrenceRule != nil {
+		event.RecurrenceRules = []models.RecurrenceRule{*recurrenceRule}
 	}
-	return nil
+
+	return event, nil
 }
 
-func createRecurrenceRule() map[string]any {
+func createRecurrenceRule() *models.RecurrenceRule {
 	if rand.IntN(10) <= 7 {
 		return nil
 	}
 	frequency := tools.PickRandom("weekly", "daily")
-	interval := tools.PickRandom(1, 2)
-	count := 1
+	interval := tools.PickRandom[uint](1, 2)
+	count := uint(1)
 	if frequency == "weekly" {
-		count = 1 + rand.IntN(8)
+		count = 1 + rand.UintN(8)
 	} else {
-		count = 1 + rand.IntN(4)
+		count = 1 + rand.UintN(4)
 	}
-	return map[string]any{
-		"@type":          "RecurrenceRule",
-		"frequency":      frequency,
-		"interval":       interval,
-		"rscale":         "iso8601",
-		"skip":           "omit",
-		"firstDayOfWeek": "mo",
-		"count":          count,
+	return &models.RecurrenceRule{
+		Frequency:      frequency,
+		Interval:       interval,
+		Rscale:         "iso8601",
+		Skip:           "omit",
+		FirstDayOfWeek: "mo",
+		Count:          count,
 	}
 }
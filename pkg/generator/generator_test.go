@@ -0,0 +1,606 @@
+package generator_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"unicode"
+
+	"golang.org/x/net/idna"
+	"opencloud.eu/groupware-assistant/pkg/generator"
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/jmap/jmaptest"
+	"opencloud.eu/groupware-assistant/pkg/models"
+)
+
+var config = jmap.Config{Auth: jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword}}
+
+// output collects the lines that a generator prints, which may come from several goroutines.
+type output struct {
+	m     sync.Mutex
+	lines []string
+}
+
+func (o *output) print(text string) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.lines = append(o.lines, text)
+}
+
+// count returns how many lines start with the given prefix.
+func (o *output) count(prefix string) int {
+	o.m.Lock()
+	defer o.m.Unlock()
+	n := 0
+	for _, line := range o.lines {
+		if strings.HasPrefix(line, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// objects returns the objects of the given type in the account of the default user.
+func objects(s *jmaptest.Server, objectType string) []map[string]any {
+	return s.Objects(s.AccountId(jmaptest.DefaultUsername), objectType)
+}
+
+func TestGenerateContacts(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	ctx := context.Background()
+
+	o := &output{}
+	if err := generator.GenerateContacts(ctx, s.URL, config, 2, "", false, "", 12, o.print); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(objects(s, jmap.ContactCardObjectType)); n != 12 {
+		t.Errorf("expected 12 contacts, got %d", n)
+	}
+	if n := o.count("🧑🏻 created"); n != 12 {
+		t.Errorf("expected 12 progress lines, got %d", n)
+	}
+
+	// emptying the address book first replaces the contacts
+	o = &output{}
+	if err := generator.GenerateContacts(ctx, s.URL, config, 2, "", true, "", 5, o.print); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(objects(s, jmap.ContactCardObjectType)); n != 5 {
+		t.Errorf("expected 5 contacts, got %d", n)
+	}
+	if n := o.count("🗑️ deleted 12 contacts"); n != 1 {
+		t.Errorf("expected the 12 contacts to be deleted, got %v", o.lines)
+	}
+}
+
+func TestGenerateEvents(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+
+	o := &output{}
+	if err := generator.GenerateEvents(context.Background(), s.URL, config, 2, "", false, "", 10, o.print); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(objects(s, jmap.EventObjectType)); n != 10 {
+		t.Errorf("expected 10 events, got %d", n)
+	}
+}
+
+func TestGenerateTasks(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+
+	o := &output{}
+	if err := generator.GenerateTasks(context.Background(), s.URL, config, 2, "", false, "", 10, o.print); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(objects(s, jmap.TaskObjectType)); n != 10 {
+		t.Errorf("expected 10 tasks, got %d", n)
+	}
+}
+
+func TestGenerateMailboxes(t *testing.T) {
+	for _, maxObjectsInSet := range []uint{500, 2} {
+		t.Run(strconv.Itoa(int(maxObjectsInSet)), func(t *testing.T) {
+			s := jmaptest.NewServer()
+			defer s.Close()
+			s.Core.MaxObjectsInSet = maxObjectsInSet
+			before := len(objects(s, "Mailbox"))
+
+			o := &output{}
+			requests := s.Requests()
+			if err := generator.GenerateMailboxes(context.Background(), s.URL, config, "", "", 2, 2, 4, 4, o.print); err != nil {
+				t.Fatal(err)
+			}
+			mailboxes := objects(s, "Mailbox")
+			if n := o.count("📁 created"); n < 1 || len(mailboxes) != before+n {
+				t.Fatalf("expected the %d mailboxes to be created, got %d", n, len(mailboxes)-before)
+			}
+			// the whole tree in one request, unless it takes several batches
+			if n := s.Requests() - requests; maxObjectsInSet == 500 && n != 1 {
+				t.Errorf("expected 1 request, got %d", n)
+			}
+			byId := map[string]map[string]any{}
+			for _, m := range mailboxes {
+				byId[m["id"].(string)] = m
+			}
+			for _, m := range mailboxes {
+				if parentId, ok := m["parentId"].(string); ok && byId[parentId] == nil {
+					t.Errorf("mailbox %v has an unknown parent %s", m["name"], parentId)
+				}
+			}
+		})
+	}
+}
+
+// emailOptions are the defaults of the command line, for 5 senders.
+var emailOptions = generator.EmailOptions{
+	Emojis:          true,
+	MailboxRole:     "inbox",
+	Domain:          "example.com",
+	Senders:         5,
+	MinThreadSize:   1,
+	MaxThreadSize:   6,
+	CcEvery:         3,
+	BccEvery:        2,
+	SeenEvery:       3,
+	AttachmentEvery: 2,
+	MinAttachments:  1,
+	MaxAttachments:  4,
+	ForwardedEvery:  4,
+	ImportantEvery:  4,
+	JunkEvery:       10,
+	NotJunkEvery:    3,
+	PhishingEvery:   7,
+	DraftEvery:      10,
+	IcalEvery:       4,
+}
+
+func TestGenerateEmails(t *testing.T) {
+	for _, importMessages := range []bool{false, true} {
+		name := "set"
+		if importMessages {
+			name = "import"
+		}
+		t.Run(name, func(t *testing.T) {
+			s := jmaptest.NewServer()
+			defer s.Close()
+
+			options := emailOptions
+			options.Import = importMessages
+			o := &output{}
+			if err := generator.GenerateEmails(context.Background(), s.URL, config, 2, jmaptest.DefaultUsername, "", 20, options, o.print); err != nil {
+				t.Fatal(err)
+			}
+			emails := objects(s, "Email")
+			if len(emails) != 20 {
+				t.Fatalf("expected 20 emails, got %d", len(emails))
+			}
+			if n := o.count("❌"); n != 0 {
+				t.Errorf("expected no failures, got %v", o.lines)
+			}
+			for _, e := range emails {
+				if ids, _ := e["mailboxIds"].(map[string]any); len(ids) != 1 {
+					t.Errorf("expected email %v to be in one mailbox, got %v", e["id"], ids)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateEmailsWithoutTraits(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+
+	// a fixed thread size, and no Cc, Bcc or attachments at all
+	options := emailOptions
+	options.MinThreadSize, options.MaxThreadSize = 3, 3
+	options.CcEvery, options.BccEvery, options.AttachmentEvery = 0, 0, 0
+	o := &output{}
+	if err := generator.GenerateEmails(context.Background(), s.URL, config, 2, jmaptest.DefaultUsername, "", 9, options, o.print); err != nil {
+		t.Fatal(err)
+	}
+	emails := objects(s, "Email")
+	if len(emails) != 9 {
+		t.Fatalf("expected 9 emails, got %d", len(emails))
+	}
+	// the fake server does not thread the emails, but every thread starts with one that does
+	// not reply to any other
+	threads := 0
+	for _, e := range emails {
+		if e["inReplyTo"] == nil {
+			threads++
+		}
+		if e["cc"] != nil || e["bcc"] != nil {
+			t.Errorf("expected email %v to have neither Cc nor Bcc, got %v and %v", e["id"], e["cc"], e["bcc"])
+		}
+	}
+	if threads != 3 {
+		t.Errorf("expected 3 threads of 3 emails, got %d threads", threads)
+	}
+}
+
+func TestGenerateEmailsInvalidThreadSize(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+
+	options := emailOptions
+	options.MinThreadSize, options.MaxThreadSize = 4, 2
+	if err := generator.GenerateEmails(context.Background(), s.URL, config, 2, jmaptest.DefaultUsername, "", 9, options, (&output{}).print); err == nil {
+		t.Error("expected a minimum thread size above the maximum to be rejected")
+	}
+}
+
+func TestSendEmails(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.AddUser("grace", "secret")
+	ctx := context.Background()
+
+	o := &output{}
+	if err := generator.GenerateIdentities(ctx, s.URL, config, "", jmaptest.DefaultUsername, jmaptest.DefaultDomain, 3, 2, o.print); err != nil {
+		t.Fatal(err)
+	}
+	if n := o.count("🪪 created"); n != 3 {
+		t.Errorf("expected 3 identities to be created, got %v", o.lines)
+	}
+
+	recipient := generator.UserAddress("grace", jmaptest.DefaultDomain)
+	o = &output{}
+	if err := generator.SendEmails(ctx, s.URL, config, "", "", []mail.Address{recipient}, 4, 0, o.print); err != nil {
+		t.Fatal(err)
+	}
+	if n := o.count("📨 sent"); n != 4 {
+		t.Errorf("expected 4 emails to be sent, got %v", o.lines)
+	}
+	if n := len(objects(s, jmap.EmailSubmissionObjectType)); n != 4 {
+		t.Errorf("expected 4 submissions, got %d", n)
+	}
+	if n := len(s.Objects(s.AccountId("grace"), "Email")); n != 4 {
+		t.Errorf("expected 4 emails to be delivered, got %d", n)
+	}
+}
+
+func TestGenerateEmailsWithAttachmentSizes(t *testing.T) {
+	for _, c := range []struct {
+		spec     string
+		min, max int
+	}{
+		{"3000", 3000, 3000},
+		{"1.5KB", 1500, 1500},
+		{"2KiB", 2048, 2048},
+		{"1 MB", 1_000_000, 1_000_000},
+		{"1.5mib", 1536 * 1024, 1536 * 1024},
+		{"1KB..2KiB", 1000, 2048},
+		{"1100B, 1200 B", 1100, 1200},
+	} {
+		t.Run(c.spec, func(t *testing.T) {
+			s := jmaptest.NewServer()
+			defer s.Close()
+			accountId := s.AccountId(jmaptest.DefaultUsername)
+
+			options := emailOptions
+			options.IcalEvery = 0
+			options.AttachmentEvery, options.MinAttachments, options.MaxAttachments = 1, 2, 2
+			options.AttachmentSizes = c.spec
+			if err := generator.GenerateEmails(context.Background(), s.URL, config, 2, jmaptest.DefaultUsername, "", 4, options, (&output{}).print); err != nil {
+				t.Fatal(err)
+			}
+			n := 0
+			for _, e := range objects(s, "Email") {
+				attachments, _ := e["attachments"].([]any)
+				for _, a := range attachments {
+					a := a.(map[string]any)
+					data, ok := s.Blob(accountId, a["blobId"].(string))
+					if !ok {
+						t.Fatalf("expected the blob of attachment %v", a)
+					}
+					n++
+					// documents and images that are larger than asked for already are not cut
+					if (len(data) > c.max && a["type"] == "text/plain") || len(data) < c.min {
+						t.Errorf("expected a %s between %d and %d bytes, got %d", a["type"], c.min, c.max, len(data))
+					}
+					// those that are smaller are padded after their end
+					signature := map[any]string{"application/pdf": "%PDF", "image/png": "\x89PNG", "image/jpeg": "\xff\xd8\xff"}[a["type"]]
+					if !strings.HasPrefix(string(data), signature) {
+						t.Errorf("expected a %s to start with %q, got %q", a["type"], signature, data[:min(len(data), 8)])
+					}
+				}
+			}
+			if n != 8 {
+				t.Errorf("expected 8 attachments, got %d", n)
+			}
+		})
+	}
+}
+
+func TestGenerateEmailsWithInvalidAttachmentSizes(t *testing.T) {
+	for _, spec := range []string{"10XB", "KB", "-1KB", "2KB..1KB", "1KB..", "..1KB", "1KB,,2KB", "1e3"} {
+		t.Run(spec, func(t *testing.T) {
+			s := jmaptest.NewServer()
+			defer s.Close()
+
+			options := emailOptions
+			options.AttachmentSizes = spec
+			if err := generator.GenerateEmails(context.Background(), s.URL, config, 2, jmaptest.DefaultUsername, "", 4, options, (&output{}).print); err == nil {
+				t.Errorf("expected the attachment sizes '%s' to be rejected", spec)
+			}
+			if n := len(objects(s, "Email")); n != 0 {
+				t.Errorf("expected no emails, got %d", n)
+			}
+		})
+	}
+}
+
+func TestGenerateEmailsExceedingMaxSizeUpload(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.Core.MaxSizeUpload = 4096
+
+	options := emailOptions
+	options.Import = true
+	options.AttachmentEvery = 1
+	options.AttachmentSizes = "8KB"
+	config := config
+	config.IgnoreUploadLimits = true
+	o := &output{}
+	if err := generator.GenerateEmails(context.Background(), s.URL, config, 2, jmaptest.DefaultUsername, "", 4, options, o.print); err != nil {
+		t.Fatal(err)
+	}
+	if n := o.count("🚫 rejected"); n != 4 {
+		t.Errorf("expected the 4 emails to be rejected, got %v", o.lines)
+	}
+	if n := len(objects(s, "Email")); n != 0 {
+		t.Errorf("expected no emails, got %d", n)
+	}
+}
+
+func TestGenerateEmailsSendsQueuedOnFailure(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	// room for a few messages, after which the upload of the next one fails
+	s.BlobQuota = 6000
+
+	options := emailOptions
+	options.Import = true
+	options.MaxAttachments = 0
+	options.IcalEvery = 0
+	o := &output{}
+	if err := generator.GenerateEmails(context.Background(), s.URL, config, 1, jmaptest.DefaultUsername, "", 20, options, o.print); err == nil {
+		t.Fatal("expected the upload to fail")
+	}
+	// the emails that were queued before are still imported, and reported
+	n := len(objects(s, "Email"))
+	if n < 1 || n >= 20 {
+		t.Fatalf("expected some of the emails to be imported, got %d", n)
+	}
+	if imported := o.count("📥imported"); imported != n {
+		t.Errorf("expected the %d emails to be reported, got %v", n, o.lines)
+	}
+}
+
+func TestForEachUser(t *testing.T) {
+	users := []generator.User{{Username: "alan"}, {Username: "grace", Counts: map[string]uint{generator.RosterContacts: 7}}, {Username: "ada"}}
+	failed := errors.New("no addressbook")
+	counts := map[string]uint{}
+	o := &output{}
+	err := generator.ForEachUser(context.Background(), users, generator.RosterContacts, 3, o.print, func(ctx context.Context, user generator.User, count uint) error {
+		counts[user.Username] = count
+		if user.Username == "grace" {
+			return failed
+		}
+		return nil
+	})
+	if err == nil {
+		t.Error("expected the failure for one of the users to be returned")
+	}
+	if counts["alan"] != 3 || counts["grace"] != 7 || counts["ada"] != 3 {
+		t.Errorf("expected the counts of the roster, or the default one, got %v", counts)
+	}
+	// the failure is printed once, in the summary
+	n := 0
+	for _, line := range o.lines {
+		if strings.Contains(line, failed.Error()) {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("expected the failure to be printed once, got %v", o.lines)
+	}
+}
+
+// decryptSMIME decrypts the CMS enveloped data of an S/MIME message with the given key.
+func decryptSMIME(der []byte, key *rsa.PrivateKey) ([]byte, error) {
+	var info struct {
+		ContentType asn1.ObjectIdentifier
+		Content     struct {
+			Version        int
+			RecipientInfos []struct {
+				Version                int
+				Rid                    asn1.RawValue
+				KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+				EncryptedKey           []byte
+			} `asn1:"set"`
+			EncryptedContentInfo struct {
+				ContentType                asn1.ObjectIdentifier
+				ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+				EncryptedContent           []byte `asn1:"tag:0"`
+			}
+		} `asn1:"explicit,tag:0"`
+	}
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+	for _, r := range info.Content.RecipientInfos {
+		secret, err := rsa.DecryptPKCS1v15(nil, key, r.EncryptedKey)
+		if err != nil {
+			continue
+		}
+		var iv []byte
+		if _, err := asn1.Unmarshal(info.Content.EncryptedContentInfo.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(secret)
+		if err != nil {
+			return nil, err
+		}
+		plain := slices.Clone(info.Content.EncryptedContentInfo.EncryptedContent)
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, plain)
+		return plain[:len(plain)-int(plain[len(plain)-1])], nil
+	}
+	return nil, errors.New("the message is not encrypted for the key")
+}
+
+func TestGenerateEmailsEncryptedWithSmime(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	keysDir := t.TempDir()
+
+	options := emailOptions
+	options.SmimeEvery = 2
+	options.SmimeEncryptEvery = 1
+	options.KeysDir = keysDir
+	o := &output{}
+	if err := generator.GenerateEmails(context.Background(), s.URL, config, 2, jmaptest.DefaultUsername, "", 4, options, o.print); err != nil {
+		t.Fatal(err)
+	}
+
+	// the recipient can decrypt every message with the key that was written for it
+	raw, err := os.ReadFile(filepath.Join(keysDir, jmaptest.DefaultUsername+"@"+emailOptions.Domain+".pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var key *rsa.PrivateKey
+	for block, rest := pem.Decode(raw); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "PRIVATE KEY" {
+			k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key = k.(*rsa.PrivateKey)
+		}
+	}
+	if key == nil {
+		t.Fatal("expected the key of the recipient to be written")
+	}
+	emails := objects(s, "Email")
+	if len(emails) != 4 {
+		t.Fatalf("expected 4 emails, got %d", len(emails))
+	}
+	signed := 0
+	for _, e := range emails {
+		blob, _ := s.Blob(s.AccountId(jmaptest.DefaultUsername), e["blobId"].(string))
+		m, err := mail.ReadMessage(bytes.NewReader(blob))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mediaType, params, _ := mime.ParseMediaType(m.Header.Get("Content-Type"))
+		if mediaType != "application/pkcs7-mime" || params["smime-type"] != "enveloped-data" {
+			t.Fatalf("expected an S/MIME encrypted message, got %s", m.Header.Get("Content-Type"))
+		}
+		der, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, m.Body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entity, err := decryptSMIME(der, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.HasPrefix(entity, []byte("Content-Type: multipart/signed;")) {
+			signed++
+		}
+	}
+	if signed != 2 {
+		t.Errorf("expected 2 of the messages to be signed before being encrypted, got %d", signed)
+	}
+}
+
+func TestGenerateEmailsSignedWithSmimeInLocales(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+
+	options := emailOptions
+	options.Locales = "all"
+	options.SmimeEvery = 1
+	o := &output{}
+	if err := generator.GenerateEmails(context.Background(), s.URL, config, 2, jmaptest.DefaultUsername, "", 12, options, o.print); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(objects(s, "Email")); n != 12 {
+		t.Errorf("expected 12 emails, got %d", n)
+	}
+
+	// the certificates of senders with internationalized addresses have those as SmtpUTF8Mailbox
+	// names, and the domains of the others in ASCII
+	oidSubjectAltName := asn1.ObjectIdentifier{2, 5, 29, 17}
+	contacts := objects(s, jmap.ContactCardObjectType)
+	if len(contacts) < 1 {
+		t.Fatal("expected the certificates of the senders to be published")
+	}
+	for _, c := range contacts {
+		var card struct {
+			Emails     map[string]models.ContactEmail `json:"emails"`
+			CryptoKeys map[string]models.CryptoKey    `json:"cryptoKeys"`
+		}
+		raw, _ := json.Marshal(c)
+		if err := json.Unmarshal(raw, &card); err != nil {
+			t.Fatal(err)
+		}
+		address := ""
+		for _, e := range card.Emails {
+			address = e.Address
+		}
+		for _, key := range card.CryptoKeys {
+			der, ok := strings.CutPrefix(key.Uri, "data:application/pkix-cert;base64,")
+			if !ok {
+				continue
+			}
+			b, err := base64.StdEncoding.DecodeString(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			certificate, err := x509.ParseCertificate(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			local, domain, _ := strings.Cut(address, "@")
+			if strings.ContainsFunc(local, func(r rune) bool { return r > unicode.MaxASCII }) {
+				found := false
+				for _, e := range certificate.Extensions {
+					found = found || (e.Id.Equal(oidSubjectAltName) && bytes.Contains(e.Value, []byte(address)))
+				}
+				if !found || len(certificate.EmailAddresses) > 0 {
+					t.Errorf("expected the certificate of %s to have it as a SmtpUTF8Mailbox only, got %v", address, certificate.EmailAddresses)
+				}
+				continue
+			}
+			domain, err = idna.ToASCII(domain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(certificate.EmailAddresses, []string{local + "@" + domain}) {
+				t.Errorf("expected the certificate of %s to have its address with an ASCII domain, got %v", address, certificate.EmailAddresses)
+			}
+		}
+	}
+}
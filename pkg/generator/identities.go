@@ -0,0 +1,122 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/brianvoe/gofakeit/v7"
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/models"
+)
+
+// identityTags are the subaddresses of the identities besides the first one, as in
+// alan+sales@example.com.
+var identityTags = []string{"sales", "support", "billing", "press", "jobs", "events", "newsletter", "info"}
+
+// identityAddress returns the email address of the identity of the given user, which is the
+// username when it is an address already, or the username at the given domain otherwise,
+// with the given tag as subaddress unless it is empty.
+func identityAddress(username string, domain string, tag string) string {
+	local, host, ok := strings.Cut(username, "@")
+	if !ok {
+		host = domain
+	}
+	if tag != "" {
+		local += "+" + tag
+	}
+	return local + "@" + host
+}
+
+// UserAddress returns the address of the first identity that GenerateIdentities creates for
+// the given user, to send emails to.
+func UserAddress(username string, domain string) mail.Address {
+	return mail.Address{Name: username, Address: identityAddress(username, domain, "")}
+}
+
+func GenerateIdentities(
+	ctx context.Context,
+	jmapUrl string,
+	config jmap.Config,
+	accountId string,
+	username string,
+	domain string,
+	count uint,
+	replyToEvery uint,
+	printer func(string),
+) error {
+	created := newSummary("identities")
+	var j *jmap.Jmap = nil
+	var s *jmap.IdentitySender = nil
+	{
+		u, err := url.Parse(jmapUrl)
+		if err != nil {
+			return err
+		}
+
+		j, err = jmap.NewJmap(ctx, u, config)
+		if err != nil {
+			return err
+		}
+		defer j.Close()
+		defer created.report(ctx, printer, j)
+
+		s, err = jmap.NewIdentitySender(ctx, j, accountId)
+		if err != nil {
+			return err
+		}
+	}
+	defer s.Close()
+
+	person := gofakeit.Person()
+	name := person.FirstName + " " + person.LastName
+	for i := uint(0); i < count && ctx.Err() == nil; i++ {
+		tag := ""
+		if i > 0 {
+			tag = identityTags[int(i-1)%len(identityTags)]
+			if n := (i - 1) / uint(len(identityTags)); n > 0 {
+				tag += strconv.Itoa(int(n) + 1)
+			}
+		}
+		identity := createIdentity(name, person.Job.Title, person.Job.Company, person.Contact.Phone, identityAddress(username, domain, tag))
+		if replyToEvery > 0 && (i+1)%replyToEvery == 0 {
+			identity.ReplyTo = []models.EmailAddress{{Name: identity.Name, Email: identityAddress(username, domain, "replies")}}
+		}
+		err := s.QueueIdentity(context.WithoutCancel(ctx), identity, func(id string, err error) error {
+			if err != nil {
+				printer(fmt.Sprintf("❌ failed  %*s/%v %s", int(math.Log10(float64(count))+1), strconv.Itoa(int(i+1)), count, describeError(err, identity)))
+				return err
+			}
+			created.add("identities", id)
+			replyTo := ""
+			if len(identity.ReplyTo) > 0 {
+				replyTo = " reply-to=" + identity.ReplyTo[0].Email
+			}
+			printer(fmt.Sprintf("🪪 created %*s/%v id=%v '%s' <%s>%s", int(math.Log10(float64(count))+1), strconv.Itoa(int(i+1)), count, id, identity.Name, identity.Email, replyTo))
+			return nil
+		})
+		if err != nil {
+			return finish(ctx, err, s.Flush)
+		}
+	}
+	return finish(ctx, nil, s.Flush)
+}
+
+// createIdentity creates an identity with a plain text and an HTML signature, where the name
+// tells the team of the subaddress, if any.
+func createIdentity(name string, title string, company string, phone string, address string) models.Identity {
+	local, _, _ := strings.Cut(address, "@")
+	if _, tag, ok := strings.Cut(local, "+"); ok {
+		name = fmt.Sprintf("%s (%s)", name, strings.ToUpper(tag[:1])+tag[1:])
+	}
+	return models.Identity{
+		Name:          name,
+		Email:         address,
+		TextSignature: fmt.Sprintf("%s\n%s, %s\n%s", name, title, company, phone),
+		HtmlSignature: fmt.Sprintf("<p><b>%s</b><br>%s, <i>%s</i><br><a href=\"tel:%s\">%s</a></p>", name, title, company, phone, phone),
+	}
+}
@@ -0,0 +1,389 @@
+package generator
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"maps"
+	"math/big"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"golang.org/x/net/idna"
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/message"
+	"opencloud.eu/groupware-assistant/pkg/models"
+	"opencloud.eu/groupware-assistant/pkg/tools"
+)
+
+// keyring holds the OpenPGP keys and the S/MIME certificates of the senders and the recipient
+// of the emails, which are generated when they are first needed, the certificates being
+// issued by a certification authority of its own.
+type keyring struct {
+	m          sync.Mutex
+	identities map[string]*identity
+	caOnce     sync.Once
+	ca         *x509.Certificate
+	caKey      *rsa.PrivateKey
+	caErr      error
+}
+
+type identity struct {
+	m           sync.Mutex
+	address     mail.Address
+	pgp         *crypto.Key
+	certificate *x509.Certificate
+	key         *rsa.PrivateKey
+}
+
+func newKeyring() *keyring {
+	return &keyring{identities: map[string]*identity{}}
+}
+
+func (k *keyring) identity(address mail.Address) *identity {
+	k.m.Lock()
+	defer k.m.Unlock()
+	i, ok := k.identities[address.Address]
+	if !ok {
+		i = &identity{address: address}
+		k.identities[address.Address] = i
+	}
+	return i
+}
+
+// openpgp returns the OpenPGP key of the given address, which is generated when needed.
+func (k *keyring) openpgp(address mail.Address) (*crypto.Key, error) {
+	i := k.identity(address)
+	i.m.Lock()
+	defer i.m.Unlock()
+	if i.pgp == nil {
+		key, err := crypto.GenerateKey(address.Name, address.Address, "x25519", 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate an OpenPGP key for '%s': %w", address.Address, err)
+		}
+		i.pgp = key
+	}
+	return i.pgp, nil
+}
+
+// smime returns the S/MIME certificate of the given address along with its key, which are
+// generated when needed.
+func (k *keyring) smime(address mail.Address) (*x509.Certificate, *rsa.PrivateKey, error) {
+	k.caOnce.Do(func() {
+		k.ca, k.caKey, k.caErr = certificate(pkix.Name{CommonName: tools.ProductName + " Test CA"}, nil, nil, nil)
+	})
+	if k.caErr != nil {
+		return nil, nil, fmt.Errorf("failed to generate a CA for S/MIME: %w", k.caErr)
+	}
+	i := k.identity(address)
+	i.m.Lock()
+	defer i.m.Unlock()
+	if i.certificate == nil {
+		c, key, err := certificate(pkix.Name{CommonName: address.Name}, []string{address.Address}, k.ca, k.caKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate an S/MIME certificate for '%s': %w", address.Address, err)
+		}
+		i.certificate, i.key = c, key
+	}
+	return i.certificate, i.key, nil
+}
+
+var (
+	oidSubjectAltName  = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidSmtpUTF8Mailbox = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 8, 9}
+)
+
+// otherName is the otherName of a GeneralName (RFC 5280) that holds a SmtpUTF8Mailbox.
+type otherName struct {
+	TypeId asn1.ObjectIdentifier
+	Value  string `asn1:"utf8,explicit,tag:0"`
+}
+
+// subjectAltNames returns the addresses that go into the certificate as rfc822Name ones, with
+// their domain in ASCII, and the extension that has them along with SmtpUTF8Mailbox ones for
+// the addresses with a local part that is not ASCII (RFC 8398), if there are such addresses.
+func subjectAltNames(addresses []string) ([]string, []pkix.Extension, error) {
+	ascii := []string{}
+	names := []asn1.RawValue{}
+	internationalized := false
+	for _, address := range addresses {
+		local, domain, ok := strings.Cut(address, "@")
+		if !ok {
+			return nil, nil, fmt.Errorf("'%s' is not an email address", address)
+		}
+		if isASCII(local) {
+			domain, err := idna.ToASCII(domain)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to convert the domain of '%s' to ASCII: %w", address, err)
+			}
+			ascii = append(ascii, local+"@"+domain)
+			names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, Bytes: []byte(local + "@" + domain)})
+			continue
+		}
+		// the domain of a SmtpUTF8Mailbox is in U-labels
+		domain, err := idna.ToUnicode(domain)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to convert the domain of '%s' to Unicode: %w", address, err)
+		}
+		b, err := asn1.MarshalWithParams(otherName{TypeId: oidSmtpUTF8Mailbox, Value: local + "@" + domain}, "tag:0")
+		if err != nil {
+			return nil, nil, err
+		}
+		names = append(names, asn1.RawValue{FullBytes: b})
+		internationalized = true
+	}
+	if !internationalized {
+		return ascii, nil, nil
+	}
+	value, err := asn1.Marshal(names)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, []pkix.Extension{{Id: oidSubjectAltName, Value: value}}, nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// certificate generates an RSA key and a certificate for it, which is a self-signed CA one
+// when there is no issuer, and one for signing emails from the given addresses otherwise.
+func certificate(subject pkix.Name, addresses []string, issuer *x509.Certificate, issuerKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return nil, nil, err
+	}
+	emailAddresses, extensions, err := subjectAltNames(addresses)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:    serial,
+		Subject:         subject,
+		EmailAddresses:  emailAddresses,
+		ExtraExtensions: extensions,
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().AddDate(2, 0, 0),
+		KeyUsage:        x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	if issuer == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		template.ExtKeyUsage = nil
+		issuer, issuerKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := x509.ParseCertificate(der)
+	return c, key, err
+}
+
+// protect has the message of the email signed or encrypted with OpenPGP or with S/MIME, where
+// encrypted messages can be read by both the sender and the recipient, and signed ones are
+// signed before being encrypted.
+func (k *keyring) protect(b *jmap.EmailBuilder, from mail.Address, to mail.Address, pgpSign bool, pgpEncrypt bool, smime bool, smimeEncrypt bool) error {
+	if smime {
+		c, key, err := k.smime(from)
+		if err != nil {
+			return err
+		}
+		b.Protect(func(p message.Part) (message.Part, error) {
+			return message.SignSMIME(p, c, key, k.ca)
+		})
+	}
+	if smimeEncrypt {
+		recipients := []*x509.Certificate{}
+		for _, a := range []mail.Address{to, from} {
+			c, _, err := k.smime(a)
+			if err != nil {
+				return err
+			}
+			recipients = append(recipients, c)
+		}
+		b.Protect(func(p message.Part) (message.Part, error) {
+			return message.EncryptSMIME(p, recipients...)
+		})
+	}
+	if pgpSign {
+		key, err := k.openpgp(from)
+		if err != nil {
+			return err
+		}
+		signer, err := crypto.NewKeyRing(key)
+		if err != nil {
+			return err
+		}
+		b.Protect(func(p message.Part) (message.Part, error) {
+			return message.SignPGP(p, signer)
+		})
+	}
+	if pgpEncrypt {
+		recipients, err := crypto.NewKeyRing(nil)
+		if err != nil {
+			return err
+		}
+		for _, a := range []mail.Address{to, from} {
+			key, err := k.openpgp(a)
+			if err != nil {
+				return err
+			}
+			public, err := key.ToPublic()
+			if err != nil {
+				return err
+			}
+			if err := recipients.AddKey(public); err != nil {
+				return err
+			}
+		}
+		b.Protect(func(p message.Part) (message.Part, error) {
+			return message.EncryptPGP(p, recipients)
+		})
+	}
+	return nil
+}
+
+// publish creates a contact for every sender that has keys, with their OpenPGP public key and
+// their S/MIME certificate, for clients to verify the signatures and to encrypt replies, and
+// writes the private key of the recipient and the certificate of the CA to the given
+// directory, unless it is empty, for those to be imported into a client.
+func (k *keyring) publish(ctx context.Context, j *jmap.Jmap, accountId string, recipient string, keysDir string, created *summary, printer func(string)) error {
+	k.m.Lock()
+	identities := []*identity{}
+	for _, address := range slices.Sorted(maps.Keys(k.identities)) {
+		if address != recipient {
+			identities = append(identities, k.identities[address])
+		}
+	}
+	k.m.Unlock()
+	if err := k.save(recipient, keysDir, printer); err != nil {
+		return err
+	}
+	if len(identities) < 1 {
+		return nil
+	}
+
+	s, err := jmap.NewContactSender(ctx, j, accountId, "")
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	for _, i := range identities {
+		contact, err := i.contact(s.AddressBook())
+		if err != nil {
+			return err
+		}
+		err = s.QueueContact(context.WithoutCancel(ctx), contact, func(uid string, err error) error {
+			if err != nil {
+				printer(fmt.Sprintf("❌ failed to publish the keys of %s: %s", i.address.Address, describeError(err, contact)))
+				return err
+			}
+			created.add("contacts", uid)
+			printer(fmt.Sprintf("🔑 published the keys of %s on contact uid=%v", i.address.Address, uid))
+			return nil
+		})
+		if err != nil {
+			return finish(ctx, err, s.Flush)
+		}
+	}
+	return finish(ctx, nil, s.Flush)
+}
+
+func (i *identity) contact(addressbookId string) (models.ContactCard, error) {
+	keys := map[string]models.CryptoKey{}
+	if i.pgp != nil {
+		public, err := i.pgp.GetPublicKey()
+		if err != nil {
+			return models.ContactCard{}, err
+		}
+		keys[id()] = models.CryptoKey{
+			Uri:   "data:application/pgp-keys;base64," + base64.StdEncoding.EncodeToString(public),
+			Label: "OpenPGP",
+		}
+	}
+	if i.certificate != nil {
+		keys[id()] = models.CryptoKey{
+			Uri:   "data:application/pkix-cert;base64," + base64.StdEncoding.EncodeToString(i.certificate.Raw),
+			Label: "S/MIME",
+		}
+	}
+	name := models.Name{Full: i.address.Name}
+	if first, last, ok := strings.Cut(i.address.Name, " "); ok {
+		name.Components = []models.NameComponent{{Kind: "given", Value: first}, {Kind: "surname", Value: last}}
+		name.IsOrdered = true
+		name.DefaultSeparator = " "
+	}
+	return models.ContactCard{
+		Version:        models.CardVersion,
+		AddressBookIds: tools.ToBoolMapS(addressbookId),
+		ProdId:         tools.ProductName,
+		Kind:           models.CardKindIndividual,
+		Name:           &name,
+		Emails:         map[string]models.ContactEmail{id(): {Address: i.address.Address}},
+		CryptoKeys:     keys,
+	}, nil
+}
+
+// save writes the private OpenPGP key of the recipient, its S/MIME certificate along with the
+// key in PEM, and the certificate of the CA that issued the S/MIME certificates.
+func (k *keyring) save(recipient string, keysDir string, printer func(string)) error {
+	if keysDir == "" {
+		return nil
+	}
+	files := map[string][]byte{}
+	k.m.Lock()
+	i, ok := k.identities[recipient]
+	k.m.Unlock()
+	if ok && i.pgp != nil {
+		armored, err := i.pgp.Armor()
+		if err != nil {
+			return err
+		}
+		files[i.address.Address+".asc"] = []byte(armored)
+	}
+	if ok && i.certificate != nil {
+		der, err := x509.MarshalPKCS8PrivateKey(i.key)
+		if err != nil {
+			return err
+		}
+		files[i.address.Address+".pem"] = append(
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: i.certificate.Raw}),
+			pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})...)
+	}
+	if k.ca != nil {
+		files["ca.pem"] = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: k.ca.Raw})
+	}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		path := filepath.Join(keysDir, name)
+		if err := os.WriteFile(path, files[name], 0o600); err != nil {
+			return err
+		}
+		printer(fmt.Sprintf("🔑 wrote %s", path))
+	}
+	return nil
+}
@@ -0,0 +1,404 @@
+package generator
+
+import (
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"net/mail"
+	"slices"
+	"strings"
+)
+
+// locale is a language to write emails in, with people whose addresses have internationalized
+// local parts and domain names (RFC 6531 and 5890), to see how clients and servers encode and
+// render other scripts, right-to-left text, combining characters and emoji. Some of the
+// sentences have characters in their decomposed form on purpose, such as U+0308 after a vowel.
+type locale struct {
+	tag    string
+	rtl    bool
+	people []localPerson
+	// the IDN domains of the addresses of the people
+	domains   []string
+	subjects  []string
+	sentences []string
+	// what the sentences of a paragraph are joined with, as Chinese and Japanese use no spaces
+	separator string
+	reply     string
+	forward   string
+	// the names of attachments, without their extension
+	files []string
+	flag  string
+}
+
+type localPerson struct {
+	first string
+	last  string
+	local string
+}
+
+// emojiSequences are emoji made of several code points, with zero width joiners, skin tone
+// modifiers and variation selectors, which are appended to some subjects.
+var emojiSequences = []string{"👩🏽‍💻", "🧑‍🤝‍🧑", "👍🏿", "🏳️‍🌈", "❤️‍🔥", "👨‍👩‍👧‍👦", "🙋🏻‍♀️"}
+
+var locales = map[string]*locale{
+	"de": {
+		tag: "de",
+		people: []localPerson{
+			{"Jürgen", "Groß", "jürgen.groß"},
+			{"Björn", "Schäfer", "björn.schäfer"},
+			{"Özlem", "Yıldız", "özlem.yıldız"},
+			{"Käthe", "Müller-Lüdenscheidt", "käthe"},
+			{"Søren", "Weiß", "søren.weiß"},
+			{"Änne", "Bößmann", "änne.bößmann"},
+		},
+		domains: []string{"bäckerei-müller.de", "straßenbau-köln.de", "größe.at", "zürich-bücher.ch"},
+		subjects: []string{
+			"Protokoll der Besprechung vom Dienstag 📝",
+			"Rückfrage zur Rechnung Nr. 4711",
+			"Änderungen am Entwurf – bitte prüfen",
+			"Grüße aus München 🥨🍺",
+			"Terminvorschlag für die Übergabe",
+			"Urlaubsvertretung im Sommer ☀️",
+			"Ku\u0308ndigung des Wartungsvertrags",
+			"Neue Schlüssel für das Büro 🔑",
+		},
+		sentences: []string{
+			"Vielen Dank für Ihre schnelle Rückmeldung.",
+			"Könnten Sie mir bitte bis Freitag eine kurze Übersicht schicken?",
+			"Die Änderungen sind im Dokument gelb markiert.",
+			"Wir treffen uns um 14:30 Uhr im großen Besprechungsraum.",
+			"Ich habe die Unterlagen an Frau Groß weitergeleitet. 👍",
+			"Leider müssen wir den Termin auf nächste Woche verschieben.",
+			"Die Lieferung verzögert sich um etwa drei Werktage.",
+			"Bei Fragen stehe ich Ihnen jederzeit gern zur Verfügung.",
+			"Das Budget für das dritte Quartal ist fast ausgescho\u0308pft. 📉",
+			"Die Straße vor dem Büro ist ab Montag gesperrt.",
+			"Bitte denken Sie an die Schlüsselübergabe am Empfang.",
+			"Mit freundlichen Grüßen aus dem Süden 🌞",
+		},
+		separator: " ",
+		reply:     "AW: ",
+		forward:   "WG: ",
+		files:     []string{"Übersicht", "Angebot Bäckerei", "Rechnung März", "Größenvergleich", "Protokoll_Besprechung"},
+		flag:      "🇩🇪",
+	},
+	"fr": {
+		tag: "fr",
+		people: []localPerson{
+			{"François", "Lefèvre", "françois.lefèvre"},
+			{"Hélène", "Dupré", "hélène"},
+			{"Zoë", "Bénard", "zoë.bénard"},
+			{"Jérôme", "Côté", "jérôme.côté"},
+			{"Cécile", "Lemaître", "cécile.lemaître"},
+			{"Gaëlle", "Noël", "gaëlle.noël"},
+		},
+		domains: []string{"société-exemple.fr", "crème-brûlée.fr", "hôtel-côte.fr", "éditions-légères.be"},
+		subjects: []string{
+			"Compte rendu de la réunion de lundi 📋",
+			"Réservation de l’hôtel pour le séminaire",
+			"Question à propos de la facture n° 2024-117",
+			"Bon anniversaire Hélène\u202f! 🎂🎉",
+			"Mise à jour du planning – été",
+			"Pre\u0301sentation des re\u0301sultats trimestriels",
+			"Déjeuner d’équipe vendredi\u202f? 🥐☕",
+			"Problème d’accès au réseau 🔧",
+		},
+		sentences: []string{
+			"Merci beaucoup pour votre retour rapide.",
+			"Pourriez-vous m’envoyer le document révisé avant jeudi\u202f?",
+			"La réunion aura lieu à 10\u202fh\u202f30 dans la salle «\u202fMontréal\u202f».",
+			"J’ai ajouté quelques remarques en marge du brouillon. ✍️",
+			"Nous devons malheureusement reporter la livraison d’une semaine.",
+			"Le café de la cafe\u0301te\u0301ria est enfin réparé\u202f! ☕",
+			"N’hésitez pas à me contacter si vous avez des questions.",
+			"Le budget prévisionnel a été validé par la direction. ✅",
+			"Voici le lien vers la présentation de l’équipe.",
+			"Les congés d’été doivent être posés avant la fin du mois.",
+			"L’équipe s’occupe de la décoration du hall pour Noël. 🎄",
+			"Bien cordialement et à très bientôt.",
+		},
+		separator: " ",
+		reply:     "RE : ",
+		forward:   "TR : ",
+		files:     []string{"Compte rendu réunion", "Présentation", "Devis hôtel", "Facture_éléments", "Planning été"},
+		flag:      "🇫🇷",
+	},
+	"ja": {
+		tag: "ja",
+		people: []localPerson{
+			{"田中", "太郎", "たなか"},
+			{"佐藤", "花子", "佐藤.花子"},
+			{"鈴木", "一郎", "すずき"},
+			{"高橋", "美咲", "高橋"},
+			{"渡辺", "健太", "わたなべ.けんた"},
+			{"伊藤", "さくら", "さくら"},
+		},
+		domains: []string{"例え.jp", "株式会社さくら.jp", "テスト.jp", "会社.みんな"},
+		subjects: []string{
+			"会議の議事録について 📝",
+			"見積書のご確認のお願い",
+			"来週の打ち合わせ日程 🗓️",
+			"新年会のお知らせ 🎍🍶",
+			"【至急】サーバー障害の報告",
+			"資料の修正版を送ります",
+			"ファイルのハ\u309aスワード変更について",
+			"お疲れさまです！週末の予定 🌸",
+		},
+		sentences: []string{
+			"いつもお世話になっております。",
+			"先日の会議ではありがとうございました。",
+			"添付の資料をご確認いただけますでしょうか。",
+			"金曜日までにご返信いただけると助かります。🙏",
+			"打ち合わせは午後２時から第３会議室で行います。",
+			"スケジュールが少し遅れております。申し訳ございません。",
+			"詳細は下記のリンクをご参照ください。",
+			"ご不明な点がございましたら、お気軽にお問い合わせください。",
+			"桜がきれいに咲いていますね。🌸",
+			"テ\u3099ータの移行は来週完了する予定です。",
+			"引き続きよろしくお願いいたします。",
+		},
+		separator: "",
+		reply:     "Re: ",
+		forward:   "転送: ",
+		files:     []string{"議事録", "見積書_2024", "資料（修正版）", "写真", "スケジュール表"},
+		flag:      "🇯🇵",
+	},
+	"zh": {
+		tag: "zh",
+		people: []localPerson{
+			{"王", "伟", "王伟"},
+			{"李", "娜", "李娜"},
+			{"张", "敏", "张敏"},
+			{"刘", "洋", "刘洋"},
+			{"陈", "静", "陈静"},
+			{"杨", "磊", "杨磊"},
+		},
+		domains: []string{"示例.中国", "公司.中国", "测试.cn", "例子.公司"},
+		subjects: []string{
+			"关于下周会议的安排 📅",
+			"请确认报价单",
+			"项目进度更新（第三季度）",
+			"春节放假通知 🧧🏮",
+			"合同草案的修改意见",
+			"服务器维护通知 🔧",
+			"团队聚餐投票 🍜🥟",
+			"拼音小测验：ni\u030c ha\u030co、xie\u0300 xie 📚",
+		},
+		sentences: []string{
+			"感谢您的及时回复。",
+			"请在周五之前把修改后的文件发给我。",
+			"会议定于下午三点在二号会议室举行。",
+			"附件是最新版本的报价单，请查收。📎",
+			"由于供应商的原因，交货时间将推迟一周。",
+			"如有任何问题，请随时与我联系。",
+			"项目目前进展顺利，预计下月上线。🚀",
+			"请大家注意保存好自己的数据。",
+			"祝大家节日快乐！🎉",
+			"此致敬礼。",
+		},
+		separator: "",
+		reply:     "回复：",
+		forward:   "转发：",
+		files:     []string{"会议纪要", "报价单", "项目计划（草案）", "合同", "培训资料"},
+		flag:      "🇨🇳",
+	},
+	"ar": {
+		tag: "ar",
+		rtl: true,
+		people: []localPerson{
+			{"أحمد", "منصور", "أحمد.منصور"},
+			{"فاطمة", "الزهراء", "فاطمة"},
+			{"محمد", "العلي", "محمد"},
+			{"ليلى", "حسن", "ليلى.حسن"},
+			{"يوسف", "خليل", "يوسف"},
+			{"نور", "الهدى", "نور"},
+		},
+		domains: []string{"مثال.مصر", "شركة.السعودية", "موقع.امارات", "تجربة.com"},
+		subjects: []string{
+			"محضر اجتماع يوم الاثنين 📝",
+			"طلب تأكيد عرض السعر رقم 2024-118",
+			"تحديث الجدول الزمني للمشروع",
+			"عيد مبارك! 🌙✨",
+			"مَرْحَبًا بالزملاء الجدد 👋",
+			"تأجيل موعد التسليم",
+			"مشكلة في الوصول إلى خادم OpenCloud 🔧",
+			"دعوة لحضور ورشة العمل",
+		},
+		sentences: []string{
+			"شكرًا جزيلًا على ردكم السريع.",
+			"هل يمكنكم إرسال النسخة المعدلة قبل يوم الخميس؟",
+			"سيعقد الاجتماع في الساعة 10:30 في قاعة الاجتماعات الكبرى.",
+			"أرفقت لكم التقرير الشهري بصيغة PDF. 📎",
+			"للأسف، سنضطر إلى تأجيل التسليم لمدة أسبوع.",
+			"يُرجى مراجعة الملاحظات في المستند المرفق.",
+			"الميزانية المخصصة للربع الثالث هي 15,000 دولار.",
+			"لا تترددوا في التواصل معي لأي استفسار.",
+			"تم تحديث الصفحة على العنوان https://example.com/ar بنجاح. ✅",
+			"السَّلَامُ عَلَيْكُمْ وَرَحْمَةُ اللهِ.",
+			"مع أطيب التحيات وأصدق الأمنيات. 🌹",
+		},
+		separator: " ",
+		reply:     "رد: ",
+		forward:   "إعادة توجيه: ",
+		files:     []string{"التقرير الشهري", "عرض السعر", "محضر الاجتماع", "جدول المشروع"},
+		flag:      "🇪🇬",
+	},
+	"he": {
+		tag: "he",
+		rtl: true,
+		people: []localPerson{
+			{"דוד", "כהן", "דוד.כהן"},
+			{"שרה", "לוי", "שרה"},
+			{"יוסי", "מזרחי", "יוסי"},
+			{"מיכל", "אברהם", "מיכל.אברהם"},
+			{"נועה", "פרץ", "נועה"},
+			{"אבי", "ביטון", "אבי"},
+		},
+		domains: []string{"דוגמה.ישראל", "חברה.ישראל", "אתר.co.il"},
+		subjects: []string{
+			"סיכום הפגישה מיום שני 📝",
+			"בקשה לאישור הצעת מחיר",
+			"עדכון לוח זמנים לפרויקט",
+			"חג שמח! 🕎🍩",
+			"שָׁלוֹם לצוות החדש 👋",
+			"דחיית מועד המסירה",
+			"תקלה בשרת OpenCloud 🔧",
+			"הזמנה לסדנה ביום חמישי",
+		},
+		sentences: []string{
+			"תודה רבה על התגובה המהירה.",
+			"האם תוכלו לשלוח את הגרסה המעודכנת עד יום חמישי?",
+			"הפגישה תתקיים בשעה 10:30 בחדר הישיבות הגדול.",
+			"צירפתי את הדוח החודשי בפורמט PDF. 📎",
+			"לצערנו, נאלץ לדחות את המסירה בשבוע.",
+			"נא לעבור על ההערות במסמך המצורף.",
+			"התקציב לרבעון השלישי הוא 15,000 ש״ח.",
+			"אל תהססו לפנות אליי בכל שאלה.",
+			"בְּרֵאשִׁית הכול התחיל מרעיון קטן. 💡",
+			"בברכה ובתודה מראש. 🙏",
+		},
+		separator: " ",
+		reply:     "השב: ",
+		forward:   "העבר: ",
+		files:     []string{"דוח חודשי", "הצעת מחיר", "סיכום פגישה", "לוח זמנים"},
+		flag:      "🇮🇱",
+	},
+	"ru": {
+		tag: "ru",
+		people: []localPerson{
+			{"Иван", "Петров", "иван.петров"},
+			{"Ольга", "Смирнова", "ольга"},
+			{"Алексей", "Кузнецов", "алексей.кузнецов"},
+			{"Наталья", "Иванова", "наталья"},
+			{"Дмитрий", "Соколов", "дмитрий"},
+			{"Юлия", "Фёдорова", "юлия.фёдорова"},
+		},
+		domains: []string{"пример.рф", "компания.рф", "почта.москва", "тест.бел"},
+		subjects: []string{
+			"Протокол совещания от понедельника 📝",
+			"Просьба подтвердить коммерческое предложение",
+			"Обновление графика проекта",
+			"С Новым годом! 🎄🥂",
+			"Перенос срока сдачи",
+			"Проблема с доступом к серверу 🔧",
+			"Приглашение на семинар в четверг",
+			"Отчёт за маи\u0306 📊",
+		},
+		sentences: []string{
+			"Большое спасибо за быстрый ответ.",
+			"Не могли бы вы прислать исправленную версию до четверга?",
+			"Совещание состоится в 10:30 в большом конференц-зале.",
+			"Во вложении ежемесячный отчёт в формате PDF. 📎",
+			"К сожалению, нам придётся перенести поставку на неделю.",
+			"Пожалуйста, ознакомьтесь с замечаниями в документе.",
+			"Бюджет на третий квартал почти исчерпан. 📉",
+			"Если возникнут вопросы, пишите в любое время.",
+			"Ёжик в тумане — любимый мультфильм нашей команды. 🦔",
+			"С уважением и наилучшими пожеланиями.",
+		},
+		separator: " ",
+		reply:     "Re: ",
+		forward:   "Fwd: ",
+		files:     []string{"Отчёт за май", "Коммерческое предложение", "Протокол", "График работ"},
+		flag:      "🇷🇺",
+	},
+}
+
+// parseLocales parses a comma-separated list of the locales to write emails in, where 'en'
+// stands for the English text that is used without locales, which is a nil locale, and 'all'
+// for all of them. It returns nil when the spec is empty.
+func parseLocales(spec string) ([]*locale, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	result := []*locale{}
+	for _, tag := range strings.Split(spec, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		switch {
+		case tag == "all":
+			for _, t := range slices.Sorted(maps.Keys(locales)) {
+				result = append(result, locales[t])
+			}
+		case tag == "en":
+			result = append(result, nil)
+		case locales[tag] != nil:
+			result = append(result, locales[tag])
+		default:
+			return nil, fmt.Errorf("unsupported locale '%s', use 'all', 'en' or any of %s", tag, strings.Join(slices.Sorted(maps.Keys(locales)), ", "))
+		}
+	}
+	return result, nil
+}
+
+func (l *locale) person() (localPerson, mail.Address) {
+	p := l.people[rand.IntN(len(l.people))]
+	name := p.first + " " + p.last
+	return p, mail.Address{Name: name, Address: p.local + "@" + l.domains[rand.IntN(len(l.domains))]}
+}
+
+// sender returns a random person of the locale as a sender.
+func (l *locale) sender() *Sender {
+	p, a := l.person()
+	return &Sender{first: p.first, last: p.last, from: a.Address, sender: a.String()}
+}
+
+// others returns the given number of distinct people of the locale, other than the sender.
+func (l *locale) others(n int, sender *Sender) []mail.Address {
+	result := []mail.Address{}
+	for _, i := range rand.Perm(len(l.people)) {
+		p := l.people[i]
+		if len(result) >= n || strings.HasPrefix(sender.from, p.local+"@") {
+			continue
+		}
+		result = append(result, mail.Address{Name: p.first + " " + p.last, Address: p.local + "@" + l.domains[rand.IntN(len(l.domains))]})
+	}
+	return result
+}
+
+// subject returns a random subject, of which some end with an emoji sequence and a flag.
+func (l *locale) subject() string {
+	s := l.subjects[rand.IntN(len(l.subjects))]
+	if rand.IntN(4) == 0 {
+		s += " " + emojiSequences[rand.IntN(len(emojiSequences))] + l.flag
+	}
+	return s
+}
+
+// text returns a few paragraphs of random sentences, separated by newlines.
+func (l *locale) text() string {
+	paragraphs := make([]string, 2+rand.IntN(4))
+	for i := range paragraphs {
+		sentences := make([]string, 1+rand.IntN(4))
+		for k := range sentences {
+			sentences[k] = l.sentences[rand.IntN(len(l.sentences))]
+		}
+		paragraphs[i] = strings.Join(sentences, l.separator)
+	}
+	return strings.Join(paragraphs, "\n")
+}
+
+// filename returns a random name for an attachment with the given extension, which needs to
+// be encoded as per RFC 2231 in the MIME header.
+func (l *locale) filename(extension string) string {
+	return l.files[rand.IntN(len(l.files))] + extension
+}
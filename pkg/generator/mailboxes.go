@@ -0,0 +1,248 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/models"
+)
+
+var projectFolders = []string{"Planning", "Meetings", "Invoices", "Design", "Contracts", "Reports"}
+
+// sharedFolders look like the folders that teams share across languages and scripts, to see
+// how clients sort, truncate and render them.
+var sharedFolders = []string{
+	"Équipe Marketing",
+	"Vertrieb & Außendienst",
+	"営業チーム",
+	"Ομάδα Έργου",
+	"Отдел продаж",
+	"فريق الدعم",
+	"צוות פיתוח",
+	"개발팀",
+	"Café ☕ Talk",
+	"Ünïcödé Tëst",
+	"🚀 Launch Crew",
+	"Zażółć gęślą jaźń",
+}
+
+// folder is a mailbox of the tree to create, along with the mailboxes below it.
+type folder struct {
+	name     string
+	children []*folder
+}
+
+// mailboxTree builds folders for the given number of projects with a few subfolders each, an
+// archive with a folder for each of the given number of past years, and shared folders with
+// unicode names of which one goes the given number of levels deep.
+func mailboxTree(projects uint, years uint, depth uint) []*folder {
+	tree := []*folder{}
+	if projects > 0 {
+		p := &folder{name: "Projects"}
+		names := map[string]bool{}
+		for len(p.children) < int(projects) {
+			name := gofakeit.AppName()
+			if names[name] {
+				continue
+			}
+			names[name] = true
+			f := &folder{name: name}
+			for _, i := range rand.Perm(len(projectFolders))[:1+rand.Intn(3)] {
+				f.children = append(f.children, &folder{name: projectFolders[i]})
+			}
+			p.children = append(p.children, f)
+		}
+		tree = append(tree, p)
+	}
+	if years > 0 {
+		a := &folder{name: "Archive"}
+		year := time.Now().Year()
+		for i := range int(years) {
+			a.children = append(a.children, &folder{name: strconv.Itoa(year - 1 - i)})
+		}
+		tree = append(tree, a)
+	}
+	if depth > 0 {
+		names := rand.Perm(len(sharedFolders))
+		s := &folder{name: "Shared 👥"}
+		for _, i := range names[:min(2, len(names))] {
+			s.children = append(s.children, &folder{name: sharedFolders[i]})
+		}
+		current := s
+		for level := uint(1); level < depth; level++ {
+			f := &folder{name: fmt.Sprintf("%s %d", sharedFolders[names[int(level)%len(names)]], level)}
+			current.children = append(current.children, f)
+			current = f
+		}
+		tree = append(tree, s)
+	}
+	return tree
+}
+
+// prune drops the folders below the given number of levels, and tells whether there were any.
+func prune(tree []*folder, levels uint) bool {
+	pruned := false
+	for _, f := range tree {
+		if levels <= 1 {
+			pruned = pruned || len(f.children) > 0
+			f.children = nil
+		} else if prune(f.children, levels-1) {
+			pruned = true
+		}
+	}
+	return pruned
+}
+
+func countFolders(tree []*folder) uint {
+	n := uint(0)
+	for _, f := range tree {
+		n += 1 + countFolders(f.children)
+	}
+	return n
+}
+
+func GenerateMailboxes(
+	ctx context.Context,
+	jmapUrl string,
+	config jmap.Config,
+	accountId string,
+	parentId string,
+	projects uint,
+	years uint,
+	depth uint,
+	unsubscribedEvery uint,
+	printer func(string),
+) error {
+	created := newSummary("mailboxes")
+	var j *jmap.Jmap = nil
+	var s *jmap.MailboxSender = nil
+	{
+		u, err := url.Parse(jmapUrl)
+		if err != nil {
+			return err
+		}
+
+		j, err = jmap.NewJmap(ctx, u, config)
+		if err != nil {
+			return err
+		}
+		defer j.Close()
+		defer created.report(ctx, printer, j)
+
+		s, err = jmap.NewMailboxSender(ctx, j, accountId, parentId)
+		if err != nil {
+			return err
+		}
+	}
+	defer s.Close()
+
+	tree := mailboxTree(projects, years, depth)
+	if maxDepth := s.MaxDepth(); maxDepth > 0 && prune(tree, maxDepth) {
+		printer(fmt.Sprintf("⚠️ leaving out the folders below %d levels, the server accepts no deeper ones (maxMailboxDepth)", maxDepth))
+	}
+	count := countFolders(tree)
+
+	// the folders are queued with their parents before them, which they refer to by their
+	// creation ID, for the whole tree to be created with as few requests as possible
+	n := uint(0)
+	var queue func(folders []*folder, parentId string, parentPath string) error
+	queue = func(folders []*folder, parentId string, parentPath string) error {
+		for k, f := range folders {
+			if ctx.Err() != nil {
+				return nil
+			}
+			n++
+			i := n
+			path := parentPath + f.name
+			m := models.Mailbox{
+				Name:         f.name,
+				SortOrder:    uint(k+1) * 10,
+				IsSubscribed: unsubscribedEvery == 0 || n%unsubscribedEvery != 0,
+			}
+			if parentId != "" {
+				m.ParentId = &parentId
+			}
+			ref, err := s.QueueMailbox(context.WithoutCancel(ctx), m, func(id string, err error) error {
+				if err != nil {
+					printer(fmt.Sprintf("❌ failed  %*s/%v %s", int(math.Log10(float64(count))+1), strconv.Itoa(int(i)), count, describeError(err, m)))
+					return err
+				}
+				created.add("mailboxes", id)
+				subscribed := ""
+				if !m.IsSubscribed {
+					subscribed = " (unsubscribed)"
+				}
+				printer(fmt.Sprintf("📁 created %*s/%v id=%v '%s'%s", int(math.Log10(float64(count))+1), strconv.Itoa(int(i)), count, id, path, subscribed))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if err := queue(f.children, ref, path+"/"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := queue(tree, s.Parent(), "")
+	return finish(ctx, err, s.Flush)
+}
+
+// spread picks the mailboxes to put the emails of a thread in, with the weight of the mailbox
+// of rank r being 1/r^exponent in a random order, which is uniform for an exponent of zero,
+// and has a few mailboxes get most of the emails otherwise, as per Zipf's law.
+type spread struct {
+	mailboxIds []string
+	cumulative []float64
+}
+
+// newSpread parses the distribution of the emails across the mailboxes, either 'uniform', or
+// 'zipf' optionally followed by ':' and the exponent, which is 1 by default, and returns nil
+// when the spec is empty.
+func newSpread(spec string, mailboxIds []string) (*spread, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	exponent := 0.0
+	name, param, hasParam := strings.Cut(spec, ":")
+	switch {
+	case name == "uniform" && !hasParam:
+	case name == "zipf" && !hasParam:
+		exponent = 1
+	case name == "zipf":
+		e, err := strconv.ParseFloat(param, 64)
+		if err != nil || e < 0 {
+			return nil, fmt.Errorf("invalid exponent '%s' in the spread '%s'", param, spec)
+		}
+		exponent = e
+	default:
+		return nil, fmt.Errorf("unsupported spread '%s', use 'uniform', 'zipf' or 'zipf:<exponent>'", spec)
+	}
+	if len(mailboxIds) < 1 {
+		return nil, fmt.Errorf("there are no mailboxes to spread the emails across")
+	}
+
+	shuffled := append([]string{}, mailboxIds...)
+	rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	cumulative := make([]float64, len(shuffled))
+	total := 0.0
+	for r := range shuffled {
+		total += 1 / math.Pow(float64(r+1), exponent)
+		cumulative[r] = total
+	}
+	return &spread{mailboxIds: shuffled, cumulative: cumulative}, nil
+}
+
+func (s *spread) pick() string {
+	x := rand.Float64() * s.cumulative[len(s.cumulative)-1]
+	return s.mailboxIds[min(sort.SearchFloat64s(s.cumulative, x), len(s.mailboxIds)-1)]
+}
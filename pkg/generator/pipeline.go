@@ -0,0 +1,78 @@
+package generator
+
+import (
+	"context"
+	"sync"
+)
+
+// pipeline produces jobs sequentially, builds them on up to workers goroutines in parallel, and
+// commits them sequentially, in the order in which they were produced, which is what keeps
+// threads of emails in order and the progress output numbered.
+//
+// Producing stops as soon as yield returns false, which it does once the context is cancelled,
+// but the jobs that were produced by then are still built and committed, without cancellation.
+// The first error of any stage stops the pipeline and is returned.
+func pipeline[J any](ctx context.Context, workers uint, produce func(yield func(J) bool) error, build func(context.Context, J) error, commit func(J) error) error {
+	type slot struct {
+		job  J
+		done chan error
+	}
+
+	stop := make(chan struct{})
+	halt := sync.OnceFunc(func() { close(stop) })
+	ordered := make(chan slot, max(workers, 1))
+	work := make(chan slot)
+
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range work {
+				s.done <- build(context.WithoutCancel(ctx), s.job)
+			}
+		}()
+	}
+
+	var produced error = nil
+	go func() {
+		defer close(ordered)
+		defer close(work)
+		produced = produce(func(job J) bool {
+			if ctx.Err() != nil {
+				return false
+			}
+			s := slot{job: job, done: make(chan error, 1)}
+			select {
+			case ordered <- s:
+			case <-stop:
+				return false
+			}
+			select {
+			case work <- s:
+				return true
+			case <-stop:
+				return false
+			}
+		})
+	}()
+
+	var err error = nil
+	for s := range ordered {
+		if err != nil {
+			// drain the jobs that are still queued, without waiting for them to be built
+			continue
+		}
+		if err = <-s.done; err == nil {
+			err = commit(s.job)
+		}
+		if err != nil {
+			halt()
+		}
+	}
+	wg.Wait()
+	if err == nil {
+		err = produced
+	}
+	return err
+}
@@ -0,0 +1,195 @@
+package generator
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The kinds of objects that the users of a roster may have counts of.
+const (
+	RosterEmails     = "emails"
+	RosterContacts   = "contacts"
+	RosterEvents     = "events"
+	RosterTasks      = "tasks"
+	RosterIdentities = "identities"
+	RosterSent       = "sent"
+)
+
+var rosterKinds = []string{RosterEmails, RosterContacts, RosterEvents, RosterTasks, RosterIdentities, RosterSent}
+
+// User is an entry of a roster, with the number of objects of each kind to generate for them,
+// where a missing count leaves it to the default of the generator.
+type User struct {
+	Username  string          `json:"username"`
+	Password  string          `json:"password,omitempty"`
+	AccountId string          `json:"accountId,omitempty"`
+	Counts    map[string]uint `json:"-"`
+}
+
+func (u *User) UnmarshalJSON(b []byte) error {
+	type plain User
+	if err := json.Unmarshal(b, (*plain)(u)); err != nil {
+		return err
+	}
+	var counts map[string]json.RawMessage
+	if err := json.Unmarshal(b, &counts); err != nil {
+		return err
+	}
+	u.Counts = map[string]uint{}
+	for _, kind := range rosterKinds {
+		if raw, ok := counts[kind]; ok {
+			var count uint
+			if err := json.Unmarshal(raw, &count); err != nil {
+				return fmt.Errorf("the %s of user '%s' is not a count: %s", kind, u.Username, raw)
+			}
+			u.Counts[kind] = count
+		}
+	}
+	return nil
+}
+
+// Count returns the number of objects of the given kind to generate for the user.
+func (u User) Count(kind string, defaultCount uint) uint {
+	if count, ok := u.Counts[kind]; ok {
+		return count
+	}
+	return defaultCount
+}
+
+// LoadRoster reads the users from a JSON file with an array of objects, or from a CSV file
+// with a header line, both with the username, password, accountId and the counts of emails,
+// contacts, events, tasks, identities and sent emails, of which all but the username are
+// optional.
+func LoadRoster(filename string) ([]User, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var users []User
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		if err := json.NewDecoder(f).Decode(&users); err != nil {
+			return nil, fmt.Errorf("failed to parse the users file '%s': %w", filename, err)
+		}
+	} else if users, err = readCsvRoster(f); err != nil {
+		return nil, fmt.Errorf("failed to parse the users file '%s': %w", filename, err)
+	}
+
+	for i, u := range users {
+		if u.Username == "" {
+			return nil, fmt.Errorf("user %d in the users file '%s' has no username", i+1, filename)
+		}
+	}
+	if len(users) < 1 {
+		return nil, fmt.Errorf("the users file '%s' has no users", filename)
+	}
+	return users, nil
+}
+
+func readCsvRoster(r io.Reader) ([]User, error) {
+	c := csv.NewReader(r)
+	c.TrimLeadingSpace = true
+	c.Comment = '#'
+	header, err := c.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if name != "username" && name != "password" && name != "accountId" && !slices.Contains(rosterKinds, name) {
+			return nil, fmt.Errorf("unknown column '%s', expected username, password, accountId, %s", name, strings.Join(rosterKinds, ", "))
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["username"]; !ok {
+		return nil, fmt.Errorf("there is no username column")
+	}
+
+	users := []User{}
+	for {
+		record, err := c.Read()
+		if err == io.EOF {
+			return users, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		u := User{Username: value("username"), Password: value("password"), AccountId: value("accountId"), Counts: map[string]uint{}}
+		for _, kind := range rosterKinds {
+			if v := value(kind); v != "" {
+				count, err := strconv.ParseUint(v, 10, 0)
+				if err != nil {
+					return nil, fmt.Errorf("the %s of user '%s' is not a count: '%s'", kind, u.Username, v)
+				}
+				u.Counts[kind] = uint(count)
+			}
+		}
+		users = append(users, u)
+	}
+}
+
+// ForEachUser runs a generator for every user of a roster in turn, with the number of objects
+// of the given kind to generate for them, and summarises how that went per user, along with
+// why it failed for some of them. A user for whom the generator fails does not stop the
+// others, unless the context is cancelled.
+func ForEachUser(
+	ctx context.Context,
+	users []User,
+	kind string,
+	defaultCount uint,
+	printer func(string),
+	generate func(ctx context.Context, user User, count uint) error,
+) error {
+	type result struct {
+		user    User
+		count   uint
+		err     error
+		elapsed time.Duration
+	}
+	results := []result{}
+	for i, user := range users {
+		if ctx.Err() != nil {
+			break
+		}
+		count := user.Count(kind, defaultCount)
+		printer(fmt.Sprintf("👤 %d/%d %s: generating %d %s", i+1, len(users), user.Username, count, kind))
+		started := time.Now()
+		err := generate(ctx, user, count)
+		results = append(results, result{user: user, count: count, err: err, elapsed: time.Since(started)})
+	}
+
+	failed := 0
+	printer(fmt.Sprintf("👥 %s for %d of %d users", kind, len(results), len(users)))
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			printer(fmt.Sprintf("   ❌ %s: %v", r.user.Username, r.err))
+		} else {
+			printer(fmt.Sprintf("   ✅ %s: %d %s in %v", r.user.Username, r.count, kind, r.elapsed.Round(time.Millisecond)))
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to generate %s for %d of %d users", kind, failed, len(users))
+	}
+	return nil
+}
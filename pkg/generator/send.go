@@ -0,0 +1,99 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+)
+
+// SendEmails sends emails from an identity of the account to the given recipients with
+// EmailSubmission, for the server to deliver them, unlike GenerateEmails which puts them
+// straight into a mailbox. The sent emails end up in the sent mailbox of the account, and
+// every n-th one is sent to a second recipient in Cc when there is one.
+func SendEmails(
+	ctx context.Context,
+	jmapUrl string,
+	config jmap.Config,
+	accountId string,
+	identityId string,
+	recipients []mail.Address,
+	count uint,
+	ccEvery uint,
+	printer func(string),
+) error {
+	if len(recipients) < 1 {
+		return fmt.Errorf("there are no recipients to send emails to")
+	}
+
+	created := newSummary("messages")
+	var j *jmap.Jmap = nil
+	var s *jmap.EmailSubmitter = nil
+	{
+		u, err := url.Parse(jmapUrl)
+		if err != nil {
+			return err
+		}
+
+		j, err = jmap.NewJmap(ctx, u, config)
+		if err != nil {
+			return err
+		}
+		defer j.Close()
+		defer created.report(ctx, printer, j)
+
+		s, err = jmap.NewEmailSubmitter(ctx, j, accountId, identityId)
+		if err != nil {
+			return err
+		}
+	}
+	defer s.Close()
+
+	identity := s.Identity()
+	printer(fmt.Sprintf("🪪 sending from id=%v '%s' <%s>", identity.Id, identity.Name, identity.Email))
+	for i := uint(0); i < count && ctx.Err() == nil; i++ {
+		b, err := s.NewEmail()
+		if err != nil {
+			return err
+		}
+		k := rand.Intn(len(recipients))
+		to := recipients[k]
+		b.To(to)
+		if ccEvery > 0 && (i+1)%ccEvery == 0 && len(recipients) > 1 {
+			b.CC([]mail.Address{recipients[(k+1+rand.Intn(len(recipients)-1))%len(recipients)]})
+		}
+		subject := strings.Trim(gofakeit.Sentence(), ".")
+		b.Subject(subject)
+		_, domain, _ := strings.Cut(identity.Email, "@")
+		b.MessageId(fmt.Sprintf("%d.%d@%s", time.Now().Unix(), 1000000+rand.Intn(8999999), domain))
+		b.Sent(time.Now())
+
+		text := gofakeit.Paragraph(2+rand.Intn(4), 1+rand.Intn(4), 1+rand.Intn(32), "\n")
+		if identity.TextSignature != "" {
+			text += "\n-- \n" + identity.TextSignature
+		}
+		formats[int(i)%len(formats)](text, b)
+
+		err = s.QueueSubmission(context.WithoutCancel(ctx), b, func(id string, err error) error {
+			if err != nil {
+				printer(fmt.Sprintf("❌ failed  %*s/%v to %s: %v", int(math.Log10(float64(count))+1), strconv.Itoa(int(i+1)), count, to.Address, err))
+				return err
+			}
+			created.add("messages", id)
+			printer(fmt.Sprintf("📨 sent    %*s/%v id=%v to %s '%s'", int(math.Log10(float64(count))+1), strconv.Itoa(int(i+1)), count, id, to.Address, subject))
+			return nil
+		})
+		if err != nil {
+			return finish(ctx, err, s.Flush)
+		}
+	}
+	return finish(ctx, nil, s.Flush)
+}
@@ -0,0 +1,74 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/tools"
+)
+
+// summary keeps track of the objects that were created, to tell what was done when the
+// generator completes, fails, or is interrupted.
+type summary struct {
+	m     sync.Mutex
+	kinds []string
+	ids   map[string][]string
+}
+
+func newSummary(kinds ...string) *summary {
+	return &summary{
+		kinds: kinds,
+		ids:   map[string][]string{},
+	}
+}
+
+func (s *summary) add(kind string, id string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.ids[kind] = append(s.ids[kind], id)
+}
+
+// report prints how many objects of each kind were created along with their IDs, how
+// many requests had to be sent again because the server was throttling us or was
+// temporarily unavailable, and how many uploads were saved by reusing blobs.
+func (s *summary) report(ctx context.Context, printer func(string), j *jmap.Jmap) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if errors.Is(ctx.Err(), context.Canceled) {
+		printer("⏹️ interrupted, stopped after the pending requests")
+	}
+	for _, kind := range s.kinds {
+		ids := s.ids[kind]
+		if len(ids) > 0 {
+			printer(fmt.Sprintf("📊 created %d %s: %s", len(ids), kind, strings.Join(ids, " ")))
+		} else {
+			printer(fmt.Sprintf("📊 created no %s", kind))
+		}
+	}
+	if retries := j.Retries(); retries > 0 {
+		printer(fmt.Sprintf("🔁 retried %d requests", retries))
+	}
+	if reused, saved := j.ReusedBlobs(); reused > 0 {
+		printer(fmt.Sprintf("♻️ reused %d blobs instead of uploading %s again", reused, tools.FormatBytes(saved)))
+	}
+}
+
+// finish sends the objects that are still queued, even when the context was cancelled or
+// generating the others failed, as they are complete already, and returns why generating
+// failed, or the reason for the cancellation, if any.
+//
+// For the same reason, the generators queue objects without cancellation, and only check
+// the context before creating the next one.
+func finish(ctx context.Context, failed error, flush func(context.Context) error) error {
+	if err := flush(context.WithoutCancel(ctx)); err != nil {
+		return errors.Join(failed, err)
+	}
+	if failed != nil {
+		return failed
+	}
+	return ctx.Err()
+}
@@ -1,29 +1,34 @@
 package generator
 
 import (
+	"context"
 	"fmt"
 	"math"
-	"math/rand"
+	"math/rand/v2"
 	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/brianvoe/gofakeit/v7"
 	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/models"
 	"opencloud.eu/groupware-assistant/pkg/tools"
 )
 
 func GenerateTasks(
+	ctx context.Context,
 	jmapUrl string,
-	trace bool,
-	color bool,
-	username string,
-	password string,
+	config jmap.Config,
+	parallel uint,
 	accountId string,
 	empty bool,
 	tasklistId string,
 	count uint,
 	printer func(string),
 ) error {
+	created := newSummary("tasks")
+	var j *jmap.Jmap = nil
 	var s *jmap.TaskSender = nil
 	{
 		u, err := url.Parse(jmapUrl)
@@ -31,13 +36,14 @@ func GenerateTasks(
 			return err
 		}
 
-		j, err := jmap.NewJmap(u, username, password, trace, color)
+		j, err = jmap.NewJmap(ctx, u, config)
 		if err != nil {
 			return err
 		}
 		defer j.Close()
+		defer created.report(ctx, printer, j)
 
-		s, err = jmap.NewTaskSender(j, accountId, tasklistId)
+		s, err = jmap.NewTaskSender(ctx, j, accountId, tasklistId)
 		if err != nil {
 			return err
 		}
@@ -45,45 +51,96 @@ func GenerateTasks(
 	defer s.Close()
 
 	if empty {
-		deleted, err := s.EmptyTasks()
-		if err != nil {
+		result, err := s.EmptyTasks(ctx)
+		if err := reportEmptied(printer, result, err, "tasks", "tasklist"); err != nil {
 			return err
 		}
-		if deleted > 0 {
-			printer(fmt.Sprintf("🗑️ deleted %d tasks", deleted))
-		} else {
-			printer("ℹ️ did not delete any tasks, tasklist is empty")
-		}
 	}
 
-	for i := range count {
-		person := gofakeit.Person()
-		task := map[string]any{
-			"@type":       "Task",
-			"version":     "1.0",
-			"taskListIds": tools.ToBoolMap([]string{s.TaskList()}),
-			"prodId":      tools.ProductName,
-			"language":    tools.PickLanguage(),
-		}
+	type job struct {
+		i    uint
+		task models.Task
+	}
+	err := pipeline(ctx, parallel,
+		func(yield func(*job) bool) error {
+			for i := range count {
+				if !yield(&job{i: i}) {
+					break
+				}
+			}
+			return nil
+		},
+		func(_ context.Context, job *job) error {
+			var err error
+			job.task, err = createTask(s.TaskList())
+			return err
+		},
+		func(job *job) error {
+			return s.QueueTask(context.WithoutCancel(ctx), job.task, func(uid string, err error) error {
+				if err != nil {
+					printer(fmt.Sprintf("❌ failed  %*s/%v %s", int(math.Log10(float64(count))+1), strconv.Itoa(int(job.i+1)), count, describeError(err, job.task)))
+					return err
+				}
+				created.add("tasks", uid)
+				printer(fmt.Sprintf("📋 created %*s/%v uid=%v", int(math.Log10(float64(count))+1), strconv.Itoa(int(job.i+1)), count, uid))
+				return nil
+			})
+		},
+	)
+	return finish(ctx, err, s.Flush)
+}
 
-		task["@type"] = "individual"
-		task["name"] = createName(person)
-		nickNameId := id()
-		task["nicknames"] = map[string]any{
-			nickNameId: createNickName(person),
-		}
-		emails := map[string]any{}
-		emailId := id()
-		emails[emailId] = createEmail(person, 10)
-		for i := range rand.Intn(3) {
-			emails[id()] = createSecondaryEmail(gofakeit.Email(), i*100)
-		}
+func createTask(tasklistId string) (models.Task, error) {
+	title := strings.Trim(gofakeit.Sentence(), ".")
+	description := gofakeit.Paragraph()
+	descriptionFormat := tools.PickRandom("text/plain", "text/html")
+	if descriptionFormat == "text/html" {
+		description = tools.ToHtml(description)
+	}
+	t := time.Now().Add(time.Duration(rand.IntN(29)-14) * time.Hour * 24)
+	t = time.Date(t.Year(), t.Month(), t.Day(), tools.PickRandom(9, 12, 17), 0, 0, 0, t.Location())
+	due := strings.ReplaceAll(t.Format(time.DateTime), " ", "T")
 
-		uid, err := s.CreateTask(task)
-		if err != nil {
-			return err
+	progress := tools.PickRandom(models.ProgressNeedsAction, models.ProgressNeedsAction, models.ProgressInProcess, models.ProgressCompleted, models.ProgressCancelled)
+	percentComplete := uint(0)
+	switch progress {
+	case models.ProgressInProcess:
+		percentComplete = tools.PickRandom[uint](10, 25, 50, 75, 90)
+	case models.ProgressCompleted:
+		percentComplete = 100
+	}
+
+	task := models.Task{
+		TaskListIds:            tools.ToBoolMap([]string{tasklistId}),
+		Uid:                    gofakeit.UUID(),
+		ProdId:                 tools.ProductName,
+		Sequence:               0,
+		Title:                  title,
+		Description:            description,
+		DescriptionContentType: descriptionFormat,
+		Due:                    due,
+		EstimatedDuration:      tools.PickRandom("PT15M", "PT30M", "PT1H", "PT2H", "P1D"),
+		TimeZone:               tools.PickRandom("Europe/Paris", "Europe/Brussels", "Europe/Berlin"),
+		ShowWithoutTime:        false,
+		PercentComplete:        percentComplete,
+		Progress:               progress,
+		// 0 is undefined, 1 is the highest and 9 the lowest priority
+		Priority:   tools.PickRandom(0, 0, 1, 5, 9),
+		Privacy:    tools.PickRandom("public", "public", "private"),
+		Locale:     tools.PickLanguage(),
+		Keywords:   keywords(),
+		Categories: categories(),
+	}
+	if rand.IntN(2) < 1 {
+		task.Alerts = map[string]models.Alert{
+			id(): {
+				Trigger: models.OffsetTrigger{
+					Offset:     tools.PickRandom("-PT15M", "-PT1H", "-P1D"),
+					RelativeTo: "end",
+				},
+			},
 		}
-		printer(fmt.Sprintf("📋 created %*s/%v uid=%v", int(math.Log10(float64(count))+1), strconv.Itoa(int(i+1)), count, uid))
 	}
-	return nil
+
+	return task, nil
 }
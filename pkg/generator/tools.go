@@ -1,6 +1,8 @@
 package generator
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand/v2"
 	"net/mail"
@@ -11,6 +13,7 @@ import (
 	ics "github.com/arran4/golang-ical"
 	"github.com/brianvoe/gofakeit/v7"
 	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/models"
 	"opencloud.eu/groupware-assistant/pkg/tools"
 )
 
@@ -121,51 +124,39 @@ func toIcal(created time.Time, starts time.Time, duration time.Duration, summary
 	return cal.Serialize()
 }
 
-func createName(person *gofakeit.PersonInfo) map[string]any {
-	name := map[string]any{
-		"@type": "Name",
-	}
-	components := make([]map[string]string, 2)
-	components[0] = map[string]string{
-		"kind":  "given",
-		"value": person.FirstName,
-	}
-	components[1] = map[string]string{
-		"kind":  "surname",
-		"value": person.LastName,
+func createName(person *gofakeit.PersonInfo) models.Name {
+	return models.Name{
+		Components: []models.NameComponent{
+			{Kind: "given", Value: person.FirstName},
+			{Kind: "surname", Value: person.LastName},
+		},
+		IsOrdered:        true,
+		DefaultSeparator: " ",
+		Full:             fmt.Sprintf("%s %s", person.FirstName, person.LastName),
 	}
-	name["components"] = components
-	name["isOrdered"] = true
-	name["defaultSeparator"] = " "
-	name["full"] = fmt.Sprintf("%s %s", person.FirstName, person.LastName)
-	return name
-}
-
-func createNickName(_ *gofakeit.PersonInfo) map[string]any {
-	return map[string]any{
-		"@type":   "Name",
-		"name":    gofakeit.PetName(),
-		"context": tools.ToBoolMap(tools.PickRandoms("work", "private")),
+}
+
+func createNickName(_ *gofakeit.PersonInfo) models.Nickname {
+	return models.Nickname{
+		Name:     gofakeit.PetName(),
+		Contexts: tools.ToBoolMap(tools.PickRandoms("work", "private")),
 	}
 }
 
-func createEmail(person *gofakeit.PersonInfo, pref int) map[string]any {
-	email := person.Contact.Email
-	return map[string]any{
-		"@type":   "EmailAddress",
-		"address": email,
-		"context": tools.ToBoolMap(tools.PickRandoms("work", "private")),
-		"label":   strings.ToLower(person.FirstName),
-		"pref":    pref,
+func createEmail(person *gofakeit.PersonInfo, pref uint) models.ContactEmail {
+	return models.ContactEmail{
+		Address:  person.Contact.Email,
+		Contexts: tools.ToBoolMap(tools.PickRandoms("work", "private")),
+		Label:    strings.ToLower(person.FirstName),
+		Pref:     pref,
 	}
 }
 
-func createSecondaryEmail(email string, pref int) map[string]any {
-	return map[string]any{
-		"@type":   "EmailAddress",
-		"address": email,
-		"context": tools.ToBoolMap(tools.PickRandoms("work", "private")),
-		"pref":    pref,
+func createSecondaryEmail(email string, pref uint) models.ContactEmail {
+	return models.ContactEmail{
+		Address:  email,
+		Contexts: tools.ToBoolMap(tools.PickRandoms("work", "private")),
+		Pref:     pref,
 	}
 }
 
@@ -182,84 +173,56 @@ func id() string {
 	return string(b)
 }
 
-type Link struct {
-	Href string
-}
-
-type Location struct {
-	Type         string          `json:"@type"`
-	Id           string          `json:"id"`
-	Name         string          `json:"name"`
-	Description  string          `json:"description"`
-	LocationType map[string]bool `json:"locationType"`
-	Coordinates  string          `json:"coordinates"`
-	Links        map[string]Link `json:"links"`
-}
-
-var Rooms = []Location{
+var Rooms = []models.Location{
 	{
-		Type:         "Location",
-		Name:         "office-upstairs",
-		Description:  "Office meeting room upstairs",
-		LocationType: tools.ToBoolMapS("office"),
-		Coordinates:  "geo:52.5335389,13.4103296",
-		Links: map[string]Link{
+		Name:          "office-upstairs",
+		Description:   "Office meeting room upstairs",
+		LocationTypes: tools.ToBoolMapS("office"),
+		Coordinates:   "geo:52.5335389,13.4103296",
+		Links: map[string]models.Link{
 			id(): {Href: "https://www.heinlein-support.de/"},
 		},
 	},
 	{
-		Type:         "Location",
-		Name:         "office-nue",
-		Description:  "",
-		LocationType: tools.ToBoolMapS("office"),
-		Coordinates:  "geo:49.4723337,11.1042282",
-		Links: map[string]Link{
+		Name:          "office-nue",
+		Description:   "",
+		LocationTypes: tools.ToBoolMapS("office"),
+		Coordinates:   "geo:49.4723337,11.1042282",
+		Links: map[string]models.Link{
 			id(): {Href: "https://www.workandpepper.de/"},
 		},
 	},
 	{
-		Type:         "Location",
-		Name:         "Meetingraum Prenzlauer Berg",
-		Description:  "This is a Hero Space with great reviews, fast response-time and good quality service",
-		LocationType: tools.ToBoolMapS("office", "public"),
-		Coordinates:  "geo:52.554222,13.4142387",
-		Links: map[string]Link{
+		Name:          "Meetingraum Prenzlauer Berg",
+		Description:   "This is a Hero Space with great reviews, fast response-time and good quality service",
+		LocationTypes: tools.ToBoolMapS("office", "public"),
+		Coordinates:   "geo:52.554222,13.4142387",
+		Links: map[string]models.Link{
 			id(): {Href: "https://www.spacebase.com/en/venue/meeting-room-prenzlauer-be-11499/"},
 		},
 	},
 	{
-		Type:         "Location",
-		Name:         "Meetingraum LIANE 1",
-		Description:  "Ecofriendly Bright Urban Jungle",
-		LocationType: tools.ToBoolMapS("office", "library"),
-		Coordinates:  "geo:52.4854301,13.4224763",
-		Links: map[string]Link{
+		Name:          "Meetingraum LIANE 1",
+		Description:   "Ecofriendly Bright Urban Jungle",
+		LocationTypes: tools.ToBoolMapS("office", "library"),
+		Coordinates:   "geo:52.4854301,13.4224763",
+		Links: map[string]models.Link{
 			id(): {Href: "https://www.spacebase.com/en/venue/rent-a-jungle-8372/"},
 		},
 	},
 	{
-		Type:         "Location",
-		Name:         "Dark Horse",
-		Description:  "Collaboration and event spaces from the authors of the Workspace and Digital Innovation Playbooks.",
-		LocationType: tools.ToBoolMapS("office"),
-		Coordinates:  "geo:52.4942254,13.4346015",
-		Links: map[string]Link{
+		Name:          "Dark Horse",
+		Description:   "Collaboration and event spaces from the authors of the Workspace and Digital Innovation Playbooks.",
+		LocationTypes: tools.ToBoolMapS("office"),
+		Coordinates:   "geo:52.4942254,13.4346015",
+		Links: map[string]models.Link{
 			id(): {Href: "https://www.spacebase.com/en/event-venue/workshop-white-space-2667/"},
 		},
 	},
 }
 
-type VirtualLocation struct {
-	Type        string          `json:"@type"`
-	Name        string          `json:"name"`
-	Description string          `json:"description"`
-	Uri         string          `json:"uri"`
-	Features    map[string]bool `json:"features"`
-}
-
-var VirtualRooms = []VirtualLocation{
+var VirtualRooms = []models.VirtualLocation{
 	{
-		Type:        "VirtualLocation",
 		Name:        "opentalk",
 		Description: "the main room in our opentalk instance",
 		Uri:         "https://meet.opentalk.eu/fake/room/" + gofakeit.UUID(),
@@ -267,13 +230,13 @@ var VirtualRooms = []VirtualLocation{
 	},
 }
 
-func createLocation() (string, Location) {
+func createLocation() (string, models.Location) {
 	locationId := id()
 	room := Rooms[rand.IntN(len(Rooms))]
 	return locationId, room
 }
 
-func createVirtualLocation() (string, VirtualLocation) {
+func createVirtualLocation() (string, models.VirtualLocation) {
 	locationId := id()
 	return locationId, VirtualRooms[rand.IntN(len(VirtualRooms))]
 }
@@ -281,19 +244,19 @@ func createVirtualLocation() (string, VirtualLocation) {
 var ChairRoles = tools.ToBoolMapS("attendee", "chair", "owner")
 var RegularRoles = tools.ToBoolMapS("attendee")
 
-func createParticipants(locationId string, virtualLocationid string) (map[string]map[string]any, string) {
+func createParticipants(locationId string, virtualLocationid string) (map[string]models.Participant, string) {
 	n := 1 + rand.IntN(4)
-	participants := map[string]map[string]any{}
+	participants := map[string]models.Participant{}
 	organizerId, organizerEmail, organizer := createParticipant(0, tools.PickRandom(locationId, virtualLocationid), "", "")
 	participants[organizerId] = organizer
 	for i := 1; i < n; i++ {
-		id, _, participant := createParticipant(i, tools.PickRandom(locationId, virtualLocationid), organizerId, organizerEmail)
+		id, _, participant := createParticipant(i, tools.PickRandom(locationId, virtualLocationid), organizerEmail, organizerId)
 		participants[id] = participant
 	}
 	return participants, organizerEmail
 }
 
-func createParticipant(i int, locationId string, organizerEmail string, organizerId string) (string, string, map[string]any) {
+func createParticipant(i int, locationId string, organizerEmail string, organizerId string) (string, string, models.Participant) {
 	participantId := id()
 	person := gofakeit.Person()
 	roles := RegularRoles
@@ -312,46 +275,44 @@ func createParticipant(i int, locationId string, organizerEmail string, organize
 		organizerEmail = person.Contact.Email
 		organizerId = participantId
 	}
-	m := map[string]any{
-		"@type":       "Participant",
-		"name":        person.FirstName + " " + person.LastName,
-		"email":       person.Contact.Email,
-		"description": person.Job.Title,
-		"sendTo": map[string]string{
+	p := models.Participant{
+		Name:        person.FirstName + " " + person.LastName,
+		Email:       person.Contact.Email,
+		Description: person.Job.Title,
+		SendTo: map[string]string{
 			"imip": "mailto:" + person.Contact.Email,
 		},
-		"kind":                 "individual",
-		"roles":                roles,
-		"locationId":           locationId,
-		"language":             tools.PickLanguage(),
-		"participationStatus":  status,
-		"participationComment": statusComment,
-		"expectReply":          true,
-		"scheduleAgent":        "server",
-		"scheduleSequence":     1,
-		"scheduleStatus":       []string{"1.0"},
-		"scheduleUpdated":      "2025-10-01T1:59:12Z",
-		"sentBy":               organizerEmail,
-		"invitedBy":            organizerId,
-		"scheduleId":           "mailto:" + person.Contact.Email,
+		Kind:                 "individual",
+		Roles:                roles,
+		LocationId:           locationId,
+		Language:             tools.PickLanguage(),
+		ParticipationStatus:  status,
+		ParticipationComment: statusComment,
+		ExpectReply:          true,
+		ScheduleAgent:        "server",
+		ScheduleSequence:     1,
+		ScheduleStatus:       []string{"1.0"},
+		ScheduleUpdated:      "2025-10-01T01:59:12Z",
+		SentBy:               organizerEmail,
+		InvitedBy:            organizerId,
+		ScheduleId:           "mailto:" + person.Contact.Email,
 	}
 
-	links := map[string]map[string]any{}
+	links := map[string]models.Link{}
 	for range rand.IntN(3) {
-		links[id()] = map[string]any{
-			"@type":       "Link",
-			"href":        "https://picsum.photos/id/" + strconv.Itoa(1+rand.IntN(200)) + "/200/300",
-			"contentType": "image/jpeg",
-			"rel":         "icon",
-			"display":     "badge",
-			"title":       person.FirstName + "'s Cake Day pick",
+		links[id()] = models.Link{
+			Href:        "https://picsum.photos/id/" + strconv.Itoa(1+rand.IntN(200)) + "/200/300",
+			ContentType: "image/jpeg",
+			Rel:         "icon",
+			Display:     "badge",
+			Title:       person.FirstName + "'s Cake Day pick",
 		}
 	}
 	if len(links) > 0 {
-		m["links"] = links
+		p.Links = links
 	}
 
-	return participantId, person.Contact.Email, m
+	return participantId, person.Contact.Email, p
 }
 
 var Keywords = []string{
@@ -375,29 +336,91 @@ func categories() map[string]bool {
 	return tools.ToBoolMap(tools.PickRandoms(Categories...))
 }
 
-func propmap(container map[string]any, name string, min int, max int, generator func(int, string) (map[string]any, error)) error {
+// propmap generates between min and max items, keyed by random IDs, or nil when there are none.
+func propmap[T any](min int, max int, generator func(int) (T, error)) (map[string]T, error) {
 	n := min + rand.IntN(max-min+1)
 	if n < 1 {
-		return nil
+		return nil, nil
 	}
 
-	m := make(map[string]map[string]any, n)
+	m := make(map[string]T, n)
 	for i := range n {
-		id := id()
-		item, err := generator(i, id)
+		item, err := generator(i)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if item != nil {
-			m[id] = item
-		}
-	}
-	if len(m) > 0 {
-		container[name] = m
+		m[id()] = item
 	}
-	return nil
+	return m, nil
 }
 
 func picsum(w, h int) string {
 	return fmt.Sprintf("https://picsum.photos/id/%d/%d/%d", 1+rand.IntN(200), h, w)
 }
+
+// describeError renders an error for the progress output.
+// When the server rejected properties of the object, the values that we sent for them are
+// included, to diagnose schema mismatches without having to trace the JMAP traffic.
+func describeError(err error, object any) string {
+	lines := []string{err.Error()}
+	var setError *jmap.SetError
+	if errors.As(err, &setError) && object != nil && len(setError.Properties) > 0 {
+		var generic any
+		if b, err := json.Marshal(object); err == nil && json.Unmarshal(b, &generic) == nil {
+			for _, property := range setError.Properties {
+				value := "<not set>"
+				if v, ok := lookupProperty(generic, property); ok {
+					if b, err := json.Marshal(v); err == nil {
+						value = string(b)
+					}
+				}
+				lines = append(lines, fmt.Sprintf("   %s: %s", property, value))
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// lookupProperty resolves a property path as used in SetErrors, which is either a property
+// name or a JSON pointer into the object, without the leading slash.
+func lookupProperty(object any, path string) (any, bool) {
+	current := object
+	for _, token := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch c := current.(type) {
+		case map[string]any:
+			v, ok := c[token]
+			if !ok {
+				return nil, false
+			}
+			current = v
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, false
+			}
+			current = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// reportEmptied prints the outcome of emptying a collection before adding objects to it.
+func reportEmptied(printer func(string), result jmap.EmptyResult, err error, kind string, container string) error {
+	switch {
+	case err != nil && result.Found == 0:
+		// we could not even tell what was in there
+	case result.Found == 0:
+		printer(fmt.Sprintf("ℹ️ did not delete any %s, %s is empty", kind, container))
+	case result.Destroyed < result.Found:
+		printer(fmt.Sprintf("⚠️ deleted %d of %d %s", result.Destroyed, result.Found, kind))
+	default:
+		printer(fmt.Sprintf("🗑️ deleted %d %s", result.Destroyed, kind))
+	}
+	if err != nil {
+		printer(fmt.Sprintf("❌ failed to empty the %s: %s", container, describeError(err, nil)))
+	}
+	return err
+}
@@ -0,0 +1,162 @@
+package inspect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+)
+
+// DefaultChangesTypes are the types of objects whose changes are shown unless others are
+// requested.
+var DefaultChangesTypes = []string{"Email", "Mailbox", jmap.ContactCardObjectType, jmap.EventObjectType, jmap.TaskObjectType}
+
+// states are the states of the types of objects, by account, by JMAP URL, as they are saved in
+// the state file.
+type states map[string]map[string]map[string]string
+
+func loadStates(filename string) (states, error) {
+	s := states{}
+	b, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse the state file '%s': %w", filename, err)
+	}
+	return s, nil
+}
+
+func (s states) save(filename string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(b, '\n'), 0o644)
+}
+
+func (s states) get(jmapUrl string, accountId string, objectType string) string {
+	return s[jmapUrl][accountId][objectType]
+}
+
+func (s states) set(jmapUrl string, accountId string, objectType string, state string) {
+	if s[jmapUrl] == nil {
+		s[jmapUrl] = map[string]map[string]string{}
+	}
+	if s[jmapUrl][accountId] == nil {
+		s[jmapUrl][accountId] = map[string]string{}
+	}
+	s[jmapUrl][accountId][objectType] = state
+}
+
+// Changes prints the IDs of the objects of the given types that were created, updated and
+// destroyed since the given states, by type, or since those that were saved in the state file
+// otherwise, unless its name is empty, and saves the new states to it.
+//
+// The states of the types without any earlier state are merely saved, to show the changes
+// since then next time.
+func Changes(
+	ctx context.Context,
+	jmapUrl string,
+	config jmap.Config,
+	accountId string,
+	types []string,
+	since map[string]string,
+	stateFile string,
+	maxChanges uint,
+	printer func(string),
+) error {
+	j, err := connect(ctx, jmapUrl, config)
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+
+	saved := states{}
+	if stateFile != "" {
+		if saved, err = loadStates(stateFile); err != nil {
+			return err
+		}
+	}
+
+	session := j.Session()
+	for _, objectType := range types {
+		capability, ok := jmap.ObjectTypes[objectType]
+		if !ok {
+			return fmt.Errorf("unsupported object type '%s'", objectType)
+		}
+		account := accountId
+		if account == "" {
+			account = session.PrimaryAccounts[capability]
+		}
+		if a, ok := session.Accounts[account]; !ok || !a.AccountCapabilities.Has(capability) {
+			printer(fmt.Sprintf("⏭️ skipping %s, there is no account for %s", objectType, capability))
+			continue
+		}
+
+		sinceState, ok := since[objectType]
+		if !ok {
+			sinceState = saved.get(jmapUrl, account, objectType)
+		}
+		if sinceState == "" {
+			state, err := j.State(ctx, account, objectType)
+			if err != nil {
+				return err
+			}
+			printer(fmt.Sprintf("📌 %s in account %s is in state %s", objectType, account, state))
+			saved.set(jmapUrl, account, objectType, state)
+			continue
+		}
+
+		result, err := j.Changes(ctx, account, objectType, sinceState, maxChanges)
+		var methodError *jmap.MethodError
+		if errors.As(err, &methodError) && methodError.Type == "cannotCalculateChanges" {
+			state, err := j.State(ctx, account, objectType)
+			if err != nil {
+				return err
+			}
+			printer(fmt.Sprintf("❌ %s in account %s: the server cannot tell the changes since state %s, starting over from state %s", objectType, account, sinceState, state))
+			saved.set(jmapUrl, account, objectType, state)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if result.NewState == sinceState {
+			printer(fmt.Sprintf("🔎 %s in account %s did not change since state %s", objectType, account, sinceState))
+		} else {
+			printer(fmt.Sprintf("🔎 %s in account %s changed from state %s to %s", objectType, account, sinceState, result.NewState))
+			printChanges(printer, "   ", result)
+		}
+		saved.set(jmapUrl, account, objectType, result.NewState)
+	}
+
+	if stateFile != "" {
+		return saved.save(stateFile)
+	}
+	return nil
+}
+
+// ParseSince parses the states to show the changes since, given either as a single state for a
+// single type, or as Type=state pairs.
+func ParseSince(types []string, values []string) (map[string]string, error) {
+	since := map[string]string{}
+	for _, v := range values {
+		objectType, state, ok := strings.Cut(v, "=")
+		if !ok {
+			if len(types) != 1 || len(values) != 1 {
+				return nil, fmt.Errorf("'%s' does not tell the type of objects it is the state of, use Type=state", v)
+			}
+			objectType, state = types[0], v
+		}
+		since[objectType] = state
+	}
+	return since, nil
+}
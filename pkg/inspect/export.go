@@ -0,0 +1,149 @@
+package inspect
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/models"
+	"opencloud.eu/groupware-assistant/pkg/tools"
+)
+
+var (
+	unsafeFilenameCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+	mboxFromLine             = regexp.MustCompile(`^>*From `)
+)
+
+// ExportEmails downloads the raw RFC 5322 messages of the emails with the given IDs, or of the
+// emails in the mailbox with the given ID or role, oldest first, up to limit unless it is zero,
+// and writes them as <id>.eml files to the directory dir, or to the single mbox file when its
+// name is not empty.
+//
+// The mbox file is written in the mboxrd format, with the line breaks of the messages turned
+// into the local convention of mbox files, which is LF.
+func ExportEmails(
+	ctx context.Context,
+	jmapUrl string,
+	config jmap.Config,
+	accountId string,
+	mailboxId string,
+	mailboxRole string,
+	ids []string,
+	limit uint,
+	dir string,
+	mbox string,
+	printer func(string),
+) error {
+	j, err := connect(ctx, jmapUrl, config)
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+
+	r, err := jmap.NewEmailReader(ctx, j, accountId, mailboxId, mailboxRole)
+	if err != nil {
+		return err
+	}
+
+	var w *bufio.Writer = nil
+	if mbox != "" {
+		f, err := os.Create(mbox)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = bufio.NewWriter(f)
+	} else if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	exported := 0
+	failed := 0
+	size := uint64(0)
+	for e, err := range r.Emails(ctx, ids, limit) {
+		if err != nil && e.Id == "" {
+			return err
+		}
+		if err != nil {
+			printer(fmt.Sprintf("❌ %v", err))
+			failed++
+			continue
+		}
+		message, err := r.Message(ctx, e)
+		if err != nil {
+			printer(fmt.Sprintf("❌ failed to download email %s: %v", e.Id, err))
+			failed++
+			continue
+		}
+		target := mbox
+		if w != nil {
+			err = writeMbox(w, e, message)
+		} else {
+			target = filepath.Join(dir, unsafeFilenameCharacters.ReplaceAllString(e.Id, "_")+".eml")
+			err = os.WriteFile(target, message, 0o644)
+		}
+		if err != nil {
+			return err
+		}
+		exported++
+		size += uint64(len(message))
+		printer(fmt.Sprintf("📤 exported email %s to %s (%s): %s", e.Id, target, tools.FormatBytes(uint64(len(message))), e.Subject))
+	}
+	if w != nil {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	where := "in account " + r.AccountId()
+	if r.MailboxId() != "" && len(ids) == 0 {
+		where = fmt.Sprintf("in mailbox %s of account %s", r.MailboxId(), r.AccountId())
+	}
+	summary := fmt.Sprintf("📊 exported %d emails %s, %s", exported, where, tools.FormatBytes(size))
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d failed", failed)
+	}
+	printer(summary)
+	if failed > 0 {
+		return fmt.Errorf("failed to export %d emails", failed)
+	}
+	return nil
+}
+
+// writeMbox appends a message to an mboxrd file, after a From line with the time at which the
+// email was received, and with the lines of the message that start with "From ", after any
+// number of '>', quoted by one more.
+func writeMbox(w io.Writer, e models.Email, message []byte) error {
+	received := time.Now()
+	if e.ReceivedAt != nil {
+		received = *e.ReceivedAt
+	}
+	if _, err := fmt.Fprintf(w, "From MAILER-DAEMON %s\n", received.UTC().Format(time.ANSIC)); err != nil {
+		return err
+	}
+	message = bytes.ReplaceAll(message, []byte("\r\n"), []byte("\n"))
+	for line := range bytes.Lines(message) {
+		if mboxFromLine.Match(line) {
+			if _, err := w.Write([]byte{'>'}); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+	}
+	if !bytes.HasSuffix(message, []byte("\n")) {
+		if _, err := w.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte{'\n'})
+	return err
+}
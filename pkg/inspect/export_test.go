@@ -0,0 +1,92 @@
+package inspect_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"opencloud.eu/groupware-assistant/pkg/inspect"
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/jmap/jmaptest"
+)
+
+// exportable puts two emails into the inbox of the default user, whose raw messages have CRLF
+// line breaks and lines that start with "From ", and of which the last one does not end with
+// a line break.
+func exportable(t *testing.T, s *jmaptest.Server) map[string]string {
+	t.Helper()
+	accountId := s.AccountId(jmaptest.DefaultUsername)
+	inbox := ""
+	for _, m := range s.Objects(accountId, "Mailbox") {
+		if m["role"] == "inbox" {
+			inbox = m["id"].(string)
+		}
+	}
+	messages := map[string]string{
+		"m/1:a": "From: alan@example.com\r\nSubject: Minutes\r\n\r\nFrom now on\r\n>From the minutes\r\nnothing else\r\n",
+		"m/2:b": "From: grace@example.com\r\nSubject: Agenda\r\n\r\nno line break at the end",
+	}
+	for i, id := range []string{"m/1:a", "m/2:b"} {
+		s.Put(accountId, "Email", map[string]any{
+			"id":         id,
+			"blobId":     s.PutBlob(accountId, []byte(messages[id]), "message/rfc822"),
+			"mailboxIds": map[string]any{inbox: true},
+			"subject":    "Email " + id,
+			"size":       len(messages[id]),
+			"receivedAt": []string{"2026-01-02T03:04:05Z", "2026-01-03T04:05:06Z"}[i],
+		})
+	}
+	return messages
+}
+
+func TestExportEmailsToMbox(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	config := jmap.Config{Auth: jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword}}
+	exportable(t, s)
+
+	mbox := filepath.Join(t.TempDir(), "inbox.mbox")
+	if err := inspect.ExportEmails(context.Background(), s.URL, config, "", "", "inbox", nil, 0, "", mbox, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(mbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the From lines of the bodies are quoted with one more '>' and the line breaks are LF
+	expected := "From MAILER-DAEMON Fri Jan  2 03:04:05 2026\n" +
+		"From: alan@example.com\nSubject: Minutes\n\n>From now on\n>>From the minutes\nnothing else\n\n" +
+		"From MAILER-DAEMON Sat Jan  3 04:05:06 2026\n" +
+		"From: grace@example.com\nSubject: Agenda\n\nno line break at the end\n\n"
+	if string(b) != expected {
+		t.Errorf("expected the mbox file\n%q\ngot\n%q", expected, b)
+	}
+}
+
+func TestExportEmailsToFiles(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	config := jmap.Config{Auth: jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword}}
+	messages := exportable(t, s)
+
+	dir := filepath.Join(t.TempDir(), "export")
+	if err := inspect.ExportEmails(context.Background(), s.URL, config, "", "", "", []string{"m/1:a", "m/2:b"}, 0, dir, "", func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	// the characters of the IDs that are unsafe in file names are replaced, and the messages
+	// are written as they are
+	for file, id := range map[string]string{"m_1_a.eml": "m/1:a", "m_2_b.eml": "m/2:b"} {
+		b, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(b) != messages[id] {
+			t.Errorf("expected %s to hold the message %q, got %q", file, messages[id], b)
+		}
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 2 {
+		t.Errorf("expected 2 files, got %v (%v)", entries, err)
+	}
+}
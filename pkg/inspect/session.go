@@ -0,0 +1,282 @@
+package inspect
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+)
+
+const (
+	FormatTable = "table"
+	FormatJson  = "json"
+)
+
+// CollectionTypes are the types of objects that hold the others, which are listed along with
+// their IDs and roles.
+var CollectionTypes = []string{"Mailbox", jmap.AddressBookObjectType, jmap.CalendarObjectType, jmap.TaskListsObjectType}
+
+func checkFormat(format string) error {
+	if format != FormatTable && format != FormatJson {
+		return fmt.Errorf("unsupported format '%s', use '%s' or '%s'", format, FormatTable, FormatJson)
+	}
+	return nil
+}
+
+func connect(ctx context.Context, jmapUrl string, config jmap.Config) (*jmap.Jmap, error) {
+	u, err := url.Parse(jmapUrl)
+	if err != nil {
+		return nil, err
+	}
+	return jmap.NewJmap(ctx, u, config)
+}
+
+// ShowSession prints what the session of the server tells: the username, the accounts, the
+// primary account per capability, the capabilities of the server and of every account along
+// with their limits, and the URLs.
+func ShowSession(ctx context.Context, jmapUrl string, config jmap.Config, format string, printer func(string)) error {
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	j, err := connect(ctx, jmapUrl, config)
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+	session := j.Session()
+
+	if format == FormatJson {
+		return printJson(printer, session)
+	}
+
+	printer(fmt.Sprintf("👤 username: %s", session.Username))
+	printer(fmt.Sprintf("🏷️ state:    %s", session.State))
+	printer("")
+	printer("🔗 URLs")
+	printTable(printer, []string{"ENDPOINT", "URL"}, [][]string{
+		{"api", session.ApiUrl},
+		{"download", session.DownloadUrl},
+		{"upload", session.UploadUrl},
+		{"eventSource", session.EventSourceUrl},
+	})
+
+	printer("")
+	printer("🗂️ accounts")
+	rows := [][]string{}
+	for _, id := range slices.Sorted(maps.Keys(session.Accounts)) {
+		a := session.Accounts[id]
+		rows = append(rows, []string{id, a.Name, yesNo(a.IsPersonal), yesNo(a.IsReadOnly)})
+	}
+	printTable(printer, []string{"ACCOUNT", "NAME", "PERSONAL", "READ-ONLY"}, rows)
+
+	printer("")
+	printer("⭐ primary accounts")
+	rows = [][]string{}
+	for _, capability := range slices.Sorted(maps.Keys(session.PrimaryAccounts)) {
+		rows = append(rows, []string{capability, session.PrimaryAccounts[capability]})
+	}
+	printTable(printer, []string{"CAPABILITY", "ACCOUNT"}, rows)
+
+	printer("")
+	printer("⚙️ server capabilities")
+	printTable(printer, []string{"CAPABILITY", "PROPERTY", "VALUE"}, capabilityRows(session.Capabilities))
+
+	for _, id := range slices.Sorted(maps.Keys(session.Accounts)) {
+		printer("")
+		printer(fmt.Sprintf("⚙️ capabilities of account %s", id))
+		printTable(printer, []string{"CAPABILITY", "PROPERTY", "VALUE"}, capabilityRows(session.Accounts[id].AccountCapabilities))
+	}
+	return nil
+}
+
+// capabilityRows lists the properties of every capability, with their values as JSON unless
+// they are strings, and a capability without properties on a row of its own.
+func capabilityRows(capabilities jmap.Capabilities) [][]string {
+	rows := [][]string{}
+	for _, uri := range slices.Sorted(maps.Keys(capabilities)) {
+		properties := map[string]any{}
+		if err := json.Unmarshal(capabilities[uri], &properties); err != nil || len(properties) == 0 {
+			rows = append(rows, []string{uri, "-", ""})
+			continue
+		}
+		for _, name := range slices.Sorted(maps.Keys(properties)) {
+			rows = append(rows, []string{uri, name, jsonValue(properties[name])})
+			uri = ""
+		}
+	}
+	return rows
+}
+
+// collections are the collections of one type in an account, as they are printed as JSON.
+type collections struct {
+	Type      string           `json:"type"`
+	AccountId string           `json:"accountId"`
+	List      []map[string]any `json:"list"`
+}
+
+// ShowCollections prints the mailboxes, address books, calendars and task lists, or those of
+// the given types, of the given account, or of the primary account for each of them when it
+// is empty, with their IDs and roles, and mailboxes as a tree.
+func ShowCollections(ctx context.Context, jmapUrl string, config jmap.Config, accountId string, types []string, format string, printer func(string)) error {
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	j, err := connect(ctx, jmapUrl, config)
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+	session := j.Session()
+
+	result := []collections{}
+	for _, objectType := range types {
+		capability, ok := jmap.ObjectTypes[objectType]
+		if !ok || !slices.Contains(CollectionTypes, objectType) {
+			return fmt.Errorf("unsupported collection type '%s'", objectType)
+		}
+		account := accountId
+		if account == "" {
+			account = session.PrimaryAccounts[capability]
+		}
+		if a, ok := session.Accounts[account]; !ok || !a.AccountCapabilities.Has(capability) {
+			if format == FormatTable {
+				printer(fmt.Sprintf("⏭️ skipping %s, there is no account for %s", objectType, capability))
+			}
+			continue
+		}
+		list, err := j.Objects(ctx, account, objectType)
+		if err != nil {
+			return err
+		}
+		result = append(result, collections{Type: objectType, AccountId: account, List: tree(list)})
+	}
+
+	if format == FormatJson {
+		return printJson(printer, result)
+	}
+	for i, c := range result {
+		if i > 0 {
+			printer("")
+		}
+		printer(fmt.Sprintf("📂 %s in account %s", c.Type, c.AccountId))
+		rows := [][]string{}
+		for _, object := range c.List {
+			role := stringProperty(object, "role")
+			if role == "" && object["isDefault"] == true {
+				role = "(default)"
+			}
+			indent := strings.Repeat("  ", depth(c.List, object))
+			rows = append(rows, []string{stringProperty(object, "id"), indent + stringProperty(object, "name"), role})
+		}
+		printTable(printer, []string{"ID", "NAME", "ROLE"}, rows)
+	}
+	return nil
+}
+
+// tree orders collections by their sortOrder and name, with their children, as given by their
+// parentId, right after them.
+func tree(list []map[string]any) []map[string]any {
+	byId := map[string]bool{}
+	for _, object := range list {
+		byId[stringProperty(object, "id")] = true
+	}
+	children := map[string][]map[string]any{}
+	for _, object := range list {
+		parentId := stringProperty(object, "parentId")
+		if !byId[parentId] {
+			parentId = ""
+		}
+		children[parentId] = append(children[parentId], object)
+	}
+	result := make([]map[string]any, 0, len(list))
+	var walk func(parentId string)
+	walk = func(parentId string) {
+		siblings := children[parentId]
+		slices.SortStableFunc(siblings, func(a, b map[string]any) int {
+			sa, _ := a["sortOrder"].(float64)
+			sb, _ := b["sortOrder"].(float64)
+			return cmp.Or(cmp.Compare(sa, sb), strings.Compare(stringProperty(a, "name"), stringProperty(b, "name")))
+		})
+		for _, object := range siblings {
+			result = append(result, object)
+			walk(stringProperty(object, "id"))
+		}
+	}
+	walk("")
+	return result
+}
+
+// depth counts the ancestors of a collection that are in the list.
+func depth(list []map[string]any, object map[string]any) int {
+	parents := map[string]string{}
+	for _, o := range list {
+		parents[stringProperty(o, "id")] = stringProperty(o, "parentId")
+	}
+	d := 0
+	for id := parents[stringProperty(object, "id")]; id != "" && d < len(list); id = parents[id] {
+		if _, ok := parents[id]; !ok {
+			break
+		}
+		d++
+	}
+	return d
+}
+
+func stringProperty(object map[string]any, name string) string {
+	if s, ok := object[name].(string); ok {
+		return s
+	}
+	return ""
+}
+
+func jsonValue(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func printJson(printer func(string), v any) error {
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+	e.SetIndent("", "  ")
+	if err := e.Encode(v); err != nil {
+		return err
+	}
+	printer(strings.TrimSuffix(buf.String(), "\n"))
+	return nil
+}
+
+// printTable prints rows in aligned columns under a header.
+func printTable(printer func(string), header []string, rows [][]string) {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		printer(strings.TrimRight(line, " "))
+	}
+}
@@ -0,0 +1,123 @@
+package inspect_test
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"opencloud.eu/groupware-assistant/pkg/inspect"
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/jmap/jmaptest"
+)
+
+// sharing returns a server on which the account of grace is shared with the default user.
+func sharing(t *testing.T) (*jmaptest.Server, string) {
+	t.Helper()
+	s := jmaptest.NewServer()
+	t.Cleanup(s.Close)
+	grace := s.AddUser("grace", "secret")
+	s.Share(grace, jmaptest.DefaultUsername)
+	return s, grace
+}
+
+func TestShowSessionAsTable(t *testing.T) {
+	s, grace := sharing(t)
+	config := jmap.Config{Auth: jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword}}
+	alan := s.AccountId(jmaptest.DefaultUsername)
+
+	lines := []string{}
+	if err := inspect.ShowSession(context.Background(), s.URL, config, inspect.FormatTable, func(line string) { lines = append(lines, line) }); err != nil {
+		t.Fatal(err)
+	}
+	// the accounts are sorted by their IDs, and the properties of the capabilities by name,
+	// in aligned columns
+	for _, expected := range [][]string{
+		{
+			"👤 username: alan",
+			"🏷️ state:    0",
+			"",
+			"🔗 URLs",
+			"ENDPOINT     URL",
+			"api          " + s.URL + "/api",
+			"download     " + s.URL + "/download/{accountId}/{blobId}/{name}?accept={type}",
+			"upload       " + s.URL + "/upload/{accountId}/",
+			"eventSource  " + s.URL + "/eventsource?types={types}&closeafter={closeafter}&ping={ping}",
+			"",
+			"🗂️ accounts",
+			"ACCOUNT  NAME   PERSONAL  READ-ONLY",
+			alan + "       alan   yes       no",
+			grace + "       grace  no        no",
+			"",
+			"⭐ primary accounts",
+			"CAPABILITY                       ACCOUNT",
+			"urn:ietf:params:jmap:calendars   " + alan,
+		},
+		{
+			"⚙️ server capabilities",
+			"CAPABILITY                       PROPERTY               VALUE",
+			"urn:ietf:params:jmap:calendars   -",
+			"urn:ietf:params:jmap:contacts    -",
+			`urn:ietf:params:jmap:core        collationAlgorithms    ["i;ascii-casemap"]`,
+			"                                 maxCallsInRequest      16",
+		},
+		{
+			"⚙️ capabilities of account " + grace,
+			"CAPABILITY                       PROPERTY                    VALUE",
+			"urn:ietf:params:jmap:calendars   maxCalendarsPerEvent        null",
+		},
+	} {
+		i := slices.Index(lines, expected[0])
+		if i < 0 || i+len(expected) > len(lines) || !slices.Equal(lines[i:i+len(expected)], expected) {
+			t.Errorf("expected the lines\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+		}
+	}
+	if !slices.Contains(lines, "⚙️ capabilities of account "+alan) {
+		t.Errorf("expected the capabilities of account %s, got\n%s", alan, strings.Join(lines, "\n"))
+	}
+}
+
+func TestShowSessionAsJson(t *testing.T) {
+	s, grace := sharing(t)
+	config := jmap.Config{Auth: jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword}}
+	alan := s.AccountId(jmaptest.DefaultUsername)
+
+	lines := []string{}
+	if err := inspect.ShowSession(context.Background(), s.URL, config, inspect.FormatJson, func(line string) { lines = append(lines, line) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 {
+		t.Fatalf("expected the session to be printed at once, got %d lines", len(lines))
+	}
+	var session jmap.Session
+	if err := json.Unmarshal([]byte(lines[0]), &session); err != nil {
+		t.Fatalf("expected the session as JSON, got %v: %s", err, lines[0])
+	}
+	if session.Username != jmaptest.DefaultUsername || session.ApiUrl != s.URL+"/api" {
+		t.Errorf("expected the session of %s, got %+v", jmaptest.DefaultUsername, session)
+	}
+	if len(session.Accounts) != 2 || !session.Accounts[alan].IsPersonal || session.Accounts[grace].IsPersonal {
+		t.Errorf("expected the personal and the shared account, got %+v", session.Accounts)
+	}
+	if session.PrimaryAccounts[jmap.JmapMail] != alan {
+		t.Errorf("expected %s to be the primary mail account, got %v", alan, session.PrimaryAccounts)
+	}
+	// the URL templates are not escaped for HTML
+	if !strings.Contains(lines[0], "&closeafter=") {
+		t.Errorf("expected the eventSourceUrl as it is, got %s", lines[0])
+	}
+}
+
+func TestShowSessionUnsupportedFormat(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	config := jmap.Config{Auth: jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword}}
+
+	if err := inspect.ShowSession(context.Background(), s.URL, config, "yaml", func(string) {}); err == nil {
+		t.Error("expected the format to be rejected")
+	}
+	if n := s.Requests(); n != 0 {
+		t.Errorf("expected no requests, got %d", n)
+	}
+}
@@ -0,0 +1,122 @@
+// Package inspect shows what is on the JMAP server and what changes on it, as opposed to the
+// generator package, which populates it.
+package inspect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+)
+
+// Watch prints the StateChange events that the server pushes for the given types of objects, or
+// for all of them when there are none, in the given account, or in all the accounts of the
+// session when it is empty.
+//
+// With changes set, the IDs of the objects that were created, updated and destroyed are fetched
+// with /changes and printed as well, for the types that support it.
+func Watch(
+	ctx context.Context,
+	jmapUrl string,
+	config jmap.Config,
+	accountId string,
+	types []string,
+	ping uint,
+	closeAfterState bool,
+	changes bool,
+	printer func(string),
+) error {
+	j, err := connect(ctx, jmapUrl, config)
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+
+	session := j.Session()
+	if accountId != "" {
+		if _, ok := session.Accounts[accountId]; !ok {
+			return fmt.Errorf("account ID '%s' does not exist in session", accountId)
+		}
+	}
+	watched := func(account string, objectType string) bool {
+		return (accountId == "" || account == accountId) && (len(types) == 0 || slices.Contains(types, objectType))
+	}
+
+	// the states from which to fetch the changes, by type, by account
+	states := map[string]map[string]string{}
+	if changes {
+		for account, a := range session.Accounts {
+			states[account] = map[string]string{}
+			for objectType, capability := range jmap.ObjectTypes {
+				if !watched(account, objectType) || !a.AccountCapabilities.Has(capability) {
+					continue
+				}
+				state, err := j.State(ctx, account, objectType)
+				if err != nil {
+					return err
+				}
+				states[account][objectType] = state
+			}
+		}
+	}
+
+	what := "all types"
+	if len(types) > 0 {
+		what = strings.Join(types, ", ")
+	}
+	eventSourceUrl, _, _ := strings.Cut(session.EventSourceUrl, "?")
+	printer(fmt.Sprintf("📡 watching %s for changes of %s", eventSourceUrl, what))
+
+	err = j.Watch(ctx, types, ping, closeAfterState, func(change jmap.StateChange) error {
+		now := time.Now().Format(time.TimeOnly)
+		for _, account := range slices.Sorted(maps.Keys(change.Changed)) {
+			for _, objectType := range slices.Sorted(maps.Keys(change.Changed[account])) {
+				if !watched(account, objectType) {
+					continue
+				}
+				state := change.Changed[account][objectType]
+				printer(fmt.Sprintf("🔔 %s %s changed in account %s, now in state %s", now, objectType, account, state))
+
+				since, ok := states[account][objectType]
+				if !changes || !ok || since == state {
+					continue
+				}
+				result, err := j.Changes(ctx, account, objectType, since, 0)
+				if err != nil {
+					// most likely, the server cannot tell the changes since that state anymore
+					printer(fmt.Sprintf("   ❌ %v", err))
+					states[account][objectType] = state
+					continue
+				}
+				printChanges(printer, "   ", result)
+				states[account][objectType] = result.NewState
+			}
+		}
+		return nil
+	}, func() {
+		printer(fmt.Sprintf("💓 %s ping", time.Now().Format(time.TimeOnly)))
+	})
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		// interrupting is how watching is meant to end
+		printer(fmt.Sprintf("📴 %s stopped watching", time.Now().Format(time.TimeOnly)))
+		return nil
+	}
+	return err
+}
+
+func printChanges(printer func(string), indent string, changes jmap.ChangesResponse) {
+	if len(changes.Created) > 0 {
+		printer(fmt.Sprintf("%s➕ created:   %s", indent, strings.Join(changes.Created, " ")))
+	}
+	if len(changes.Updated) > 0 {
+		printer(fmt.Sprintf("%s✏️ updated:   %s", indent, strings.Join(changes.Updated, " ")))
+	}
+	if len(changes.Destroyed) > 0 {
+		printer(fmt.Sprintf("%s🗑️ destroyed: %s", indent, strings.Join(changes.Destroyed, " ")))
+	}
+}
@@ -0,0 +1,46 @@
+package inspect_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"opencloud.eu/groupware-assistant/pkg/inspect"
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/jmap/jmaptest"
+)
+
+func TestWatchEndsWhenInterrupted(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	config := jmap.Config{Auth: jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword}}
+
+	var m sync.Mutex
+	lines := []string{}
+	printer := func(text string) {
+		m.Lock()
+		defer m.Unlock()
+		lines = append(lines, text)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- inspect.Watch(ctx, s.URL, config, "", nil, 0, false, false, printer)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for s.EventSources() < 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expected an interrupted watch to end without an error, got %v", err)
+	}
+	m.Lock()
+	defer m.Unlock()
+	if last := lines[len(lines)-1]; !strings.HasPrefix(last, "📴") {
+		t.Errorf("expected the watch to tell that it stopped, got %v", lines)
+	}
+}
@@ -0,0 +1,231 @@
+package jmap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authenticator adds credentials to the HTTP requests that are sent to the JMAP server, which
+// it may have to obtain first, as long as the given context is not done.
+type Authenticator interface {
+	Authenticate(ctx context.Context, h *http.Client, req *http.Request) error
+}
+
+// refresher is implemented by Authenticators whose credentials may be renewed
+// when the server rejects them, as it did those of the given request.
+type refresher interface {
+	Refresh(ctx context.Context, h *http.Client, rejected *http.Request) error
+}
+
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a BasicAuth) Authenticate(_ context.Context, _ *http.Client, req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+type BearerToken struct {
+	Token string
+}
+
+func (a BearerToken) Authenticate(_ context.Context, _ *http.Client, req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	return nil
+}
+
+const (
+	OAuth2ClientCredentialsGrant = "client_credentials"
+	OAuth2PasswordGrant          = "password"
+
+	// how long before its expiry an access token is renewed
+	oauth2ExpiryMargin = 30 * time.Second
+	// how long to wait for the token endpoint
+	oauth2Timeout = 30 * time.Second
+)
+
+// OAuth2 obtains access tokens from an OAuth2 token endpoint, using either the client
+// credentials or the resource owner password grant, and renews them before they expire.
+type OAuth2 struct {
+	TokenUrl     string
+	Grant        string
+	ClientId     string
+	ClientSecret string
+	Username     string
+	Password     string
+	Scopes       []string
+
+	m            sync.Mutex
+	accessToken  string
+	refreshToken string
+	expiry       time.Time
+	// the renewal of the access token that is in progress, if any
+	renewing *renewal
+}
+
+// renewal is a renewal of the access token by one of the requests, which the others wait for.
+type renewal struct {
+	done chan struct{}
+	err  error
+}
+
+type oauth2TokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int    `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (a *OAuth2) Authenticate(ctx context.Context, h *http.Client, req *http.Request) error {
+	token, err := a.current(ctx, h, "")
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (a *OAuth2) Refresh(ctx context.Context, h *http.Client, rejected *http.Request) error {
+	token := strings.TrimPrefix(rejected.Header.Get("Authorization"), "Bearer ")
+	_, err := a.current(ctx, h, token)
+	return err
+}
+
+// current returns the access token, which is renewed first when there is none, when it is
+// about to expire, or when it is the rejected one.
+//
+// Only one request renews it at a time, without holding the mutex meanwhile, while the others
+// wait for it as long as their context is not done.
+func (a *OAuth2) current(ctx context.Context, h *http.Client, rejected string) (string, error) {
+	for {
+		a.m.Lock()
+		if r := a.renewing; r != nil {
+			a.m.Unlock()
+			select {
+			case <-r.done:
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+			if r.err != nil {
+				return "", r.err
+			}
+			continue
+		}
+		expired := !a.expiry.IsZero() && time.Now().Add(oauth2ExpiryMargin).After(a.expiry)
+		if a.accessToken != "" && !expired && a.accessToken != rejected {
+			token := a.accessToken
+			a.m.Unlock()
+			return token, nil
+		}
+		r := &renewal{done: make(chan struct{})}
+		a.renewing = r
+		refreshToken := a.refreshToken
+		a.m.Unlock()
+
+		renewCtx, cancel := context.WithTimeout(ctx, oauth2Timeout)
+		t, refreshed, err := a.renew(renewCtx, h, refreshToken)
+		cancel()
+
+		a.m.Lock()
+		if err == nil {
+			a.accessToken = t.AccessToken
+			if t.RefreshToken != "" {
+				a.refreshToken = t.RefreshToken
+			} else if !refreshed {
+				a.refreshToken = ""
+			}
+			if t.ExpiresIn > 0 {
+				a.expiry = time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+			} else {
+				a.expiry = time.Time{}
+			}
+		}
+		r.err = err
+		a.renewing = nil
+		close(r.done)
+		token := a.accessToken
+		a.m.Unlock()
+		return token, err
+	}
+}
+
+// renew uses the refresh token if we have one, and falls back to performing the
+// configured grant again when there is none or when it has been rejected, and tells
+// whether the refresh token was used.
+func (a *OAuth2) renew(ctx context.Context, h *http.Client, refreshToken string) (oauth2TokenResponse, bool, error) {
+	if refreshToken != "" {
+		t, err := a.token(ctx, h, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refreshToken},
+		})
+		if err == nil {
+			return t, true, nil
+		}
+	}
+
+	form := url.Values{}
+	switch a.Grant {
+	case "", OAuth2ClientCredentialsGrant:
+		form.Set("grant_type", OAuth2ClientCredentialsGrant)
+	case OAuth2PasswordGrant:
+		form.Set("grant_type", OAuth2PasswordGrant)
+		form.Set("username", a.Username)
+		form.Set("password", a.Password)
+	default:
+		return oauth2TokenResponse{}, false, fmt.Errorf("unsupported OAuth2 grant type '%s'", a.Grant)
+	}
+	if len(a.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.Scopes, " "))
+	}
+	t, err := a.token(ctx, h, form)
+	return t, false, err
+}
+
+func (a *OAuth2) token(ctx context.Context, h *http.Client, form url.Values) (oauth2TokenResponse, error) {
+	form.Set("client_id", a.ClientId)
+	if a.ClientSecret != "" {
+		form.Set("client_secret", a.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.TokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return oauth2TokenResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := h.Do(req)
+	if err != nil {
+		return oauth2TokenResponse{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return oauth2TokenResponse{}, err
+	}
+
+	var t oauth2TokenResponse
+	if err := json.Unmarshal(body, &t); err != nil {
+		return oauth2TokenResponse{}, fmt.Errorf("failed to parse OAuth2 token response (status %s): %w", resp.Status, err)
+	}
+	if resp.StatusCode >= 300 || t.Error != "" {
+		return oauth2TokenResponse{}, fmt.Errorf("OAuth2 token request failed with status %s: %s %s", resp.Status, t.Error, t.ErrorDescription)
+	}
+	if t.AccessToken == "" {
+		return oauth2TokenResponse{}, fmt.Errorf("OAuth2 token response does not contain an access token")
+	}
+	if t.TokenType != "" && !strings.EqualFold(t.TokenType, "bearer") {
+		return oauth2TokenResponse{}, fmt.Errorf("unsupported OAuth2 token type '%s'", t.TokenType)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,208 @@
+package jmap_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/jmap/jmaptest"
+)
+
+// connect returns a client of the server that authenticates with the given method.
+func connect(t *testing.T, s *jmaptest.Server, auth jmap.Authenticator) *jmap.Jmap {
+	t.Helper()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := jmap.NewJmap(context.Background(), u, jmap.Config{Auth: auth})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+	return j
+}
+
+// mailboxes sends a Mailbox/get request for the account of the default user.
+func mailboxes(ctx context.Context, j *jmap.Jmap, s *jmaptest.Server) error {
+	req := jmap.NewRequest(jmap.JmapMail)
+	req.Call("Mailbox/get", jmap.GetArgs{AccountId: s.AccountId(jmaptest.DefaultUsername), Ids: []string{}})
+	_, err := j.Send(ctx, req)
+	return err
+}
+
+func TestOAuth2PasswordGrant(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.AddClient("assistant", "", "")
+
+	j := connect(t, s, &jmap.OAuth2{
+		TokenUrl: s.TokenUrl(),
+		Grant:    jmap.OAuth2PasswordGrant,
+		ClientId: "assistant",
+		Username: jmaptest.DefaultUsername,
+		Password: jmaptest.DefaultPassword,
+	})
+	if err := mailboxes(context.Background(), j, s); err != nil {
+		t.Fatal(err)
+	}
+	if grants := s.Grants(); !slices.Equal(grants, []string{jmap.OAuth2PasswordGrant}) {
+		t.Errorf("expected a single password grant, got %v", grants)
+	}
+}
+
+func TestOAuth2PasswordGrantWrongPassword(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.AddClient("assistant", "", "")
+
+	u, _ := url.Parse(s.URL)
+	_, err := jmap.NewJmap(context.Background(), u, jmap.Config{Auth: &jmap.OAuth2{
+		TokenUrl: s.TokenUrl(),
+		Grant:    jmap.OAuth2PasswordGrant,
+		ClientId: "assistant",
+		Username: jmaptest.DefaultUsername,
+		Password: "wrong",
+	}})
+	if err == nil {
+		t.Fatal("expected the session to fail with a wrong password")
+	}
+}
+
+func TestOAuth2ClientCredentialsGrant(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.AddClient("assistant", "s3cret", jmaptest.DefaultUsername)
+
+	j := connect(t, s, &jmap.OAuth2{
+		TokenUrl:     s.TokenUrl(),
+		Grant:        jmap.OAuth2ClientCredentialsGrant,
+		ClientId:     "assistant",
+		ClientSecret: "s3cret",
+	})
+	if err := mailboxes(context.Background(), j, s); err != nil {
+		t.Fatal(err)
+	}
+	if grants := s.Grants(); !slices.Equal(grants, []string{jmap.OAuth2ClientCredentialsGrant}) {
+		t.Errorf("expected a single client credentials grant, got %v", grants)
+	}
+
+	// without a refresh token, the client credentials are used again once the token expired
+	s.ExpireTokens()
+	if err := mailboxes(context.Background(), j, s); err != nil {
+		t.Fatal(err)
+	}
+	if grants := s.Grants(); !slices.Equal(grants, []string{jmap.OAuth2ClientCredentialsGrant, jmap.OAuth2ClientCredentialsGrant}) {
+		t.Errorf("expected a second client credentials grant, got %v", grants)
+	}
+}
+
+func TestOAuth2RefreshAfterUnauthorized(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.AddClient("assistant", "", "")
+
+	j := connect(t, s, &jmap.OAuth2{
+		TokenUrl: s.TokenUrl(),
+		Grant:    jmap.OAuth2PasswordGrant,
+		ClientId: "assistant",
+		Username: jmaptest.DefaultUsername,
+		Password: jmaptest.DefaultPassword,
+	})
+	s.ExpireTokens()
+	requests := s.Requests()
+	if err := mailboxes(context.Background(), j, s); err != nil {
+		t.Fatal(err)
+	}
+	if grants := s.Grants(); !slices.Equal(grants, []string{jmap.OAuth2PasswordGrant, "refresh_token"}) {
+		t.Errorf("expected the token to be refreshed after the 401, got %v", grants)
+	}
+	// the rejected request and the one that is sent again with the refreshed token
+	if n := s.Requests() - requests; n != 2 {
+		t.Errorf("expected 2 API requests, got %d", n)
+	}
+}
+
+func TestOAuth2RefreshBeforeExpiry(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.AddClient("assistant", "", "")
+	// shorter than the margin within which the tokens are renewed ahead of their expiry
+	s.TokenLifetime = 10 * time.Second
+
+	j := connect(t, s, &jmap.OAuth2{
+		TokenUrl: s.TokenUrl(),
+		Grant:    jmap.OAuth2PasswordGrant,
+		ClientId: "assistant",
+		Username: jmaptest.DefaultUsername,
+		Password: jmaptest.DefaultPassword,
+	})
+	if err := mailboxes(context.Background(), j, s); err != nil {
+		t.Fatal(err)
+	}
+	if grants := s.Grants(); len(grants) != 2 || grants[1] != "refresh_token" {
+		t.Errorf("expected the expired token to be refreshed, got %v", grants)
+	}
+}
+
+func TestOAuth2ConcurrentRequestsRenewOnce(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.AddClient("assistant", "", jmaptest.DefaultUsername)
+
+	j := connect(t, s, &jmap.OAuth2{
+		TokenUrl: s.TokenUrl(),
+		ClientId: "assistant",
+	})
+	s.ExpireTokens()
+	s.TokenDelay = 100 * time.Millisecond
+
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = mailboxes(context.Background(), j, s)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the grant of the connection, and a single one for all the requests that were rejected
+	if grants := s.Grants(); len(grants) != 2 {
+		t.Errorf("expected the token to be renewed once, got %v", grants)
+	}
+}
+
+func TestOAuth2RenewalIsCancelled(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.AddClient("assistant", "", jmaptest.DefaultUsername)
+
+	j := connect(t, s, &jmap.OAuth2{
+		TokenUrl: s.TokenUrl(),
+		ClientId: "assistant",
+	})
+	s.ExpireTokens()
+	s.TokenDelay = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	err := mailboxes(ctx, j, s)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the renewal to be cancelled with the context, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Errorf("expected the renewal to stop with the context, took %v", elapsed)
+	}
+}
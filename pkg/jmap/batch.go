@@ -0,0 +1,213 @@
+package jmap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const (
+	// used when the server does not advertise maxObjectsInSet in its core capabilities
+	DefaultMaxObjectsInSet = 50
+
+	// room that is left for the request envelope and creation IDs when filling a batch up
+	// to the maxSizeRequest of the server
+	requestOverhead = 1024
+)
+
+// creation is an object that has been queued for creation, together with the
+// closure to invoke with its outcome once the batch it is part of has been sent.
+type creation struct {
+	id     string
+	object any
+	done   func(id string, err error) error
+}
+
+// creations marshals into the "create" map of a /set method call, preserving
+// the order in which the objects were queued, as servers process them in that order.
+type creations []creation
+
+func (c creations) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, e := range c {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(e.id)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(e.object)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// batch queues objects of a given type and creates them with as few /set calls as possible,
+// or /import calls for a batch of emails to import.
+type batch struct {
+	j          *Jmap
+	accountId  string
+	objectType string
+	scope      string
+	method     string
+	size       int
+	next       uint
+	pending    creations
+	bytes      int
+	// the IDs of the objects that were created by earlier requests, by their creation ID
+	created map[string]string
+}
+
+func newBatch(j *Jmap, accountId string, objectType string, scope string) *batch {
+	return &batch{
+		j:          j,
+		accountId:  accountId,
+		objectType: objectType,
+		scope:      scope,
+		method:     "set",
+		size:       j.chunkSize(),
+		next:       0,
+		pending:    creations{},
+		bytes:      0,
+		created:    map[string]string{},
+	}
+}
+
+// newImportBatch creates a batch that imports messages that were uploaded already with
+// Email/import, for which the objects to queue are EmailImport ones.
+func newImportBatch(j *Jmap, accountId string) *batch {
+	b := newBatch(j, accountId, "Email", JmapMail)
+	b.method = "import"
+	return b
+}
+
+// add queues an object for creation, and sends the batch when it is full, which is when it
+// holds maxObjectsInSet objects or when adding another one would exceed maxSizeRequest.
+//
+// The done closure is called with the ID that was assigned by the server, or with the
+// error that prevented the object from being created, which is that of the whole request
+// when it failed, or that the object alone exceeds maxSizeRequest.
+// When done returns an error, the results of the other objects of that batch are still
+// passed on to their closures, and the errors are returned together.
+func (b *batch) add(ctx context.Context, object any, done func(id string, err error) error) error {
+	return b.addResolved(ctx, func(map[string]string) any { return object }, done)
+}
+
+// reference returns "#" followed by the creation ID of the next object that is added, by
+// which the objects that are added after it may refer to it.
+func (b *batch) reference() string {
+	return "#c" + strconv.FormatUint(uint64(b.next), 10)
+}
+
+// addResolved adds the object that resolve returns, which is given the IDs of the objects
+// that were created already by their creation ID, as those refer to objects of the same
+// request only. Objects that are in the batch still are referred to with their reference.
+func (b *batch) addResolved(ctx context.Context, resolve func(created map[string]string) any, done func(id string, err error) error) error {
+	id := "c" + strconv.FormatUint(uint64(b.next), 10)
+	b.next++
+	raw, err := json.Marshal(resolve(b.created))
+	if err != nil {
+		return err
+	}
+	// one that would not fit into a request of its own fails by itself
+	if b.j.exceedsMaxSizeRequest(len(raw)) {
+		return done("", fmt.Errorf("the %v has %d bytes, the server accepts requests of at most %d bytes (maxSizeRequest)", b.objectType, len(raw), b.j.core.MaxSizeRequest))
+	}
+	if len(b.pending) > 0 && b.j.exceedsMaxSizeRequest(b.bytes+len(raw)) {
+		if err := b.flush(ctx); err != nil {
+			return err
+		}
+		// the objects it refers to may have been created by now
+		if raw, err = json.Marshal(resolve(b.created)); err != nil {
+			return err
+		}
+	}
+
+	b.pending = append(b.pending, creation{
+		id:     id,
+		object: json.RawMessage(raw),
+		done:   done,
+	})
+	b.bytes += len(raw)
+	if len(b.pending) >= b.size {
+		return b.flush(ctx)
+	}
+	return nil
+}
+
+// exceedsMaxSizeRequest tells whether a request with objects of the given size in total would
+// exceed the maxSizeRequest of the server, leaving room for the request envelope.
+func (j *Jmap) exceedsMaxSizeRequest(size int) bool {
+	limit := int(j.core.MaxSizeRequest)
+	return limit > 0 && size+requestOverhead > limit
+}
+
+// flush sends all the objects that are currently queued.
+func (b *batch) flush(ctx context.Context) error {
+	if len(b.pending) < 1 {
+		return nil
+	}
+	pending := b.pending
+	b.pending = creations{}
+	b.bytes = 0
+
+	req := NewRequest(b.scope)
+	var args any = SetArgs{
+		AccountId: b.accountId,
+		Create:    pending,
+	}
+	if b.method == "import" {
+		args = ImportArgs{
+			AccountId: b.accountId,
+			Emails:    pending,
+		}
+	}
+	set := req.Call(b.objectType+"/"+b.method, args)
+	var r SetResponse
+	resp, err := b.j.Send(ctx, req)
+	if err == nil {
+		err = resp.Get(set, &r)
+	}
+	if err != nil {
+		// every object of the request failed along with it
+		errs := []error{err}
+		for _, c := range pending {
+			if e := c.done("", err); e != nil && e != err {
+				errs = append(errs, e)
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	errs := []error{}
+	for _, c := range pending {
+		id := ""
+		var err error = nil
+		if obj, ok := r.Created[c.id]; ok {
+			id, _ = obj["id"].(string)
+		} else if e, ok := r.NotCreated[c.id]; ok {
+			err = setError(e, b.objectType, SetOperationCreate, c.id)
+		}
+		if id == "" && err == nil {
+			err = fmt.Errorf("failed to create %v", b.objectType)
+		}
+		if id != "" {
+			b.created[c.id] = id
+		}
+		if err := c.done(id, err); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,243 @@
+package jmap_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/jmap/jmaptest"
+	"opencloud.eu/groupware-assistant/pkg/models"
+)
+
+// basic returns a client of the server that authenticates as the default user.
+func basic(t *testing.T, s *jmaptest.Server) *jmap.Jmap {
+	return connect(t, s, jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword})
+}
+
+// contactSender returns a sender of contacts to the default address book of the default user.
+func contactSender(t *testing.T, j *jmap.Jmap) *jmap.ContactSender {
+	t.Helper()
+	s, err := jmap.NewContactSender(context.Background(), j, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func contact(name string) models.ContactCard {
+	return models.ContactCard{Name: &models.Name{Full: name}}
+}
+
+func TestBatchSplitsByMaxObjectsInSet(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.Core.MaxObjectsInSet = 3
+	j := basic(t, s)
+	sender := contactSender(t, j)
+
+	ctx := context.Background()
+	requests := s.Requests()
+	ids := []string{}
+	for i := range 7 {
+		err := sender.QueueContact(ctx, contact(strings.Repeat("x", i+1)), func(id string, err error) error {
+			if err != nil {
+				t.Errorf("contact %d: %v", i, err)
+			}
+			ids = append(ids, id)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := s.Requests() - requests; n != 2 {
+		t.Errorf("expected the 2 full batches to be sent before flushing, got %d requests", n)
+	}
+	if err := sender.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Requests() - requests; n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+
+	// the IDs are passed on in the order in which the contacts were queued
+	created := []string{}
+	for _, c := range s.Objects(s.AccountId(jmaptest.DefaultUsername), jmap.ContactCardObjectType) {
+		created = append(created, c["id"].(string))
+	}
+	if !slices.Equal(ids, created) {
+		t.Errorf("expected the IDs %v, got %v", created, ids)
+	}
+}
+
+func TestBatchSplitsByMaxSizeRequest(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	// room for the request overhead and two of the contacts below, but not three
+	s.Core.MaxSizeRequest = 5000
+	j := basic(t, s)
+	sender := contactSender(t, j)
+
+	ctx := context.Background()
+	requests := s.Requests()
+	for range 5 {
+		err := sender.QueueContact(ctx, contact(strings.Repeat("x", 1500)), func(id string, err error) error {
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sender.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Requests() - requests; n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+	if n := len(s.Objects(s.AccountId(jmaptest.DefaultUsername), jmap.ContactCardObjectType)); n != 5 {
+		t.Errorf("expected 5 contacts, got %d", n)
+	}
+}
+
+func TestBatchPassesEveryResultOn(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.Reject(jmap.ContactCardObjectType, jmap.SetOperationCreate, func(id string, object map[string]any) *jmap.SetError {
+		if id == "c1" {
+			return &jmap.SetError{Type: "invalidProperties", Properties: []string{"name"}}
+		}
+		return nil
+	})
+	j := basic(t, s)
+	sender := contactSender(t, j)
+
+	ctx := context.Background()
+	results := map[int]error{}
+	failed := errors.New("failed")
+	for i := range 3 {
+		err := sender.QueueContact(ctx, contact("Alan"), func(id string, err error) error {
+			results[i] = err
+			if err != nil || i == 2 {
+				return failed
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := sender.Flush(ctx)
+	if !errors.Is(err, failed) {
+		t.Errorf("expected the errors of the callbacks, got %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected all 3 callbacks to be called, got %d", len(results))
+	}
+	var setError *jmap.SetError
+	if !errors.As(results[1], &setError) || setError.Type != "invalidProperties" {
+		t.Errorf("expected the rejection of the second contact, got %v", results[1])
+	}
+	if results[0] != nil || results[2] != nil {
+		t.Errorf("expected the other contacts to be created, got %v and %v", results[0], results[2])
+	}
+}
+
+func TestBatchPassesRequestErrorOn(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	j := basic(t, s)
+	sender := contactSender(t, j)
+
+	ctx := context.Background()
+	results := map[int]error{}
+	for i := range 3 {
+		err := sender.QueueContact(ctx, contact("Alan"), func(id string, err error) error {
+			results[i] = err
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.FailHTTP(1, http.StatusForbidden, "")
+	var failed *jmap.HttpError
+	if err := sender.Flush(ctx); !errors.As(err, &failed) {
+		t.Errorf("expected the error of the request, got %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected all 3 callbacks to be called, got %d", len(results))
+	}
+	for i, err := range results {
+		if !errors.As(err, &failed) {
+			t.Errorf("expected contact %d to fail with the request, got %v", i, err)
+		}
+	}
+}
+
+func TestBatchRejectsObjectExceedingMaxSizeRequest(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.Core.MaxSizeRequest = 5000
+	j := basic(t, s)
+	sender := contactSender(t, j)
+
+	ctx := context.Background()
+	results := map[int]error{}
+	for i, name := range []string{"Alan", strings.Repeat("x", 5000), "Grace"} {
+		err := sender.QueueContact(ctx, contact(name), func(id string, err error) error {
+			results[i] = err
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sender.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if results[1] == nil || !strings.Contains(results[1].Error(), "maxSizeRequest") {
+		t.Errorf("expected the large contact to fail by itself, got %v", results[1])
+	}
+	if results[0] != nil || results[2] != nil {
+		t.Errorf("expected the other contacts to be created, got %v and %v", results[0], results[2])
+	}
+	if n := len(s.Objects(s.AccountId(jmaptest.DefaultUsername), jmap.ContactCardObjectType)); n != 2 {
+		t.Errorf("expected 2 contacts, got %d", n)
+	}
+}
+
+func TestRequestResultReference(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	j := basic(t, s)
+	accountId := s.AccountId(jmaptest.DefaultUsername)
+
+	req := jmap.NewRequest(jmap.JmapMail)
+	query := req.Call("Mailbox/query", jmap.QueryArgs{AccountId: accountId})
+	ids := query.Ref("/ids")
+	get := req.Call("Mailbox/get", jmap.GetArgs{AccountId: accountId, IdsRef: &ids})
+	resp, err := j.Send(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var q jmap.QueryResponse
+	if err := resp.Get(query, &q); err != nil {
+		t.Fatal(err)
+	}
+	var g jmap.GetResponse[map[string]any]
+	if err := resp.Get(get, &g); err != nil {
+		t.Fatal(err)
+	}
+	if len(q.Ids) < 1 || len(g.List) != len(q.Ids) {
+		t.Fatalf("expected the %d mailboxes of the query, got %d", len(q.Ids), len(g.List))
+	}
+	for i, m := range g.List {
+		if m["id"] != q.Ids[i] {
+			t.Errorf("expected mailbox %s, got %v", q.Ids[i], m["id"])
+		}
+	}
+}
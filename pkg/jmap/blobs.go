@@ -0,0 +1,165 @@
+package jmap
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// BlobCache remembers the blobs that were uploaded by the SHA-256 of their content, per
+// account, so that identical attachments are only uploaded once.
+//
+// It may be shared by several clients through their Config, in which case a blob that is
+// missing from one account may be copied from another one with Blob/copy, provided that the
+// client has access to both and that Config.CopyBlobs is set.
+type BlobCache struct {
+	m     sync.Mutex
+	blobs map[blobKey]*cachedBlob
+}
+
+type blobKey struct {
+	hash      [sha256.Size]byte
+	accountId string
+}
+
+type cachedBlob struct {
+	// closed once the blob was uploaded or copied, or failed to
+	ready  chan struct{}
+	blobId string
+	err    error
+}
+
+func NewBlobCache() *BlobCache {
+	return &BlobCache{blobs: map[blobKey]*cachedBlob{}}
+}
+
+// claim returns the entry for the blob, along with whether the caller created it and is hence
+// expected to upload the blob and to resolve the entry.
+func (c *BlobCache) claim(key blobKey) (*cachedBlob, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if b, ok := c.blobs[key]; ok {
+		return b, false
+	}
+	b := &cachedBlob{ready: make(chan struct{})}
+	c.blobs[key] = b
+	return b, true
+}
+
+// resolve completes the entry of a blob, which is dropped when it failed, to upload it again
+// next time.
+func (c *BlobCache) resolve(key blobKey, b *cachedBlob, blobId string, err error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	b.blobId = blobId
+	b.err = err
+	if err != nil {
+		delete(c.blobs, key)
+	}
+	close(b.ready)
+}
+
+// source returns an account among the given ones that has the blob with the given hash
+// already, along with its ID in that account.
+func (c *BlobCache) source(hash [sha256.Size]byte, accountIds func(string) bool) (string, string, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	for key, b := range c.blobs {
+		if key.hash != hash || !accountIds(key.accountId) {
+			continue
+		}
+		select {
+		case <-b.ready:
+			if b.err == nil {
+				return key.accountId, b.blobId, true
+			}
+		default:
+		}
+	}
+	return "", "", false
+}
+
+// blob returns the ID of a blob with the given content in the account, which is only uploaded
+// when neither this client nor any other one sharing the BlobCache did so before.
+func (j *Jmap) blob(ctx context.Context, accountId string, content Content, mimetype string) (string, error) {
+	hash, err := content.hash()
+	if err != nil {
+		return "", err
+	}
+	key := blobKey{hash: hash, accountId: accountId}
+	b, owner := j.blobs.claim(key)
+	if !owner {
+		select {
+		case <-b.ready:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		if b.err != nil {
+			return "", b.err
+		}
+		j.reusedBlobs.Add(1)
+		j.savedBytes.Add(uint64(content.Size))
+		return b.blobId, nil
+	}
+
+	// Blob/copy is optional, and the blob is uploaded instead whenever it fails
+	if j.copyBlobs {
+		blobId, err := j.copyBlob(ctx, key.hash, accountId)
+		if err != nil {
+			log.Printf("%v, uploading it instead", err)
+		} else if blobId != "" {
+			j.reusedBlobs.Add(1)
+			j.savedBytes.Add(uint64(content.Size))
+			j.blobs.resolve(key, b, blobId, nil)
+			return blobId, nil
+		}
+	}
+
+	upload, err := j.uploadBlob(ctx, accountId, content, mimetype)
+	j.blobs.resolve(key, b, upload.BlobId, err)
+	return upload.BlobId, err
+}
+
+// copyBlob copies the blob with the given hash from another account of the session that has
+// it already, and returns its ID in the account, or an empty one when there is no such
+// account.
+func (j *Jmap) copyBlob(ctx context.Context, hash [sha256.Size]byte, accountId string) (string, error) {
+	fromAccountId, fromBlobId, ok := j.blobs.source(hash, func(id string) bool {
+		_, ok := j.session.Accounts[id]
+		return ok && id != accountId
+	})
+	if !ok {
+		return "", nil
+	}
+
+	r := NewRequest()
+	c := r.Call("Blob/copy", map[string]any{
+		"fromAccountId": fromAccountId,
+		"accountId":     accountId,
+		"blobIds":       []string{fromBlobId},
+	})
+	response, err := j.Send(ctx, r)
+	if err != nil {
+		return "", fmt.Errorf("failed to copy blob '%s' from account '%s': %w", fromBlobId, fromAccountId, err)
+	}
+	var result struct {
+		Copied    map[string]string   `json:"copied"`
+		NotCopied map[string]SetError `json:"notCopied"`
+	}
+	if err := response.Get(c, &result); err != nil {
+		return "", fmt.Errorf("failed to copy blob '%s' from account '%s': %w", fromBlobId, fromAccountId, err)
+	}
+	// e.g. because it was deleted in the meantime
+	if e, ok := result.NotCopied[fromBlobId]; ok {
+		return "", fmt.Errorf("failed to copy blob '%s' from account '%s': %w", fromBlobId, fromAccountId, &e)
+	}
+	return result.Copied[fromBlobId], nil
+}
+
+// ReusedBlobs returns how many blobs were not uploaded because the same content was uploaded
+// before, along with the number of bytes that this saved.
+func (j *Jmap) ReusedBlobs() (uint, uint64) {
+	return uint(j.reusedBlobs.Load()), j.savedBytes.Load()
+}
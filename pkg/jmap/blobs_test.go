@@ -0,0 +1,143 @@
+package jmap_test
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/jmap/jmaptest"
+)
+
+// copying returns a client of the server that authenticates as the default user, and that
+// copies blobs from other accounts with Blob/copy.
+func copying(t *testing.T, s *jmaptest.Server) *jmap.Jmap {
+	t.Helper()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := jmap.NewJmap(context.Background(), u, jmap.Config{
+		Auth:      jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword},
+		CopyBlobs: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+	return j
+}
+
+// attaching prepares an email of the given account with the given attachment, which uploads it.
+func attaching(t *testing.T, j *jmap.Jmap, accountId string, data []byte) error {
+	t.Helper()
+	sender, err := jmap.NewEmailSender(context.Background(), j, accountId, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := sender.NewEmail()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Subject("Report")
+	e.Text("See the attachment.")
+	e.Attach(jmap.Bytes(data), "text/plain", "report.txt")
+	return sender.Prepare(context.Background(), e)
+}
+
+func TestBlobReusedByContent(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	j := basic(t, s)
+	accountId := s.AccountId(jmaptest.DefaultUsername)
+
+	for _, data := range []string{"first", "second", "first", "first"} {
+		if err := attaching(t, j, accountId, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := s.Uploads(); n != 2 {
+		t.Errorf("expected the 2 distinct blobs to be uploaded, got %d uploads", n)
+	}
+	if reused, saved := j.ReusedBlobs(); reused != 2 || saved != 10 {
+		t.Errorf("expected 2 blobs of 10 bytes to be reused, got %d of %d bytes", reused, saved)
+	}
+}
+
+func TestBlobWaitsForUploadInFlight(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.UploadDelay = 200 * time.Millisecond
+	j := basic(t, s)
+	accountId := s.AccountId(jmaptest.DefaultUsername)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- attaching(t, j, accountId, []byte("report"))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	// the others waited for the first upload rather than uploading the blob as well
+	if n := s.Uploads(); n != 1 {
+		t.Errorf("expected 1 upload, got %d", n)
+	}
+	if reused, _ := j.ReusedBlobs(); reused != 3 {
+		t.Errorf("expected the blob to be reused 3 times, got %d", reused)
+	}
+}
+
+func TestBlobCopiedFromOtherAccount(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	shared := s.AddUser("grace", "secret")
+	s.Share(shared, jmaptest.DefaultUsername)
+	j := copying(t, s)
+
+	if err := attaching(t, j, s.AccountId(jmaptest.DefaultUsername), []byte("report")); err != nil {
+		t.Fatal(err)
+	}
+	if err := attaching(t, j, shared, []byte("report")); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Uploads(); n != 1 {
+		t.Errorf("expected the blob to be copied rather than uploaded again, got %d uploads", n)
+	}
+	if reused, _ := j.ReusedBlobs(); reused != 1 {
+		t.Errorf("expected the blob to be reused once, got %d", reused)
+	}
+}
+
+func TestBlobUploadedWhenCopyFails(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	shared := s.AddUser("grace", "secret")
+	s.Share(shared, jmaptest.DefaultUsername)
+	j := copying(t, s)
+
+	if err := attaching(t, j, s.AccountId(jmaptest.DefaultUsername), []byte("report")); err != nil {
+		t.Fatal(err)
+	}
+	// as for a server that does not implement the optional Blob/copy
+	s.FailMethod("Blob/copy", 1, "unknownMethod", "")
+	if err := attaching(t, j, shared, []byte("report")); err != nil {
+		t.Fatalf("expected the blob to be uploaded instead, got %v", err)
+	}
+	if n := s.Uploads(); n != 2 {
+		t.Errorf("expected the blob to be uploaded again, got %d uploads", n)
+	}
+	if reused, _ := j.ReusedBlobs(); reused != 0 {
+		t.Errorf("expected no blob to be reused, got %d", reused)
+	}
+}
@@ -0,0 +1,133 @@
+package jmap
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// ObjectTypes are the types of objects that support /changes, along with the capability that
+// their methods require.
+var ObjectTypes = map[string]string{
+	"Mailbox":             JmapMail,
+	"Email":               JmapMail,
+	"Thread":              JmapMail,
+	AddressBookObjectType: JmapContacts,
+	ContactCardObjectType: JmapContacts,
+	CalendarObjectType:    JmapCalendars,
+	EventObjectType:       JmapCalendars,
+	TaskListsObjectType:   JmapTasks,
+	TaskObjectType:        JmapTasks,
+}
+
+type ChangesArgs struct {
+	AccountId  string `json:"accountId"`
+	SinceState string `json:"sinceState"`
+	MaxChanges uint   `json:"maxChanges,omitempty"`
+}
+
+// ChangesResponse is the response to a /changes call as per RFC 8620 section 5.2.
+type ChangesResponse struct {
+	AccountId      string   `json:"accountId"`
+	OldState       string   `json:"oldState"`
+	NewState       string   `json:"newState"`
+	HasMoreChanges bool     `json:"hasMoreChanges"`
+	Created        []string `json:"created"`
+	Updated        []string `json:"updated"`
+	Destroyed      []string `json:"destroyed"`
+}
+
+// merge adds the changes of the next page, of an object that was created and destroyed in the
+// meantime to neither.
+func (c *ChangesResponse) merge(next ChangesResponse) {
+	c.NewState = next.NewState
+	c.HasMoreChanges = next.HasMoreChanges
+	for _, id := range next.Created {
+		if !slices.Contains(c.Created, id) {
+			c.Created = append(c.Created, id)
+		}
+	}
+	for _, id := range next.Updated {
+		if !slices.Contains(c.Created, id) && !slices.Contains(c.Updated, id) {
+			c.Updated = append(c.Updated, id)
+		}
+	}
+	for _, id := range next.Destroyed {
+		if i := slices.Index(c.Created, id); i >= 0 {
+			c.Created = slices.Delete(c.Created, i, i+1)
+			continue
+		}
+		if i := slices.Index(c.Updated, id); i >= 0 {
+			c.Updated = slices.Delete(c.Updated, i, i+1)
+		}
+		c.Destroyed = append(c.Destroyed, id)
+	}
+}
+
+// State returns the current state of the objects of the given type in the account, to fetch
+// the changes since then later on.
+func (j *Jmap) State(ctx context.Context, accountId string, objectType string) (string, error) {
+	capability, ok := ObjectTypes[objectType]
+	if !ok {
+		return "", fmt.Errorf("unsupported object type '%s'", objectType)
+	}
+	req := NewRequest(capability)
+	get := req.Call(objectType+"/get", GetArgs{AccountId: accountId, Ids: []string{}})
+	resp, err := j.Send(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	var r GetResponse[map[string]any]
+	if err := resp.Get(get, &r); err != nil {
+		return "", err
+	}
+	return r.State, nil
+}
+
+// Objects fetches all the objects of the given type in the account, with all their properties,
+// which is meant for collections such as mailboxes and calendars rather than their contents.
+func (j *Jmap) Objects(ctx context.Context, accountId string, objectType string) ([]map[string]any, error) {
+	capability, ok := ObjectTypes[objectType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported object type '%s'", objectType)
+	}
+	req := NewRequest(capability)
+	get := req.Call(objectType+"/get", GetArgs{AccountId: accountId})
+	resp, err := j.Send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var r GetResponse[map[string]any]
+	if err := resp.Get(get, &r); err != nil {
+		return nil, err
+	}
+	return r.List, nil
+}
+
+// Changes fetches the IDs of the objects of the given type that were created, updated or
+// destroyed in the account since the given state, in pages of up to maxChanges unless it is
+// zero, until there are no more changes.
+func (j *Jmap) Changes(ctx context.Context, accountId string, objectType string, sinceState string, maxChanges uint) (ChangesResponse, error) {
+	capability, ok := ObjectTypes[objectType]
+	if !ok {
+		return ChangesResponse{}, fmt.Errorf("unsupported object type '%s'", objectType)
+	}
+	result := ChangesResponse{AccountId: accountId, OldState: sinceState, NewState: sinceState, HasMoreChanges: true}
+	for result.HasMoreChanges {
+		req := NewRequest(capability)
+		changes := req.Call(objectType+"/changes", ChangesArgs{AccountId: accountId, SinceState: result.NewState, MaxChanges: maxChanges})
+		resp, err := j.Send(ctx, req)
+		if err != nil {
+			return result, err
+		}
+		var page ChangesResponse
+		if err := resp.Get(changes, &page); err != nil {
+			return result, err
+		}
+		if page.HasMoreChanges && page.NewState == result.NewState {
+			return result, fmt.Errorf("%s/changes has more changes but stays in state '%s'", objectType, page.NewState)
+		}
+		result.merge(page)
+	}
+	return result, nil
+}
@@ -0,0 +1,173 @@
+package jmap_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/jmap/jmaptest"
+)
+
+// mailboxSet updates and destroys mailboxes with Mailbox/set.
+func mailboxSet(t *testing.T, j *jmap.Jmap, accountId string, update map[string]any, destroy []string) {
+	t.Helper()
+	req := jmap.NewRequest(jmap.JmapMail)
+	set := req.Call("Mailbox/set", jmap.SetArgs{AccountId: accountId, Update: update, Destroy: destroy})
+	resp, err := j.Send(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r jmap.SetResponse
+	if err := resp.Get(set, &r); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Updated) != len(update) || len(r.Destroyed) != len(destroy) {
+		t.Fatalf("expected the mailboxes to be updated and destroyed, got %+v", r)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		maxChanges uint
+		// changes the mailboxes A, B and C, of which C exists beforehand, and returns the
+		// expected created, updated and destroyed ones
+		change   func(t *testing.T, s *jmaptest.Server, j *jmap.Jmap, accountId string, ids map[string]string) (created, updated, destroyed []string)
+		requests int
+	}{
+		{
+			name: "in one page",
+			change: func(t *testing.T, s *jmaptest.Server, j *jmap.Jmap, accountId string, ids map[string]string) ([]string, []string, []string) {
+				ids["A"] = s.Put(accountId, "Mailbox", map[string]any{"name": "A"})
+				ids["B"] = s.Put(accountId, "Mailbox", map[string]any{"name": "B"})
+				mailboxSet(t, j, accountId, map[string]any{ids["C"]: map[string]any{"name": "C2"}}, nil)
+				return []string{"A", "B"}, []string{"C"}, []string{}
+			},
+			requests: 1,
+		},
+		{
+			name:       "across pages",
+			maxChanges: 1,
+			change: func(t *testing.T, s *jmaptest.Server, j *jmap.Jmap, accountId string, ids map[string]string) ([]string, []string, []string) {
+				ids["A"] = s.Put(accountId, "Mailbox", map[string]any{"name": "A"})
+				ids["B"] = s.Put(accountId, "Mailbox", map[string]any{"name": "B"})
+				mailboxSet(t, j, accountId, map[string]any{ids["C"]: map[string]any{"name": "C2"}}, nil)
+				return []string{"A", "B"}, []string{"C"}, []string{}
+			},
+			requests: 3,
+		},
+		{
+			name:       "created and destroyed on different pages",
+			maxChanges: 1,
+			change: func(t *testing.T, s *jmaptest.Server, j *jmap.Jmap, accountId string, ids map[string]string) ([]string, []string, []string) {
+				ids["A"] = s.Put(accountId, "Mailbox", map[string]any{"name": "A"})
+				ids["B"] = s.Put(accountId, "Mailbox", map[string]any{"name": "B"})
+				mailboxSet(t, j, accountId, nil, []string{ids["A"]})
+				return []string{"B"}, []string{}, []string{}
+			},
+			requests: 3,
+		},
+		{
+			name:       "updated and destroyed on different pages",
+			maxChanges: 1,
+			change: func(t *testing.T, s *jmaptest.Server, j *jmap.Jmap, accountId string, ids map[string]string) ([]string, []string, []string) {
+				mailboxSet(t, j, accountId, map[string]any{ids["C"]: map[string]any{"name": "C2"}}, nil)
+				ids["A"] = s.Put(accountId, "Mailbox", map[string]any{"name": "A"})
+				mailboxSet(t, j, accountId, nil, []string{ids["C"]})
+				return []string{"A"}, []string{}, []string{"C"}
+			},
+			requests: 3,
+		},
+		{
+			name:       "no changes",
+			maxChanges: 1,
+			change: func(t *testing.T, s *jmaptest.Server, j *jmap.Jmap, accountId string, ids map[string]string) ([]string, []string, []string) {
+				return []string{}, []string{}, []string{}
+			},
+			requests: 1,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			s := jmaptest.NewServer()
+			defer s.Close()
+			j := basic(t, s)
+			accountId := s.AccountId(jmaptest.DefaultUsername)
+			ids := map[string]string{"C": s.Put(accountId, "Mailbox", map[string]any{"name": "C"})}
+
+			state, err := j.State(context.Background(), accountId, "Mailbox")
+			if err != nil {
+				t.Fatal(err)
+			}
+			created, updated, destroyed := c.change(t, s, j, accountId, ids)
+			newState, err := j.State(context.Background(), accountId, "Mailbox")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			requests := s.Requests()
+			changes, err := j.Changes(context.Background(), accountId, "Mailbox", state, c.maxChanges)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := s.Requests() - requests; n != c.requests {
+				t.Errorf("expected %d pages, got %d", c.requests, n)
+			}
+			if changes.OldState != state || changes.NewState != newState || changes.HasMoreChanges {
+				t.Errorf("expected the changes from state %s to %s, got %+v", state, newState, changes)
+			}
+			for _, expected := range []struct {
+				what  string
+				names []string
+				ids   []string
+			}{
+				{"created", created, changes.Created},
+				{"updated", updated, changes.Updated},
+				{"destroyed", destroyed, changes.Destroyed},
+			} {
+				want := []string{}
+				for _, name := range expected.names {
+					want = append(want, ids[name])
+				}
+				if !slices.Equal(expected.ids, want) {
+					t.Errorf("expected %v to be %s, got %v", expected.names, expected.what, expected.ids)
+				}
+			}
+		})
+	}
+}
+
+func TestChangesStuckInState(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	j := basic(t, s)
+	accountId := s.AccountId(jmaptest.DefaultUsername)
+	state, err := j.State(context.Background(), accountId, "Mailbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put(accountId, "Mailbox", map[string]any{"name": "A"})
+
+	// a server that claims to have more changes without moving on would be asked forever
+	s.Respond("Mailbox/changes", 1, map[string]any{
+		"accountId":      accountId,
+		"oldState":       state,
+		"newState":       state,
+		"hasMoreChanges": true,
+		"created":        []string{},
+		"updated":        []string{},
+		"destroyed":      []string{},
+	})
+	if _, err := j.Changes(context.Background(), accountId, "Mailbox", state, 1); err == nil {
+		t.Error("expected the changes that stay in the same state to be rejected")
+	}
+}
+
+func TestChangesUnsupportedType(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	j := basic(t, s)
+	if _, err := j.Changes(context.Background(), s.AccountId(jmaptest.DefaultUsername), "Identity", "0", 0); err == nil {
+		t.Error("expected the changes of a type without /changes to be rejected")
+	}
+}
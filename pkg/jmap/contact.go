@@ -1,7 +1,10 @@
 package jmap
 
 import (
+	"context"
 	"fmt"
+
+	"opencloud.eu/groupware-assistant/pkg/models"
 )
 
 var AddressBookObjectType = "AddressBook"
@@ -11,26 +14,20 @@ type ContactSender struct {
 	j             *Jmap
 	accountId     string
 	addressbookId string
+	batch         *batch
 }
 
 func (s *ContactSender) AddressBook() string {
 	return s.addressbookId
 }
 
-func NewContactSender(j *Jmap, accountId string, addressbookId string) (*ContactSender, error) {
-	if accountId == "" {
-		// use default mail account
-		accountId = j.session.PrimaryAccounts.Contacts
-		if accountId == "" {
-			return nil, fmt.Errorf("session has no matching primary account")
-		}
-	} else {
-		if _, ok := j.session.Accounts[accountId]; !ok {
-			return nil, fmt.Errorf("account ID '%s' does not exist in session", accountId)
-		}
+func NewContactSender(ctx context.Context, j *Jmap, accountId string, addressbookId string) (*ContactSender, error) {
+	accountId, err := j.account(accountId, JmapContacts)
+	if err != nil {
+		return nil, err
 	}
 
-	addressbooksById, err := objectsById(j, accountId, AddressBookObjectType, JmapContacts)
+	addressbooksById, err := objectsById(ctx, j, accountId, AddressBookObjectType, JmapContacts)
 	if err != nil {
 		return nil, err
 	}
@@ -56,6 +53,7 @@ func NewContactSender(j *Jmap, accountId string, addressbookId string) (*Contact
 		j:             j,
 		accountId:     accountId,
 		addressbookId: addressbookId,
+		batch:         newBatch(j, accountId, ContactCardObjectType, JmapContacts),
 	}, nil
 }
 
@@ -63,31 +61,22 @@ func (s *ContactSender) Close() error {
 	return nil
 }
 
-func (s *ContactSender) EmptyContacts() (uint, error) {
-	return empty(s.j, s.accountId, ContactCardObjectType, JmapContacts, map[string]any{
+func (s *ContactSender) EmptyContacts(ctx context.Context) (EmptyResult, error) {
+	return empty(ctx, s.j, s.accountId, ContactCardObjectType, JmapContacts, map[string]any{
 		"inAddressBook": s.addressbookId,
-	}, s.destroy)
+	})
 }
 
-func (s *ContactSender) destroy(ids []string) error {
-	return destroy(s.j, s.accountId, ContactCardObjectType, JmapContacts, ids)
+// QueueContact queues the contact for creation.
+//
+// The contact is sent along with others once enough of them have been queued, or when Flush
+// is called, after which done is invoked with the ID of the created contact or with the error
+// that prevented its creation.
+func (s *ContactSender) QueueContact(ctx context.Context, c models.ContactCard, done func(id string, err error) error) error {
+	return s.batch.add(ctx, c, done)
 }
 
-func (s *ContactSender) CreateContact(c map[string]any) (string, error) {
-	body := map[string]any{
-		"using": []string{JmapCore, JmapContacts},
-		"methodCalls": []any{
-			[]any{
-				ContactCardObjectType + "/set",
-				map[string]any{
-					"accountId": s.accountId,
-					"create": map[string]any{
-						"c": c,
-					},
-				},
-				"0",
-			},
-		},
-	}
-	return create(s.j, "c", ContactCardObjectType, body)
+// Flush sends all the contacts that are currently queued.
+func (s *ContactSender) Flush(ctx context.Context) error {
+	return s.batch.flush(ctx)
 }
@@ -0,0 +1,39 @@
+package jmap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+)
+
+// Content is the content of a blob, which is only produced when it is uploaded, for large
+// attachments not to be held in memory.
+//
+// Open may be called several times, since the content is hashed before it is uploaded and
+// sent again when the upload is retried, and must yield the same Size bytes every time.
+type Content struct {
+	Size int64
+	Open func() (io.Reader, error)
+}
+
+// Bytes is the Content of a blob that is held in memory.
+func Bytes(data []byte) Content {
+	return Content{
+		Size: int64(len(data)),
+		Open: func() (io.Reader, error) { return bytes.NewReader(data), nil },
+	}
+}
+
+func (c Content) hash() ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	r, err := c.Open()
+	if err != nil {
+		return sum, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return sum, err
+	}
+	h.Sum(sum[:0])
+	return sum, nil
+}
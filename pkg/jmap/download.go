@@ -0,0 +1,32 @@
+package jmap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Download fetches the content of a blob from the downloadUrl of the session, under the given
+// name, and as the given type, or as the type that the server stored it with when it is empty.
+func (j *Jmap) Download(ctx context.Context, accountId string, blobId string, name string, mimetype string) ([]byte, error) {
+	if j.session.DownloadUrl == "" {
+		return nil, fmt.Errorf("the JMAP server does not serve blobs, its session has no downloadUrl")
+	}
+	// as per RFC 6570 simple string expansion, which does not encode a space as '+'
+	escape := func(v string) string {
+		return strings.ReplaceAll(url.QueryEscape(v), "+", "%20")
+	}
+	downloadUrl := strings.NewReplacer(
+		"{accountId}", escape(accountId),
+		"{blobId}", escape(blobId),
+		"{name}", escape(name),
+		"{type}", escape(mimetype),
+	).Replace(j.session.DownloadUrl)
+	return j.do(ctx, exchange{
+		method:     http.MethodGet,
+		url:        downloadUrl,
+		idempotent: true,
+	})
+}
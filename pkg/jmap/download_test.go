@@ -0,0 +1,56 @@
+package jmap_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/jmap/jmaptest"
+)
+
+func TestDownload(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	j, traceFile := tracing(t, s, jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword}, jmap.TraceFormatJsonl)
+	accountId := s.AccountId(jmaptest.DefaultUsername)
+	blobId := s.PutBlob(accountId, []byte("Grüße"), "application/octet-stream")
+
+	data, err := j.Download(context.Background(), accountId, blobId, "Q1 report/draft+ä.txt", "text/plain; charset=utf-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "Grüße" {
+		t.Errorf("expected the content of the blob, got %q", data)
+	}
+
+	// the variables are expanded as per RFC 6570, with spaces as %20 rather than '+', and
+	// with the reserved characters encoded
+	request, response := tracedTo(t, traced(t, j, traceFile, jmap.TraceFormatJsonl), "/download/")
+	expected := "/download/" + accountId + "/" + blobId + "/Q1%20report%2Fdraft%2B%C3%A4.txt?accept=text%2Fplain%3B%20charset%3Dutf-8"
+	if u := request["url"].(string); !strings.HasSuffix(u, expected) {
+		t.Errorf("expected the URL to end with %s, got %s", expected, u)
+	}
+	if mimetype := response["content"].(map[string]any)["mimeType"]; mimetype != "text/plain; charset=utf-8" {
+		t.Errorf("expected the blob as the requested type, got %v", mimetype)
+	}
+}
+
+func TestDownloadWithoutType(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	j, traceFile := tracing(t, s, jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword}, jmap.TraceFormatJsonl)
+	accountId := s.AccountId(jmaptest.DefaultUsername)
+	blobId := s.PutBlob(accountId, []byte("%PDF-1.7"), "application/pdf")
+
+	if _, err := j.Download(context.Background(), accountId, blobId, "report.pdf", ""); err != nil {
+		t.Fatal(err)
+	}
+	request, response := tracedTo(t, traced(t, j, traceFile, jmap.TraceFormatJsonl), "/download/")
+	if u := request["url"].(string); !strings.HasSuffix(u, "/report.pdf?accept=") {
+		t.Errorf("expected an empty type in the URL, got %s", u)
+	}
+	if mimetype := response["content"].(map[string]any)["mimeType"]; mimetype != "application/pdf" {
+		t.Errorf("expected the blob as the type it was stored with, got %v", mimetype)
+	}
+}
@@ -1,35 +1,64 @@
 package jmap
 
 import (
+	"context"
 	"fmt"
+
+	"opencloud.eu/groupware-assistant/pkg/models"
 )
 
 type EmailSender struct {
 	j         *Jmap
 	accountId string
 	mailboxId string
+	limits    MailAccountCapabilities
+	batch     *batch
+	imports   *batch
+	// the batch that the last email was queued to, as the other one has to be sent before
+	// queueing to it, for the server to thread the emails in the order they were queued
+	last *batch
 }
 
-func NewEmailSender(j *Jmap, accountId string, mailboxId string, mailboxRole string) (*EmailSender, error) {
-	if accountId == "" {
-		// use default mail account
-		accountId = j.session.PrimaryAccounts.Mail
-		if accountId == "" {
-			return nil, fmt.Errorf("session has no matching primary account")
-		}
-	} else {
-		if _, ok := j.session.Accounts[accountId]; !ok {
-			return nil, fmt.Errorf("account ID '%s' does not exist in session", accountId)
-		}
+func NewEmailSender(ctx context.Context, j *Jmap, accountId string, mailboxId string, mailboxRole string) (*EmailSender, error) {
+	accountId, err := j.account(accountId, JmapMail)
+	if err != nil {
+		return nil, err
+	}
+
+	var limits MailAccountCapabilities
+	if err := j.session.Accounts[accountId].AccountCapabilities.Decode(JmapMail, &limits); err != nil {
+		return nil, fmt.Errorf("failed to parse the mail capabilities of account '%s': %w", accountId, err)
 	}
 
-	mailboxesById, err := objectsById(j, accountId, "Mailbox", JmapMail)
+	mailboxId, err = resolveMailbox(ctx, j, accountId, mailboxId, mailboxRole)
 	if err != nil {
 		return nil, err
 	}
+
+	return &EmailSender{
+		j:         j,
+		accountId: accountId,
+		mailboxId: mailboxId,
+		limits:    limits,
+		batch:     newBatch(j, accountId, "Email", JmapMail),
+		imports:   newImportBatch(j, accountId),
+	}, nil
+}
+
+// resolveMailbox checks that the mailbox with the given ID exists and has the given role, or
+// looks up the mailbox with that role when there is no ID. Neither being given is fine, and
+// yields no mailbox.
+func resolveMailbox(ctx context.Context, j *Jmap, accountId string, mailboxId string, mailboxRole string) (string, error) {
+	if mailboxId == "" && mailboxRole == "" {
+		return "", nil
+	}
+	mailboxesById, err := objectsById(ctx, j, accountId, "Mailbox", JmapMail)
+	if err != nil {
+		return "", err
+	}
 	if mailboxId != "" {
 		if _, ok := mailboxesById[mailboxId]; !ok {
-			return nil, fmt.Errorf("mailbox with id '%s' does not exist", mailboxId)
+			return "", fmt.Errorf("mailbox with id '%s' does not exist", mailboxId)
 		}
 	}
 	if mailboxRole != "" {
@@ -45,21 +74,16 @@ func NewEmailSender(j *Jmap, accountId string, mailboxId string, mailboxRole str
 				}
 			}
 			if mailboxId == "" {
-				return nil, fmt.Errorf("there is no mailbox with role '%s'", mailboxRole)
+				return "", fmt.Errorf("there is no mailbox with role '%s'", mailboxRole)
 			}
 		} else {
 			mailbox := mailboxesById[mailboxId]
 			if mailboxRole != mailbox["role"].(string) {
-				return nil, fmt.Errorf("mailbox with id '%s' does not have role '%s' but '%v'", mailboxId, mailboxRole, mailbox["role"])
+				return "", fmt.Errorf("mailbox with id '%s' does not have role '%s' but '%v'", mailboxId, mailboxRole, mailbox["role"])
 			}
 		}
 	}
-
-	return &EmailSender{
-		j:         j,
-		accountId: accountId,
-		mailboxId: mailboxId,
-	}, nil
+	return mailboxId, nil
 }
 
 func (s *EmailSender) Close() error {
@@ -70,70 +94,154 @@ func (s *EmailSender) NewEmail() (*EmailBuilder, error) {
 	return newEmailBuilder(s.accountId, s.mailboxId)
 }
 
-func (s *EmailSender) EmptyEmails() (uint, error) {
-	return empty(s.j, s.accountId, "Email", JmapMail, map[string]any{
+func (s *EmailSender) EmptyEmails(ctx context.Context) (EmptyResult, error) {
+	return empty(ctx, s.j, s.accountId, "Email", JmapMail, map[string]any{
 		"inMailbox": s.mailboxId,
-	}, s.destroy)
+	})
 }
 
-func (s *EmailSender) destroy(ids []string) error {
-	return destroy(s.j, s.accountId, "Email", JmapMail, ids)
-}
-
-func (s *EmailSender) SendEmail(e *EmailBuilder) (string, error) {
-	bodyValues := map[string]map[string]any{}
+// Prepare uploads the attachments of the email, which may be done for several emails in
+// parallel before queueing them in order.
+func (s *EmailSender) Prepare(ctx context.Context, e *EmailBuilder) error {
+	if e.prepared {
+		return nil
+	}
+	bodyValues := map[string]models.EmailBodyValue{}
 	if e.text != "" {
-		bodyValues["t"] = map[string]any{"value": e.text}
-		e.email["textBody"] = []map[string]any{{
-			"partId": "t",
-			"type":   "text/plain",
+		bodyValues["t"] = models.EmailBodyValue{Value: e.text}
+		e.email.TextBody = []models.EmailBodyPart{{
+			PartId:   "t",
+			Type:     "text/plain",
+			Language: e.languages(),
 		}}
 	}
 	if e.html != "" {
-		bodyValues["h"] = map[string]any{"value": e.html}
-		e.email["htmlBody"] = []map[string]any{{
-			"partId": "h",
-			"type":   "text/html",
+		bodyValues["h"] = models.EmailBodyValue{Value: e.htmlBody()}
+		e.email.HtmlBody = []models.EmailBodyPart{{
+			PartId:   "h",
+			Type:     "text/html",
+			Language: e.languages(),
 		}}
 	}
 
-	attachments := []map[string]any{}
+	if err := s.checkAttachments(e); err != nil {
+		return err
+	}
+
 	for _, a := range e.attachments {
-		upload, err := s.j.uploadBlob(s.accountId, a.data, a.mime)
+		blobId, err := s.j.blob(ctx, s.accountId, a.content, a.mime)
 		if err != nil {
-			return "", err
+			return err
 		}
-		ao := map[string]any{
-			"blobId":      upload.BlobId,
-			"name":        a.filename,
-			"type":        a.mime,
-			"disposition": "attachment",
+		part := models.EmailBodyPart{
+			BlobId:      blobId,
+			Name:        a.filename,
+			Type:        a.mime,
+			Disposition: "attachment",
 		}
-		attachments = append(attachments, ao)
-	}
-	if len(attachments) > 0 {
-		e.email["attachments"] = attachments
+		if a.cid != "" {
+			part.Disposition = "inline"
+			part.Cid = a.cid
+		}
+		e.email.Attachments = append(e.email.Attachments, part)
 	}
 
 	if len(bodyValues) > 0 {
-		e.email["bodyValues"] = bodyValues
-	}
-
-	body := map[string]any{
-		"using": []string{JmapCore, JmapMail},
-		"methodCalls": []any{
-			[]any{
-				"Email/set",
-				map[string]any{
-					"accountId": s.accountId,
-					"create": map[string]any{
-						"c": e.email,
-					},
-				},
-				"0",
-			},
-		},
-	}
-
-	return create(s.j, "c", "Email", body)
+		e.email.BodyValues = bodyValues
+	}
+	e.prepared = true
+	return nil
+}
+
+func (s *EmailSender) checkAttachments(e *EmailBuilder) error {
+	if !s.j.ignoreUploadLimits && s.limits.MaxSizeAttachmentsPerEmail > 0 {
+		total := int64(0)
+		for _, a := range e.attachments {
+			total += a.content.Size
+		}
+		if uint64(total) > uint64(s.limits.MaxSizeAttachmentsPerEmail) {
+			return fmt.Errorf("the attachments of the email have %d bytes, the server accepts at most %d bytes (maxSizeAttachmentsPerEmail)", total, s.limits.MaxSizeAttachmentsPerEmail)
+		}
+	}
+	return nil
+}
+
+// QueueEmail uploads the attachments of the email unless it was prepared already, and queues
+// it for creation.
+//
+// The email is sent along with others once enough of them have been queued, or when Flush
+// is called, after which done is invoked with the ID of the created email or with the error
+// that prevented its creation.
+func (s *EmailSender) QueueEmail(ctx context.Context, e *EmailBuilder, done func(id string, err error) error) error {
+	if err := s.Prepare(ctx, e); err != nil {
+		return err
+	}
+	if err := s.switchTo(ctx, s.batch); err != nil {
+		return err
+	}
+	return s.batch.add(ctx, e.email, done)
+}
+
+// PrepareImport builds the message of the email and uploads it, which may be done for several
+// emails in parallel before queueing them in order.
+func (s *EmailSender) PrepareImport(ctx context.Context, e *EmailBuilder) error {
+	if e.blobId != "" {
+		return nil
+	}
+	if err := s.checkAttachments(e); err != nil {
+		return err
+	}
+	content, err := e.Message()
+	if err != nil {
+		return err
+	}
+	blobId, err := s.j.blob(ctx, s.accountId, content, "message/rfc822")
+	if err != nil {
+		return err
+	}
+	e.blobId = blobId
+	return nil
+}
+
+// QueueImport uploads the message of the email unless it was prepared already, and queues it
+// for Email/import, which creates the email from the exact bytes of that message rather than
+// having the server compose one from its properties.
+//
+// The email is sent along with others once enough of them have been queued, or when Flush
+// is called, after which done is invoked with the ID of the imported email or with the error
+// that prevented its import.
+func (s *EmailSender) QueueImport(ctx context.Context, e *EmailBuilder, done func(id string, err error) error) error {
+	if err := s.PrepareImport(ctx, e); err != nil {
+		return err
+	}
+	if err := s.switchTo(ctx, s.imports); err != nil {
+		return err
+	}
+	return s.imports.add(ctx, models.EmailImport{
+		BlobId:     e.blobId,
+		MailboxIds: e.email.MailboxIds,
+		Keywords:   e.email.Keywords,
+		ReceivedAt: e.email.ReceivedAt,
+	}, done)
+}
+
+// switchTo sends the emails that were queued to the other batch before queueing one to the
+// given batch, as a reply that is created before the email it replies to ends up in a thread
+// of its own.
+func (s *EmailSender) switchTo(ctx context.Context, b *batch) error {
+	if s.last != nil && s.last != b {
+		if err := s.last.flush(ctx); err != nil {
+			return err
+		}
+	}
+	s.last = b
+	return nil
+}
+
+// Flush sends all the emails that are currently queued, for creation and for import.
+func (s *EmailSender) Flush(ctx context.Context) error {
+	if err := s.batch.flush(ctx); err != nil {
+		return err
+	}
+	return s.imports.flush(ctx)
 }
@@ -1,34 +1,47 @@
 package jmap
 
 import (
+	"fmt"
+	"html"
+	"io"
 	"net/mail"
+	"strings"
 	"time"
 
+	"opencloud.eu/groupware-assistant/pkg/message"
+	"opencloud.eu/groupware-assistant/pkg/models"
 	"opencloud.eu/groupware-assistant/pkg/tools"
 )
 
 type attachment struct {
-	name     string
+	cid      string
 	mime     string
-	data     []byte
+	content  Content
 	filename string
 }
 
 type EmailBuilder struct {
 	accountId   string
 	mailboxId   string
-	email       map[string]any
+	email       models.Email
 	html        string
 	text        string
 	attachments []attachment
+	prepared    bool
+	protections []func(message.Part) (message.Part, error)
+	// the blob of the message to import, once it was uploaded
+	blobId string
+	// the language tag of the text and HTML bodies, if any
+	language string
+	rtl      bool
 }
 
 func newEmailBuilder(accountId string, mailboxId string) (*EmailBuilder, error) {
 	return &EmailBuilder{
 		accountId: accountId,
 		mailboxId: mailboxId,
-		email: map[string]any{
-			"mailboxIds": map[string]bool{
+		email: models.Email{
+			MailboxIds: map[string]bool{
 				mailboxId: true,
 			},
 		},
@@ -38,66 +51,72 @@ func newEmailBuilder(accountId string, mailboxId string) (*EmailBuilder, error)
 	}, nil
 }
 
-func (b *EmailBuilder) To(to mail.Address) {
-	b.email["to"] = []map[string]any{
-		{"name": to.Name, "email": to.Address},
+// Mailbox puts the email in another mailbox than the one of the sender.
+func (b *EmailBuilder) Mailbox(mailboxId string) {
+	b.mailboxId = mailboxId
+	b.email.MailboxIds = map[string]bool{mailboxId: true}
+}
+
+func addresses(list ...mail.Address) []models.EmailAddress {
+	result := make([]models.EmailAddress, len(list))
+	for i, a := range list {
+		result[i] = models.EmailAddress{Name: a.Name, Email: a.Address}
 	}
+	return result
+}
+
+func (b *EmailBuilder) To(to ...mail.Address) {
+	b.email.To = addresses(to...)
 }
 
 func (b *EmailBuilder) CC(cc []mail.Address) {
-	list := make([]map[string]any, len(cc))
-	for i, a := range cc {
-		list[i] = map[string]any{"name": a.Name, "email": a.Address}
-	}
-	b.email["cc"] = list
+	b.email.Cc = addresses(cc...)
 }
 
 func (b *EmailBuilder) BCC(bcc []mail.Address) {
-	list := make([]map[string]any, len(bcc))
-	for i, a := range bcc {
-		list[i] = map[string]any{"name": a.Name, "email": a.Address}
-	}
-	b.email["bcc"] = list
+	b.email.Bcc = addresses(bcc...)
 }
 
 func (b *EmailBuilder) From(from mail.Address) {
-	b.email["from"] = []map[string]any{
-		{"name": from.Name, "email": from.Address},
-	}
+	b.email.From = addresses(from)
 }
 
 func (b *EmailBuilder) Sender(sender mail.Address) {
-	b.email["sender"] = []map[string]any{
-		{"name": sender.Name, "email": sender.Address},
-	}
+	b.email.Sender = addresses(sender)
 }
 
 func (b *EmailBuilder) MessageId(id string) {
-	b.header("Message-ID", id)
+	b.email.MessageId = []string{id}
 }
 
 func (b *EmailBuilder) InReplyTo(address string) {
-	b.email["inReplyTo"] = []string{address}
+	b.email.InReplyTo = []string{address}
 }
 
 func (b *EmailBuilder) Subject(value string) {
-	b.email["subject"] = value
+	b.email.Subject = value
 }
 
-func (b *EmailBuilder) header(name string, value string) {
-	b.email["header:"+name] = value
+// Header adds a header field with the given name and raw value to the email, which may be any
+// field that has no property of its own.
+func (b *EmailBuilder) Header(name string, value string) {
+	if b.email.Headers == nil {
+		b.email.Headers = map[string]string{}
+	}
+	b.email.Headers[name] = value
 }
 
 func (b *EmailBuilder) ReturnPath(returnPath string) {
-	b.header("Return-Path", returnPath)
+	b.Header("Return-Path", returnPath)
 }
 
 func (b *EmailBuilder) Received(t time.Time) {
-	b.email["receivedAt"] = t.Format(time.RFC3339)
+	// receivedAt is a UTCDate, without fractions of seconds
+	b.email.ReceivedAt = ptr(t.UTC().Truncate(time.Second))
 }
 
 func (b *EmailBuilder) Sent(t time.Time) {
-	b.email["sentAt"] = t.Format(time.RFC3339)
+	b.email.SentAt = ptr(t.Truncate(time.Second))
 }
 
 func (b *EmailBuilder) HTML(text string) {
@@ -108,30 +127,73 @@ func (b *EmailBuilder) Text(text string) {
 	b.text = text
 }
 
-func (b *EmailBuilder) Attach(content []byte, contentType string, filename string) {
+// Language sets the language of the text and HTML bodies, and has the HTML written from right
+// to left for scripts such as Arabic and Hebrew.
+func (b *EmailBuilder) Language(tag string, rtl bool) {
+	b.language = tag
+	b.rtl = rtl
+}
+
+// languages returns the language of the bodies as the language property of a body part.
+func (b *EmailBuilder) languages() []string {
+	if b.language == "" {
+		return nil
+	}
+	return []string{b.language}
+}
+
+func (b *EmailBuilder) Attach(content Content, contentType string, filename string) {
 	b.attachments = append(b.attachments, attachment{
-		data:     content,
+		content:  content,
 		mime:     contentType,
 		filename: filename,
 	})
 }
 
-func (b *EmailBuilder) AttachInline(content []byte, contentType string, filename string, contentId string) {
+func (b *EmailBuilder) AttachInline(content Content, contentType string, filename string, contentId string) {
 	b.attachments = append(b.attachments, attachment{
-		name:     contentId,
-		data:     content,
+		cid:      contentId,
+		content:  content,
 		mime:     contentType,
 		filename: filename,
 	})
 }
 
+// htmlBody returns the HTML of the email with an image for each inline attachment that it does
+// not refer to by its content ID yet, for those to show where they are meant to.
+func (b *EmailBuilder) htmlBody() string {
+	images := ""
+	for _, a := range b.attachments {
+		if a.cid != "" && !strings.Contains(b.html, "cid:"+a.cid) {
+			images += fmt.Sprintf(`<p><img src="cid:%s" alt="%s"></p>`, html.EscapeString(a.cid), html.EscapeString(a.filename))
+		}
+	}
+	body := b.html
+	if b.language != "" {
+		dir := "ltr"
+		if b.rtl {
+			dir = "rtl"
+		}
+		body = strings.Replace(body, "<html>", fmt.Sprintf(`<html lang="%s" dir="%s">`, html.EscapeString(b.language), dir), 1)
+	}
+	if i := strings.LastIndex(body, "</body>"); i >= 0 {
+		return body[:i] + images + body[i:]
+	}
+	return body + images
+}
+
+// Protect has the body of the message wrapped by the given function, such as one that signs or
+// encrypts it, after those that were added before. This only applies to the message of an
+// email that is imported, as the server composes the others.
+func (b *EmailBuilder) Protect(f func(message.Part) (message.Part, error)) {
+	b.protections = append(b.protections, f)
+}
+
 func (b *EmailBuilder) keyword(k string) {
-	keywords, ok := b.email["keywords"].(map[string]bool)
-	if !ok {
-		keywords = map[string]bool{}
+	if b.email.Keywords == nil {
+		b.email.Keywords = map[string]bool{}
 	}
-	keywords[k] = true
-	b.email["keywords"] = keywords
+	b.email.Keywords[k] = true
 }
 
 func (b *EmailBuilder) Answered() {
@@ -165,3 +227,58 @@ func (b *EmailBuilder) Phishing() {
 func (b *EmailBuilder) Seen() {
 	b.keyword("$seen")
 }
+
+// Message returns the RFC 5322 message of the email, with the text and HTML bodies in a
+// multipart/alternative, the inline attachments in a multipart/related with the HTML that
+// refers to them, and the other attachments in a multipart/mixed.
+//
+// The message is written as it is read, for the attachments not to be held in memory unless
+// the message is signed or encrypted, which needs all of it at once.
+func (b *EmailBuilder) Message() (Content, error) {
+	texts := []message.Part{}
+	if b.text != "" {
+		texts = append(texts, message.Text("text/plain", b.text).Language(b.language))
+	}
+	htmls := []message.Part{}
+	if b.html != "" {
+		htmls = append(htmls, message.Text("text/html", b.htmlBody()).Language(b.language))
+	}
+	related := []message.Part{}
+	attachments := []message.Part{}
+	for _, a := range b.attachments {
+		open := func() (io.Reader, error) {
+			r, err := a.content.Open()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the attachment '%s': %w", a.filename, err)
+			}
+			return r, nil
+		}
+		if a.cid != "" {
+			related = append(related, message.InlineReader(a.mime, a.filename, a.cid, open))
+		} else {
+			attachments = append(attachments, message.AttachmentReader(a.mime, a.filename, open))
+		}
+	}
+	body := message.Compose(texts, htmls, related, attachments)
+	for _, protect := range b.protections {
+		var err error
+		if body, err = protect(body); err != nil {
+			return Content{}, err
+		}
+	}
+	fields := message.Fields(b.email)
+	size, err := message.Size(fields, body)
+	if err != nil {
+		return Content{}, err
+	}
+	return Content{
+		Size: size,
+		Open: func() (io.Reader, error) {
+			r, w := io.Pipe()
+			go func() {
+				w.CloseWithError(message.Write(w, fields, body))
+			}()
+			return r, nil
+		},
+	}, nil
+}
@@ -0,0 +1,136 @@
+package jmap
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"opencloud.eu/groupware-assistant/pkg/models"
+)
+
+// emailReaderProperties are the properties of the emails that are fetched to export them.
+var emailReaderProperties = []string{"id", "blobId", "size", "receivedAt", "subject", "messageId"}
+
+// EmailReader fetches emails and their raw RFC 5322 messages from an account, as opposed to the
+// EmailSender, which creates them.
+type EmailReader struct {
+	j         *Jmap
+	accountId string
+	mailboxId string
+}
+
+// NewEmailReader creates a reader for the emails in the mailbox with the given ID or role, or
+// for the emails in all the mailboxes of the account when neither is given.
+func NewEmailReader(ctx context.Context, j *Jmap, accountId string, mailboxId string, mailboxRole string) (*EmailReader, error) {
+	accountId, err := j.account(accountId, JmapMail)
+	if err != nil {
+		return nil, err
+	}
+	mailboxId, err = resolveMailbox(ctx, j, accountId, mailboxId, mailboxRole)
+	if err != nil {
+		return nil, err
+	}
+	return &EmailReader{j: j, accountId: accountId, mailboxId: mailboxId}, nil
+}
+
+func (r *EmailReader) AccountId() string {
+	return r.accountId
+}
+
+func (r *EmailReader) MailboxId() string {
+	return r.mailboxId
+}
+
+// Emails fetches the emails with the given IDs, in that order, or the emails in the mailbox,
+// oldest first, when there are none, up to limit unless it is zero.
+//
+// An ID that does not exist yields an error along with an email that only has that ID, after
+// which the iteration may go on.
+func (r *EmailReader) Emails(ctx context.Context, ids []string, limit uint) iter.Seq2[models.Email, error] {
+	return func(yield func(models.Email, error) bool) {
+		count := uint(0)
+		more := func() bool {
+			return limit == 0 || count < limit
+		}
+		// yield the emails of a page in the order of their IDs, of which the /get
+		// response might not be
+		page := func(ids []string) bool {
+			emails, notFound, err := r.get(ctx, ids)
+			if err != nil {
+				yield(models.Email{}, err)
+				return false
+			}
+			for _, id := range ids {
+				if !more() {
+					return false
+				}
+				count++
+				if e, ok := emails[id]; ok {
+					if !yield(e, nil) {
+						return false
+					}
+				} else if notFound[id] {
+					if !yield(models.Email{Id: id}, fmt.Errorf("email with id '%s' does not exist", id)) {
+						return false
+					}
+				}
+			}
+			return more()
+		}
+
+		if len(ids) > 0 {
+			size := int(r.j.pageSize())
+			for i := 0; i < len(ids); i += size {
+				if !page(ids[i:min(i+size, len(ids))]) {
+					return
+				}
+			}
+			return
+		}
+
+		var filter map[string]any = nil
+		if r.mailboxId != "" {
+			filter = map[string]any{"inMailbox": r.mailboxId}
+		}
+		sort := []Comparator{{Property: "receivedAt", IsAscending: true}}
+		for q, err := range r.j.Query(ctx, r.accountId, "Email", JmapMail, filter, sort) {
+			if err != nil {
+				yield(models.Email{}, err)
+				return
+			}
+			if !page(q.Ids) {
+				return
+			}
+		}
+	}
+}
+
+func (r *EmailReader) get(ctx context.Context, ids []string) (map[string]models.Email, map[string]bool, error) {
+	req := NewRequest(JmapMail)
+	get := req.Call("Email/get", GetArgs{AccountId: r.accountId, Ids: ids, Properties: emailReaderProperties})
+	resp, err := r.j.Send(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	var g GetResponse[models.Email]
+	if err := resp.Get(get, &g); err != nil {
+		return nil, nil, err
+	}
+	emails := make(map[string]models.Email, len(g.List))
+	for _, e := range g.List {
+		emails[e.Id] = e
+	}
+	notFound := make(map[string]bool, len(g.NotFound))
+	for _, id := range g.NotFound {
+		notFound[id] = true
+	}
+	return emails, notFound, nil
+}
+
+// Message downloads the raw RFC 5322 message of an email.
+func (r *EmailReader) Message(ctx context.Context, e models.Email) ([]byte, error) {
+	if e.BlobId == "" {
+		return nil, fmt.Errorf("email with id '%s' has no blobId", e.Id)
+	}
+	return r.j.Download(ctx, r.accountId, e.BlobId, e.Id+".eml", "message/rfc822")
+}
@@ -0,0 +1,54 @@
+package jmap_test
+
+import (
+	"context"
+	"net/mail"
+	"testing"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/jmap/jmaptest"
+)
+
+func TestEmailsCreatedInOrderAcrossSetAndImport(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	j := basic(t, s)
+	sender, err := jmap.NewEmailSender(context.Background(), j, "", "", "inbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a thread whose second message is signed, and thus imported, while the others are not
+	ctx := context.Background()
+	subjects := []string{"Lunch", "Re: Lunch", "Re: Re: Lunch"}
+	for i, subject := range subjects {
+		e, err := sender.NewEmail()
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.From(mail.Address{Name: "Alan", Address: "alan@example.com"})
+		e.To(mail.Address{Name: "Grace", Address: "grace@example.com"})
+		e.Subject(subject)
+		e.Text("See you there.")
+		queue := sender.QueueEmail
+		if i == 1 {
+			queue = sender.QueueImport
+		}
+		if err := queue(ctx, e, func(id string, err error) error { return err }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sender.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	emails := s.Objects(s.AccountId(jmaptest.DefaultUsername), "Email")
+	if len(emails) != len(subjects) {
+		t.Fatalf("expected %d emails, got %d", len(subjects), len(emails))
+	}
+	for i, e := range emails {
+		if e["subject"] != subjects[i] {
+			t.Errorf("expected email %d to be '%s', got '%v'", i, subjects[i], e["subject"])
+		}
+	}
+}
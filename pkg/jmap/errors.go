@@ -0,0 +1,129 @@
+package jmap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxErrorBody is how much of the body of a response that failed is quoted in its error.
+const maxErrorBody = 200
+
+// HttpError is returned when the server responds with an HTTP status other than 2xx, along
+// with the body of the response, which a RequestError wraps when it is a problem details
+// object.
+type HttpError struct {
+	StatusCode int
+	Status     string
+	Body       []byte
+}
+
+func (e *HttpError) Error() string {
+	msg := "JMAP HTTP response status is " + e.Status
+	body := strings.TrimSpace(string(e.Body))
+	if len(body) > maxErrorBody {
+		body = strings.ToValidUTF8(body[:maxErrorBody], "") + "…"
+	}
+	if body != "" {
+		msg += ": " + body
+	}
+	return msg
+}
+
+// RequestError is a request-level error as per RFC 8620 section 3.6.1, which the server
+// returns as an RFC 7807 problem details object when it rejects the request as a whole.
+type RequestError struct {
+	Status int    `json:"status"`
+	Type   string `json:"type"`
+	Detail string `json:"detail,omitempty"`
+	Limit  string `json:"limit,omitempty"`
+	// the response that the problem details object was taken from
+	Response *HttpError `json:"-"`
+}
+
+func (e *RequestError) Error() string {
+	msg := fmt.Sprintf("JMAP request failed with status %d: %s", e.Status, e.Type)
+	if e.Limit != "" {
+		msg += fmt.Sprintf(" (limit: %s)", e.Limit)
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+func (e *RequestError) Unwrap() error {
+	if e.Response == nil {
+		return nil
+	}
+	return e.Response
+}
+
+// MethodError is returned when the server responds to a method call with an "error"
+// response, as per RFC 8620 section 3.6.2.
+type MethodError struct {
+	Method      string   `json:"-"`
+	CallId      string   `json:"-"`
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Properties  []string `json:"properties,omitempty"`
+	Arguments   []string `json:"arguments,omitempty"`
+}
+
+func (e *MethodError) Error() string {
+	msg := fmt.Sprintf("%s failed: %s", e.Method, e.Type)
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	if len(e.Arguments) > 0 {
+		msg += " [arguments: " + strings.Join(e.Arguments, ", ") + "]"
+	}
+	if len(e.Properties) > 0 {
+		msg += " [properties: " + strings.Join(e.Properties, ", ") + "]"
+	}
+	return msg
+}
+
+const (
+	SetOperationCreate  = "create"
+	SetOperationUpdate  = "update"
+	SetOperationDestroy = "destroy"
+)
+
+// SetError describes why a single object could not be created, updated or destroyed
+// by a /set method call, as per RFC 8620 section 5.3.
+type SetError struct {
+	ObjectType  string   `json:"-"`
+	Operation   string   `json:"-"`
+	Id          string   `json:"-"`
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Properties  []string `json:"properties,omitempty"`
+	ExistingId  string   `json:"existingId,omitempty"`
+}
+
+func (e *SetError) Error() string {
+	msg := fmt.Sprintf("failed to %s %s", e.Operation, e.ObjectType)
+	if e.Id != "" {
+		msg += " " + e.Id
+	}
+	msg += ": " + e.Type
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	if len(e.Properties) > 0 {
+		msg += " [properties: " + strings.Join(e.Properties, ", ") + "]"
+	}
+	if e.ExistingId != "" {
+		msg += " [existing: " + e.ExistingId + "]"
+	}
+	return msg
+}
+
+// setError adds the context that is not part of the JSON representation to the SetError
+// that was returned for the given object.
+func setError(e SetError, objectType string, operation string, id string) *SetError {
+	e.ObjectType = objectType
+	e.Operation = operation
+	e.Id = id
+	return &e
+}
@@ -1,7 +1,10 @@
 package jmap
 
 import (
+	"context"
 	"fmt"
+
+	"opencloud.eu/groupware-assistant/pkg/models"
 )
 
 const CalendarObjectType = "Calendar"
@@ -11,26 +14,20 @@ type EventSender struct {
 	j          *Jmap
 	accountId  string
 	calendarId string
+	batch      *batch
 }
 
 func (s *EventSender) CalendarId() string {
 	return s.calendarId
 }
 
-func NewEventSender(j *Jmap, accountId string, calendarId string) (*EventSender, error) {
-	if accountId == "" {
-		// use default mail account
-		accountId = j.session.PrimaryAccounts.Calendars
-		if accountId == "" {
-			return nil, fmt.Errorf("session has no matching primary account")
-		}
-	} else {
-		if _, ok := j.session.Accounts[accountId]; !ok {
-			return nil, fmt.Errorf("account ID '%s' does not exist in session", accountId)
-		}
+func NewEventSender(ctx context.Context, j *Jmap, accountId string, calendarId string) (*EventSender, error) {
+	accountId, err := j.account(accountId, JmapCalendars)
+	if err != nil {
+		return nil, err
 	}
 
-	calendarsById, err := objectsById(j, accountId, CalendarObjectType, JmapCalendars)
+	calendarsById, err := objectsById(ctx, j, accountId, CalendarObjectType, JmapCalendars)
 	if err != nil {
 		return nil, err
 	}
@@ -56,6 +53,7 @@ func NewEventSender(j *Jmap, accountId string, calendarId string) (*EventSender,
 		j:          j,
 		accountId:  accountId,
 		calendarId: calendarId,
+		batch:      newBatch(j, accountId, EventObjectType, JmapCalendars),
 	}, nil
 }
 
@@ -63,32 +61,22 @@ func (j *EventSender) Close() error {
 	return nil
 }
 
-func (j *EventSender) EmptyEvents() (uint, error) {
-	return empty(j.j, j.accountId, EventObjectType, JmapMail, map[string]any{
+func (j *EventSender) EmptyEvents(ctx context.Context) (EmptyResult, error) {
+	return empty(ctx, j.j, j.accountId, EventObjectType, JmapCalendars, map[string]any{
 		"inCalendar": j.calendarId,
-	}, j.destroy)
+	})
 }
 
-func (j *EventSender) destroy(ids []string) error {
-	return destroy(j.j, j.accountId, EventObjectType, JmapCalendars, ids)
+// QueueEvent queues the event for creation.
+//
+// The event is sent along with others once enough of them have been queued, or when Flush
+// is called, after which done is invoked with the ID of the created event or with the error
+// that prevented its creation.
+func (j *EventSender) QueueEvent(ctx context.Context, c models.CalendarEvent, done func(id string, err error) error) error {
+	return j.batch.add(ctx, c, done)
 }
 
-func (j *EventSender) CreateEvent(c map[string]any) (string, error) {
-	body := map[string]any{
-		"using": []string{JmapCore, JmapContacts},
-		"methodCalls": []any{
-			[]any{
-				EventObjectType + "/set",
-				map[string]any{
-					"accountId": j.accountId,
-					"create": map[string]any{
-						"c": c,
-					},
-				},
-				"0",
-			},
-		},
-	}
-
-	return create(j.j, "c", EventObjectType, body)
+// Flush sends all the events that are currently queued.
+func (j *EventSender) Flush(ctx context.Context) error {
+	return j.batch.flush(ctx)
 }
@@ -0,0 +1,71 @@
+package jmap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"opencloud.eu/groupware-assistant/pkg/models"
+)
+
+var IdentityObjectType = "Identity"
+
+type IdentitySender struct {
+	j         *Jmap
+	accountId string
+	batch     *batch
+}
+
+func NewIdentitySender(ctx context.Context, j *Jmap, accountId string) (*IdentitySender, error) {
+	accountId, err := j.account(accountId, JmapSubmission)
+	if err != nil {
+		return nil, err
+	}
+	return &IdentitySender{
+		j:         j,
+		accountId: accountId,
+		batch:     newBatch(j, accountId, IdentityObjectType, JmapSubmission),
+	}, nil
+}
+
+func (s *IdentitySender) Close() error {
+	return nil
+}
+
+// QueueIdentity queues the identity for creation.
+//
+// The identity is sent along with others once enough of them have been queued, or when Flush
+// is called, after which done is invoked with the ID of the created identity or with the error
+// that prevented its creation, such as the server not allowing its email address.
+func (s *IdentitySender) QueueIdentity(ctx context.Context, identity models.Identity, done func(id string, err error) error) error {
+	return s.batch.add(ctx, identity, done)
+}
+
+// Flush sends all the identities that are currently queued.
+func (s *IdentitySender) Flush(ctx context.Context) error {
+	return s.batch.flush(ctx)
+}
+
+// identities returns the identities of the account, ordered by their IDs.
+func identities(ctx context.Context, j *Jmap, accountId string) ([]models.Identity, error) {
+	identitiesById, err := objectsById(ctx, j, accountId, IdentityObjectType, JmapSubmission)
+	if err != nil {
+		return nil, err
+	}
+	result := []models.Identity{}
+	for _, object := range identitiesById {
+		b, err := json.Marshal(object)
+		if err != nil {
+			return nil, err
+		}
+		var identity models.Identity
+		if err := json.Unmarshal(b, &identity); err != nil {
+			return nil, fmt.Errorf("failed to parse the identity '%v': %w", object["id"], err)
+		}
+		result = append(result, identity)
+	}
+	slices.SortFunc(result, func(a, b models.Identity) int { return strings.Compare(a.Id, b.Id) })
+	return result, nil
+}
@@ -2,7 +2,7 @@ package jmap
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,129 +10,378 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"slices"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/tidwall/pretty"
 )
 
 const (
-	JmapCore      = "urn:ietf:params:jmap:core"
-	JmapMail      = "urn:ietf:params:jmap:mail"
-	JmapContacts  = "urn:ietf:params:jmap:contacts"
-	JmapCalendars = "urn:ietf:params:jmap:calendars"
-	JmapTasks     = "urn:ietf:params:jmap:tasks"
-
-	EmailDeletionChunkSize = 20
+	JmapCore       = "urn:ietf:params:jmap:core"
+	JmapMail       = "urn:ietf:params:jmap:mail"
+	JmapSubmission = "urn:ietf:params:jmap:submission"
+	JmapContacts   = "urn:ietf:params:jmap:contacts"
+	JmapCalendars  = "urn:ietf:params:jmap:calendars"
+	JmapTasks      = "urn:ietf:params:jmap:tasks"
 )
 
-type Account struct {
-	Name       string `json:"name,omitempty"`
-	IsPersonal bool   `json:"isPersonal"`
-	IsReadOnly bool   `json:"isReadOnly"`
+// Config holds the options that determine how the client connects to the JMAP server.
+type Config struct {
+	Auth  Authenticator
+	TLS   TLSConfig
+	Retry RetryPolicy
+	Trace bool
+	Color bool
+	// file to write the HTTP traffic to, in the TraceFormat, which is derived from the
+	// extension of the file when empty
+	TraceFile   string
+	TraceFormat string
+	// the blobs that were uploaded already, which may be shared with the clients of other
+	// users, or nil to use one of its own
+	Blobs *BlobCache
+	// whether to copy blobs from other accounts with Blob/copy instead of uploading them again
+	CopyBlobs bool
+	// whether to send blobs and emails that exceed the maxSizeUpload and
+	// maxSizeAttachmentsPerEmail of the server anyway, to see how it rejects them
+	IgnoreUploadLimits bool
 }
 
-type SessionPrimaryAccounts struct {
-	Mail      string `json:"urn:ietf:params:jmap:mail,omitempty"`
-	Contacts  string `json:"urn:ietf:params:jmap:contacts,omitempty"`
-	Calendars string `json:"urn:ietf:params:jmap:calendars,omitempty"`
-	Tasks     string `json:"urn:ietf:params:jmap:tasks,omitempty"`
+type Jmap struct {
+	h       *http.Client
+	auth    Authenticator
+	session Session
+	core    CoreCapabilities
+	u       *url.URL
+	retry   RetryPolicy
+	retries atomic.Uint64
+	trace   bool
+	color   bool
+	tracer  *tracer
+	// limit the number of concurrent uploads and API requests as per the core capabilities
+	uploads  chan struct{}
+	requests chan struct{}
+
+	blobs              *BlobCache
+	copyBlobs          bool
+	ignoreUploadLimits bool
+	reusedBlobs        atomic.Uint64
+	savedBytes         atomic.Uint64
 }
 
-type Session struct {
-	Accounts        map[string]Account     `json:"accounts,omitempty"`
-	PrimaryAccounts SessionPrimaryAccounts `json:"primaryAccounts"`
-	Username        string                 `json:"username,omitempty"`
-	ApiUrl          string                 `json:"apiUrl,omitempty"`
-	UploadUrl       string                 `json:"uploadUrl,omitempty"`
+func NewJmap(ctx context.Context, baseurl *url.URL, config Config) (*Jmap, error) {
+	if config.Auth == nil {
+		return nil, fmt.Errorf("no JMAP authentication method was configured")
+	}
+
+	h, err := newHttpClient(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Jmap{
+		h:                  h,
+		auth:               config.Auth,
+		retry:              config.Retry,
+		trace:              config.Trace,
+		color:              config.Color,
+		blobs:              config.Blobs,
+		copyBlobs:          config.CopyBlobs,
+		ignoreUploadLimits: config.IgnoreUploadLimits,
+	}
+	if j.blobs == nil {
+		j.blobs = NewBlobCache()
+	}
+	if config.TraceFile != "" {
+		j.tracer, err = newTracer(config.TraceFile, config.TraceFormat)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := j.connect(ctx, baseurl); err != nil {
+		j.Close()
+		return nil, err
+	}
+	return j, nil
 }
 
-type Jmap struct {
-	h        *http.Client
-	username string
-	password string
-	session  Session
-	u        *url.URL
-	trace    bool
-	color    bool
+// connect fetches the session resource.
+func (j *Jmap) connect(ctx context.Context, baseurl *url.URL) error {
+	response, err := j.do(ctx, exchange{
+		method:     http.MethodGet,
+		url:        baseurl.JoinPath("/.well-known/jmap").String(),
+		idempotent: true,
+	})
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(response, &j.session)
+	if err != nil {
+		return err
+	}
+	err = j.session.Capabilities.Decode(JmapCore, &j.core)
+	if err != nil {
+		return fmt.Errorf("failed to parse the core capabilities of the JMAP session: %w", err)
+	}
+	if j.core.MaxConcurrentUpload > 0 {
+		j.uploads = make(chan struct{}, j.core.MaxConcurrentUpload)
+	}
+	if j.core.MaxConcurrentRequests > 0 {
+		j.requests = make(chan struct{}, j.core.MaxConcurrentRequests)
+	}
+
+	j.u, err = url.Parse(j.session.ApiUrl)
+	return err
 }
 
-func NewJmap(baseurl *url.URL, username string, password string, trace bool, color bool) (*Jmap, error) {
-	httpTransport := http.DefaultTransport.(*http.Transport).Clone()
-	tlsConfig := &tls.Config{InsecureSkipVerify: true}
-	httpTransport.TLSClientConfig = tlsConfig
-	h := http.DefaultClient
-	h.Transport = httpTransport
+func (j *Jmap) Close() error {
+	if j.tracer != nil {
+		err := j.tracer.Close()
+		j.tracer = nil
+		return err
+	}
+	return nil
+}
 
-	var session Session
-	{
-		wku := baseurl.JoinPath("/.well-known/jmap")
+// exchange describes an HTTP request to send to the JMAP server.
+type exchange struct {
+	method      string
+	url         string
+	contentType string
+	// further headers of the request
+	header  http.Header
+	payload []byte
+	// the content of an upload, which is streamed rather than sent from the payload
+	content Content
+	// whether the payload is JSON, to pretty-print it when tracing
+	json bool
+	// whether the request may be sent again without any side effects
+	idempotent bool
+	// the JMAP methods that are invoked by the request, for the trace file
+	calls []string
+}
 
-		req, err := http.NewRequest(http.MethodGet, wku.String(), nil)
+// do sends an HTTP request with the configured authentication and returns the response body.
+//
+// When the server rejects the credentials and they can be renewed, the request is sent once
+// more with fresh ones.
+// When the server is throttling us or is unavailable, the request is sent again as per the
+// RetryPolicy, but requests that are not idempotent only when it is certain that the server
+// did not process them.
+//
+// Once a request has been sent, it is allowed to complete even when the context is cancelled,
+// for us to know its outcome, but no further attempts are made.
+func (j *Jmap) do(ctx context.Context, x exchange) ([]byte, error) {
+	refreshed := false
+	attempt := uint(0)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		// the request is completed even when the context is cancelled, but the credentials
+		// are only obtained for it as long as it is not
+		req, err := j.request(ctx, context.WithoutCancel(ctx), x)
 		if err != nil {
 			return nil, err
 		}
-		if trace {
-			if b, err := httputil.DumpRequestOut(req, true); err == nil {
-				log.Printf("==> %s\n", string(b))
+		started := time.Now()
+		resp, err := j.h.Do(req)
+		waited := time.Since(started)
+		if err != nil {
+			j.record(x, attempt, req, started, waited, 0, nil, nil, err)
+			if attempt < j.retry.MaxRetries && shouldRetryError(err, x.idempotent) {
+				attempt++
+				if err := j.backoff(ctx, attempt, 0, err.Error()); err != nil {
+					return nil, err
+				}
+				continue
 			}
+			return nil, err
 		}
-		req.SetBasicAuth(username, password)
-		resp, err := h.Do(req)
+		response, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		j.record(x, attempt, req, started, waited, time.Since(started)-waited, resp, response, err)
 		if err != nil {
 			return nil, err
 		}
-		defer resp.Body.Close()
-		var response []byte = nil
-		if trace {
-			if b, err := httputil.DumpResponse(resp, false); err == nil {
-				response, err = io.ReadAll(resp.Body)
-				if err != nil {
+		j.traceResponse(resp, response)
+
+		if resp.StatusCode == http.StatusUnauthorized && !refreshed {
+			if r, ok := j.auth.(refresher); ok {
+				if err := r.Refresh(ctx, j.h, req); err != nil {
 					return nil, err
 				}
-				p := pretty.Pretty(response)
-				if color {
-					p = pretty.Color(p, nil)
-				}
-				log.Printf("<== %s%s\n", b, p)
+				refreshed = true
+				continue
 			}
 		}
-		if resp.StatusCode >= 300 {
-			return nil, fmt.Errorf("JMAP command HTTP response status is %s", resp.Status)
-		}
-		if response == nil {
-			response, err = io.ReadAll(resp.Body)
-			if err != nil {
+		if attempt < j.retry.MaxRetries && shouldRetryStatus(resp.StatusCode, x.idempotent) {
+			attempt++
+			if err := j.backoff(ctx, attempt, retryAfter(resp.Header), resp.Status); err != nil {
 				return nil, err
 			}
+			continue
 		}
-		if err != nil {
-			return nil, err
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			failed := &HttpError{StatusCode: resp.StatusCode, Status: resp.Status, Body: response}
+			if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/problem+json") {
+				problem := RequestError{Status: resp.StatusCode, Response: failed}
+				if err := json.Unmarshal(response, &problem); err == nil && problem.Type != "" {
+					return nil, &problem
+				}
+			}
+			return nil, failed
 		}
-		err = json.Unmarshal(response, &session)
+		return response, nil
+	}
+}
+
+// request builds an HTTP request for an exchange that is bound to reqCtx, traces it to the log
+// and authenticates it, obtaining the credentials first if need be, as long as ctx is not done.
+func (j *Jmap) request(ctx context.Context, reqCtx context.Context, x exchange) (*http.Request, error) {
+	var body io.Reader = nil
+	if x.content.Open != nil {
+		r, err := x.content.Open()
 		if err != nil {
 			return nil, err
 		}
+		body = r
+	} else if x.payload != nil {
+		body = bytes.NewReader(x.payload)
 	}
-
-	u, err := url.Parse(session.ApiUrl)
+	req, err := http.NewRequestWithContext(reqCtx, x.method, x.url, body)
 	if err != nil {
 		return nil, err
 	}
+	if x.content.Open != nil {
+		req.ContentLength = x.content.Size
+	}
+	if x.contentType != "" {
+		req.Header.Set("Content-Type", x.contentType)
+	}
+	for name, values := range x.header {
+		req.Header[name] = values
+	}
+
+	if j.trace {
+		if b, err := httputil.DumpRequestOut(req, false); err == nil {
+			var p []byte = nil
+			if x.json {
+				p = pretty.Pretty(x.payload)
+				if j.color {
+					p = pretty.Color(p, nil)
+				}
+			}
+			log.Printf("==> %s%s\n", b, p)
+		}
+	}
+
+	if err := j.auth.Authenticate(ctx, j.h, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
 
-	return &Jmap{
-		h:        h,
-		trace:    trace,
-		color:    color,
-		username: username,
-		password: password,
-		session:  session,
-		u:        u,
-	}, nil
+// traceResponse traces a response to the log, along with its body unless it is streamed.
+func (j *Jmap) traceResponse(resp *http.Response, response []byte) {
+	if !j.trace {
+		return
+	}
+	if b, err := httputil.DumpResponse(resp, false); err == nil {
+		var p []byte = nil
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+			p = pretty.Pretty(response)
+			if j.color {
+				p = pretty.Color(p, nil)
+			}
+		}
+		log.Printf("<== %s%s\n", b, p)
+	}
 }
 
-func (j *Jmap) Close() error {
-	return nil
+// record writes an HTTP exchange to the trace file, if there is one.
+func (j *Jmap) record(x exchange, attempt uint, req *http.Request, started time.Time, wait time.Duration, receive time.Duration, resp *http.Response, response []byte, err error) {
+	if j.tracer == nil {
+		return
+	}
+	j.write(entry(x, attempt, req, started, wait, receive, resp, response, err))
+}
+
+// write writes an entry to the trace file.
+func (j *Jmap) write(e harEntry) {
+	if err := j.tracer.record(e); err != nil {
+		log.Printf("failed to write to the trace file: %v", err)
+	}
+}
+
+// entry describes an HTTP exchange for the trace file.
+func entry(x exchange, attempt uint, req *http.Request, started time.Time, wait time.Duration, receive time.Duration, resp *http.Response, response []byte, err error) harEntry {
+	e := harEntry{
+		StartedDateTime: started.Format(time.RFC3339Nano),
+		Time:            milliseconds(wait + receive),
+		Request: harRequest{
+			Method:      req.Method,
+			Url:         req.URL.String(),
+			HttpVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(req.Header),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(x.payload),
+		},
+		Response: harResponse{
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Timings: harTimings{
+			Wait:    milliseconds(wait),
+			Receive: milliseconds(receive),
+		},
+		JmapMethods: x.calls,
+		Attempt:     attempt + 1,
+	}
+	if x.content.Open != nil {
+		e.Request.BodySize = int(x.content.Size)
+		text, encoding, sha := harContentBody(x.contentType, x.content)
+		e.Request.PostData = &harPostData{MimeType: x.contentType, Text: text, Encoding: encoding, Sha256: sha}
+	} else if x.payload != nil {
+		text, encoding, sha := harBody(x.contentType, x.payload)
+		e.Request.PostData = &harPostData{MimeType: x.contentType, Text: text, Encoding: encoding, Sha256: sha}
+	}
+	if resp != nil {
+		contentType := resp.Header.Get("Content-Type")
+		text, encoding, sha := harBody(contentType, response)
+		e.Response.Status = resp.StatusCode
+		e.Response.StatusText = http.StatusText(resp.StatusCode)
+		e.Response.HttpVersion = resp.Proto
+		e.Response.Headers = harHeaders(resp.Header)
+		e.Response.BodySize = len(response)
+		e.Response.Content = harContent{Size: len(response), MimeType: contentType, Text: text, Encoding: encoding, Sha256: sha}
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// backoff waits before the given attempt, unless the context is cancelled in the meantime.
+func (j *Jmap) backoff(ctx context.Context, attempt uint, retryAfter time.Duration, reason string) error {
+	j.retries.Add(1)
+	d := j.retry.delay(attempt, retryAfter)
+	if j.trace {
+		log.Printf("retrying in %v (attempt %d of %d): %s", d, attempt, j.retry.MaxRetries, reason)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
 }
 
 type uploadedBlob struct {
@@ -142,42 +391,26 @@ type uploadedBlob struct {
 	Sha512 string `json:"sha:512"`
 }
 
-func (j *Jmap) uploadBlob(accountId string, data []byte, mimetype string) (uploadedBlob, error) {
-	uploadUrl := strings.ReplaceAll(j.session.UploadUrl, "{accountId}", accountId)
-	req, err := http.NewRequest(http.MethodPost, uploadUrl, bytes.NewReader(data))
+func (j *Jmap) uploadBlob(ctx context.Context, accountId string, content Content, mimetype string) (uploadedBlob, error) {
+	if !j.ignoreUploadLimits && j.core.MaxSizeUpload > 0 && uint64(content.Size) > uint64(j.core.MaxSizeUpload) {
+		return uploadedBlob{}, fmt.Errorf("cannot upload %d bytes of %s, the server accepts at most %d bytes (maxSizeUpload)", content.Size, mimetype, j.core.MaxSizeUpload)
+	}
+	release, err := acquire(ctx, j.uploads)
 	if err != nil {
 		return uploadedBlob{}, err
 	}
-	req.Header.Add("Content-Type", mimetype)
-	req.SetBasicAuth(j.username, j.password)
-	res, err := j.h.Do(req)
+	defer release()
+	uploadUrl := strings.ReplaceAll(j.session.UploadUrl, "{accountId}", accountId)
+	response, err := j.do(ctx, exchange{
+		method:      http.MethodPost,
+		url:         uploadUrl,
+		contentType: mimetype,
+		content:     content,
+		idempotent:  true,
+	})
 	if err != nil {
 		return uploadedBlob{}, err
 	}
-	defer res.Body.Close()
-	var response []byte = nil
-	if j.trace {
-		if b, err := httputil.DumpResponse(res, false); err == nil {
-			response, err = io.ReadAll(res.Body)
-			if err != nil {
-				return uploadedBlob{}, err
-			}
-			p := pretty.Pretty(response)
-			if j.color {
-				p = pretty.Color(p, nil)
-			}
-			log.Printf("<== %s%s\n", b, p)
-		}
-	}
-	if res.StatusCode < 200 || res.StatusCode > 299 {
-		return uploadedBlob{}, fmt.Errorf("status is %s", res.Status)
-	}
-	if response == nil {
-		response, err = io.ReadAll(res.Body)
-		if err != nil {
-			return uploadedBlob{}, err
-		}
-	}
 
 	var result uploadedBlob
 	err = json.Unmarshal(response, &result)
@@ -188,214 +421,81 @@ func (j *Jmap) uploadBlob(accountId string, data []byte, mimetype string) (uploa
 	return result, nil
 }
 
-func command[T any](j *Jmap, body map[string]any, closure func([]any) (T, error)) (T, error) {
-	var zero T
-
-	payload, err := json.Marshal(body)
-	if err != nil {
-		return zero, err
+// Send posts the request to the JMAP API endpoint and returns the method responses.
+func (j *Jmap) Send(ctx context.Context, r *Request) (*Response, error) {
+	if j.core.MaxCallsInRequest > 0 && uint(len(r.calls)) > j.core.MaxCallsInRequest {
+		return nil, fmt.Errorf("request has %d method calls, the server accepts at most %d (maxCallsInRequest)", len(r.calls), j.core.MaxCallsInRequest)
 	}
-	req, err := http.NewRequest(http.MethodPost, j.u.String(), bytes.NewReader(payload))
+	payload, err := json.Marshal(r)
 	if err != nil {
-		return zero, err
+		return nil, err
 	}
-
-	if j.trace {
-		if b, err := httputil.DumpRequestOut(req, false); err == nil {
-			p := pretty.Pretty(payload)
-			if j.color {
-				p = pretty.Color(p, nil)
-			}
-			log.Printf("==> %s%s\n", b, p)
-		}
+	if j.core.MaxSizeRequest > 0 && uint(len(payload)) > j.core.MaxSizeRequest {
+		return nil, fmt.Errorf("request has %d bytes, the server accepts at most %d (maxSizeRequest)", len(payload), j.core.MaxSizeRequest)
 	}
-
-	req.SetBasicAuth(j.username, j.password)
-	resp, err := j.h.Do(req)
+	release, err := acquire(ctx, j.requests)
 	if err != nil {
-		return zero, err
-	}
-	defer resp.Body.Close()
-	var response []byte = nil
-	if j.trace {
-		if b, err := httputil.DumpResponse(resp, false); err == nil {
-			response, err = io.ReadAll(resp.Body)
-			if err != nil {
-				return zero, err
-			}
-			p := pretty.Pretty(response)
-			if j.color {
-				p = pretty.Color(p, nil)
-			}
-			log.Printf("<== %s%s\n", b, p)
-		}
-	}
-	if resp.StatusCode >= 300 {
-		return zero, fmt.Errorf("JMAP command HTTP response status is %s", resp.Status)
+		return nil, err
 	}
-	if response == nil {
-		response, err = io.ReadAll(resp.Body)
-		if err != nil {
-			return zero, err
-		}
+	defer release()
+	response, err := j.do(ctx, exchange{
+		method:      http.MethodPost,
+		url:         j.u.String(),
+		contentType: "application/json",
+		payload:     payload,
+		json:        true,
+		idempotent:  r.isIdempotent(),
+		calls:       r.methods(),
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	r := map[string]any{}
-	err = json.Unmarshal(response, &r)
+	var result Response
+	err = json.Unmarshal(response, &result)
 	if err != nil {
-		return zero, err
+		return nil, err
 	}
-
-	methodResponses := r["methodResponses"].([]any)
-	return closure(methodResponses)
-}
-
-func create(j *Jmap, id string, objectType string, body map[string]any) (string, error) {
-	return command(j, body, func(methodResponses []any) (string, error) {
-		z := methodResponses[0].([]any)
-		f := z[1].(map[string]any)
-		if x, ok := f["created"]; ok {
-			created := x.(map[string]any)
-			if c, ok := created[id].(map[string]any); ok {
-				return c["id"].(string), nil
-			} else {
-				return "", fmt.Errorf("failed to create %v", objectType)
-			}
-		} else {
-			if ncx, ok := f["notCreated"]; ok {
-				nc := ncx.(map[string]any)
-				c := nc[id].(map[string]any)
-				return "", fmt.Errorf("failed to create %v: %v", objectType, c["description"])
-			} else {
-				return "", fmt.Errorf("failed to create %v", objectType)
-			}
-		}
-	})
+	return &result, nil
 }
 
-func destroy(j *Jmap, accountId string, objectType string, scope string, ids []string) error {
-	body := map[string]any{
-		"using": []string{JmapCore, scope},
-		"methodCalls": []any{
-			[]any{
-				objectType + "/set",
-				map[string]any{
-					"accountId": accountId,
-					"destroy":   ids,
-				},
-				"0",
-			},
-		},
+// acquire waits for one of the slots to be available, where nil slots means that there is
+// no limit, and returns the function that makes it available again.
+func acquire(ctx context.Context, slots chan struct{}) (func(), error) {
+	if slots == nil {
+		return func() {}, nil
 	}
-
-	f, err := command(j, body, func(methodResponses []any) (map[string]any, error) {
-		z := methodResponses[0].([]any)
-		return z[1].(map[string]any), nil
-	})
-	if err != nil {
-		return err
-	}
-
-	if x, ok := f["destroyed"]; ok {
-		destroyed := x.([]any)
-		if len(destroyed) == len(ids) {
-			return nil
-		} else {
-			return fmt.Errorf("failed to destroy %ss: %v", objectType, f)
-		}
-	} else {
-		if ncx, ok := f["notDestroyed"]; ok {
-			nc := ncx.(map[string]any)
-			for id, setErrorObj := range nc {
-				setError := setErrorObj.(map[string]any)
-				if description, ok := setError["description"]; ok {
-					return fmt.Errorf("failed to destroy %ss: %s: %v", objectType, id, description)
-				}
-			}
-			keys := make([]string, len(nc))
-			i := 0
-			for k := range nc {
-				keys[i] = k
-				i++
-			}
-			return fmt.Errorf("failed to destroy %ss: [%s]", objectType, strings.Join(keys, ", "))
-		} else {
-			return fmt.Errorf("failed to destroy %ss: %v", objectType, f)
-		}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
-func empty(j *Jmap, accountId string, objectType string, scope string, filter map[string]any, destroyer func([]string) error) (uint, error) {
-	body := map[string]any{
-		"using": []string{JmapCore, scope},
-		"methodCalls": []any{
-			[]any{
-				objectType + "/query",
-				map[string]any{
-					"accountId": accountId,
-					"filter":    filter,
-				},
-				"0",
-			},
-		},
+func objectsById(ctx context.Context, j *Jmap, accountId string, objectType string, scope string) (map[string]map[string]any, error) {
+	req := NewRequest(scope)
+	get := req.Call(objectType+"/get", GetArgs{AccountId: accountId})
+	resp, err := j.Send(ctx, req)
+	if err != nil {
+		return nil, err
 	}
-
-	f, err := command(j, body, func(methodResponses []any) (map[string]any, error) {
-		z := methodResponses[0].([]any)
-		return z[1].(map[string]any), nil
-	})
-	if idsObj, ok := f["ids"]; ok {
-		anies := idsObj.([]any)
-		ids := make([]string, len(anies))
-		for i, a := range anies {
-			ids[i] = a.(string)
-		}
-		destroyed := uint(0)
-		for chunk := range slices.Chunk(ids, 20) {
-			err = destroyer(chunk)
-			if err != nil {
-				return destroyed, err
-			}
-			destroyed += uint(len(chunk))
-		}
-		return destroyed, nil
-	} else {
-		return uint(0), fmt.Errorf("failed to destroy %vs: %v", objectType, f)
+	var r GetResponse[map[string]any]
+	if err := resp.Get(get, &r); err != nil {
+		return nil, err
 	}
-}
 
-func objectsById(j *Jmap, accountId string, objectType string, scope string) (map[string]map[string]any, error) {
-	m := map[string]map[string]any{}
-	{
-		body := map[string]any{
-			"using": []string{JmapCore, scope},
-			"methodCalls": []any{
-				[]any{
-					objectType + "/get",
-					map[string]any{
-						"accountId": accountId,
-					},
-					"0",
-				},
-			},
-		}
-		result, err := command(j, body, func(methodResponses []any) ([]any, error) {
-			z := methodResponses[0].([]any)
-			f := z[1].(map[string]any)
-			if list, ok := f["list"]; ok {
-				return list.([]any), nil
-			} else {
-				return nil, fmt.Errorf("methodResponse[1] has no 'list' attribute: %v", f)
-			}
-		})
-		if err != nil {
-			return nil, err
-		}
-		for _, a := range result {
-			obj := a.(map[string]any)
-			id := obj["id"].(string)
-			m[id] = obj
+	m := make(map[string]map[string]any, len(r.List))
+	for _, obj := range r.List {
+		id, ok := obj["id"].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s has no 'id' attribute: %v", objectType, obj)
 		}
+		m[id] = obj
 	}
 	return m, nil
 }
+
+func ptr[T any](t T) *T {
+	return &t
+}
@@ -0,0 +1,109 @@
+package jmaptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+
+	"opencloud.eu/groupware-assistant/pkg/message"
+	"opencloud.eu/groupware-assistant/pkg/models"
+)
+
+// message renders the RFC 5322 message of an email that was created with Email/set, as the
+// content of its blobId, from the body values and blobs that it refers to.
+func (s *Server) message(a *account, object map[string]any) []byte {
+	var e models.Email
+	if b, err := json.Marshal(object); err != nil || json.Unmarshal(b, &e) != nil {
+		return nil
+	}
+	text := func(parts []models.EmailBodyPart, contentType string) []message.Part {
+		result := []message.Part{}
+		for _, p := range parts {
+			if v, ok := e.BodyValues[p.PartId]; ok {
+				result = append(result, message.Text(contentType, v.Value).Language(strings.Join(p.Language, ", ")))
+			}
+		}
+		return result
+	}
+
+	related := []message.Part{}
+	attachments := []message.Part{}
+	for _, attachment := range e.Attachments {
+		content := a.blobs[attachment.BlobId].data
+		if attachment.Disposition == "inline" {
+			related = append(related, message.Inline(attachment.Type, attachment.Name, attachment.Cid, content))
+		} else {
+			attachments = append(attachments, message.Attachment(attachment.Type, attachment.Name, content))
+		}
+	}
+	body := message.Compose(text(e.TextBody, "text/plain"), text(e.HtmlBody, "text/html"), related, attachments)
+	// the content of the parts is in memory, which cannot fail to be read
+	raw, _ := message.Bytes(message.Fields(e), body)
+	return raw
+}
+
+// parseMessage returns the properties of an imported email that are taken from the header of
+// its message, along with the other header fields as "header:{name}" properties.
+func parseMessage(data []byte) (map[string]any, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	decoder := new(mime.WordDecoder)
+	object := map[string]any{}
+	for name, values := range m.Header {
+		value := strings.Join(values, ", ")
+		switch name {
+		case "From", "Sender", "Reply-To", "To", "Cc", "Bcc":
+			list, err := mail.ParseAddressList(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s header field: %w", name, err)
+			}
+			addresses := []any{}
+			for _, a := range list {
+				addresses = append(addresses, map[string]any{"name": a.Name, "email": a.Address})
+			}
+			object[addressProperties[name]] = addresses
+		case "Message-Id", "In-Reply-To", "References":
+			ids := []any{}
+			for _, id := range strings.Fields(value) {
+				ids = append(ids, strings.Trim(id, "<>"))
+			}
+			object[idProperties[name]] = ids
+		case "Subject":
+			if subject, err := decoder.DecodeHeader(value); err == nil {
+				value = subject
+			}
+			object["subject"] = value
+		case "Date":
+			t, err := mail.ParseDate(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Date header field: %w", err)
+			}
+			object["sentAt"] = t.Format(time.RFC3339)
+		case "Mime-Version", "Content-Type", "Content-Transfer-Encoding":
+		default:
+			object["header:"+name] = " " + value
+		}
+	}
+	return object, nil
+}
+
+var addressProperties = map[string]string{
+	"From":     "from",
+	"Sender":   "sender",
+	"Reply-To": "replyTo",
+	"To":       "to",
+	"Cc":       "cc",
+	"Bcc":      "bcc",
+}
+
+var idProperties = map[string]string{
+	"Message-Id":  "messageId",
+	"In-Reply-To": "inReplyTo",
+	"References":  "references",
+}
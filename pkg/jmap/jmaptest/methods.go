@@ -0,0 +1,1037 @@
+package jmaptest
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+)
+
+type invocation struct {
+	name   string
+	args   map[string]any
+	callId string
+}
+
+// requestContext holds what the method calls of a single API request share: the responses
+// that later calls may refer to, and the IDs of the objects that were created so far, by
+// their creation ID.
+type requestContext struct {
+	user      *user
+	using     []string
+	responses []invocation
+	created   map[string]string
+}
+
+func (rc *requestContext) respond(name string, args any, callId string) {
+	rc.responses = append(rc.responses, invocation{name: name, args: normalize(args), callId: callId})
+}
+
+func (rc *requestContext) fail(callId string, errorType string, description string) {
+	args := map[string]any{"type": errorType}
+	if description != "" {
+		args["description"] = description
+	}
+	rc.respond("error", args, callId)
+}
+
+func (s *Server) call(rc *requestContext, inv invocation) {
+	if f, ok := s.methodFailures[inv.name]; ok && f.times > 0 {
+		f.times--
+		rc.fail(inv.callId, f.errorType, f.description)
+		return
+	}
+	if r, ok := s.responses[inv.name]; ok && r.times > 0 {
+		r.times--
+		rc.respond(inv.name, r.args, inv.callId)
+		return
+	}
+
+	if err := rc.resolveReferences(inv.args); err != nil {
+		rc.fail(inv.callId, "invalidResultReference", err.Error())
+		return
+	}
+
+	objectType, method, _ := strings.Cut(inv.name, "/")
+	capability, ok := objectTypes[objectType]
+	if !ok || !slices.Contains(rc.using, capability) {
+		rc.fail(inv.callId, "unknownMethod", inv.name)
+		return
+	}
+	accountId, _ := inv.args["accountId"].(string)
+	if accountId == "" {
+		accountId = rc.user.accountId
+	}
+	a, ok := s.accounts[accountId]
+	if !ok || !rc.user.mayAccess(accountId) {
+		rc.fail(inv.callId, "accountNotFound", accountId)
+		return
+	}
+
+	switch method {
+	case "copy":
+		if objectType != "Blob" {
+			rc.fail(inv.callId, "unknownMethod", inv.name)
+			return
+		}
+		s.copyBlobs(rc, a, inv)
+	case "get":
+		s.get(rc, a, objectType, inv)
+	case "set":
+		if objectType == "EmailSubmission" {
+			s.submit(rc, a, inv)
+			return
+		}
+		s.set(rc, a, objectType, inv)
+	case "query":
+		s.query(rc, a, objectType, inv)
+	case "changes":
+		s.changes(rc, a, objectType, inv)
+	case "import":
+		if objectType != "Email" {
+			rc.fail(inv.callId, "unknownMethod", inv.name)
+			return
+		}
+		s.importEmails(rc, a, inv)
+	default:
+		rc.fail(inv.callId, "unknownMethod", inv.name)
+	}
+}
+
+// copyBlobs implements Blob/copy as per RFC 8620 section 6.3.
+func (s *Server) copyBlobs(rc *requestContext, a *account, inv invocation) {
+	fromAccountId, _ := inv.args["fromAccountId"].(string)
+	from, ok := s.accounts[fromAccountId]
+	if !ok || !rc.user.mayAccess(fromAccountId) {
+		rc.fail(inv.callId, "fromAccountNotFound", fromAccountId)
+		return
+	}
+	blobIds, _ := inv.args["blobIds"].([]any)
+	copied := map[string]any{}
+	notCopied := map[string]any{}
+	for _, v := range blobIds {
+		blobId, _ := v.(string)
+		b, ok := from.blobs[blobId]
+		if !ok {
+			notCopied[blobId] = map[string]any{"type": "blobNotFound"}
+			continue
+		}
+		id := s.id("B")
+		a.blobs[id] = b
+		copied[blobId] = id
+	}
+	response := map[string]any{
+		"fromAccountId": from.id,
+		"accountId":     a.id,
+		"copied":        nil,
+		"notCopied":     nil,
+	}
+	if len(copied) > 0 {
+		response["copied"] = copied
+	}
+	if len(notCopied) > 0 {
+		response["notCopied"] = notCopied
+	}
+	rc.respond(inv.name, response, inv.callId)
+}
+
+// resolveReferences replaces the arguments that are result references, whose names start
+// with '#', by the values they point to, as per RFC 8620 section 3.7.
+func (rc *requestContext) resolveReferences(args map[string]any) error {
+	for name, value := range args {
+		property, ok := strings.CutPrefix(name, "#")
+		if !ok {
+			continue
+		}
+		if _, conflict := args[property]; conflict {
+			return fmt.Errorf("both '%s' and '%s' are present", property, name)
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		var ref jmap.ResultReference
+		if err := json.Unmarshal(b, &ref); err != nil {
+			return fmt.Errorf("'%s' is not a result reference: %v", name, err)
+		}
+		var result *invocation = nil
+		for i := range rc.responses {
+			if rc.responses[i].callId == ref.ResultOf {
+				result = &rc.responses[i]
+				break
+			}
+		}
+		if result == nil || result.name != ref.Name {
+			return fmt.Errorf("there is no %s response for the call '%s'", ref.Name, ref.ResultOf)
+		}
+		resolved, err := evaluate(result.args, strings.Split(strings.TrimPrefix(ref.Path, "/"), "/"))
+		if err != nil {
+			return fmt.Errorf("failed to evaluate '%s': %v", ref.Path, err)
+		}
+		delete(args, name)
+		args[property] = resolved
+	}
+	return nil
+}
+
+// evaluate follows a JSON pointer, where a '*' in place of an array index maps the rest of
+// the pointer over all the items of the array, flattening arrays that result from it.
+func evaluate(value any, tokens []string) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	token := strings.ReplaceAll(strings.ReplaceAll(tokens[0], "~1", "/"), "~0", "~")
+	switch v := value.(type) {
+	case map[string]any:
+		child, ok := v[token]
+		if !ok {
+			return nil, fmt.Errorf("no such property '%s'", token)
+		}
+		return evaluate(child, tokens[1:])
+	case []any:
+		if token == "*" {
+			result := []any{}
+			for _, item := range v {
+				r, err := evaluate(item, tokens[1:])
+				if err != nil {
+					return nil, err
+				}
+				if items, ok := r.([]any); ok {
+					result = append(result, items...)
+				} else {
+					result = append(result, r)
+				}
+			}
+			return result, nil
+		}
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 || i >= len(v) {
+			return nil, fmt.Errorf("no such index '%s'", token)
+		}
+		return evaluate(v[i], tokens[1:])
+	default:
+		return nil, fmt.Errorf("cannot evaluate '%s' on a scalar", token)
+	}
+}
+
+func stringList(value any) ([]string, bool) {
+	items, ok := value.([]any)
+	if !ok {
+		return nil, false
+	}
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, false
+		}
+		result = append(result, s)
+	}
+	return result, true
+}
+
+func (s *Server) get(rc *requestContext, a *account, objectType string, inv invocation) {
+	c := a.collection(objectType)
+	var ids []string
+	if v, ok := inv.args["ids"]; ok && v != nil {
+		if ids, ok = stringList(v); !ok {
+			rc.fail(inv.callId, "invalidArguments", "ids must be a list of strings")
+			return
+		}
+		if s.Core.MaxObjectsInGet > 0 && uint(len(ids)) > s.Core.MaxObjectsInGet {
+			rc.fail(inv.callId, "requestTooLarge", "")
+			return
+		}
+	} else {
+		ids = c.order
+	}
+	properties, filtered := stringList(inv.args["properties"])
+
+	var counts map[string]map[string]any = nil
+	if objectType == "Mailbox" {
+		counts = a.mailboxCounts()
+	}
+
+	list := []map[string]any{}
+	notFound := []string{}
+	for _, id := range ids {
+		object, ok := c.objects[id]
+		if !ok {
+			notFound = append(notFound, id)
+			continue
+		}
+		if counts != nil {
+			object = clone(object)
+			maps.Copy(object, counts[id])
+		}
+		if filtered {
+			selected := map[string]any{"id": id}
+			for _, p := range properties {
+				if v, ok := object[p]; ok {
+					selected[p] = v
+				}
+			}
+			object = selected
+		}
+		list = append(list, object)
+	}
+	rc.respond(inv.name, map[string]any{
+		"accountId": a.id,
+		"state":     c.stateString(),
+		"list":      list,
+		"notFound":  notFound,
+	}, inv.callId)
+}
+
+// mailboxCounts returns the totalEmails, unreadEmails, totalThreads and unreadThreads of
+// every mailbox, as per RFC 8621 section 2, by mailbox ID.
+func (a *account) mailboxCounts() map[string]map[string]any {
+	type count struct {
+		emails, unread         int
+		threads, unreadThreads map[string]bool
+	}
+	counts := map[string]*count{}
+	for _, id := range a.collection("Mailbox").order {
+		counts[id] = &count{threads: map[string]bool{}, unreadThreads: map[string]bool{}}
+	}
+	emails := a.collection("Email")
+	for _, id := range emails.order {
+		e := emails.objects[id]
+		mailboxIds, _ := e["mailboxIds"].(map[string]any)
+		keywords, _ := e["keywords"].(map[string]any)
+		threadId, _ := e["threadId"].(string)
+		seen := keywords["$seen"] == true
+		for mailboxId := range mailboxIds {
+			c, ok := counts[mailboxId]
+			if !ok {
+				continue
+			}
+			c.emails++
+			c.threads[threadId] = true
+			if !seen {
+				c.unread++
+				c.unreadThreads[threadId] = true
+			}
+		}
+	}
+	result := make(map[string]map[string]any, len(counts))
+	for id, c := range counts {
+		result[id] = map[string]any{
+			"totalEmails":   c.emails,
+			"unreadEmails":  c.unread,
+			"totalThreads":  len(c.threads),
+			"unreadThreads": len(c.unreadThreads),
+		}
+	}
+	return result
+}
+
+func (s *Server) set(rc *requestContext, a *account, objectType string, inv invocation) {
+	c := a.collection(objectType)
+	if ifInState, ok := inv.args["ifInState"].(string); ok && ifInState != c.stateString() {
+		rc.fail(inv.callId, "stateMismatch", "")
+		return
+	}
+	create, _ := inv.args["create"].(map[string]any)
+	update, _ := inv.args["update"].(map[string]any)
+	destroy, _ := stringList(inv.args["destroy"])
+	if s.Core.MaxObjectsInSet > 0 && uint(len(create)+len(update)+len(destroy)) > s.Core.MaxObjectsInSet {
+		rc.fail(inv.callId, "requestTooLarge", "")
+		return
+	}
+
+	oldState := c.stateString()
+	var created, updated map[string]any
+	var destroyed []string
+	var notCreated, notUpdated, notDestroyed map[string]*jmap.SetError
+	reject := func(errors *map[string]*jmap.SetError, id string, e *jmap.SetError) {
+		if *errors == nil {
+			*errors = map[string]*jmap.SetError{}
+		}
+		(*errors)[id] = e
+	}
+
+	// objects may refer to others that are created in the same call, hence those that
+	// cannot be resolved yet are retried until no more progress is made
+	pending := make([]string, 0, len(create))
+	for creationId := range create {
+		pending = append(pending, creationId)
+	}
+	slices.SortFunc(pending, naturalOrder)
+	for len(pending) > 0 {
+		deferred := []string{}
+		for _, creationId := range pending {
+			object, ok := create[creationId].(map[string]any)
+			if !ok {
+				reject(&notCreated, creationId, &jmap.SetError{Type: "invalidArguments"})
+				continue
+			}
+			object, unresolved := rc.substitute(clone(object))
+			if unresolved {
+				deferred = append(deferred, creationId)
+				continue
+			}
+			if e := s.validate(objectType, jmap.SetOperationCreate, creationId, object); e != nil {
+				reject(&notCreated, creationId, e)
+				continue
+			}
+			if _, ok := object["id"]; ok {
+				reject(&notCreated, creationId, &jmap.SetError{Type: "invalidProperties", Properties: []string{"id"}})
+				continue
+			}
+			s.defaults(a, objectType, object)
+			id := s.insert(a, objectType, object)
+			rc.created[creationId] = id
+			if created == nil {
+				created = map[string]any{}
+			}
+			created[creationId] = s.serverSet(objectType, object)
+		}
+		if len(deferred) == len(pending) {
+			for _, creationId := range deferred {
+				reject(&notCreated, creationId, &jmap.SetError{Type: "invalidProperties", Description: "unresolved creation ID reference"})
+			}
+			break
+		}
+		pending = deferred
+	}
+
+	for id, v := range update {
+		object, ok := c.objects[id]
+		if !ok {
+			reject(&notUpdated, id, &jmap.SetError{Type: "notFound"})
+			continue
+		}
+		patch, ok := v.(map[string]any)
+		if !ok {
+			reject(&notUpdated, id, &jmap.SetError{Type: "invalidPatch"})
+			continue
+		}
+		patch, _ = rc.substitute(patch)
+		if e := s.validate(objectType, jmap.SetOperationUpdate, id, patch); e != nil {
+			reject(&notUpdated, id, e)
+			continue
+		}
+		patched := clone(object)
+		if err := applyPatch(patched, patch); err != nil {
+			reject(&notUpdated, id, &jmap.SetError{Type: "invalidPatch", Description: err.Error()})
+			continue
+		}
+		c.objects[id] = patched
+		c.record(id, jmap.SetOperationUpdate)
+		if updated == nil {
+			updated = map[string]any{}
+		}
+		updated[id] = nil
+	}
+
+	for _, id := range destroy {
+		if created, ok := strings.CutPrefix(id, "#"); ok {
+			id = rc.created[created]
+		}
+		object, ok := c.objects[id]
+		if !ok {
+			reject(&notDestroyed, id, &jmap.SetError{Type: "notFound"})
+			continue
+		}
+		if e := s.validate(objectType, jmap.SetOperationDestroy, id, object); e != nil {
+			reject(&notDestroyed, id, e)
+			continue
+		}
+		c.remove(id)
+		destroyed = append(destroyed, id)
+	}
+
+	if c.stateString() != oldState {
+		s.notify(a, objectType)
+	}
+	rc.respond(inv.name, map[string]any{
+		"accountId":    a.id,
+		"oldState":     oldState,
+		"newState":     c.stateString(),
+		"created":      created,
+		"updated":      updated,
+		"destroyed":    destroyed,
+		"notCreated":   notCreated,
+		"notUpdated":   notUpdated,
+		"notDestroyed": notDestroyed,
+	}, inv.callId)
+}
+
+// importEmails implements Email/import as per RFC 8621 section 4.8, taking the envelope
+// properties from the header of the message.
+func (s *Server) importEmails(rc *requestContext, a *account, inv invocation) {
+	c := a.collection("Email")
+	if ifInState, ok := inv.args["ifInState"].(string); ok && ifInState != c.stateString() {
+		rc.fail(inv.callId, "stateMismatch", "")
+		return
+	}
+	emails, _ := inv.args["emails"].(map[string]any)
+	if s.Core.MaxObjectsInSet > 0 && uint(len(emails)) > s.Core.MaxObjectsInSet {
+		rc.fail(inv.callId, "requestTooLarge", "")
+		return
+	}
+
+	oldState := c.stateString()
+	var created map[string]any
+	var notCreated map[string]*jmap.SetError
+	creationIds := slices.SortedFunc(maps.Keys(emails), naturalOrder)
+	for _, creationId := range creationIds {
+		e := func() *jmap.SetError {
+			args, ok := emails[creationId].(map[string]any)
+			if !ok {
+				return &jmap.SetError{Type: "invalidArguments"}
+			}
+			args, _ = rc.substitute(clone(args))
+			blobId, _ := args["blobId"].(string)
+			b, ok := a.blobs[blobId]
+			if !ok {
+				return &jmap.SetError{Type: "blobNotFound", Description: blobId}
+			}
+			object, err := parseMessage(b.data)
+			if err != nil {
+				return &jmap.SetError{Type: "invalidEmail", Description: err.Error()}
+			}
+			for _, p := range []string{"mailboxIds", "keywords", "receivedAt"} {
+				if v, ok := args[p]; ok {
+					object[p] = v
+				}
+			}
+			if mailboxIds, _ := object["mailboxIds"].(map[string]any); len(mailboxIds) < 1 {
+				return &jmap.SetError{Type: "invalidProperties", Properties: []string{"mailboxIds"}}
+			}
+			if e := s.validate("Email", jmap.SetOperationCreate, creationId, object); e != nil {
+				return e
+			}
+			object["blobId"] = blobId
+			object["threadId"] = s.id("T")
+			object["size"] = len(b.data)
+			if _, ok := object["receivedAt"]; !ok {
+				object["receivedAt"] = time.Now().UTC().Format(time.RFC3339)
+			}
+			id := s.insert(a, "Email", object)
+			rc.created[creationId] = id
+			if created == nil {
+				created = map[string]any{}
+			}
+			created[creationId] = s.serverSet("Email", object)
+			return nil
+		}()
+		if e != nil {
+			if notCreated == nil {
+				notCreated = map[string]*jmap.SetError{}
+			}
+			notCreated[creationId] = e
+		}
+	}
+
+	if c.stateString() != oldState {
+		s.notify(a, "Email")
+	}
+	rc.respond(inv.name, map[string]any{
+		"accountId":  a.id,
+		"oldState":   oldState,
+		"newState":   c.stateString(),
+		"created":    created,
+		"notCreated": notCreated,
+	}, inv.callId)
+}
+
+// submit implements the creation of EmailSubmission objects as per RFC 8621 section 7.5,
+// where the emails are delivered right away to the inboxes of the accounts that have an
+// identity with the address of a recipient, and are reported as queued for the others.
+func (s *Server) submit(rc *requestContext, a *account, inv invocation) {
+	c := a.collection("EmailSubmission")
+	if ifInState, ok := inv.args["ifInState"].(string); ok && ifInState != c.stateString() {
+		rc.fail(inv.callId, "stateMismatch", "")
+		return
+	}
+	create, _ := inv.args["create"].(map[string]any)
+	if s.Core.MaxObjectsInSet > 0 && uint(len(create)) > s.Core.MaxObjectsInSet {
+		rc.fail(inv.callId, "requestTooLarge", "")
+		return
+	}
+
+	oldState := c.stateString()
+	var created map[string]any
+	var notCreated map[string]*jmap.SetError
+	submitted := map[string]string{}
+	creationIds := slices.SortedFunc(maps.Keys(create), naturalOrder)
+	for _, creationId := range creationIds {
+		e := func() *jmap.SetError {
+			object, ok := create[creationId].(map[string]any)
+			if !ok {
+				return &jmap.SetError{Type: "invalidArguments"}
+			}
+			object, _ = rc.substitute(clone(object))
+			identityId, _ := object["identityId"].(string)
+			identity, ok := a.collection("Identity").objects[identityId]
+			if !ok {
+				return &jmap.SetError{Type: "invalidProperties", Properties: []string{"identityId"}}
+			}
+			emailId, _ := object["emailId"].(string)
+			email, ok := a.collection("Email").objects[emailId]
+			if !ok {
+				return &jmap.SetError{Type: "invalidProperties", Properties: []string{"emailId"}}
+			}
+			if e := s.validate("EmailSubmission", jmap.SetOperationCreate, creationId, object); e != nil {
+				return e
+			}
+			from, _ := identity["email"].(string)
+			if !slices.Contains(addresses(email, "from"), from) {
+				return &jmap.SetError{Type: "forbiddenFrom", Description: from}
+			}
+			recipients := slices.Concat(addresses(email, "to"), addresses(email, "cc"), addresses(email, "bcc"))
+			if len(recipients) < 1 {
+				return &jmap.SetError{Type: "noRecipients"}
+			}
+
+			rcptTo := []any{}
+			status := map[string]any{}
+			for _, r := range recipients {
+				rcptTo = append(rcptTo, map[string]any{"email": r, "parameters": nil})
+				delivered := "queued"
+				if s.deliver(a, email, r) {
+					delivered = "yes"
+				}
+				status[r] = map[string]any{"smtpReply": "250 2.0.0 OK", "delivered": delivered, "displayed": "unknown"}
+			}
+			object["threadId"] = email["threadId"]
+			object["envelope"] = map[string]any{
+				"mailFrom": map[string]any{"email": from, "parameters": nil},
+				"rcptTo":   rcptTo,
+			}
+			object["sendAt"] = time.Now().UTC().Format(time.RFC3339)
+			object["undoStatus"] = "final"
+			object["deliveryStatus"] = status
+			id := s.insert(a, "EmailSubmission", object)
+			rc.created[creationId] = id
+			submitted[id] = emailId
+			if created == nil {
+				created = map[string]any{}
+			}
+			created[creationId] = map[string]any{"id": id, "sendAt": object["sendAt"], "undoStatus": "final"}
+			return nil
+		}()
+		if e != nil {
+			if notCreated == nil {
+				notCreated = map[string]*jmap.SetError{}
+			}
+			notCreated[creationId] = e
+		}
+	}
+
+	if c.stateString() != oldState {
+		s.notify(a, "EmailSubmission")
+	}
+	rc.respond(inv.name, map[string]any{
+		"accountId":  a.id,
+		"oldState":   oldState,
+		"newState":   c.stateString(),
+		"created":    created,
+		"notCreated": notCreated,
+	}, inv.callId)
+
+	// the emails of the submissions that were created are updated with an implicit Email/set
+	// call, whose response has the same call ID
+	onSuccess, _ := inv.args["onSuccessUpdateEmail"].(map[string]any)
+	update := map[string]any{}
+	for ref, patch := range onSuccess {
+		id := ref
+		if creationId, ok := strings.CutPrefix(ref, "#"); ok {
+			id = rc.created[creationId]
+		}
+		if emailId, ok := submitted[id]; ok {
+			update[emailId] = patch
+		}
+	}
+	if len(update) > 0 {
+		s.set(rc, a, "Email", invocation{
+			name:   "Email/set",
+			args:   map[string]any{"accountId": a.id, "update": update},
+			callId: inv.callId,
+		})
+	}
+}
+
+// deliver puts a copy of the email into the inbox of every account that has an identity with
+// the given address, and tells whether there was any.
+func (s *Server) deliver(from *account, email map[string]any, address string) bool {
+	delivered := false
+	for _, a := range s.accounts {
+		found := false
+		for _, identity := range a.collection("Identity").objects {
+			if e, _ := identity["email"].(string); strings.EqualFold(e, address) {
+				found = true
+				break
+			}
+		}
+		inboxId := ""
+		for id, m := range a.collection("Mailbox").objects {
+			if m["role"] == "inbox" {
+				inboxId = id
+				break
+			}
+		}
+		if !found || inboxId == "" {
+			continue
+		}
+		received := clone(email)
+		delete(received, "id")
+		received["mailboxIds"] = map[string]any{inboxId: true}
+		received["keywords"] = map[string]any{}
+		received["receivedAt"] = time.Now().UTC().Format(time.RFC3339)
+		received["threadId"] = s.id("T")
+		if b, ok := from.blobs[fmt.Sprint(email["blobId"])]; ok {
+			blobId := s.id("B")
+			a.blobs[blobId] = b
+			received["blobId"] = blobId
+		}
+		s.insert(a, "Email", received)
+		s.notify(a, "Email")
+		delivered = true
+	}
+	return delivered
+}
+
+// addresses returns the email addresses of the given address property of an email, such as
+// from or to.
+func addresses(email map[string]any, property string) []string {
+	list, _ := email[property].([]any)
+	result := []string{}
+	for _, v := range list {
+		if a, ok := v.(map[string]any); ok {
+			if e, ok := a["email"].(string); ok {
+				result = append(result, e)
+			}
+		}
+	}
+	return result
+}
+
+// changes implements /changes as per RFC 8620 section 5.2, where an object that was created
+// and destroyed since the given state is not reported at all.
+func (s *Server) changes(rc *requestContext, a *account, objectType string, inv invocation) {
+	c := a.collection(objectType)
+	sinceState, _ := inv.args["sinceState"].(string)
+	since, err := strconv.ParseUint(sinceState, 10, 64)
+	if err != nil || since > c.state {
+		rc.fail(inv.callId, "cannotCalculateChanges", "")
+		return
+	}
+	maxChanges, _ := inv.args["maxChanges"].(float64)
+
+	newState := since
+	first := map[string]string{}
+	last := map[string]string{}
+	order := []string{}
+	for _, change := range c.log {
+		if change.state <= since {
+			continue
+		}
+		if _, seen := first[change.id]; !seen {
+			if maxChanges > 0 && len(order) >= int(maxChanges) {
+				break
+			}
+			first[change.id] = change.op
+			order = append(order, change.id)
+		}
+		last[change.id] = change.op
+		newState = change.state
+	}
+
+	created, updated, destroyed := []string{}, []string{}, []string{}
+	for _, id := range order {
+		switch {
+		case first[id] == jmap.SetOperationCreate && last[id] == jmap.SetOperationDestroy:
+		case first[id] == jmap.SetOperationCreate:
+			created = append(created, id)
+		case last[id] == jmap.SetOperationDestroy:
+			destroyed = append(destroyed, id)
+		default:
+			updated = append(updated, id)
+		}
+	}
+	response := map[string]any{
+		"accountId":      a.id,
+		"oldState":       sinceState,
+		"newState":       strconv.FormatUint(newState, 10),
+		"hasMoreChanges": newState < c.state,
+		"created":        created,
+		"updated":        updated,
+		"destroyed":      destroyed,
+	}
+	if objectType == "Mailbox" {
+		response["updatedProperties"] = nil
+	}
+	rc.respond(inv.name, response, inv.callId)
+}
+
+func (s *Server) validate(objectType string, operation string, id string, object map[string]any) *jmap.SetError {
+	if reject, ok := s.rejections[rejection{objectType: objectType, operation: operation}]; ok {
+		return reject(id, object)
+	}
+	return nil
+}
+
+// defaults sets the server-set properties of a new object.
+func (s *Server) defaults(a *account, objectType string, object map[string]any) {
+	switch objectType {
+	case "Email":
+		data := s.message(a, object)
+		blobId := s.id("B")
+		a.blobs[blobId] = blob{data: data, mimetype: "message/rfc822"}
+		object["blobId"] = blobId
+		object["threadId"] = s.id("T")
+		if _, ok := object["size"]; !ok {
+			object["size"] = len(data)
+		}
+		if _, ok := object["receivedAt"]; !ok {
+			object["receivedAt"] = time.Now().UTC().Format(time.RFC3339)
+		}
+	case "Mailbox":
+		if _, ok := object["parentId"]; !ok {
+			object["parentId"] = nil
+		}
+	}
+}
+
+// serverSet returns the properties that are part of the created response.
+func (s *Server) serverSet(objectType string, object map[string]any) map[string]any {
+	result := map[string]any{"id": object["id"]}
+	if objectType == "Email" {
+		for _, p := range []string{"blobId", "threadId", "size"} {
+			result[p] = object[p]
+		}
+	}
+	return result
+}
+
+// substitute replaces references to creation IDs, which are strings that start with '#' in
+// values as well as in keys such as those of mailboxIds, by the IDs of the created objects,
+// and tells whether there were references to objects that were not created yet.
+func (rc *requestContext) substitute(object map[string]any) (map[string]any, bool) {
+	unresolved := false
+	var walk func(v any) any
+	walk = func(v any) any {
+		switch x := v.(type) {
+		case string:
+			if creationId, ok := strings.CutPrefix(x, "#"); ok {
+				if id, ok := rc.created[creationId]; ok {
+					return id
+				}
+				unresolved = true
+			}
+			return x
+		case []any:
+			for i := range x {
+				x[i] = walk(x[i])
+			}
+			return x
+		case map[string]any:
+			result := make(map[string]any, len(x))
+			for k, v := range x {
+				result[walk(k).(string)] = walk(v)
+			}
+			return result
+		default:
+			return x
+		}
+	}
+	return walk(object).(map[string]any), unresolved
+}
+
+// applyPatch applies a PatchObject as per RFC 8620 section 5.3, where null values remove
+// properties.
+func applyPatch(object map[string]any, patch map[string]any) error {
+	for path, value := range patch {
+		tokens := strings.Split(path, "/")
+		target := object
+		for _, token := range tokens[:len(tokens)-1] {
+			token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+			child, ok := target[token].(map[string]any)
+			if !ok {
+				return fmt.Errorf("cannot patch '%s'", path)
+			}
+			target = child
+		}
+		last := strings.ReplaceAll(strings.ReplaceAll(tokens[len(tokens)-1], "~1", "/"), "~0", "~")
+		if last == "id" && len(tokens) == 1 {
+			return fmt.Errorf("the id cannot be changed")
+		}
+		if value == nil {
+			delete(target, last)
+		} else {
+			target[last] = value
+		}
+	}
+	return nil
+}
+
+func (s *Server) query(rc *requestContext, a *account, objectType string, inv invocation) {
+	c := a.collection(objectType)
+	ids := []string{}
+	for _, id := range c.order {
+		match, err := matches(c.objects[id], inv.args["filter"])
+		if err != nil {
+			rc.fail(inv.callId, "unsupportedFilter", err.Error())
+			return
+		}
+		if match {
+			ids = append(ids, id)
+		}
+	}
+
+	if sort, ok := inv.args["sort"].([]any); ok && len(sort) > 0 {
+		slices.SortStableFunc(ids, func(x, y string) int {
+			for _, v := range sort {
+				comparator, _ := v.(map[string]any)
+				property, _ := comparator["property"].(string)
+				r := compare(c.objects[x][property], c.objects[y][property])
+				if ascending, ok := comparator["isAscending"].(bool); ok && !ascending {
+					r = -r
+				}
+				if r != 0 {
+					return r
+				}
+			}
+			return 0
+		})
+	}
+
+	total := len(ids)
+	position := 0
+	if p, ok := inv.args["position"].(float64); ok {
+		position = int(p)
+		if position < 0 {
+			position = max(total+position, 0)
+		}
+	}
+	position = min(position, total)
+	end := total
+	response := map[string]any{
+		"accountId":           a.id,
+		"queryState":          c.stateString(),
+		"canCalculateChanges": false,
+		"position":            position,
+	}
+	limit := -1
+	if l, ok := inv.args["limit"].(float64); ok {
+		limit = int(l)
+	}
+	if s.MaxQueryResults > 0 && (limit < 0 || limit > s.MaxQueryResults) {
+		limit = s.MaxQueryResults
+		response["limit"] = limit
+	}
+	if limit >= 0 {
+		end = min(position+limit, total)
+	}
+	response["ids"] = ids[position:end]
+	if calculateTotal, _ := inv.args["calculateTotal"].(bool); calculateTotal {
+		response["total"] = total
+	}
+	rc.respond(inv.name, response, inv.callId)
+}
+
+// matches evaluates a FilterOperator or a FilterCondition, of which only the conditions that
+// match objects by the collections they are in are supported.
+func matches(object map[string]any, filter any) (bool, error) {
+	f, ok := filter.(map[string]any)
+	if !ok || len(f) == 0 {
+		return true, nil
+	}
+	if operator, ok := f["operator"].(string); ok {
+		conditions, _ := f["conditions"].([]any)
+		count := 0
+		for _, condition := range conditions {
+			match, err := matches(object, condition)
+			if err != nil {
+				return false, err
+			}
+			if match {
+				count++
+			}
+		}
+		switch operator {
+		case "AND":
+			return count == len(conditions), nil
+		case "OR":
+			return count > 0, nil
+		case "NOT":
+			return count == 0, nil
+		default:
+			return false, fmt.Errorf("unknown operator '%s'", operator)
+		}
+	}
+	for condition, value := range f {
+		property, ok := membershipFilters[condition]
+		if !ok {
+			return false, fmt.Errorf("unsupported filter condition '%s'", condition)
+		}
+		id, _ := value.(string)
+		memberships, _ := object[property].(map[string]any)
+		if member, _ := memberships[id].(bool); !member {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func compare(x, y any) int {
+	switch a := x.(type) {
+	case string:
+		b, _ := y.(string)
+		return strings.Compare(a, b)
+	case float64:
+		b, _ := y.(float64)
+		return cmp.Compare(a, b)
+	case bool:
+		b, _ := y.(bool)
+		if a == b {
+			return 0
+		} else if a {
+			return 1
+		}
+		return -1
+	default:
+		if y == nil {
+			return 0
+		}
+		return -1
+	}
+}
+
+// naturalOrder sorts creation IDs such as "c2" before "c10", to create the objects in the
+// order in which they were most likely added to the request.
+func naturalOrder(x, y string) int {
+	px := strings.TrimRight(x, "0123456789")
+	py := strings.TrimRight(y, "0123456789")
+	if px == py {
+		nx, errx := strconv.Atoi(x[len(px):])
+		ny, erry := strconv.Atoi(y[len(py):])
+		if errx == nil && erry == nil {
+			return cmp.Compare(nx, ny)
+		}
+	}
+	return strings.Compare(x, y)
+}
+
+// normalize turns a value into its generic JSON representation, for result references to be
+// evaluated against it.
+func normalize(v any) map[string]any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("failed to marshal response: %v", err))
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		panic(fmt.Sprintf("failed to unmarshal response: %v", err))
+	}
+	return m
+}
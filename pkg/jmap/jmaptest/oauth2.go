@@ -0,0 +1,130 @@
+package jmaptest
+
+import (
+	"net/http"
+	"time"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+)
+
+// client is an OAuth2 client that may obtain tokens from the token endpoint, on behalf of the
+// given user for the client credentials grant.
+type client struct {
+	secret   string
+	username string
+}
+
+// issued is an access token that was issued by the token endpoint.
+type issued struct {
+	username string
+	expiry   time.Time
+}
+
+// AddClient registers an OAuth2 client with the token endpoint at TokenUrl, which obtains
+// tokens for the given user with the client credentials grant, and for any user with the
+// password grant. The secret may be empty for a public client.
+func (s *Server) AddClient(clientId string, secret string, username string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.clients[clientId] = client{secret: secret, username: username}
+}
+
+// TokenUrl returns the URL of the OAuth2 token endpoint, which issues access tokens that
+// expire after TokenLifetime when it is greater than zero, along with refresh tokens.
+func (s *Server) TokenUrl() string {
+	return s.URL + "/oauth2/token"
+}
+
+// ExpireTokens makes all the access tokens that were issued so far invalid, as if they had
+// expired or been revoked, for the requests that use them to be rejected with a 401.
+func (s *Server) ExpireTokens() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.issued = map[string]issued{}
+}
+
+// Grants returns the grant types of the successful token requests, in the order in which
+// they were made.
+func (s *Server) Grants() []string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([]string{}, s.grants...)
+}
+
+// tokenUser returns the user that an issued access token is valid for, if any.
+func (s *Server) tokenUser(token string) *user {
+	t, ok := s.issued[token]
+	if !ok || (!t.expiry.IsZero() && time.Now().After(t.expiry)) {
+		return nil
+	}
+	return s.users[t.username]
+}
+
+// handleToken implements the token endpoint of RFC 6749 section 3.2 for the client
+// credentials, resource owner password and refresh token grants.
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]any{"error": "invalid_request"})
+		return
+	}
+	// the server only notices that the client has gone once the body has been read
+	select {
+	case <-time.After(s.TokenDelay):
+	case <-r.Context().Done():
+		return
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	clientId, secret, ok := r.BasicAuth()
+	if !ok {
+		clientId, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	c, ok := s.clients[clientId]
+	if !ok || c.secret != secret {
+		writeJson(w, http.StatusUnauthorized, map[string]any{"error": "invalid_client"})
+		return
+	}
+
+	grant := r.PostForm.Get("grant_type")
+	username := ""
+	switch grant {
+	case jmap.OAuth2ClientCredentialsGrant:
+		username = c.username
+	case jmap.OAuth2PasswordGrant:
+		u, ok := s.users[r.PostForm.Get("username")]
+		if !ok || u.password != r.PostForm.Get("password") {
+			writeJson(w, http.StatusBadRequest, map[string]any{"error": "invalid_grant", "error_description": "invalid username or password"})
+			return
+		}
+		username = u.username
+	case "refresh_token":
+		refreshToken := r.PostForm.Get("refresh_token")
+		if username, ok = s.refreshTokens[refreshToken]; !ok {
+			writeJson(w, http.StatusBadRequest, map[string]any{"error": "invalid_grant", "error_description": "unknown refresh token"})
+			return
+		}
+		// refresh tokens are rotated, as per RFC 6819 section 5.2.2.3
+		delete(s.refreshTokens, refreshToken)
+	default:
+		writeJson(w, http.StatusBadRequest, map[string]any{"error": "unsupported_grant_type"})
+		return
+	}
+
+	accessToken := s.id("at")
+	t := issued{username: username}
+	response := map[string]any{"access_token": accessToken, "token_type": "Bearer"}
+	if s.TokenLifetime > 0 {
+		t.expiry = time.Now().Add(s.TokenLifetime)
+		response["expires_in"] = int(s.TokenLifetime.Seconds())
+	}
+	s.issued[accessToken] = t
+	// as per RFC 6749 section 4.4.3, there is no refresh token for the client credentials grant
+	if grant != jmap.OAuth2ClientCredentialsGrant {
+		refreshToken := s.id("rt")
+		s.refreshTokens[refreshToken] = username
+		response["refresh_token"] = refreshToken
+	}
+	s.grants = append(s.grants, grant)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJson(w, http.StatusOK, response)
+}
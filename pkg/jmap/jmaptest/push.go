@@ -0,0 +1,136 @@
+package jmaptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// subscriber is a client that is connected to the event source, to which the state changes
+// are pushed, coalesced while it is busy.
+type subscriber struct {
+	user  *user
+	types map[string]bool
+	m     sync.Mutex
+	// the new states by type, by account, that were not pushed yet
+	pending map[string]map[string]string
+	wake    chan struct{}
+}
+
+// notify queues a StateChange for the subscribers that have access to the account and are
+// interested in the given type.
+func (s *Server) notify(a *account, objectType string) {
+	state := a.collection(objectType).stateString()
+	for sub := range s.subscribers {
+		if !sub.user.mayAccess(a.id) || (sub.types != nil && !sub.types[objectType]) {
+			continue
+		}
+		sub.m.Lock()
+		if sub.pending[a.id] == nil {
+			sub.pending[a.id] = map[string]string{}
+		}
+		sub.pending[a.id][objectType] = state
+		sub.m.Unlock()
+		select {
+		case sub.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (sub *subscriber) take() map[string]map[string]string {
+	sub.m.Lock()
+	defer sub.m.Unlock()
+	changed := sub.pending
+	sub.pending = map[string]map[string]string{}
+	return changed
+}
+
+// EventSources returns the number of connections to the event source that were opened so far.
+func (s *Server) EventSources() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.eventSources
+}
+
+// handleEventSource pushes StateChange events as per RFC 8620 section 7.3.
+func (s *Server) handleEventSource(w http.ResponseWriter, r *http.Request) {
+	s.m.Lock()
+	u := s.authenticate(r)
+	if u == nil {
+		s.m.Unlock()
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if s.injectedFailure(w) {
+		s.m.Unlock()
+		return
+	}
+	s.eventSources++
+	sub := &subscriber{user: u, pending: map[string]map[string]string{}, wake: make(chan struct{}, 1)}
+	if types := r.URL.Query().Get("types"); types != "*" && types != "" {
+		sub.types = map[string]bool{}
+		for _, t := range strings.Split(types, ",") {
+			sub.types[t] = true
+		}
+	}
+	s.subscribers[sub] = struct{}{}
+	s.m.Unlock()
+	defer func() {
+		s.m.Lock()
+		delete(s.subscribers, sub)
+		s.m.Unlock()
+	}()
+
+	closeAfterState := r.URL.Query().Get("closeafter") == "state"
+	var ping <-chan time.Time = nil
+	interval, _ := strconv.Atoi(r.URL.Query().Get("ping"))
+	if interval > 0 {
+		t := time.NewTicker(time.Duration(interval) * time.Second)
+		defer t.Stop()
+		ping = t.C
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	send := func(event string, data any) bool {
+		b, err := json.Marshal(data)
+		if err == nil {
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return err == nil
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			return
+		case <-ping:
+			if !send("ping", map[string]any{"@type": "Ping", "interval": interval}) {
+				return
+			}
+		case <-sub.wake:
+			changed := sub.take()
+			if len(changed) == 0 {
+				continue
+			}
+			if !send("state", map[string]any{"@type": "StateChange", "changed": changed}) || closeAfterState {
+				return
+			}
+		}
+	}
+}
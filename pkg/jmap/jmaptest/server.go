@@ -0,0 +1,685 @@
+// Package jmaptest provides an in-memory JMAP server for tests, that implements just enough of
+// JMAP Core, Mail, Contacts, Calendars and Tasks to exercise the senders and generators offline.
+package jmaptest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+)
+
+const (
+	DefaultUsername = "alan"
+	DefaultPassword = "demo"
+	// the domain of the email address of the default identity of every user
+	DefaultDomain = "example.com"
+)
+
+// the capability that is required to use the methods of each object type
+var objectTypes = map[string]string{
+	"Blob":            jmap.JmapCore,
+	"Mailbox":         jmap.JmapMail,
+	"Email":           jmap.JmapMail,
+	"Thread":          jmap.JmapMail,
+	"Identity":        jmap.JmapSubmission,
+	"EmailSubmission": jmap.JmapSubmission,
+	"AddressBook":     jmap.JmapContacts,
+	"ContactCard":     jmap.JmapContacts,
+	"Calendar":        jmap.JmapCalendars,
+	"CalendarEvent":   jmap.JmapCalendars,
+	"TaskList":        jmap.JmapTasks,
+	"Task":            jmap.JmapTasks,
+}
+
+// the /query filter conditions that match objects by the collection they are in
+var membershipFilters = map[string]string{
+	"inMailbox":     "mailboxIds",
+	"inAddressBook": "addressBookIds",
+	"inCalendar":    "calendarIds",
+	"inTaskList":    "taskListIds",
+}
+
+type user struct {
+	username  string
+	password  string
+	accountId string
+	// the accounts of other users that were shared with this one
+	shared []string
+}
+
+func (u *user) mayAccess(accountId string) bool {
+	return accountId == u.accountId || slices.Contains(u.shared, accountId)
+}
+
+type collection struct {
+	objects map[string]map[string]any
+	order   []string
+	state   uint64
+	// what changed with every state, for /changes
+	log []change
+}
+
+type change struct {
+	state uint64
+	id    string
+	op    string
+}
+
+type account struct {
+	id          string
+	name        string
+	collections map[string]*collection
+	blobs       map[string]blob
+}
+
+type blob struct {
+	data     []byte
+	mimetype string
+}
+
+type httpFailure struct {
+	times      int
+	status     int
+	retryAfter string
+}
+
+type methodFailure struct {
+	times       int
+	errorType   string
+	description string
+}
+
+type cannedResponse struct {
+	times int
+	args  map[string]any
+}
+
+// Server is an in-memory JMAP server that listens on a local port.
+//
+// The limits that are advertised in the session can be changed through Core before the
+// first request is made, and failures can be injected with FailHTTP, FailMethod and Reject.
+type Server struct {
+	*httptest.Server
+	Core jmap.CoreCapabilities
+	// caps the number of IDs that are returned by a single /query, regardless of its limit,
+	// when greater than zero
+	MaxQueryResults int
+	// how long the access tokens of the OAuth2 token endpoint are valid, forever when zero
+	TokenLifetime time.Duration
+	// how long every token request takes, for several requests to wait for the same token
+	TokenDelay time.Duration
+	// how long every upload takes, for several uploads of the same blob to be in flight at once
+	UploadDelay time.Duration
+	// how many bytes of blobs every account may hold, which uploads beyond are rejected with
+	// 507 Insufficient Storage, without a limit when zero
+	BlobQuota int
+	// a cookie to set on every response, as load balancers do for sticky sessions, if any
+	Cookie *http.Cookie
+
+	m              sync.Mutex
+	users          map[string]*user
+	tokens         map[string]string
+	clients        map[string]client
+	issued         map[string]issued
+	refreshTokens  map[string]string
+	grants         []string
+	accounts       map[string]*account
+	nextId         uint64
+	httpFailures   []httpFailure
+	methodFailures map[string]*methodFailure
+	responses      map[string]*cannedResponse
+	rejections     map[rejection]func(id string, object map[string]any) *jmap.SetError
+	requests       int
+	uploads        int
+	eventSources   int
+	subscribers    map[*subscriber]struct{}
+	closed         chan struct{}
+}
+
+// NewServer starts a server with a single user, DefaultUsername, whose account has an inbox,
+// a drafts and a sent Mailbox, an Identity, a default AddressBook, a default Calendar and an
+// inbox TaskList.
+func NewServer() *Server {
+	s := NewUnstartedServer()
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a server like NewServer that is not started yet, for its TLS
+// settings to be changed before it is started with StartTLS.
+func NewUnstartedServer() *Server {
+	s := &Server{
+		Core: jmap.CoreCapabilities{
+			MaxSizeUpload:         50_000_000,
+			MaxConcurrentUpload:   4,
+			MaxSizeRequest:        10_000_000,
+			MaxConcurrentRequests: 4,
+			MaxCallsInRequest:     16,
+			MaxObjectsInGet:       500,
+			MaxObjectsInSet:       500,
+			CollationAlgorithms:   []string{"i;ascii-casemap"},
+		},
+		users:          map[string]*user{},
+		tokens:         map[string]string{},
+		clients:        map[string]client{},
+		issued:         map[string]issued{},
+		refreshTokens:  map[string]string{},
+		accounts:       map[string]*account{},
+		methodFailures: map[string]*methodFailure{},
+		responses:      map[string]*cannedResponse{},
+		rejections:     map[rejection]func(string, map[string]any) *jmap.SetError{},
+		subscribers:    map[*subscriber]struct{}{},
+		closed:         make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/jmap", s.handleSession)
+	mux.HandleFunc("POST /api", s.handleApi)
+	mux.HandleFunc("POST /upload/{accountId}/", s.handleUpload)
+	mux.HandleFunc("GET /download/{accountId}/{blobId}/{name}", s.handleDownload)
+	mux.HandleFunc("GET /eventsource", s.handleEventSource)
+	mux.HandleFunc("POST /oauth2/token", s.handleToken)
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Cookie != nil {
+			http.SetCookie(w, s.Cookie)
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	s.AddUser(DefaultUsername, DefaultPassword)
+	return s
+}
+
+// Close ends the streams of the event source, which would otherwise keep the server from
+// shutting down, and then shuts it down.
+func (s *Server) Close() {
+	close(s.closed)
+	s.Server.Close()
+}
+
+// AddUser adds a user with an account of its own, with the same default collections as the
+// account of the DefaultUsername, and returns the ID of that account. The user has an identity
+// with the username as email address when it is one, or at the DefaultDomain otherwise, to
+// which the emails that are submitted by other users are delivered.
+func (s *Server) AddUser(username string, password string) string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	a := &account{
+		id:          s.id("a"),
+		name:        username,
+		collections: map[string]*collection{},
+		blobs:       map[string]blob{},
+	}
+	s.accounts[a.id] = a
+	s.users[username] = &user{username: username, password: password, accountId: a.id}
+
+	s.insert(a, "Mailbox", map[string]any{"name": "Inbox", "role": "inbox", "parentId": nil, "sortOrder": 0, "isSubscribed": true})
+	s.insert(a, "Mailbox", map[string]any{"name": "Drafts", "role": "drafts", "parentId": nil, "sortOrder": 1, "isSubscribed": true})
+	s.insert(a, "Mailbox", map[string]any{"name": "Sent", "role": "sent", "parentId": nil, "sortOrder": 2, "isSubscribed": true})
+	email := username
+	if !strings.Contains(email, "@") {
+		email += "@" + DefaultDomain
+	}
+	s.insert(a, "Identity", map[string]any{"name": username, "email": email, "replyTo": nil, "bcc": nil, "textSignature": "", "htmlSignature": "", "mayDelete": false})
+	s.insert(a, "AddressBook", map[string]any{"name": "Contacts", "isDefault": true})
+	s.insert(a, "Calendar", map[string]any{"name": "Calendar", "isDefault": true})
+	s.insert(a, "TaskList", map[string]any{"name": "Tasks", "role": "inbox"})
+	return a.id
+}
+
+// AddToken allows the given user to authenticate with a bearer token.
+func (s *Server) AddToken(token string, username string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.tokens[token] = username
+}
+
+// Share gives the given user access to another account, which is then listed in its session
+// as a non-personal account.
+func (s *Server) Share(accountId string, username string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if u, ok := s.users[username]; ok && !u.mayAccess(accountId) {
+		u.shared = append(u.shared, accountId)
+	}
+}
+
+// AccountId returns the ID of the account of the given user.
+func (s *Server) AccountId(username string) string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if u, ok := s.users[username]; ok {
+		return u.accountId
+	}
+	return ""
+}
+
+// Objects returns copies of all the objects of the given type in an account, in the order in
+// which they were created.
+func (s *Server) Objects(accountId string, objectType string) []map[string]any {
+	s.m.Lock()
+	defer s.m.Unlock()
+	a, ok := s.accounts[accountId]
+	if !ok {
+		return nil
+	}
+	c := a.collection(objectType)
+	result := make([]map[string]any, 0, len(c.order))
+	for _, id := range c.order {
+		result = append(result, clone(c.objects[id]))
+	}
+	return result
+}
+
+// Put stores an object of the given type in an account, bypassing /set, and returns its ID,
+// which is the one of the object if it has one already.
+func (s *Server) Put(accountId string, objectType string, object map[string]any) string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	a := s.accounts[accountId]
+	id := s.insert(a, objectType, clone(object))
+	s.notify(a, objectType)
+	return id
+}
+
+// Blob returns the content of an uploaded blob.
+func (s *Server) Blob(accountId string, blobId string) ([]byte, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if a, ok := s.accounts[accountId]; ok {
+		b, ok := a.blobs[blobId]
+		return b.data, ok
+	}
+	return nil, false
+}
+
+// PutBlob stores a blob in an account, bypassing the upload, and returns its ID.
+func (s *Server) PutBlob(accountId string, data []byte, mimetype string) string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	blobId := s.id("B")
+	s.accounts[accountId].blobs[blobId] = blob{data: data, mimetype: mimetype}
+	return blobId
+}
+
+// Requests returns the number of HTTP requests that were made to the API, upload and download endpoints.
+func (s *Server) Requests() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.requests
+}
+
+// Uploads returns how many blobs were uploaded so far.
+func (s *Server) Uploads() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.uploads
+}
+
+// FailHTTP makes the next API, upload, download or event source requests fail with the given
+// HTTP status, along with a Retry-After header unless it is empty.
+func (s *Server) FailHTTP(times int, status int, retryAfter string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.httpFailures = append(s.httpFailures, httpFailure{times: times, status: status, retryAfter: retryAfter})
+}
+
+// FailMethod makes the next calls of the given method, e.g. "Email/set", yield an error
+// response with the given type, e.g. "serverFail".
+func (s *Server) FailMethod(method string, times int, errorType string, description string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.methodFailures[method] = &methodFailure{times: times, errorType: errorType, description: description}
+}
+
+// Respond makes the next calls of the given method return the given arguments rather than
+// being processed, for responses that the server would not give on its own.
+func (s *Server) Respond(method string, times int, args map[string]any) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.responses[method] = &cannedResponse{times: times, args: args}
+}
+
+type rejection struct {
+	objectType string
+	operation  string
+}
+
+// Reject installs a check of the objects of the given type that are created, updated or
+// destroyed with /set, depending on the operation (e.g. jmap.SetOperationCreate), which
+// rejects an object by returning a SetError for it.
+//
+// The check is passed the creation ID or the ID of the object, along with the object as it was
+// sent for creation, the patch for an update, or the stored object for its destruction.
+// It is invoked while the server is locked and hence must not call any method of it.
+func (s *Server) Reject(objectType string, operation string, reject func(id string, object map[string]any) *jmap.SetError) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.rejections[rejection{objectType: objectType, operation: operation}] = reject
+}
+
+func (s *Server) id(prefix string) string {
+	s.nextId++
+	return prefix + strconv.FormatUint(s.nextId, 10)
+}
+
+func (a *account) collection(objectType string) *collection {
+	c, ok := a.collections[objectType]
+	if !ok {
+		c = &collection{objects: map[string]map[string]any{}, order: []string{}}
+		a.collections[objectType] = c
+	}
+	return c
+}
+
+func (c *collection) stateString() string {
+	return strconv.FormatUint(c.state, 10)
+}
+
+func (s *Server) insert(a *account, objectType string, object map[string]any) string {
+	c := a.collection(objectType)
+	id, _ := object["id"].(string)
+	if id == "" {
+		id = s.id(strings.ToLower(objectType[:1]))
+	}
+	object["id"] = id
+	c.objects[id] = object
+	c.order = append(c.order, id)
+	c.record(id, jmap.SetOperationCreate)
+	return id
+}
+
+// record moves the collection to a new state, in which the object with the given ID was
+// created, updated or destroyed.
+func (c *collection) record(id string, op string) {
+	c.state++
+	c.log = append(c.log, change{state: c.state, id: id, op: op})
+}
+
+func (c *collection) remove(id string) {
+	delete(c.objects, id)
+	for i, o := range c.order {
+		if o == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	c.record(id, jmap.SetOperationDestroy)
+}
+
+// authenticate returns the user that the request is authenticated as, if any.
+func (s *Server) authenticate(r *http.Request) *user {
+	header := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+		if username, ok := s.tokens[token]; ok {
+			return s.users[username]
+		}
+		return s.tokenUser(token)
+	}
+	if encoded, ok := strings.CutPrefix(header, "Basic "); ok {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil
+		}
+		username, password, _ := strings.Cut(string(decoded), ":")
+		if u, ok := s.users[username]; ok && u.password == password {
+			return u
+		}
+	}
+	return nil
+}
+
+// injectedFailure writes the next injected HTTP failure, if there is one.
+func (s *Server) injectedFailure(w http.ResponseWriter) bool {
+	for len(s.httpFailures) > 0 {
+		f := &s.httpFailures[0]
+		if f.times < 1 {
+			s.httpFailures = s.httpFailures[1:]
+			continue
+		}
+		f.times--
+		if f.retryAfter != "" {
+			w.Header().Set("Retry-After", f.retryAfter)
+		}
+		http.Error(w, http.StatusText(f.status), f.status)
+		return true
+	}
+	return false
+}
+
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	u := s.authenticate(r)
+	if u == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	capabilities := map[string]any{
+		jmap.JmapCore:       s.Core,
+		jmap.JmapMail:       map[string]any{},
+		jmap.JmapSubmission: map[string]any{},
+		jmap.JmapContacts:   map[string]any{},
+		jmap.JmapCalendars:  map[string]any{},
+		jmap.JmapTasks:      map[string]any{},
+	}
+	accountCapabilities := map[string]any{
+		jmap.JmapMail: jmap.MailAccountCapabilities{
+			MaxSizeMailboxName:         255,
+			MaxSizeAttachmentsPerEmail: 50_000_000,
+			EmailQuerySortOptions:      []string{"receivedAt", "sentAt", "size", "subject"},
+			MayCreateTopLevelMailbox:   true,
+		},
+		jmap.JmapSubmission: jmap.SubmissionAccountCapabilities{MaxDelayedSend: 0, SubmissionExtensions: map[string][]string{}},
+		jmap.JmapContacts:   jmap.ContactsAccountCapabilities{MayCreateAddressBook: true},
+		jmap.JmapCalendars:  jmap.CalendarsAccountCapabilities{MayCreateCalendar: true},
+		jmap.JmapTasks:      jmap.TasksAccountCapabilities{MayCreateTaskList: true},
+	}
+	primaryAccounts := map[string]string{}
+	for capability := range capabilities {
+		if capability != jmap.JmapCore {
+			primaryAccounts[capability] = u.accountId
+		}
+	}
+
+	accounts := map[string]any{}
+	for _, id := range append([]string{u.accountId}, u.shared...) {
+		accounts[id] = map[string]any{
+			"name":                s.accounts[id].name,
+			"isPersonal":          id == u.accountId,
+			"isReadOnly":          false,
+			"accountCapabilities": accountCapabilities,
+		}
+	}
+
+	writeJson(w, http.StatusOK, map[string]any{
+		"capabilities":    capabilities,
+		"accounts":        accounts,
+		"primaryAccounts": primaryAccounts,
+		"username":        u.username,
+		"apiUrl":          s.URL + "/api",
+		"uploadUrl":       s.URL + "/upload/{accountId}/",
+		"downloadUrl":     s.URL + "/download/{accountId}/{blobId}/{name}?accept={type}",
+		"eventSourceUrl":  s.URL + "/eventsource?types={types}&closeafter={closeafter}&ping={ping}",
+		"state":           "0",
+	})
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(s.UploadDelay)
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.requests++
+	if s.injectedFailure(w) {
+		return
+	}
+	u := s.authenticate(r)
+	if u == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	accountId := r.PathValue("accountId")
+	a, ok := s.accounts[accountId]
+	if !ok || !u.mayAccess(accountId) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, int64(s.Core.MaxSizeUpload)+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.Core.MaxSizeUpload > 0 && uint(len(data)) > s.Core.MaxSizeUpload {
+		writeProblem(w, http.StatusRequestEntityTooLarge, "urn:ietf:params:jmap:error:limit", "maxSizeUpload", "blob is too large")
+		return
+	}
+	if s.BlobQuota > 0 {
+		used := len(data)
+		for _, b := range a.blobs {
+			used += len(b.data)
+		}
+		if used > s.BlobQuota {
+			http.Error(w, "Insufficient Storage", http.StatusInsufficientStorage)
+			return
+		}
+	}
+	mimetype := r.Header.Get("Content-Type")
+	blobId := s.id("B")
+	a.blobs[blobId] = blob{data: data, mimetype: mimetype}
+	s.uploads++
+	writeJson(w, http.StatusCreated, map[string]any{
+		"accountId": accountId,
+		"blobId":    blobId,
+		"type":      mimetype,
+		"size":      len(data),
+	})
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.requests++
+	if s.injectedFailure(w) {
+		return
+	}
+	u := s.authenticate(r)
+	if u == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	accountId := r.PathValue("accountId")
+	a, ok := s.accounts[accountId]
+	if !ok || !u.mayAccess(accountId) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	b, ok := a.blobs[r.PathValue("blobId")]
+	if !ok {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	mimetype := r.URL.Query().Get("accept")
+	if mimetype == "" {
+		mimetype = b.mimetype
+	}
+	w.Header().Set("Content-Type", mimetype)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": r.PathValue("name")}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(b.data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(b.data)
+}
+
+type apiRequest struct {
+	Using       []string            `json:"using"`
+	MethodCalls [][]json.RawMessage `json:"methodCalls"`
+}
+
+func (s *Server) handleApi(w http.ResponseWriter, r *http.Request) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.requests++
+	if s.injectedFailure(w) {
+		return
+	}
+	u := s.authenticate(r)
+	if u == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.Core.MaxSizeRequest > 0 && uint(len(body)) > s.Core.MaxSizeRequest {
+		writeProblem(w, http.StatusBadRequest, "urn:ietf:params:jmap:error:limit", "maxSizeRequest", "request is too large")
+		return
+	}
+	var req apiRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeProblem(w, http.StatusBadRequest, "urn:ietf:params:jmap:error:notJSON", "", err.Error())
+		return
+	}
+	if s.Core.MaxCallsInRequest > 0 && uint(len(req.MethodCalls)) > s.Core.MaxCallsInRequest {
+		writeProblem(w, http.StatusBadRequest, "urn:ietf:params:jmap:error:limit", "maxCallsInRequest", "too many method calls")
+		return
+	}
+
+	rc := &requestContext{user: u, using: req.Using, created: map[string]string{}}
+	for _, call := range req.MethodCalls {
+		var inv invocation
+		if len(call) != 3 || json.Unmarshal(call[0], &inv.name) != nil || json.Unmarshal(call[1], &inv.args) != nil || json.Unmarshal(call[2], &inv.callId) != nil {
+			writeProblem(w, http.StatusBadRequest, "urn:ietf:params:jmap:error:notRequest", "", "malformed method call")
+			return
+		}
+		s.call(rc, inv)
+	}
+
+	methodResponses := make([]any, len(rc.responses))
+	for i, r := range rc.responses {
+		methodResponses[i] = []any{r.name, r.args, r.callId}
+	}
+	writeJson(w, http.StatusOK, map[string]any{
+		"methodResponses": methodResponses,
+		"sessionState":    "0",
+	})
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeProblem(w http.ResponseWriter, status int, problemType string, limit string, detail string) {
+	problem := map[string]any{"type": problemType, "status": status, "detail": detail}
+	if limit != "" {
+		problem["limit"] = limit
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+func clone(object map[string]any) map[string]any {
+	b, err := json.Marshal(object)
+	if err != nil {
+		panic(fmt.Sprintf("failed to clone object: %v", err))
+	}
+	var c map[string]any
+	if err := json.Unmarshal(b, &c); err != nil {
+		panic(fmt.Sprintf("failed to clone object: %v", err))
+	}
+	return c
+}
@@ -0,0 +1,133 @@
+package jmap
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"opencloud.eu/groupware-assistant/pkg/models"
+)
+
+type MailboxSender struct {
+	j           *Jmap
+	accountId   string
+	parentId    string
+	parentDepth uint
+	limits      MailAccountCapabilities
+	batch       *batch
+}
+
+// NewMailboxSender creates a sender for mailboxes below the mailbox with the given ID, or at the
+// top level when it is empty.
+func NewMailboxSender(ctx context.Context, j *Jmap, accountId string, parentId string) (*MailboxSender, error) {
+	accountId, err := j.account(accountId, JmapMail)
+	if err != nil {
+		return nil, err
+	}
+
+	var limits MailAccountCapabilities
+	if err := j.session.Accounts[accountId].AccountCapabilities.Decode(JmapMail, &limits); err != nil {
+		return nil, fmt.Errorf("failed to parse the mail capabilities of account '%s': %w", accountId, err)
+	}
+
+	parentDepth := uint(0)
+	if parentId == "" {
+		if !limits.MayCreateTopLevelMailbox {
+			return nil, fmt.Errorf("account '%s' may not create top-level mailboxes (mayCreateTopLevelMailbox)", accountId)
+		}
+	} else {
+		mailboxesById, err := objectsById(ctx, j, accountId, "Mailbox", JmapMail)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := mailboxesById[parentId]; !ok {
+			return nil, fmt.Errorf("mailbox with id '%s' does not exist", parentId)
+		}
+		for id := parentId; id != "" && parentDepth <= uint(len(mailboxesById)); parentDepth++ {
+			id, _ = mailboxesById[id]["parentId"].(string)
+		}
+		if limits.MaxMailboxDepth != nil && parentDepth >= *limits.MaxMailboxDepth {
+			return nil, fmt.Errorf("mailbox with id '%s' cannot have any children, it is at the maxMailboxDepth of %d", parentId, *limits.MaxMailboxDepth)
+		}
+	}
+
+	return &MailboxSender{
+		j:           j,
+		accountId:   accountId,
+		parentId:    parentId,
+		parentDepth: parentDepth,
+		limits:      limits,
+		batch:       newBatch(j, accountId, "Mailbox", JmapMail),
+	}, nil
+}
+
+func (s *MailboxSender) Close() error {
+	return nil
+}
+
+// Parent returns the ID of the mailbox below which the mailboxes are created, if any.
+func (s *MailboxSender) Parent() string {
+	return s.parentId
+}
+
+// MaxDepth returns how many levels of mailboxes may be created below the parent, as per the
+// maxMailboxDepth of the account, or zero when there is no limit.
+func (s *MailboxSender) MaxDepth() uint {
+	if s.limits.MaxMailboxDepth == nil {
+		return 0
+	}
+	return *s.limits.MaxMailboxDepth - s.parentDepth
+}
+
+// QueueMailbox queues the mailbox for creation, after checking its name against the
+// maxSizeMailboxName of the account, and returns a reference to it, which the mailboxes that
+// are queued after it may use as their ParentId, as per RFC 8620 section 5.3.
+//
+// The mailbox is sent along with others once enough of them have been queued, or when Flush
+// is called, after which done is invoked with the ID of the created mailbox or with the error
+// that prevented its creation.
+func (s *MailboxSender) QueueMailbox(ctx context.Context, m models.Mailbox, done func(id string, err error) error) (string, error) {
+	ref := s.batch.reference()
+	if s.limits.MaxSizeMailboxName > 0 && uint(len(m.Name)) > s.limits.MaxSizeMailboxName {
+		// not to have the next mailbox take its creation ID, which children may refer to
+		s.batch.next++
+		return ref, done("", fmt.Errorf("the name '%s' has %d bytes, the server accepts at most %d (maxSizeMailboxName)", m.Name, len(m.Name), s.limits.MaxSizeMailboxName))
+	}
+	return ref, s.batch.addResolved(ctx, func(created map[string]string) any {
+		// a parent that was created by an earlier request is referred to by its ID
+		if m.ParentId != nil && strings.HasPrefix(*m.ParentId, "#") {
+			if id, ok := created[strings.TrimPrefix(*m.ParentId, "#")]; ok {
+				resolved := m
+				resolved.ParentId = &id
+				return resolved
+			}
+		}
+		return m
+	}, done)
+}
+
+// Flush sends all the mailboxes that are currently queued.
+func (s *MailboxSender) Flush(ctx context.Context) error {
+	return s.batch.flush(ctx)
+}
+
+// Folders returns the ID of the mailbox of the sender, followed by the IDs of the mailboxes
+// that have no role, which are the folders of the user rather than those of the system.
+func (s *EmailSender) Folders(ctx context.Context) ([]string, error) {
+	mailboxesById, err := objectsById(ctx, s.j, s.accountId, "Mailbox", JmapMail)
+	if err != nil {
+		return nil, err
+	}
+	folders := []string{}
+	for id, mailbox := range mailboxesById {
+		if role, _ := mailbox["role"].(string); role == "" && id != s.mailboxId {
+			folders = append(folders, id)
+		}
+	}
+	slices.Sort(folders)
+	if s.mailboxId == "" {
+		return folders, nil
+	}
+	return append([]string{s.mailboxId}, folders...), nil
+}
@@ -0,0 +1,211 @@
+package jmap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StateChange is pushed by the server when objects of some types changed, with their new state
+// by type, by account, as per RFC 8620 section 7.1.
+type StateChange struct {
+	Type    string                       `json:"@type"`
+	Changed map[string]map[string]string `json:"changed"`
+}
+
+// Watch subscribes to the event source of the server for changes of objects of the given types,
+// or of all of them when there are none, and passes the StateChange events to onState, and the
+// pings that the server sends every ping seconds, unless it is zero, to onPing unless it is nil.
+//
+// When closeAfterState is set, the server closes the connection after every StateChange, which
+// is then opened again, as it is when the server closes it for any other reason. Either way,
+// it is opened again after the delay of the RetryPolicy, or the one that the server asked for
+// with a Retry-After header or the retry field of the event stream, for a server that keeps
+// closing it not to be flooded with connections. Watch only returns when the context is
+// cancelled, when onState fails, or when the connection cannot be opened again as per the
+// RetryPolicy.
+func (j *Jmap) Watch(ctx context.Context, types []string, ping uint, closeAfterState bool, onState func(StateChange) error, onPing func()) error {
+	if j.session.EventSourceUrl == "" {
+		return fmt.Errorf("the JMAP server does not push changes, its session has no eventSourceUrl")
+	}
+	typesParam := "*"
+	if len(types) > 0 {
+		typesParam = strings.Join(types, ",")
+	}
+	closeAfter := "no"
+	if closeAfterState {
+		closeAfter = "state"
+	}
+	eventSourceUrl := strings.NewReplacer(
+		"{types}", url.QueryEscape(typesParam),
+		"{closeafter}", closeAfter,
+		"{ping}", strconv.FormatUint(uint64(ping), 10),
+	).Replace(j.session.EventSourceUrl)
+
+	attempt := uint(0)
+	for {
+		connected, wait, err := j.listen(ctx, attempt, eventSourceUrl, onState, onPing)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var failed *fatalError
+		if errors.As(err, &failed) {
+			return failed.err
+		}
+		if connected {
+			attempt = 0
+		}
+		reason := "the JMAP event source closed the connection"
+		if err != nil {
+			reason = err.Error()
+		} else if !closeAfterState {
+			err = errors.New(reason)
+		}
+		// the server closing the connection after a state change as asked is no failure
+		if err != nil && attempt >= j.retry.MaxRetries {
+			return err
+		}
+		attempt++
+		if err := j.backoff(ctx, attempt, wait, reason); err != nil {
+			return err
+		}
+	}
+}
+
+// fatalError ends watching rather than connecting again, e.g. when a callback failed.
+type fatalError struct {
+	err error
+}
+
+func (e *fatalError) Error() string {
+	return e.err.Error()
+}
+
+// listen reads the events from a single connection to the event source, and tells whether the
+// connection could be established, and how long the server asked to wait before connecting
+// again, if at all.
+//
+// The connection is traced like the other requests, of which the trace file gets the events
+// that were received once it has been closed.
+func (j *Jmap) listen(ctx context.Context, attempt uint, eventSourceUrl string, onState func(StateChange) error, onPing func()) (bool, time.Duration, error) {
+	x := exchange{
+		method:     http.MethodGet,
+		url:        eventSourceUrl,
+		header:     http.Header{"Accept": {"text/event-stream"}, "Cache-Control": {"no-cache"}},
+		idempotent: true,
+	}
+	refreshed := false
+	var req *http.Request = nil
+	var resp *http.Response = nil
+	started := time.Now()
+	waited := time.Duration(0)
+	for {
+		var err error
+		req, err = j.request(ctx, ctx, x)
+		if err != nil {
+			return false, 0, &fatalError{err}
+		}
+		started = time.Now()
+		resp, err = j.h.Do(req)
+		waited = time.Since(started)
+		if err != nil {
+			j.record(x, attempt, req, started, waited, 0, nil, nil, err)
+			return false, 0, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			response, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			j.record(x, attempt, req, started, waited, time.Since(started)-waited, resp, response, err)
+			j.traceResponse(resp, response)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && !refreshed {
+			if r, ok := j.auth.(refresher); ok {
+				if err := r.Refresh(ctx, j.h, req); err != nil {
+					return false, 0, &fatalError{err}
+				}
+				refreshed = true
+				continue
+			}
+		}
+		break
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("JMAP event source response status is %s", resp.Status)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return false, 0, &fatalError{err}
+		}
+		return false, retryAfter(resp.Header), err
+	}
+	defer resp.Body.Close()
+	j.traceResponse(resp, nil)
+	body := newCapture(resp.Body)
+	connected, wait, err := j.events(body, onState, onPing)
+	if j.tracer != nil {
+		e := entry(x, attempt, req, started, waited, time.Since(started)-waited, resp, nil, err)
+		e.Response.BodySize = body.size
+		e.Response.Content.Size = body.size
+		e.Response.Content.Text, e.Response.Content.Encoding, e.Response.Content.Sha256 = body.body(e.Response.Content.MimeType)
+		j.write(e)
+	}
+	return connected, wait, err
+}
+
+// events reads the events from the event stream of a connection, as listen.
+func (j *Jmap) events(r io.Reader, onState func(StateChange) error, onPing func()) (bool, time.Duration, error) {
+	// the event stream format as per the HTML standard, of which the id field is ignored, and
+	// the retry field sets the delay before connecting again in milliseconds
+	wait := time.Duration(0)
+	event := ""
+	data := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				event = value
+			case "data":
+				data = append(data, value)
+			case "retry":
+				if ms, err := strconv.ParseUint(value, 10, 32); err == nil {
+					wait = time.Duration(ms) * time.Millisecond
+				}
+			}
+			continue
+		}
+
+		payload := strings.Join(data, "\n")
+		if j.trace {
+			log.Printf("<== event: %s\n%s", event, payload)
+		}
+		switch event {
+		case "state":
+			var change StateChange
+			if err := json.Unmarshal([]byte(payload), &change); err != nil {
+				return true, wait, fmt.Errorf("failed to parse the StateChange '%s': %w", payload, err)
+			}
+			if err := onState(change); err != nil {
+				return true, wait, &fatalError{err}
+			}
+		case "ping":
+			if onPing != nil {
+				onPing()
+			}
+		}
+		event = ""
+		data = data[:0]
+	}
+	return true, wait, scanner.Err()
+}
@@ -0,0 +1,182 @@
+package jmap_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/jmap/jmaptest"
+)
+
+// watching returns a client of the server that connects to the event source again after the
+// given backoff, without ever giving up.
+func watching(t *testing.T, s *jmaptest.Server, backoff time.Duration) *jmap.Jmap {
+	t.Helper()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := jmap.NewJmap(context.Background(), u, jmap.Config{
+		Auth:  jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword},
+		Retry: jmap.RetryPolicy{MaxRetries: 0, Backoff: backoff, MaxBackoff: backoff},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+	return j
+}
+
+// eventually waits for the condition to hold, and fails the test when it does not within the
+// given time.
+func eventually(t *testing.T, within time.Duration, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(within)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWatchBacksOffAfterCleanClose(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	j := watching(t, s, 400*time.Millisecond)
+	accountId := s.AccountId(jmaptest.DefaultUsername)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan jmap.StateChange, 8)
+	done := make(chan error, 1)
+	go func() {
+		done <- j.Watch(ctx, []string{"Mailbox"}, 0, true, func(change jmap.StateChange) error {
+			changes <- change
+			return nil
+		}, nil)
+	}()
+
+	eventually(t, time.Second, "the event source", func() bool { return s.EventSources() == 1 })
+	s.Put(accountId, "Mailbox", map[string]any{"name": "Projects"})
+	<-changes
+	closed := time.Now()
+	// the server closed the connection after the state change as asked, which is no reason to
+	// give up even though no retries are allowed, nor to connect again right away
+	eventually(t, 2*time.Second, "connecting again", func() bool { return s.EventSources() == 2 })
+	if d := time.Since(closed); d < 150*time.Millisecond {
+		t.Errorf("expected to wait before connecting again, connected after %v", d)
+	}
+	s.Put(accountId, "Mailbox", map[string]any{"name": "Archive"})
+	<-changes
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the watch to end with the context, got %v", err)
+	}
+}
+
+func TestWatchRetryAfter(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := jmap.NewJmap(context.Background(), u, jmap.Config{
+		Auth:  jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword},
+		Retry: jmap.RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	s.FailHTTP(1, http.StatusServiceUnavailable, "1")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	started := time.Now()
+	go func() {
+		done <- j.Watch(ctx, nil, 0, false, func(jmap.StateChange) error { return nil }, nil)
+	}()
+	eventually(t, 3*time.Second, "the event source", func() bool { return s.EventSources() == 1 })
+	if d := time.Since(started); d < time.Second {
+		t.Errorf("expected to wait for the Retry-After of 1s, connected after %v", d)
+	}
+	cancel()
+	<-done
+}
+
+func TestWatchIsTraced(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	traceFile := filepath.Join(t.TempDir(), "trace.jsonl")
+	j, err := jmap.NewJmap(context.Background(), u, jmap.Config{
+		Auth:      jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword},
+		Retry:     jmap.RetryPolicy{MaxRetries: 0, Backoff: 10 * time.Millisecond, MaxBackoff: 10 * time.Millisecond},
+		TraceFile: traceFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	accountId := s.AccountId(jmaptest.DefaultUsername)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan jmap.StateChange, 8)
+	done := make(chan error, 1)
+	go func() {
+		done <- j.Watch(ctx, []string{"Mailbox"}, 0, true, func(change jmap.StateChange) error {
+			changes <- change
+			return nil
+		}, nil)
+	}()
+	eventually(t, time.Second, "the event source", func() bool { return s.EventSources() == 1 })
+	s.Put(accountId, "Mailbox", map[string]any{"name": "Projects"})
+	<-changes
+	// the first connection is traced once the server has closed it after the state change
+	eventually(t, 2*time.Second, "connecting again", func() bool { return s.EventSources() == 2 })
+	cancel()
+	<-done
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(traceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var traced map[string]any = nil
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var e map[string]any
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid trace line %q: %v", line, err)
+		}
+		if strings.Contains(e["request"].(map[string]any)["url"].(string), "/eventsource") {
+			traced = e
+			break
+		}
+	}
+	if traced == nil {
+		t.Fatalf("expected the event source connection in the trace file, got %s", b)
+	}
+	headers, _ := json.Marshal(traced["request"].(map[string]any)["headers"])
+	if !strings.Contains(string(headers), `"Basic [REDACTED]"`) || strings.Contains(string(headers), jmaptest.DefaultPassword) {
+		t.Errorf("expected the credentials to be redacted, got %s", headers)
+	}
+	content := traced["response"].(map[string]any)["content"].(map[string]any)
+	if text, _ := content["text"].(string); !strings.Contains(text, "StateChange") {
+		t.Errorf("expected the received events in the trace, got %v", content)
+	}
+}
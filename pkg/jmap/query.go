@@ -0,0 +1,127 @@
+package jmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
+)
+
+// Query pages through the IDs of all the objects that match the filter, issuing one /query
+// call per page and advancing its position until the server reports no more results.
+//
+// The total number of matches is requested with the first page, and is available in the
+// Total of every page if the server calculated it.
+func (j *Jmap) Query(ctx context.Context, accountId string, objectType string, scope string, filter any, sort []Comparator) iter.Seq2[QueryResponse, error] {
+	return func(yield func(QueryResponse, error) bool) {
+		position := 0
+		var total *uint = nil
+		for {
+			req := NewRequest(scope)
+			query := req.Call(objectType+"/query", QueryArgs{
+				AccountId:      accountId,
+				Filter:         filter,
+				Sort:           sort,
+				Position:       position,
+				Limit:          j.pageSize(),
+				CalculateTotal: total == nil,
+			})
+			resp, err := j.Send(ctx, req)
+			if err != nil {
+				yield(QueryResponse{}, err)
+				return
+			}
+			var q QueryResponse
+			if err := resp.Get(query, &q); err != nil {
+				yield(QueryResponse{}, err)
+				return
+			}
+			if q.Total == nil {
+				q.Total = total
+			} else {
+				total = q.Total
+			}
+			if len(q.Ids) < 1 {
+				return
+			}
+			if !yield(q, nil) {
+				return
+			}
+			position = int(q.Position) + len(q.Ids)
+			if total != nil && uint(position) >= *total {
+				return
+			}
+		}
+	}
+}
+
+// EmptyResult tells how many objects were found when emptying a collection, and how many
+// of those were actually destroyed.
+type EmptyResult struct {
+	Found     uint
+	Destroyed uint
+}
+
+// empty destroys all the objects that match the filter, by chaining a /query with a /set that
+// destroys its results in the same request, until the query does not yield any more results.
+// Each round destroys as many objects as the server accepts in a single /set (maxObjectsInSet).
+//
+// Objects that the server refuses to destroy are skipped by advancing the position of the
+// subsequent queries past them, and the reasons are returned as a joined error once all the
+// other objects have been destroyed.
+func empty(ctx context.Context, j *Jmap, accountId string, objectType string, scope string, filter map[string]any) (EmptyResult, error) {
+	result := EmptyResult{}
+	failures := []error{}
+	skipped := uint(0)
+	position := 0
+	first := true
+	for {
+		req := NewRequest(scope)
+		query := req.Call(objectType+"/query", QueryArgs{
+			AccountId:      accountId,
+			Filter:         filter,
+			Position:       position,
+			Limit:          uint(j.chunkSize()),
+			CalculateTotal: first,
+		})
+		set := req.Call(objectType+"/set", SetArgs{
+			AccountId:  accountId,
+			DestroyRef: ptr(query.Ref("/ids")),
+		})
+		resp, err := j.Send(ctx, req)
+		if err != nil {
+			return result, err
+		}
+
+		var q QueryResponse
+		if err := resp.Get(query, &q); err != nil {
+			return result, err
+		}
+		if first && q.Total != nil {
+			result.Found = *q.Total
+		}
+		first = false
+		if len(q.Ids) < 1 {
+			break
+		}
+
+		var r SetResponse
+		if err := resp.Get(set, &r); err != nil {
+			return result, err
+		}
+		result.Destroyed += uint(len(r.Destroyed))
+		for id, e := range r.NotDestroyed {
+			failures = append(failures, setError(e, objectType, SetOperationDestroy, id))
+		}
+		remaining := len(q.Ids) - len(r.Destroyed)
+		if remaining >= len(q.Ids) && len(r.NotDestroyed) < 1 {
+			return result, fmt.Errorf("failed to destroy %ss: [%s]", objectType, strings.Join(q.Ids, ", "))
+		}
+		skipped += uint(remaining)
+		position += remaining
+	}
+	// objects that were added while we were at it, or a server that does not calculate totals
+	result.Found = max(result.Found, result.Destroyed+skipped)
+	return result, errors.Join(failures...)
+}
@@ -0,0 +1,91 @@
+package jmap_test
+
+import (
+	"context"
+	"testing"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/jmap/jmaptest"
+)
+
+// putContacts stores the given number of contacts in the address book of the default user,
+// bypassing /set.
+func putContacts(s *jmaptest.Server, addressbookId string, count int) {
+	accountId := s.AccountId(jmaptest.DefaultUsername)
+	for range count {
+		s.Put(accountId, jmap.ContactCardObjectType, map[string]any{
+			"addressBookIds": map[string]any{addressbookId: true},
+			"name":           map[string]any{"full": "Alan"},
+		})
+	}
+}
+
+func TestEmptyPagesByMaxObjectsInSet(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.Core.MaxObjectsInSet = 3
+	j := basic(t, s)
+	sender := contactSender(t, j)
+	putContacts(s, sender.AddressBook(), 7)
+
+	requests := s.Requests()
+	result, err := sender.EmptyContacts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Found != 7 || result.Destroyed != 7 {
+		t.Errorf("expected 7 contacts to be found and destroyed, got %+v", result)
+	}
+	// 3 pages, and a last query that does not yield any more contacts
+	if n := s.Requests() - requests; n != 4 {
+		t.Errorf("expected 4 requests, got %d", n)
+	}
+	if n := len(s.Objects(s.AccountId(jmaptest.DefaultUsername), jmap.ContactCardObjectType)); n != 0 {
+		t.Errorf("expected no contacts to be left, got %d", n)
+	}
+}
+
+func TestEmptyCappedQueryResults(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.MaxQueryResults = 2
+	j := basic(t, s)
+	sender := contactSender(t, j)
+	putContacts(s, sender.AddressBook(), 5)
+
+	result, err := sender.EmptyContacts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Found != 5 || result.Destroyed != 5 {
+		t.Errorf("expected 5 contacts to be found and destroyed, got %+v", result)
+	}
+}
+
+func TestEmptySkipsRejectedDestroy(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.Core.MaxObjectsInSet = 2
+	j := basic(t, s)
+	sender := contactSender(t, j)
+	putContacts(s, sender.AddressBook(), 5)
+	kept := s.Objects(s.AccountId(jmaptest.DefaultUsername), jmap.ContactCardObjectType)[1]["id"]
+	s.Reject(jmap.ContactCardObjectType, jmap.SetOperationDestroy, func(id string, object map[string]any) *jmap.SetError {
+		if id == kept {
+			return &jmap.SetError{Type: "forbidden"}
+		}
+		return nil
+	})
+
+	result, err := sender.EmptyContacts(context.Background())
+	if err == nil {
+		t.Error("expected the rejection to be returned")
+	}
+	if result.Found != 5 || result.Destroyed != 4 {
+		t.Errorf("expected 4 of 5 contacts to be destroyed, got %+v", result)
+	}
+	left := s.Objects(s.AccountId(jmaptest.DefaultUsername), jmap.ContactCardObjectType)
+	if len(left) != 1 || left[0]["id"] != kept {
+		t.Errorf("expected only the rejected contact to be left, got %v", left)
+	}
+}
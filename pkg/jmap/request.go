@@ -0,0 +1,234 @@
+package jmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// ResultReference refers to (a part of) the result of a previous method call in the same
+// request, as per RFC 8620 section 3.7.
+type ResultReference struct {
+	ResultOf string `json:"resultOf"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+}
+
+// Call identifies a method call that was added to a Request.
+type Call struct {
+	Name string
+	Id   string
+}
+
+// Ref creates a reference to the given JSON pointer path in the result of this call,
+// to be used in the arguments of subsequent calls in the same request, e.g. as "#ids".
+func (c Call) Ref(path string) ResultReference {
+	return ResultReference{
+		ResultOf: c.Id,
+		Name:     c.Name,
+		Path:     path,
+	}
+}
+
+type invocation struct {
+	name   string
+	args   any
+	callId string
+}
+
+func (i invocation) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{i.name, i.args, i.callId})
+}
+
+// Request chains one or more method calls that are sent to the server in a single round trip.
+type Request struct {
+	using []string
+	calls []invocation
+}
+
+func NewRequest(using ...string) *Request {
+	r := &Request{
+		using: []string{JmapCore},
+		calls: []invocation{},
+	}
+	r.Using(using...)
+	return r
+}
+
+// Using adds capabilities that are required by the method calls of this request.
+func (r *Request) Using(capabilities ...string) {
+	for _, c := range capabilities {
+		if !slices.Contains(r.using, c) {
+			r.using = append(r.using, c)
+		}
+	}
+}
+
+// Call appends a method call to the request and returns a handle to retrieve its response
+// or to reference its result in subsequent calls.
+func (r *Request) Call(name string, args any) Call {
+	id := strconv.Itoa(len(r.calls))
+	r.calls = append(r.calls, invocation{name: name, args: args, callId: id})
+	return Call{Name: name, Id: id}
+}
+
+// methods returns the names of the methods that are called by this request.
+func (r *Request) methods() []string {
+	names := make([]string, len(r.calls))
+	for i, c := range r.calls {
+		names[i] = c.name
+	}
+	return names
+}
+
+func (r *Request) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"using":       r.using,
+		"methodCalls": r.calls,
+	})
+}
+
+type methodResponse struct {
+	name   string
+	args   json.RawMessage
+	callId string
+}
+
+func (m *methodResponse) UnmarshalJSON(b []byte) error {
+	var tuple []json.RawMessage
+	if err := json.Unmarshal(b, &tuple); err != nil {
+		return err
+	}
+	if len(tuple) != 3 {
+		return fmt.Errorf("method response is not a 3-tuple: %s", string(b))
+	}
+	if err := json.Unmarshal(tuple[0], &m.name); err != nil {
+		return err
+	}
+	m.args = tuple[1]
+	return json.Unmarshal(tuple[2], &m.callId)
+}
+
+type Response struct {
+	MethodResponses []methodResponse `json:"methodResponses"`
+	SessionState    string           `json:"sessionState,omitempty"`
+}
+
+// Get unmarshals the arguments of the response to the given call into result.
+//
+// Since a single method call may yield several responses (e.g. implicit /set calls), the
+// response is matched by both method name and call ID. Use GetAs to fetch such an additional
+// response.
+func (r *Response) Get(c Call, result any) error {
+	return r.GetAs(c, c.Name, result)
+}
+
+// GetAs unmarshals the arguments of the response with the given method name to the given call
+// into result.
+func (r *Response) GetAs(c Call, name string, result any) error {
+	for _, m := range r.MethodResponses {
+		if m.callId != c.Id {
+			continue
+		}
+		if m.name == "error" {
+			e := &MethodError{Method: c.Name, CallId: c.Id}
+			if err := json.Unmarshal(m.args, e); err != nil {
+				return fmt.Errorf("%s failed: %s", c.Name, string(m.args))
+			}
+			return e
+		}
+		if m.name == name {
+			return json.Unmarshal(m.args, result)
+		}
+	}
+	return fmt.Errorf("no %s response for call '%s'", name, c.Id)
+}
+
+type GetArgs struct {
+	AccountId  string
+	Ids        []string
+	IdsRef     *ResultReference
+	Properties []string
+}
+
+func (a GetArgs) MarshalJSON() ([]byte, error) {
+	m := map[string]any{"accountId": a.AccountId}
+	if a.IdsRef != nil {
+		m["#ids"] = a.IdsRef
+	} else {
+		m["ids"] = a.Ids
+	}
+	if a.Properties != nil {
+		m["properties"] = a.Properties
+	}
+	return json.Marshal(m)
+}
+
+type GetResponse[T any] struct {
+	AccountId string   `json:"accountId"`
+	State     string   `json:"state"`
+	List      []T      `json:"list"`
+	NotFound  []string `json:"notFound"`
+}
+
+type SetArgs struct {
+	AccountId  string           `json:"accountId"`
+	IfInState  string           `json:"ifInState,omitempty"`
+	Create     any              `json:"create,omitempty"`
+	Update     map[string]any   `json:"update,omitempty"`
+	Destroy    []string         `json:"destroy,omitempty"`
+	DestroyRef *ResultReference `json:"#destroy,omitempty"`
+}
+
+type SetResponse struct {
+	AccountId    string                    `json:"accountId"`
+	OldState     string                    `json:"oldState,omitempty"`
+	NewState     string                    `json:"newState"`
+	Created      map[string]map[string]any `json:"created,omitempty"`
+	Updated      map[string]map[string]any `json:"updated,omitempty"`
+	Destroyed    []string                  `json:"destroyed,omitempty"`
+	NotCreated   map[string]SetError       `json:"notCreated,omitempty"`
+	NotUpdated   map[string]SetError       `json:"notUpdated,omitempty"`
+	NotDestroyed map[string]SetError       `json:"notDestroyed,omitempty"`
+}
+
+// SubmissionSetArgs are the arguments of EmailSubmission/set, which updates the submitted
+// emails with an implicit Email/set call, as per RFC 8621 section 7.5.
+type SubmissionSetArgs struct {
+	AccountId            string         `json:"accountId"`
+	Create               any            `json:"create,omitempty"`
+	OnSuccessUpdateEmail map[string]any `json:"onSuccessUpdateEmail,omitempty"`
+}
+
+// ImportArgs are the arguments of Email/import, whose response has the created and
+// notCreated of a SetResponse.
+type ImportArgs struct {
+	AccountId string `json:"accountId"`
+	IfInState string `json:"ifInState,omitempty"`
+	Emails    any    `json:"emails"`
+}
+
+type Comparator struct {
+	Property    string `json:"property"`
+	IsAscending bool   `json:"isAscending"`
+}
+
+type QueryArgs struct {
+	AccountId      string       `json:"accountId"`
+	Filter         any          `json:"filter,omitempty"`
+	Sort           []Comparator `json:"sort,omitempty"`
+	Position       int          `json:"position,omitempty"`
+	Limit          uint         `json:"limit,omitempty"`
+	CalculateTotal bool         `json:"calculateTotal,omitempty"`
+}
+
+type QueryResponse struct {
+	AccountId           string   `json:"accountId"`
+	QueryState          string   `json:"queryState"`
+	CanCalculateChanges bool     `json:"canCalculateChanges"`
+	Position            uint     `json:"position"`
+	Ids                 []string `json:"ids"`
+	Total               *uint    `json:"total,omitempty"`
+	Limit               uint     `json:"limit,omitempty"`
+}
@@ -0,0 +1,106 @@
+package jmap
+
+import (
+	"crypto/tls"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy determines how often and after which delay requests are sent again when
+// the server is throttling us or is temporarily unavailable.
+type RetryPolicy struct {
+	MaxRetries uint
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// delay computes how long to wait before the given attempt, which is the value of the
+// Retry-After header if the server sent one, or an exponential backoff with jitter.
+func (p RetryPolicy) delay(attempt uint, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	d := p.Backoff
+	for i := uint(1); i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryAfter parses the Retry-After header, which is either a number of seconds or a date.
+func retryAfter(h http.Header) time.Duration {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// shouldRetryStatus tells whether a request that yielded the given HTTP status may be sent again.
+//
+// 429 and 503 mean that the server did not process the request at all, while a gateway
+// error leaves us in the dark as to whether it did, which is only fine for requests
+// that do not modify anything.
+func shouldRetryStatus(status int, idempotent bool) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	default:
+		return false
+	}
+}
+
+// shouldRetryError tells whether a request that failed with the given transport error may be
+// sent again, which is always the case when we could not even connect to the server, but only
+// for requests that do not modify anything when the connection broke down in the middle of it.
+// Failures to establish a trusted TLS connection are never retried.
+func shouldRetryError(err error, idempotent bool) bool {
+	var certificateError *tls.CertificateVerificationError
+	var alertError tls.AlertError
+	if errors.As(err, &certificateError) || errors.As(err, &alertError) {
+		return false
+	}
+	var opError *net.OpError
+	if errors.As(err, &opError) && opError.Op == "dial" {
+		return true
+	}
+	return idempotent
+}
+
+// isIdempotent tells whether all the method calls of the request leave the data on the server
+// untouched, and hence can safely be sent again.
+func (r *Request) isIdempotent() bool {
+	for _, c := range r.calls {
+		i := strings.LastIndex(c.name, "/")
+		switch c.name[i+1:] {
+		case "get", "query", "changes", "queryChanges", "parse":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Retries returns how many requests had to be sent again so far.
+func (j *Jmap) Retries() uint {
+	return uint(j.retries.Load())
+}
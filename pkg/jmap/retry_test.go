@@ -0,0 +1,140 @@
+package jmap_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/jmap/jmaptest"
+)
+
+// retrying returns a client of the server that sends requests again up to the given number
+// of times, without waiting long in between.
+func retrying(t *testing.T, s *jmaptest.Server, maxRetries uint) *jmap.Jmap {
+	t.Helper()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := jmap.NewJmap(context.Background(), u, jmap.Config{
+		Auth:  jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword},
+		Retry: jmap.RetryPolicy{MaxRetries: maxRetries, Backoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+	return j
+}
+
+func TestRetryOnServiceUnavailable(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	j := retrying(t, s, 3)
+
+	s.FailHTTP(2, http.StatusServiceUnavailable, "")
+	requests := s.Requests()
+	if err := mailboxes(context.Background(), j, s); err != nil {
+		t.Fatal(err)
+	}
+	if n := j.Retries(); n != 2 {
+		t.Errorf("expected 2 retries, got %d", n)
+	}
+	if n := s.Requests() - requests; n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	j := retrying(t, s, 1)
+
+	s.FailHTTP(1, http.StatusTooManyRequests, "1")
+	start := time.Now()
+	if err := mailboxes(context.Background(), j, s); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < time.Second {
+		t.Errorf("expected to wait for the Retry-After of 1s, waited %v", d)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	j := retrying(t, s, 2)
+
+	s.FailHTTP(3, http.StatusServiceUnavailable, "")
+	if err := mailboxes(context.Background(), j, s); err == nil {
+		t.Fatal("expected the request to fail once the retries are exhausted")
+	}
+	if n := j.Retries(); n != 2 {
+		t.Errorf("expected 2 retries, got %d", n)
+	}
+}
+
+func TestNoRetryOfGatewayErrorWhenModifying(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	j := retrying(t, s, 3)
+	sender := contactSender(t, j)
+
+	// the server may or may not have created the contact behind the gateway
+	s.FailHTTP(1, http.StatusBadGateway, "")
+	ctx := context.Background()
+	err := sender.QueueContact(ctx, contact("Alan"), func(id string, err error) error {
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Flush(ctx); err == nil {
+		t.Fatal("expected the creation to fail")
+	}
+	if n := j.Retries(); n != 0 {
+		t.Errorf("expected no retry, got %d", n)
+	}
+}
+
+func TestHttpError(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	j := retrying(t, s, 0)
+
+	s.FailHTTP(1, http.StatusForbidden, "")
+	err := mailboxes(context.Background(), j, s)
+	var failed *jmap.HttpError
+	if !errors.As(err, &failed) {
+		t.Fatalf("expected an HttpError, got %v", err)
+	}
+	if failed.StatusCode != http.StatusForbidden || !strings.Contains(string(failed.Body), "Forbidden") {
+		t.Errorf("expected the status and the body of the response, got %d %q", failed.StatusCode, failed.Body)
+	}
+}
+
+func TestRequestErrorIsHttpError(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	j := retrying(t, s, 0)
+	// lowered behind the back of the client, which would not send the request otherwise
+	s.Core.MaxCallsInRequest = 1
+
+	req := jmap.NewRequest(jmap.JmapMail)
+	req.Call("Mailbox/get", jmap.GetArgs{AccountId: s.AccountId(jmaptest.DefaultUsername)})
+	req.Call("Mailbox/get", jmap.GetArgs{AccountId: s.AccountId(jmaptest.DefaultUsername)})
+	_, err := j.Send(context.Background(), req)
+	var problem *jmap.RequestError
+	if !errors.As(err, &problem) || problem.Limit != "maxCallsInRequest" {
+		t.Fatalf("expected a RequestError for the limit, got %v", err)
+	}
+	var failed *jmap.HttpError
+	if !errors.As(err, &failed) || failed.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected the RequestError to wrap the HttpError, got %v", err)
+	}
+}
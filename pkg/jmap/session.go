@@ -0,0 +1,142 @@
+package jmap
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Capabilities maps capability URIs to their (not yet decoded) properties, either on the
+// session or on an account.
+type Capabilities map[string]json.RawMessage
+
+func (c Capabilities) Has(uri string) bool {
+	_, ok := c[uri]
+	return ok
+}
+
+// Decode unmarshals the properties of the given capability into v.
+func (c Capabilities) Decode(uri string, v any) error {
+	raw, ok := c[uri]
+	if !ok {
+		return fmt.Errorf("capability '%s' is not supported", uri)
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// CoreCapabilities are the limits of the server as per RFC 8620 section 2.
+type CoreCapabilities struct {
+	MaxSizeUpload         uint     `json:"maxSizeUpload"`
+	MaxConcurrentUpload   uint     `json:"maxConcurrentUpload"`
+	MaxSizeRequest        uint     `json:"maxSizeRequest"`
+	MaxConcurrentRequests uint     `json:"maxConcurrentRequests"`
+	MaxCallsInRequest     uint     `json:"maxCallsInRequest"`
+	MaxObjectsInGet       uint     `json:"maxObjectsInGet"`
+	MaxObjectsInSet       uint     `json:"maxObjectsInSet"`
+	CollationAlgorithms   []string `json:"collationAlgorithms"`
+}
+
+// MailAccountCapabilities as per RFC 8621 section 1.3.1, where a nil limit means that there is none.
+type MailAccountCapabilities struct {
+	MaxMailboxesPerEmail       *uint    `json:"maxMailboxesPerEmail"`
+	MaxMailboxDepth            *uint    `json:"maxMailboxDepth"`
+	MaxSizeMailboxName         uint     `json:"maxSizeMailboxName"`
+	MaxSizeAttachmentsPerEmail uint     `json:"maxSizeAttachmentsPerEmail"`
+	EmailQuerySortOptions      []string `json:"emailQuerySortOptions"`
+	MayCreateTopLevelMailbox   bool     `json:"mayCreateTopLevelMailbox"`
+}
+
+// SubmissionAccountCapabilities as per RFC 8621 section 1.3.2.
+type SubmissionAccountCapabilities struct {
+	MaxDelayedSend       uint                `json:"maxDelayedSend"`
+	SubmissionExtensions map[string][]string `json:"submissionExtensions"`
+}
+
+// ContactsAccountCapabilities as per RFC 9610 section 1.4.1.
+type ContactsAccountCapabilities struct {
+	MaxAddressBooksPerCard *uint `json:"maxAddressBooksPerCard"`
+	MayCreateAddressBook   bool  `json:"mayCreateAddressBook"`
+}
+
+// CalendarsAccountCapabilities as per the JMAP for Calendars draft.
+type CalendarsAccountCapabilities struct {
+	MaxCalendarsPerEvent     *uint  `json:"maxCalendarsPerEvent"`
+	MinDateTime              string `json:"minDateTime,omitempty"`
+	MaxDateTime              string `json:"maxDateTime,omitempty"`
+	MaxExpandedQueryDuration string `json:"maxExpandedQueryDuration,omitempty"`
+	MaxParticipantsPerEvent  *uint  `json:"maxParticipantsPerEvent"`
+	MayCreateCalendar        bool   `json:"mayCreateCalendar"`
+}
+
+// TasksAccountCapabilities as per the JMAP for Tasks draft.
+type TasksAccountCapabilities struct {
+	MinDateTime       string `json:"minDateTime,omitempty"`
+	MaxDateTime       string `json:"maxDateTime,omitempty"`
+	MayCreateTaskList bool   `json:"mayCreateTaskList"`
+}
+
+type Account struct {
+	Name                string       `json:"name,omitempty"`
+	IsPersonal          bool         `json:"isPersonal"`
+	IsReadOnly          bool         `json:"isReadOnly"`
+	AccountCapabilities Capabilities `json:"accountCapabilities,omitempty"`
+}
+
+type Session struct {
+	Capabilities    Capabilities       `json:"capabilities"`
+	Accounts        map[string]Account `json:"accounts,omitempty"`
+	PrimaryAccounts map[string]string  `json:"primaryAccounts"`
+	Username        string             `json:"username,omitempty"`
+	ApiUrl          string             `json:"apiUrl,omitempty"`
+	DownloadUrl     string             `json:"downloadUrl,omitempty"`
+	UploadUrl       string             `json:"uploadUrl,omitempty"`
+	EventSourceUrl  string             `json:"eventSourceUrl,omitempty"`
+	State           string             `json:"state,omitempty"`
+}
+
+func (j *Jmap) Session() Session {
+	return j.session
+}
+
+func (j *Jmap) Core() CoreCapabilities {
+	return j.core
+}
+
+// account resolves the account to use for the given capability, which is the primary account
+// for that capability when accountId is empty, and verifies that both the server and the
+// account support it.
+func (j *Jmap) account(accountId string, capability string) (string, error) {
+	if !j.session.Capabilities.Has(capability) {
+		return "", fmt.Errorf("the JMAP server does not support %s", capability)
+	}
+	if accountId == "" {
+		accountId = j.session.PrimaryAccounts[capability]
+		if accountId == "" {
+			return "", fmt.Errorf("session has no primary account for %s", capability)
+		}
+	}
+	account, ok := j.session.Accounts[accountId]
+	if !ok {
+		return "", fmt.Errorf("account ID '%s' does not exist in session", accountId)
+	}
+	if !account.AccountCapabilities.Has(capability) {
+		return "", fmt.Errorf("account '%s' does not support %s", accountId, capability)
+	}
+	return accountId, nil
+}
+
+// chunkSize is the number of objects to pass to a single /set call.
+func (j *Jmap) chunkSize() int {
+	if j.core.MaxObjectsInSet > 0 {
+		return int(j.core.MaxObjectsInSet)
+	}
+	return DefaultMaxObjectsInSet
+}
+
+// pageSize is the number of IDs to request per /query call, so that they can all be passed
+// to a single /get call (maxObjectsInGet).
+func (j *Jmap) pageSize() uint {
+	if j.core.MaxObjectsInGet > 0 {
+		return j.core.MaxObjectsInGet
+	}
+	return DefaultMaxObjectsInSet
+}
@@ -0,0 +1,305 @@
+package jmap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"slices"
+	"strconv"
+
+	"opencloud.eu/groupware-assistant/pkg/models"
+)
+
+var EmailSubmissionObjectType = "EmailSubmission"
+
+// EmailSubmitter sends emails from an identity of the account: every email is created in the
+// drafts mailbox and submitted in the same request, upon which the server moves it to the sent
+// mailbox and delivers it to its recipients.
+type EmailSubmitter struct {
+	sender   *EmailSender
+	identity models.Identity
+	sentId   string
+	size     int
+	pending  []submission
+	bytes    int
+}
+
+type submission struct {
+	email json.RawMessage
+	done  func(id string, err error) error
+}
+
+// NewEmailSubmitter creates a submitter for the identity with the given ID, or for the first
+// identity of the account when it is empty.
+func NewEmailSubmitter(ctx context.Context, j *Jmap, accountId string, identityId string) (*EmailSubmitter, error) {
+	accountId, err := j.account(accountId, JmapSubmission)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := NewEmailSender(ctx, j, accountId, "", "drafts")
+	if err != nil {
+		return nil, err
+	}
+	sentId, err := resolveMailbox(ctx, j, accountId, "", "sent")
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := identities(ctx, j, accountId)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) < 1 {
+		return nil, fmt.Errorf("account '%s' has no identities to send emails from", accountId)
+	}
+	identity := list[0]
+	if identityId != "" {
+		found := false
+		for _, i := range list {
+			if i.Id == identityId {
+				identity, found = i, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("identity with id '%s' does not exist", identityId)
+		}
+	}
+
+	return &EmailSubmitter{
+		sender:   sender,
+		identity: identity,
+		sentId:   sentId,
+		size:     j.chunkSize(),
+		pending:  []submission{},
+	}, nil
+}
+
+func (s *EmailSubmitter) Close() error {
+	return s.sender.Close()
+}
+
+// Identity returns the identity that the emails are sent from.
+func (s *EmailSubmitter) Identity() models.Identity {
+	return s.identity
+}
+
+// NewEmail creates an email from the identity, with its reply-to and bcc addresses.
+func (s *EmailSubmitter) NewEmail() (*EmailBuilder, error) {
+	b, err := s.sender.NewEmail()
+	if err != nil {
+		return nil, err
+	}
+	b.From(mail.Address{Name: s.identity.Name, Address: s.identity.Email})
+	b.email.ReplyTo = s.identity.ReplyTo
+	b.email.Bcc = s.identity.Bcc
+	b.Draft()
+	b.Seen()
+	return b, nil
+}
+
+// Prepare uploads the attachments of the email, which may be done for several emails in
+// parallel before queueing them in order.
+func (s *EmailSubmitter) Prepare(ctx context.Context, e *EmailBuilder) error {
+	return s.sender.Prepare(ctx, e)
+}
+
+// QueueSubmission uploads the attachments of the email unless it was prepared already, and
+// queues it for creation and submission.
+//
+// The email is sent along with others once enough of them have been queued, or when Flush
+// is called, after which done is invoked with the ID of the sent email or with the error
+// that prevented its creation or its submission. The draft of an email that was created but
+// not submitted is destroyed, and its ID is only passed along with the error when that failed.
+func (s *EmailSubmitter) QueueSubmission(ctx context.Context, e *EmailBuilder, done func(id string, err error) error) error {
+	if err := s.Prepare(ctx, e); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(e.email)
+	if err != nil {
+		return err
+	}
+	// the submission and the update of the email that go along with it count as well
+	_, submitting, update := s.entry(len(s.pending), raw)
+	extra, err := json.Marshal([]any{submitting.object, update})
+	if err != nil {
+		return err
+	}
+	size := len(raw) + len(extra)
+	if len(s.pending) > 0 && s.sender.j.exceedsMaxSizeRequest(s.bytes+size) {
+		if err := s.Flush(ctx); err != nil {
+			return err
+		}
+	}
+
+	s.pending = append(s.pending, submission{email: raw, done: done})
+	s.bytes += size
+	if len(s.pending) >= s.size {
+		return s.Flush(ctx)
+	}
+	return nil
+}
+
+// entry returns the creation of the email at the given position of a request, that of its
+// submission, and the update of the email once it was submitted.
+func (s *EmailSubmitter) entry(i int, email json.RawMessage) (creation, creation, map[string]any) {
+	emailId := "e" + strconv.Itoa(i)
+	submissionId := "s" + strconv.Itoa(i)
+	return creation{id: emailId, object: email},
+		creation{id: submissionId, object: models.EmailSubmission{
+			IdentityId: s.identity.Id,
+			EmailId:    "#" + emailId,
+		}},
+		map[string]any{
+			"mailboxIds/" + s.sender.mailboxId: nil,
+			"mailboxIds/" + s.sentId:           true,
+			"keywords/$draft":                  nil,
+		}
+}
+
+// Flush creates and submits all the emails that are currently queued, in a single request that
+// creates them as drafts with Email/set and submits them with EmailSubmission/set, which
+// moves them from the drafts to the sent mailbox once they were submitted.
+func (s *EmailSubmitter) Flush(ctx context.Context) error {
+	if len(s.pending) < 1 {
+		return nil
+	}
+	pending := s.pending
+	s.pending = []submission{}
+	s.bytes = 0
+
+	emails := creations{}
+	submissions := creations{}
+	onSuccess := map[string]any{}
+	for i, p := range pending {
+		email, submitting, update := s.entry(i, p.email)
+		emails = append(emails, email)
+		submissions = append(submissions, submitting)
+		onSuccess["#"+submitting.id] = update
+	}
+
+	req := NewRequest(JmapMail, JmapSubmission)
+	set := req.Call("Email/set", SetArgs{
+		AccountId: s.sender.accountId,
+		Create:    emails,
+	})
+	submit := req.Call(EmailSubmissionObjectType+"/set", SubmissionSetArgs{
+		AccountId:            s.sender.accountId,
+		Create:               submissions,
+		OnSuccessUpdateEmail: onSuccess,
+	})
+	var created, submitted, updated SetResponse
+	resp, err := s.sender.j.Send(ctx, req)
+	if err == nil {
+		err = resp.Get(set, &created)
+	}
+	if err != nil {
+		// every email of the request failed along with it
+		errs := []error{err}
+		for _, p := range pending {
+			if e := p.done("", err); e != nil && e != err {
+				errs = append(errs, e)
+			}
+		}
+		return errors.Join(errs...)
+	}
+	// the emails were created even when they could not be submitted
+	submitErr := resp.Get(submit, &submitted)
+	var updateErr error = nil
+	// the implicit Email/set call is missing when no email was submitted
+	if err := resp.GetAs(submit, "Email/set", &updated); err != nil && submitErr == nil && len(submitted.Created) > 0 {
+		updateErr = err
+	}
+
+	type result struct {
+		id  string
+		err error
+		// whether the email was created but not submitted, which leaves it in the drafts
+		orphaned bool
+	}
+	results := make([]result, len(pending))
+	orphans := []string{}
+	for i := range pending {
+		emailId := "e" + strconv.Itoa(i)
+		submissionId := "s" + strconv.Itoa(i)
+		id := ""
+		var err error = nil
+		if obj, ok := created.Created[emailId]; ok {
+			id, _ = obj["id"].(string)
+		} else if e, ok := created.NotCreated[emailId]; ok {
+			err = setError(e, "Email", SetOperationCreate, emailId)
+		}
+		orphaned := false
+		if err == nil {
+			if submitErr != nil {
+				err = submitErr
+				orphaned = id != ""
+			} else if e, ok := submitted.NotCreated[submissionId]; ok {
+				err = setError(e, EmailSubmissionObjectType, SetOperationCreate, submissionId)
+				orphaned = id != ""
+			} else if _, ok := submitted.Created[submissionId]; !ok {
+				err = fmt.Errorf("failed to submit email %v", id)
+				orphaned = id != ""
+			} else if updateErr != nil {
+				err = updateErr
+			} else if e, ok := updated.NotUpdated[id]; ok {
+				err = setError(e, "Email", SetOperationUpdate, id)
+			}
+		}
+		if id == "" && err == nil {
+			err = fmt.Errorf("failed to create Email")
+		}
+		if orphaned {
+			orphans = append(orphans, id)
+		}
+		results[i] = result{id: id, err: err, orphaned: orphaned}
+	}
+
+	left := s.destroy(ctx, orphans)
+	errs := []error{}
+	for i, p := range pending {
+		r := results[i]
+		if r.orphaned {
+			if err, ok := left[r.id]; ok {
+				r.err = fmt.Errorf("%w, and the draft email %s could not be destroyed: %w", r.err, r.id, err)
+			} else {
+				r.id = ""
+			}
+		}
+		if err := p.done(r.id, r.err); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// destroy destroys the drafts of the emails that could not be submitted, and returns why for
+// those that could not be destroyed.
+func (s *EmailSubmitter) destroy(ctx context.Context, ids []string) map[string]error {
+	left := map[string]error{}
+	if len(ids) < 1 {
+		return left
+	}
+	req := NewRequest(JmapMail)
+	set := req.Call("Email/set", SetArgs{
+		AccountId: s.sender.accountId,
+		Destroy:   ids,
+	})
+	var r SetResponse
+	resp, err := s.sender.j.Send(ctx, req)
+	if err == nil {
+		err = resp.Get(set, &r)
+	}
+	for _, id := range ids {
+		if err != nil {
+			left[id] = err
+		} else if e, ok := r.NotDestroyed[id]; ok {
+			left[id] = setError(e, "Email", SetOperationDestroy, id)
+		} else if !slices.Contains(r.Destroyed, id) {
+			left[id] = fmt.Errorf("failed to destroy Email %s", id)
+		}
+	}
+	return left
+}
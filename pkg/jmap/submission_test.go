@@ -0,0 +1,191 @@
+package jmap_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/jmap/jmaptest"
+)
+
+// submitter returns a submitter of emails from the identity of the default user.
+func submitter(t *testing.T, j *jmap.Jmap) *jmap.EmailSubmitter {
+	t.Helper()
+	s, err := jmap.NewEmailSubmitter(context.Background(), j, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func submission(t *testing.T, s *jmap.EmailSubmitter, text string) *jmap.EmailBuilder {
+	t.Helper()
+	e, err := s.NewEmail()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.To(mail.Address{Name: "Grace", Address: "grace@example.com"})
+	e.Subject("Lunch")
+	e.Text(text)
+	return e
+}
+
+func TestSubmissionDestroysUnsentDraft(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.Reject(jmap.EmailSubmissionObjectType, jmap.SetOperationCreate, func(id string, object map[string]any) *jmap.SetError {
+		if id == "s1" {
+			return &jmap.SetError{Type: "forbiddenToSend"}
+		}
+		return nil
+	})
+	j := basic(t, s)
+	sender := submitter(t, j)
+
+	ctx := context.Background()
+	ids := map[int]string{}
+	results := map[int]error{}
+	failed := errors.New("failed")
+	for i := range 3 {
+		err := sender.QueueSubmission(ctx, submission(t, sender, "See you there."), func(id string, err error) error {
+			ids[i], results[i] = id, err
+			if err != nil {
+				return failed
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sender.Flush(ctx); !errors.Is(err, failed) {
+		t.Errorf("expected the error of the callback, got %v", err)
+	}
+	if len(results) != 3 || results[0] != nil || results[2] != nil {
+		t.Errorf("expected the other emails to be sent, got %v", results)
+	}
+	var rejected *jmap.SetError
+	if !errors.As(results[1], &rejected) || rejected.Type != "forbiddenToSend" {
+		t.Errorf("expected the rejection of the submission, got %v", results[1])
+	}
+	if ids[1] != "" {
+		t.Errorf("expected no ID for the destroyed draft, got %s", ids[1])
+	}
+	// only the sent emails are left, rather than a draft of the one that was not sent
+	emails := s.Objects(s.AccountId(jmaptest.DefaultUsername), "Email")
+	if len(emails) != 2 {
+		t.Fatalf("expected 2 emails, got %d", len(emails))
+	}
+	for _, e := range emails {
+		if e["id"] != ids[0] && e["id"] != ids[2] {
+			t.Errorf("expected only the sent emails to be left, got %v", e["id"])
+		}
+	}
+}
+
+func TestSubmissionReportsUndestroyedDraft(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	s.Reject(jmap.EmailSubmissionObjectType, jmap.SetOperationCreate, func(id string, object map[string]any) *jmap.SetError {
+		return &jmap.SetError{Type: "forbiddenToSend"}
+	})
+	s.Reject("Email", jmap.SetOperationDestroy, func(id string, object map[string]any) *jmap.SetError {
+		return &jmap.SetError{Type: "forbidden"}
+	})
+	j := basic(t, s)
+	sender := submitter(t, j)
+
+	ctx := context.Background()
+	id, result := "", error(nil)
+	err := sender.QueueSubmission(ctx, submission(t, sender, "See you there."), func(i string, err error) error {
+		id, result = i, err
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	emails := s.Objects(s.AccountId(jmaptest.DefaultUsername), "Email")
+	if len(emails) != 1 || emails[0]["id"] != id {
+		t.Fatalf("expected the ID of the draft that was left behind, got %q for %v", id, emails)
+	}
+	if result == nil || !strings.Contains(result.Error(), id) {
+		t.Errorf("expected the error to name the draft that was left behind, got %v", result)
+	}
+}
+
+func TestSubmissionSplitsByMaxSizeRequest(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	// room for the request overhead and two of the emails below, but not three
+	s.Core.MaxSizeRequest = 5000
+	j := basic(t, s)
+	sender := submitter(t, j)
+
+	ctx := context.Background()
+	requests := s.Requests()
+	for range 5 {
+		err := sender.QueueSubmission(ctx, submission(t, sender, strings.Repeat("x", 1500)), func(id string, err error) error {
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sender.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Requests() - requests; n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+	if n := len(s.Objects(s.AccountId(jmaptest.DefaultUsername), jmap.EmailSubmissionObjectType)); n != 5 {
+		t.Errorf("expected 5 submissions, got %d", n)
+	}
+}
+
+func TestSubmissionPassesFailuresOn(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(s *jmaptest.Server)
+	}{
+		{"request", func(s *jmaptest.Server) { s.FailHTTP(1, http.StatusForbidden, "") }},
+		{"submission", func(s *jmaptest.Server) { s.FailMethod("EmailSubmission/set", 1, "forbidden", "") }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := jmaptest.NewServer()
+			defer s.Close()
+			j := basic(t, s)
+			sender := submitter(t, j)
+
+			ctx := context.Background()
+			results := map[int]error{}
+			for i := range 2 {
+				err := sender.QueueSubmission(ctx, submission(t, sender, "See you there."), func(id string, err error) error {
+					results[i] = err
+					return err
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			test.fail(s)
+			if err := sender.Flush(ctx); err == nil {
+				t.Error("expected the failure to be returned")
+			}
+			if len(results) != 2 || results[0] == nil || results[1] == nil {
+				t.Errorf("expected both emails to fail, got %v", results)
+			}
+			// no drafts are left behind by emails that were created but not submitted
+			if n := len(s.Objects(s.AccountId(jmaptest.DefaultUsername), "Email")); n != 0 {
+				t.Errorf("expected no emails, got %d", n)
+			}
+		})
+	}
+}
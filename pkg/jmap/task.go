@@ -1,36 +1,33 @@
 package jmap
 
 import (
+	"context"
 	"fmt"
+
+	"opencloud.eu/groupware-assistant/pkg/models"
 )
 
-var TaskListsObjectType = "TaskLists"
+var TaskListsObjectType = "TaskList"
 var TaskObjectType = "Task"
 
 type TaskSender struct {
 	j          *Jmap
 	accountId  string
 	tasklistId string
+	batch      *batch
 }
 
 func (s *TaskSender) TaskList() string {
 	return s.tasklistId
 }
 
-func NewTaskSender(j *Jmap, accountId string, tasklistId string) (*TaskSender, error) {
-	if accountId == "" {
-		// use default mail account
-		accountId = j.session.PrimaryAccounts.Tasks
-		if accountId == "" {
-			return nil, fmt.Errorf("session has no matching primary account")
-		}
-	} else {
-		if _, ok := j.session.Accounts[accountId]; !ok {
-			return nil, fmt.Errorf("account ID '%s' does not exist in session", accountId)
-		}
+func NewTaskSender(ctx context.Context, j *Jmap, accountId string, tasklistId string) (*TaskSender, error) {
+	accountId, err := j.account(accountId, JmapTasks)
+	if err != nil {
+		return nil, err
 	}
 
-	tasklistsById, err := objectsById(j, accountId, TaskListsObjectType, JmapTasks)
+	tasklistsById, err := objectsById(ctx, j, accountId, TaskListsObjectType, JmapTasks)
 	if err != nil {
 		return nil, err
 	}
@@ -56,6 +53,7 @@ func NewTaskSender(j *Jmap, accountId string, tasklistId string) (*TaskSender, e
 		j:          j,
 		accountId:  accountId,
 		tasklistId: tasklistId,
+		batch:      newBatch(j, accountId, TaskObjectType, JmapTasks),
 	}, nil
 }
 
@@ -63,31 +61,22 @@ func (s *TaskSender) Close() error {
 	return nil
 }
 
-func (s *TaskSender) EmptyTasks() (uint, error) {
-	return empty(s.j, s.accountId, TaskObjectType, JmapTasks, map[string]any{
+func (s *TaskSender) EmptyTasks(ctx context.Context) (EmptyResult, error) {
+	return empty(ctx, s.j, s.accountId, TaskObjectType, JmapTasks, map[string]any{
 		"inTaskList": s.tasklistId,
-	}, s.destroy)
+	})
 }
 
-func (s *TaskSender) destroy(ids []string) error {
-	return destroy(s.j, s.accountId, TaskObjectType, JmapTasks, ids)
+// QueueTask queues the task for creation.
+//
+// The task is sent along with others once enough of them have been queued, or when Flush
+// is called, after which done is invoked with the ID of the created task or with the error
+// that prevented its creation.
+func (s *TaskSender) QueueTask(ctx context.Context, c models.Task, done func(id string, err error) error) error {
+	return s.batch.add(ctx, c, done)
 }
 
-func (s *TaskSender) CreateTask(c map[string]any) (string, error) {
-	body := map[string]any{
-		"using": []string{JmapCore, JmapTasks},
-		"methodCalls": []any{
-			[]any{
-				TaskObjectType + "/set",
-				map[string]any{
-					"accountId": s.accountId,
-					"create": map[string]any{
-						"c": c,
-					},
-				},
-				"0",
-			},
-		},
-	}
-	return create(s.j, "c", TaskObjectType, body)
+// Flush sends all the tasks that are currently queued.
+func (s *TaskSender) Flush(ctx context.Context) error {
+	return s.batch.flush(ctx)
 }
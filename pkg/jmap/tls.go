@@ -0,0 +1,74 @@
+package jmap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// TLSConfig determines how the server certificate is verified and which client certificate,
+// if any, is presented to it.
+type TLSConfig struct {
+	// PEM files with additional certificate authorities to trust, besides the ones of the system
+	CACerts []string
+	// PEM files with the client certificate and its private key for mutual TLS, where the key
+	// may also be part of the certificate file
+	ClientCert string
+	ClientKey  string
+	// skips the verification of the server certificate altogether
+	Insecure bool
+}
+
+func (c TLSConfig) build() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.Insecure,
+	}
+
+	if len(c.CACerts) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, file := range c.CACerts {
+			pem, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no PEM encoded certificates found in '%s'", file)
+			}
+		}
+		config.RootCAs = pool
+	}
+
+	if c.ClientCert != "" {
+		key := c.ClientKey
+		if key == "" {
+			key = c.ClientCert
+		}
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	} else if c.ClientKey != "" {
+		return nil, fmt.Errorf("a client key requires a client certificate")
+	}
+
+	return config, nil
+}
+
+// newHttpClient creates an HTTP client of our own, to leave the TLS settings of
+// http.DefaultClient alone for the other users of it in the same process.
+func newHttpClient(c TLSConfig) (*http.Client, error) {
+	tlsConfig, err := c.build()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
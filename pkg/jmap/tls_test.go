@@ -0,0 +1,186 @@
+package jmap_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/jmap/jmaptest"
+)
+
+// connectTLS returns a client of the server with the given TLS settings, or the error of
+// connecting to it.
+func connectTLS(t *testing.T, s *jmaptest.Server, config jmap.TLSConfig) (*jmap.Jmap, error) {
+	t.Helper()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := jmap.NewJmap(context.Background(), u, jmap.Config{
+		Auth: jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword},
+		TLS:  config,
+	})
+	if err == nil {
+		t.Cleanup(func() { j.Close() })
+	}
+	return j, err
+}
+
+// writePem writes PEM blocks to a file in the temporary directory of the test and returns its path.
+func writePem(t *testing.T, name string, blocks ...*pem.Block) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, b := range blocks {
+		if err := pem.Encode(f, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+// issue creates a certificate with a new key, which is self-signed unless a parent and the key
+// of its issuer are given.
+func issue(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func certificatePem(cert *x509.Certificate) *pem.Block {
+	return &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}
+}
+
+func keyPem(t *testing.T, key *ecdsa.PrivateKey) *pem.Block {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+}
+
+func TestTLSVerifiesServer(t *testing.T) {
+	s := jmaptest.NewUnstartedServer()
+	s.StartTLS()
+	defer s.Close()
+
+	// the certificate of the test server is not trusted unless we are told to
+	if _, err := connectTLS(t, s, jmap.TLSConfig{}); err == nil {
+		t.Error("expected the unknown server certificate to be rejected by default")
+	}
+	if _, err := connectTLS(t, s, jmap.TLSConfig{Insecure: true}); err != nil {
+		t.Errorf("expected the server certificate not to be verified when insecure, got %v", err)
+	}
+
+	bundle := writePem(t, "ca.pem", certificatePem(s.Certificate()))
+	j, err := connectTLS(t, s, jmap.TLSConfig{CACerts: []string{bundle}})
+	if err != nil {
+		t.Fatalf("expected the server certificate to be trusted through the CA bundle, got %v", err)
+	}
+	if err := mailboxes(context.Background(), j, s); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTLSInvalidSettings(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, []byte("no certificates here\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for name, config := range map[string]jmap.TLSConfig{
+		"missing file":         {CACerts: []string{filepath.Join(t.TempDir(), "missing.pem")}},
+		"no certificates":      {CACerts: []string{empty}},
+		"key without its cert": {ClientKey: empty},
+	} {
+		t.Run(name, func(t *testing.T) {
+			u, err := url.Parse("https://jmap.example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := jmap.NewJmap(context.Background(), u, jmap.Config{Auth: jmap.BearerToken{Token: "token"}, TLS: config}); err == nil {
+				t.Error("expected the TLS settings to be rejected")
+			}
+		})
+	}
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	now := time.Now()
+	ca, caKey := issue(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	client, clientKey := issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: jmaptest.DefaultUsername},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	s := jmaptest.NewUnstartedServer()
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+	s.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	s.StartTLS()
+	defer s.Close()
+	bundle := writePem(t, "ca.pem", certificatePem(s.Certificate()))
+
+	cert := writePem(t, "client.pem", certificatePem(client))
+	key := writePem(t, "client.key", keyPem(t, clientKey))
+	combined := writePem(t, "combined.pem", certificatePem(client), keyPem(t, clientKey))
+	for name, c := range map[string]struct {
+		config jmap.TLSConfig
+		ok     bool
+	}{
+		"none":                 {jmap.TLSConfig{CACerts: []string{bundle}}, false},
+		"with its key":         {jmap.TLSConfig{CACerts: []string{bundle}, ClientCert: cert, ClientKey: key}, true},
+		"key in the same file": {jmap.TLSConfig{CACerts: []string{bundle}, ClientCert: combined}, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := connectTLS(t, s, c.config)
+			if c.ok && err != nil {
+				t.Errorf("expected the client certificate to be accepted, got %v", err)
+			} else if !c.ok && err == nil {
+				t.Error("expected the server to require a client certificate")
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package jmap
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"opencloud.eu/groupware-assistant/pkg/tools"
+)
+
+const (
+	TraceFormatHar   = "har"
+	TraceFormatJsonl = "jsonl"
+
+	// bodies that are longer than this are truncated in the trace file
+	maxTracedBodySize = 256 * 1024
+)
+
+// The HAR 1.2 structures, see http://www.softwareishard.com/blog/har-12-spec/
+// Properties that start with an underscore are custom ones, which the specification allows.
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"_encoding,omitempty"`
+	Sha256   string `json:"_sha256,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	Url         string         `json:"url"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"_encoding,omitempty"`
+	Sha256   string `json:"_sha256,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectUrl string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	JmapMethods     []string    `json:"_jmapMethods,omitempty"`
+	Attempt         uint        `json:"_attempt,omitempty"`
+	Error           string      `json:"_error,omitempty"`
+}
+
+// tracer writes the HTTP exchanges with the JMAP server to a file, either as an HTTP Archive
+// or as one HAR entry per line, which is easier to process with tools like jq.
+//
+// The HAR document is streamed, with its closing brackets written when the tracer is closed,
+// to not keep all the entries in memory during large runs.
+type tracer struct {
+	m      sync.Mutex
+	f      *os.File
+	w      *bufio.Writer
+	format string
+	count  int
+}
+
+func newTracer(filename string, format string) (*tracer, error) {
+	if format == "" {
+		if strings.EqualFold(filepath.Ext(filename), ".har") {
+			format = TraceFormatHar
+		} else {
+			format = TraceFormatJsonl
+		}
+	}
+	if format != TraceFormatHar && format != TraceFormatJsonl {
+		return nil, fmt.Errorf("unsupported trace format '%s', must be either '%s' or '%s'", format, TraceFormatHar, TraceFormatJsonl)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	t := &tracer{f: f, w: bufio.NewWriter(f), format: format}
+	if format == TraceFormatHar {
+		creator, err := json.Marshal(map[string]string{"name": tools.ProductName, "version": "1"})
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(t.w, `{"log":{"version":"1.2","creator":%s,"entries":[`, creator)
+	}
+	return t, nil
+}
+
+func (t *tracer) record(e harEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	switch t.format {
+	case TraceFormatHar:
+		if t.count > 0 {
+			t.w.WriteByte(',')
+		}
+		t.w.Write(b)
+	default:
+		t.w.Write(b)
+		t.w.WriteByte('\n')
+	}
+	t.count++
+	// flush every entry, so that the file is useful even when the process gets killed
+	return t.w.Flush()
+}
+
+func (t *tracer) Close() error {
+	t.m.Lock()
+	defer t.m.Unlock()
+	if t.format == TraceFormatHar {
+		t.w.WriteString("]}}\n")
+	}
+	if err := t.w.Flush(); err != nil {
+		t.f.Close()
+		return err
+	}
+	return t.f.Close()
+}
+
+var redactedHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+	"Set-Cookie":    true,
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	result := []harNameValue{}
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range h[name] {
+			if redactedHeaders[http.CanonicalHeaderKey(name)] {
+				// keep the scheme, which tells us which authentication method was used
+				if scheme, _, ok := strings.Cut(value, " "); ok && name == "Authorization" {
+					value = scheme + " [REDACTED]"
+				} else {
+					value = "[REDACTED]"
+				}
+			}
+			result = append(result, harNameValue{Name: name, Value: value})
+		}
+	}
+	return result
+}
+
+// harBody renders a body for the trace: text is included as is, unless it is too long, in
+// which case it is truncated, while binary data such as blobs is replaced by its hash.
+func harBody(contentType string, body []byte) (text string, encoding string, sha string) {
+	if len(body) == 0 {
+		return "", "", ""
+	}
+	if !isTextual(contentType) || !utf8.Valid(body) {
+		sum := sha256.Sum256(body)
+		return "", "omitted", hex.EncodeToString(sum[:])
+	}
+	if len(body) > maxTracedBodySize {
+		sum := sha256.Sum256(body)
+		return string(body[:maxTracedBodySize]), "truncated", hex.EncodeToString(sum[:])
+	}
+	return string(body), "", ""
+}
+
+// capture keeps the beginning of a body that is streamed, rather than read at once, along with
+// its size and hash, to render it like harBody would once the stream has ended.
+type capture struct {
+	r    io.Reader
+	head []byte
+	size int
+	sum  hash.Hash
+}
+
+func newCapture(r io.Reader) *capture {
+	return &capture{r: r, sum: sha256.New()}
+}
+
+func (c *capture) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if room := maxTracedBodySize - len(c.head); room > 0 {
+		c.head = append(c.head, p[:min(n, room)]...)
+	}
+	c.size += n
+	c.sum.Write(p[:n])
+	return n, err
+}
+
+// body renders the body that has been read so far like harBody.
+func (c *capture) body(contentType string) (text string, encoding string, sha string) {
+	if c.size <= maxTracedBodySize {
+		return harBody(contentType, c.head)
+	}
+	sha = hex.EncodeToString(c.sum.Sum(nil))
+	if !isTextual(contentType) || !utf8.Valid(c.head[:len(c.head)-utf8.UTFMax]) {
+		return "", "omitted", sha
+	}
+	return string(c.head), "truncated", sha
+}
+
+// harContentBody renders the content of an upload like harBody, without reading it into memory
+// unless it is small enough to be included.
+func harContentBody(contentType string, c Content) (text string, encoding string, sha string) {
+	if c.Size <= maxTracedBodySize {
+		if r, err := c.Open(); err == nil {
+			if body, err := io.ReadAll(r); err == nil {
+				return harBody(contentType, body)
+			}
+		}
+	}
+	sum, err := c.hash()
+	if err != nil {
+		return "", "omitted", ""
+	}
+	return "", "omitted", hex.EncodeToString(sum[:])
+}
+
+func isTextual(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/x-www-form-urlencoded", "message/rfc822", "text/event-stream":
+		return true
+	}
+	return false
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
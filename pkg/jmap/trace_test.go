@@ -0,0 +1,209 @@
+package jmap_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"opencloud.eu/groupware-assistant/pkg/jmap"
+	"opencloud.eu/groupware-assistant/pkg/jmap/jmaptest"
+)
+
+// cookieAuth authenticates with a session cookie on top of basic authentication, as some
+// proxies in front of JMAP servers require.
+type cookieAuth struct {
+	jmap.BasicAuth
+	cookie string
+}
+
+func (a cookieAuth) Authenticate(ctx context.Context, h *http.Client, req *http.Request) error {
+	req.Header.Set("Cookie", a.cookie)
+	return a.BasicAuth.Authenticate(ctx, h, req)
+}
+
+// tracing returns a client of the server that writes its trace file in the given format, and
+// the path of that file.
+func tracing(t *testing.T, s *jmaptest.Server, auth jmap.Authenticator, format string) (*jmap.Jmap, string) {
+	t.Helper()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	traceFile := filepath.Join(t.TempDir(), "trace."+format)
+	j, err := jmap.NewJmap(context.Background(), u, jmap.Config{Auth: auth, TraceFile: traceFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+	return j, traceFile
+}
+
+// traced closes the client and returns the entries of its trace file, which must be of the
+// shape of the given format.
+func traced(t *testing.T, j *jmap.Jmap, traceFile string, format string) []map[string]any {
+	t.Helper()
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(traceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []map[string]any{}
+	switch format {
+	case jmap.TraceFormatHar:
+		var har struct {
+			Log struct {
+				Version string           `json:"version"`
+				Creator map[string]any   `json:"creator"`
+				Entries []map[string]any `json:"entries"`
+			} `json:"log"`
+		}
+		if err := json.Unmarshal(b, &har); err != nil {
+			t.Fatalf("expected an HTTP Archive, got %v: %s", err, b)
+		}
+		if har.Log.Version != "1.2" || har.Log.Creator["name"] == nil {
+			t.Errorf("expected a HAR 1.2 log with its creator, got %s", b)
+		}
+		entries = har.Log.Entries
+	case jmap.TraceFormatJsonl:
+		for _, line := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+			var e map[string]any
+			if err := json.Unmarshal([]byte(line), &e); err != nil {
+				t.Fatalf("expected a HAR entry per line, got %v: %q", err, line)
+			}
+			entries = append(entries, e)
+		}
+	}
+	for _, e := range entries {
+		if e["request"] == nil || e["response"] == nil || e["timings"] == nil {
+			t.Errorf("expected a HAR entry, got %v", e)
+		}
+	}
+	return entries
+}
+
+// tracedTo returns the entry of the first request whose URL contains the given path.
+func tracedTo(t *testing.T, entries []map[string]any, path string) (request map[string]any, response map[string]any) {
+	t.Helper()
+	for _, e := range entries {
+		request = e["request"].(map[string]any)
+		if strings.Contains(request["url"].(string), path) {
+			return request, e["response"].(map[string]any)
+		}
+	}
+	t.Fatalf("expected a request to %s in the trace, got %v", path, entries)
+	return nil, nil
+}
+
+func TestTraceRedactsCredentials(t *testing.T) {
+	for _, format := range []string{jmap.TraceFormatHar, jmap.TraceFormatJsonl} {
+		t.Run(format, func(t *testing.T) {
+			s := jmaptest.NewServer()
+			defer s.Close()
+			s.Cookie = &http.Cookie{Name: "route", Value: "set-cookie-secret"}
+
+			j, traceFile := tracing(t, s, cookieAuth{
+				BasicAuth: jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword},
+				cookie:    "session=cookie-secret",
+			}, format)
+			if err := mailboxes(context.Background(), j, s); err != nil {
+				t.Fatal(err)
+			}
+			entries := traced(t, j, traceFile, format)
+			// the session and the API request
+			if len(entries) != 2 {
+				t.Errorf("expected 2 entries, got %d", len(entries))
+			}
+
+			b, err := os.ReadFile(traceFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			credentials := base64.StdEncoding.EncodeToString([]byte(jmaptest.DefaultUsername + ":" + jmaptest.DefaultPassword))
+			for _, secret := range []string{credentials, "cookie-secret", "set-cookie-secret"} {
+				if bytes.Contains(b, []byte(secret)) {
+					t.Errorf("expected %q to be redacted from the trace, got %s", secret, b)
+				}
+			}
+			request, response := tracedTo(t, entries, "/api")
+			headers, _ := json.Marshal(request["headers"])
+			if !strings.Contains(string(headers), `{"name":"Authorization","value":"Basic [REDACTED]"}`) ||
+				!strings.Contains(string(headers), `{"name":"Cookie","value":"[REDACTED]"}`) {
+				t.Errorf("expected the credentials to be redacted, got %s", headers)
+			}
+			headers, _ = json.Marshal(response["headers"])
+			if !strings.Contains(string(headers), `{"name":"Set-Cookie","value":"[REDACTED]"}`) {
+				t.Errorf("expected the cookie to be redacted, got %s", headers)
+			}
+		})
+	}
+}
+
+func TestTraceHashesBinaryBodies(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	j, traceFile := tracing(t, s, jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword}, jmap.TraceFormatJsonl)
+	accountId := s.AccountId(jmaptest.DefaultUsername)
+
+	data := []byte{0x89, 'P', 'N', 'G', 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0xff, 0xfe}
+	sender, err := jmap.NewEmailSender(context.Background(), j, accountId, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := sender.NewEmail()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Subject("Logo")
+	e.Text("See the attachment.")
+	e.Attach(jmap.Bytes(data), "image/png", "logo.png")
+	if err := sender.Prepare(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+
+	request, _ := tracedTo(t, traced(t, j, traceFile, jmap.TraceFormatJsonl), "/upload/")
+	sum := sha256.Sum256(data)
+	postData := request["postData"].(map[string]any)
+	if postData["text"] != "" || postData["_encoding"] != "omitted" || postData["_sha256"] != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected the binary body to be replaced by its hash, got %v", postData)
+	}
+	if request["bodySize"] != float64(len(data)) {
+		t.Errorf("expected a body size of %d, got %v", len(data), request["bodySize"])
+	}
+}
+
+func TestTraceTruncatesLongBodies(t *testing.T) {
+	s := jmaptest.NewServer()
+	defer s.Close()
+	j, traceFile := tracing(t, s, jmap.BasicAuth{Username: jmaptest.DefaultUsername, Password: jmaptest.DefaultPassword}, jmap.TraceFormatJsonl)
+	accountId := s.AccountId(jmaptest.DefaultUsername)
+
+	data := bytes.Repeat([]byte("All work and no play makes Jack a dull boy.\n"), 8000)
+	blobId := s.PutBlob(accountId, data, "text/plain")
+	if _, err := j.Download(context.Background(), accountId, blobId, "jack.txt", "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, response := tracedTo(t, traced(t, j, traceFile, jmap.TraceFormatJsonl), "/download/")
+	content := response["content"].(map[string]any)
+	sum := sha256.Sum256(data)
+	if text, _ := content["text"].(string); text != string(data[:256*1024]) {
+		t.Errorf("expected the body to be truncated to 256 KiB, got %d bytes", len(text))
+	}
+	if content["_encoding"] != "truncated" || content["_sha256"] != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected the truncated body to be marked with the hash of all of it, got %v and %v", content["_encoding"], content["_sha256"])
+	}
+	if content["size"] != float64(len(data)) {
+		t.Errorf("expected a size of %d, got %v", len(data), content["size"])
+	}
+}
@@ -0,0 +1,378 @@
+// Package message writes RFC 5322 messages with MIME (RFC 2045 and 2046) bodies, to import
+// byte-exact emails, and for the test server to serve the emails that were created with
+// Email/set as such.
+package message
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strings"
+	"time"
+
+	"opencloud.eu/groupware-assistant/pkg/models"
+)
+
+// Field is a header field of a message, which are written in the order in which they are
+// given.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Part is a part of a MIME body, which is either a leaf with a body that is encoded already,
+// a leaf with content that is encoded in base64 as it is written, or a multipart of other
+// parts.
+type Part struct {
+	header    textproto.MIMEHeader
+	body      []byte
+	content   func() (io.Reader, error)
+	multipart string
+	boundary  string
+	params    map[string]string
+	parts     []Part
+}
+
+// Text creates a text part of the given type, such as text/plain or text/html, in UTF-8 and
+// quoted-printable.
+func Text(contentType string, text string) Part {
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType(contentType, map[string]string{"charset": "utf-8"}))
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	var body bytes.Buffer
+	w := quotedprintable.NewWriter(&body)
+	w.Write([]byte(text))
+	w.Close()
+	return Part{header: h, body: body.Bytes()}
+}
+
+// Language sets the Content-Language (RFC 3282) of a part, unless the tag is empty.
+func (p Part) Language(tag string) Part {
+	if tag != "" && p.header != nil {
+		h := textproto.MIMEHeader{}
+		maps.Copy(h, p.header)
+		h.Set("Content-Language", tag)
+		p.header = h
+	}
+	return p
+}
+
+// Attachment creates a part with the given content in base64, as an attachment with the given
+// filename, unless it is empty.
+func Attachment(contentType string, filename string, content []byte) Part {
+	return AttachmentReader(contentType, filename, inMemory(content))
+}
+
+// AttachmentReader creates an attachment like Attachment, of which the content is only read
+// when the part is written, every time it is.
+func AttachmentReader(contentType string, filename string, open func() (io.Reader, error)) Part {
+	return binary(contentType, "attachment", filename, "", open)
+}
+
+// Inline creates a part with the given content in base64, to be displayed inline, and to be
+// referred to as cid:<cid> by an HTML part in the same multipart/related.
+func Inline(contentType string, filename string, cid string, content []byte) Part {
+	return InlineReader(contentType, filename, cid, inMemory(content))
+}
+
+// InlineReader creates an inline part like Inline, of which the content is only read when the
+// part is written, every time it is.
+func InlineReader(contentType string, filename string, cid string, open func() (io.Reader, error)) Part {
+	return binary(contentType, "inline", filename, cid, open)
+}
+
+func inMemory(content []byte) func() (io.Reader, error) {
+	return func() (io.Reader, error) { return bytes.NewReader(content), nil }
+}
+
+func binary(contentType string, disposition string, filename string, cid string, open func() (io.Reader, error)) Part {
+	h := textproto.MIMEHeader{}
+	if filename != "" {
+		contentType = mime.FormatMediaType(contentType, map[string]string{"name": filename})
+		disposition = mime.FormatMediaType(disposition, map[string]string{"filename": filename})
+	}
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Disposition", disposition)
+	if cid != "" {
+		// set directly, as the canonical form would be Content-Id
+		h["Content-ID"] = []string{"<" + cid + ">"}
+	}
+	h.Set("Content-Transfer-Encoding", "base64")
+	return Part{header: h, content: open}
+}
+
+// lines breaks base64 into lines of 76 characters, each of which ends with a CRLF once it is
+// closed.
+type lines struct {
+	w      io.Writer
+	column int
+}
+
+func (l *lines) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if l.column == 76 {
+			if _, err := io.WriteString(l.w, "\r\n"); err != nil {
+				return n, err
+			}
+			l.column = 0
+		}
+		k := min(len(p), 76-l.column)
+		if _, err := l.w.Write(p[:k]); err != nil {
+			return n, err
+		}
+		l.column += k
+		n += k
+		p = p[k:]
+	}
+	return n, nil
+}
+
+func (l *lines) Close() error {
+	_, err := io.WriteString(l.w, "\r\n")
+	return err
+}
+
+// multipartWith creates a multipart with the given parameters in its Content-Type besides the
+// boundary, such as the protocol of a multipart/signed.
+//
+// The boundary is picked here rather than when the multipart is written, for the message to
+// be the same every time it is written.
+func multipartWith(subtype string, params map[string]string, parts ...Part) Part {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	return Part{multipart: subtype, boundary: boundary, params: params, parts: parts}
+}
+
+// Multipart creates a multipart of the given subtype, such as alternative, related or mixed,
+// or returns the only part when there is just one, as a multipart of one part does not tell
+// anything.
+func Multipart(subtype string, parts ...Part) Part {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return multipartWith(subtype, nil, parts...)
+}
+
+// mimeHeader returns the header fields of a part.
+func (p Part) mimeHeader() textproto.MIMEHeader {
+	if p.multipart == "" {
+		return p.header
+	}
+	params := map[string]string{"boundary": p.boundary}
+	maps.Copy(params, p.params)
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType("multipart/"+p.multipart, params))
+	return h
+}
+
+// writeBody writes the body of a part, reading the content of its leaves as it goes.
+func (p Part) writeBody(w io.Writer) error {
+	if p.multipart != "" {
+		mw := multipart.NewWriter(w)
+		if err := mw.SetBoundary(p.boundary); err != nil {
+			return err
+		}
+		for _, part := range p.parts {
+			pw, err := mw.CreatePart(part.mimeHeader())
+			if err != nil {
+				return err
+			}
+			if err := part.writeBody(pw); err != nil {
+				return err
+			}
+		}
+		return mw.Close()
+	}
+	if p.content == nil {
+		_, err := w.Write(p.body)
+		return err
+	}
+	r, err := p.content()
+	if err != nil {
+		return err
+	}
+	l := &lines{w: w}
+	e := base64.NewEncoder(base64.StdEncoding, l)
+	if _, err := io.Copy(e, r); err != nil {
+		return err
+	}
+	if err := e.Close(); err != nil {
+		return err
+	}
+	return l.Close()
+}
+
+// writeHeader writes header fields in the order of their names, followed by the empty line
+// that ends the header.
+func writeHeader(w io.Writer, h textproto.MIMEHeader) error {
+	var buf bytes.Buffer
+	for _, name := range slices.Sorted(maps.Keys(h)) {
+		for _, v := range h[name] {
+			fmt.Fprintf(&buf, "%s: %s\r\n", name, v)
+		}
+	}
+	buf.WriteString("\r\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// entity returns the MIME entity of a part, which is its header and its body as they are
+// written within a multipart, for it to be signed or encrypted as a whole.
+func (p Part) entity() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeHeader(&buf, p.mimeHeader()); err != nil {
+		return nil, err
+	}
+	if err := p.writeBody(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// verbatim creates a part of which the header and the body are written exactly as they are in
+// the given entity, which is needed for a signature over it to remain valid.
+func verbatim(entity []byte) Part {
+	header, body, _ := bytes.Cut(entity, []byte("\r\n\r\n"))
+	h := textproto.MIMEHeader{}
+	for _, line := range strings.Split(string(header), "\r\n") {
+		if name, value, ok := strings.Cut(line, ": "); ok {
+			h[name] = append(h[name], value)
+		}
+	}
+	return Part{header: h, body: body}
+}
+
+// Compose arranges the text and HTML bodies in a multipart/alternative, the HTML bodies along
+// with the inline parts they refer to in a multipart/related, and the body along with the
+// attachments in a multipart/mixed, as far as there is more than one part in each.
+func Compose(texts []Part, htmls []Part, related []Part, attachments []Part) Part {
+	if len(htmls) > 0 {
+		htmls = []Part{Multipart("related", append(htmls, related...)...)}
+	} else {
+		attachments = append(related, attachments...)
+	}
+	parts := []Part{}
+	if alternatives := append(texts, htmls...); len(alternatives) > 0 {
+		parts = append(parts, Multipart("alternative", alternatives...))
+	}
+	parts = append(parts, attachments...)
+	if len(parts) < 1 {
+		return Text("text/plain", "")
+	}
+	return Multipart("mixed", parts...)
+}
+
+// Fields returns the header fields of an email, followed by its other header fields in the
+// order of their names.
+func Fields(e models.Email) []Field {
+	fields := []Field{}
+	if e.SentAt != nil {
+		fields = append(fields, Field{Name: "Date", Value: Date(*e.SentAt)})
+	}
+	fields = append(fields,
+		Field{Name: "From", Value: emailAddresses(e.From)},
+		Field{Name: "Sender", Value: emailAddresses(e.Sender)},
+		Field{Name: "Reply-To", Value: emailAddresses(e.ReplyTo)},
+		Field{Name: "To", Value: emailAddresses(e.To)},
+		Field{Name: "Cc", Value: emailAddresses(e.Cc)},
+		Field{Name: "Bcc", Value: emailAddresses(e.Bcc)},
+		Field{Name: "Subject", Value: Unstructured(e.Subject)},
+		Field{Name: "Message-ID", Value: MessageIds(e.MessageId...)},
+		Field{Name: "In-Reply-To", Value: MessageIds(e.InReplyTo...)},
+		Field{Name: "References", Value: MessageIds(e.References...)},
+	)
+	for _, name := range slices.Sorted(maps.Keys(e.Headers)) {
+		fields = append(fields, Field{Name: name, Value: strings.TrimSpace(e.Headers[name])})
+	}
+	return fields
+}
+
+func emailAddresses(addresses []models.EmailAddress) string {
+	list := make([]mail.Address, len(addresses))
+	for i, a := range addresses {
+		list[i] = mail.Address{Name: a.Name, Address: a.Email}
+	}
+	return Addresses(list...)
+}
+
+// Write writes a message with the given header fields, of which those with empty values are
+// left out, followed by the MIME-Version and the header fields and body of the given part,
+// which is streamed rather than rendered in memory first.
+func Write(w io.Writer, fields []Field, body Part) error {
+	var buf bytes.Buffer
+	for _, f := range fields {
+		if f.Value != "" {
+			fmt.Fprintf(&buf, "%s: %s\r\n", f.Name, f.Value)
+		}
+	}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := writeHeader(w, body.mimeHeader()); err != nil {
+		return err
+	}
+	return body.writeBody(w)
+}
+
+// Bytes returns the message that Write writes.
+func Bytes(fields []Field, body Part) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Write(&buf, fields, body); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Size returns the number of bytes that Write writes, without holding them in memory.
+func Size(fields []Field, body Part) (int64, error) {
+	var c counter
+	err := Write(&c, fields, body)
+	return int64(c), err
+}
+
+type counter int64
+
+func (c *counter) Write(p []byte) (int, error) {
+	*c += counter(len(p))
+	return len(p), nil
+}
+
+// Addresses formats a list of addresses for the From, To, Cc and similar header fields, with
+// the names encoded as per RFC 2047 where needed.
+func Addresses(addresses ...mail.Address) string {
+	list := make([]string, len(addresses))
+	for i, a := range addresses {
+		list[i] = a.String()
+	}
+	return strings.Join(list, ", ")
+}
+
+// MessageIds formats a list of message IDs for the Message-ID, In-Reply-To and References
+// header fields.
+func MessageIds(ids ...string) string {
+	list := make([]string, len(ids))
+	for i, id := range ids {
+		list[i] = "<" + id + ">"
+	}
+	return strings.Join(list, " ")
+}
+
+// Unstructured encodes the value of a header field such as the Subject as per RFC 2047 if it
+// is not ASCII.
+func Unstructured(value string) string {
+	return mime.QEncoding.Encode("utf-8", value)
+}
+
+// Date formats the value of the Date header field.
+func Date(t time.Time) string {
+	return t.Format(time.RFC1123Z)
+}
@@ -0,0 +1,263 @@
+package message_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"opencloud.eu/groupware-assistant/pkg/message"
+)
+
+var boundaries = regexp.MustCompile(`boundary=([0-9a-f]+)`)
+
+// golden replaces the random boundaries of a message by ones that are numbered in the order
+// in which they appear, to compare it with the expected output.
+func golden(b []byte) string {
+	s := string(b)
+	for i, m := range boundaries.FindAllStringSubmatch(s, -1) {
+		s = strings.ReplaceAll(s, m[1], fmt.Sprintf("BOUNDARY%d", i+1))
+	}
+	return s
+}
+
+// shape renders the structure of a MIME entity, such as "mixed(text/plain,image/png)".
+func shape(t *testing.T, header map[string][]string, body io.Reader) string {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(header["Content-Type"][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	subtype, ok := strings.CutPrefix(mediaType, "multipart/")
+	if !ok {
+		return mediaType
+	}
+	parts := []string{}
+	r := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := r.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, shape(t, p.Header, p))
+	}
+	return subtype + "(" + strings.Join(parts, ",") + ")"
+}
+
+func TestCompose(t *testing.T) {
+	text := message.Text("text/plain", "Hello")
+	html := message.Text("text/html", `<p>Hello <img src="cid:logo"></p>`)
+	logo := message.Inline("image/png", "logo.png", "logo", []byte{0x89, 'P', 'N', 'G'})
+	pdf := message.Attachment("application/pdf", "report.pdf", []byte("%PDF-1.7"))
+	for _, c := range []struct {
+		name        string
+		texts       []message.Part
+		htmls       []message.Part
+		related     []message.Part
+		attachments []message.Part
+		shape       string
+	}{
+		{"nothing", nil, nil, nil, nil, "text/plain"},
+		{"text", []message.Part{text}, nil, nil, nil, "text/plain"},
+		{"text and HTML", []message.Part{text}, []message.Part{html}, nil, nil, "alternative(text/plain,text/html)"},
+		{"HTML with an inline image", nil, []message.Part{html}, []message.Part{logo}, nil, "related(text/html,image/png)"},
+		{"text and HTML with an inline image", []message.Part{text}, []message.Part{html}, []message.Part{logo}, nil, "alternative(text/plain,related(text/html,image/png))"},
+		{"text with an attachment", []message.Part{text}, nil, nil, []message.Part{pdf}, "mixed(text/plain,application/pdf)"},
+		// without an HTML body to refer to it, the inline image is just another attachment
+		{"text with an inline image", []message.Part{text}, nil, []message.Part{logo}, []message.Part{pdf}, "mixed(text/plain,image/png,application/pdf)"},
+		{"everything", []message.Part{text}, []message.Part{html}, []message.Part{logo}, []message.Part{pdf}, "mixed(alternative(text/plain,related(text/html,image/png)),application/pdf)"},
+		{"attachment only", nil, nil, nil, []message.Part{pdf}, "application/pdf"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			b, err := message.Bytes(nil, message.Compose(c.texts, c.htmls, c.related, c.attachments))
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := mail.ReadMessage(bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s := shape(t, m.Header, m.Body); s != c.shape {
+				t.Errorf("expected %s, got %s", c.shape, s)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	sent := time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+	fields := []message.Field{
+		{Name: "Date", Value: message.Date(sent)},
+		{Name: "From", Value: message.Addresses(mail.Address{Name: "Alan Turing", Address: "alan@example.com"})},
+		{Name: "To", Value: message.Addresses(mail.Address{Address: "grace@example.com"})},
+		// fields without a value are left out
+		{Name: "Cc", Value: ""},
+		{Name: "Subject", Value: message.Unstructured("Report")},
+		{Name: "Message-ID", Value: message.MessageIds("1@example.com")},
+	}
+	body := message.Compose(
+		[]message.Part{message.Text("text/plain", "See the report.")},
+		nil, nil,
+		[]message.Part{message.Attachment("application/pdf", "report.pdf", []byte("%PDF-1.7"))},
+	)
+	b, err := message.Bytes(fields, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Date: Sat, 14 Mar 2026 15:09:26 +0000\r\n" +
+		"From: \"Alan Turing\" <alan@example.com>\r\n" +
+		"To: <grace@example.com>\r\n" +
+		"Subject: Report\r\n" +
+		"Message-ID: <1@example.com>\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=BOUNDARY1\r\n" +
+		"\r\n" +
+		"--BOUNDARY1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"See the report.\r\n" +
+		"--BOUNDARY1\r\n" +
+		"Content-Disposition: attachment; filename=report.pdf\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"Content-Type: application/pdf; name=report.pdf\r\n" +
+		"\r\n" +
+		"JVBERi0xLjc=\r\n" +
+		"\r\n" +
+		"--BOUNDARY1--\r\n"
+	if g := golden(b); g != expected {
+		t.Errorf("expected\n%q\ngot\n%q", expected, g)
+	}
+}
+
+func TestSize(t *testing.T) {
+	reads := 0
+	body := message.Compose(
+		[]message.Part{message.Text("text/plain", strings.Repeat("Grüße aus Köln. ", 100))},
+		[]message.Part{message.Text("text/html", "<p>Grüße</p>")},
+		[]message.Part{message.Inline("image/png", "logo.png", "logo", bytes.Repeat([]byte{0x89, 0x50}, 500))},
+		[]message.Part{message.AttachmentReader("application/octet-stream", "data.bin", func() (io.Reader, error) {
+			reads++
+			return bytes.NewReader(bytes.Repeat([]byte{0, 1, 2, 3, 4, 5, 6}, 10000)), nil
+		})},
+	)
+	fields := []message.Field{{Name: "Subject", Value: message.Unstructured("Grüße")}}
+
+	size, err := message.Size(fields, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := message.Bytes(fields, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := message.Bytes(fields, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(first)) {
+		t.Errorf("expected the size %d of the written message, got %d", len(first), size)
+	}
+	// the boundaries are picked once, for the message to be the same every time
+	if !bytes.Equal(first, second) {
+		t.Error("expected the message to be the same every time it is written")
+	}
+	if reads != 3 {
+		t.Errorf("expected the content to be read every time the message is written, read %d times", reads)
+	}
+}
+
+func TestBase64Lines(t *testing.T) {
+	// 57 bytes make exactly one line of 76 characters
+	for _, n := range []int{0, 1, 56, 57, 58, 114, 1000} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			content := make([]byte, n)
+			for i := range content {
+				content[i] = byte(i * 7)
+			}
+			b, err := message.Bytes(nil, message.Attachment("application/octet-stream", "", content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, body, _ := bytes.Cut(b, []byte("\r\n\r\n"))
+			if !bytes.HasSuffix(body, []byte("\r\n")) {
+				t.Fatalf("expected the body to end with a CRLF, got %q", body)
+			}
+			lines := strings.Split(strings.TrimSuffix(string(body), "\r\n"), "\r\n")
+			for i, line := range lines {
+				if len(line) > 76 || (len(line) < 76 && i < len(lines)-1) {
+					t.Errorf("expected lines of 76 characters but the last, got %d in line %d", len(line), i+1)
+				}
+				if line == "" && n > 0 {
+					t.Errorf("expected no empty lines, got one in line %d", i+1)
+				}
+			}
+			decoded, err := base64.StdEncoding.DecodeString(strings.Join(lines, ""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decoded, content) {
+				t.Error("expected the body to decode to the content")
+			}
+		})
+	}
+}
+
+func TestEncodedWords(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{"ASCII subject", message.Unstructured("Quarterly report"), "Quarterly report"},
+		{"non-ASCII subject", message.Unstructured("Grüße aus Köln"), "=?utf-8?q?Gr=C3=BC=C3=9Fe_aus_K=C3=B6ln?="},
+		{"ASCII name", message.Addresses(mail.Address{Name: "Alan Turing", Address: "alan@example.com"}), `"Alan Turing" <alan@example.com>`},
+		{"non-ASCII names", message.Addresses(
+			mail.Address{Name: "Jörg Müller", Address: "joerg@example.com"},
+			mail.Address{Name: "Zoë", Address: "zoe@example.com"},
+		), "=?utf-8?q?J=C3=B6rg_M=C3=BCller?= <joerg@example.com>, =?utf-8?q?Zo=C3=AB?= <zoe@example.com>"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if c.value != c.expected {
+				t.Errorf("expected %q, got %q", c.expected, c.value)
+			}
+		})
+	}
+
+	// the header fields are ASCII, and decode to the names and subject again
+	fields := []message.Field{
+		{Name: "From", Value: message.Addresses(mail.Address{Name: "Jörg Müller", Address: "joerg@example.com"})},
+		{Name: "Subject", Value: message.Unstructured("Grüße aus Köln")},
+	}
+	b, err := message.Bytes(fields, message.Text("text/plain", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range b {
+		if c > 127 {
+			t.Fatalf("expected the message to be ASCII, got %q", b)
+		}
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err := m.Header.AddressList("From")
+	if err != nil || len(from) != 1 || from[0].Name != "Jörg Müller" {
+		t.Errorf("expected the name to be decoded, got %v (%v)", from, err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil || subject != "Grüße aus Köln" {
+		t.Errorf("expected the subject to be decoded, got %q (%v)", subject, err)
+	}
+}
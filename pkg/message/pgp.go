@@ -0,0 +1,71 @@
+package message
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+// SignPGP signs a part with the given unlocked private key as per RFC 3156, which puts it in a
+// multipart/signed along with the detached signature.
+func SignPGP(p Part, signer *crypto.KeyRing) (Part, error) {
+	entity, err := p.entity()
+	if err != nil {
+		return Part{}, err
+	}
+	signature, err := signer.SignDetached(crypto.NewPlainMessage(entity))
+	if err != nil {
+		return Part{}, err
+	}
+	armored, err := signature.GetArmored()
+	if err != nil {
+		return Part{}, err
+	}
+	// the micalg names the hash that the signature uses, which depends on the library and key
+	pkt, err := packet.Read(bytes.NewReader(signature.GetBinary()))
+	if err != nil {
+		return Part{}, err
+	}
+	sig, ok := pkt.(*packet.Signature)
+	if !ok {
+		return Part{}, fmt.Errorf("the signature is a %T rather than a signature packet", pkt)
+	}
+	micalg := "pgp-" + strings.ToLower(strings.ReplaceAll(sig.Hash.String(), "-", ""))
+	return multipartWith("signed", map[string]string{"protocol": "application/pgp-signature", "micalg": micalg},
+		verbatim(entity),
+		armoredPart("application/pgp-signature", "signature.asc", armored),
+	), nil
+}
+
+// EncryptPGP encrypts a part for the given public keys as per RFC 3156, which puts it in a
+// multipart/encrypted along with the version of the protocol.
+func EncryptPGP(p Part, recipients *crypto.KeyRing) (Part, error) {
+	entity, err := p.entity()
+	if err != nil {
+		return Part{}, err
+	}
+	encrypted, err := recipients.Encrypt(crypto.NewPlainMessage(entity), nil)
+	if err != nil {
+		return Part{}, err
+	}
+	armored, err := encrypted.GetArmored()
+	if err != nil {
+		return Part{}, err
+	}
+	version := Part{header: map[string][]string{"Content-Type": {"application/pgp-encrypted"}}, body: []byte("Version: 1\r\n")}
+	return multipartWith("encrypted", map[string]string{"protocol": "application/pgp-encrypted"},
+		version,
+		armoredPart("application/octet-stream", "encrypted.asc", armored),
+	), nil
+}
+
+func armoredPart(contentType string, filename string, armored string) Part {
+	p := binary(contentType, "inline", filename, "", nil)
+	p.header.Del("Content-Transfer-Encoding")
+	p.content = nil
+	p.body = []byte(strings.ReplaceAll(strings.TrimRight(armored, "\n"), "\n", "\r\n") + "\r\n")
+	return p
+}
@@ -0,0 +1,232 @@
+package message
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"mime"
+	"slices"
+	"time"
+)
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidAES256CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// The CMS structures of RFC 5652 that make up a detached signature.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+type encapsulatedContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+}
+
+type signerInfo struct {
+	Version            int
+	Sid                issuerAndSerialNumber
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// The CMS structures of RFC 5652 that make up a message encrypted for its recipients.
+type envelopedData struct {
+	Version              int
+	RecipientInfos       []keyTransRecipientInfo `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type keyTransRecipientInfo struct {
+	Version                int
+	Rid                    issuerAndSerialNumber
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+// SignSMIME signs a part with the given certificate and its RSA key as per RFC 8551, which puts
+// it in a multipart/signed along with the detached CMS signature, which includes the given
+// chain of certificates that issued the one of the signer.
+func SignSMIME(p Part, certificate *x509.Certificate, key *rsa.PrivateKey, chain ...*x509.Certificate) (Part, error) {
+	entity, err := p.entity()
+	if err != nil {
+		return Part{}, err
+	}
+	digest := sha256.Sum256(entity)
+
+	attributes := [][]byte{}
+	for _, a := range []struct {
+		oid   asn1.ObjectIdentifier
+		value any
+	}{
+		{oidContentType, oidData},
+		{oidSigningTime, time.Now().UTC()},
+		{oidMessageDigest, digest[:]},
+	} {
+		value, err := asn1.Marshal(a.value)
+		if err != nil {
+			return Part{}, err
+		}
+		b, err := asn1.Marshal(attribute{Type: a.oid, Values: []asn1.RawValue{{FullBytes: value}}})
+		if err != nil {
+			return Part{}, err
+		}
+		attributes = append(attributes, b)
+	}
+	// a SET OF is in the order of its encoded elements in DER, and the signature is over the
+	// attributes as a SET rather than the implicitly tagged field they are sent as
+	slices.SortFunc(attributes, bytes.Compare)
+	signed := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(attributes, nil)}
+	b, err := asn1.Marshal(signed)
+	if err != nil {
+		return Part{}, err
+	}
+	hash := sha256.Sum256(b)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return Part{}, err
+	}
+
+	certificates := append([]byte{}, certificate.Raw...)
+	for _, c := range chain {
+		certificates = append(certificates, c.Raw...)
+	}
+	sha256Algorithm := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	sd, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Algorithm},
+		EncapContentInfo: encapsulatedContentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certificates},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			Sid:                issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: certificate.RawIssuer}, SerialNumber: certificate.SerialNumber},
+			DigestAlgorithm:    sha256Algorithm,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signed.Bytes},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue},
+			Signature:          signature,
+		}},
+	})
+	if err != nil {
+		return Part{}, err
+	}
+	der, err := asn1.Marshal(contentInfo{ContentType: oidSignedData, Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd}})
+	if err != nil {
+		return Part{}, err
+	}
+
+	return multipartWith("signed", map[string]string{"protocol": "application/pkcs7-signature", "micalg": "sha-256"},
+		verbatim(entity),
+		binary("application/pkcs7-signature", "attachment", "smime.p7s", "", inMemory(der)),
+	), nil
+}
+
+// EncryptSMIME encrypts a part for the given certificates with RSA keys as per RFC 8551, which
+// turns it into an application/pkcs7-mime part with the CMS enveloped data, the content of
+// which is encrypted with AES-256-CBC and a key that is encrypted for every recipient.
+func EncryptSMIME(p Part, recipients ...*x509.Certificate) (Part, error) {
+	entity, err := p.entity()
+	if err != nil {
+		return Part{}, err
+	}
+	key := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(key); err != nil {
+		return Part{}, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return Part{}, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return Part{}, err
+	}
+	// padded as per PKCS #7, with as many bytes as there are, a whole block when it fits
+	padding := aes.BlockSize - len(entity)%aes.BlockSize
+	encrypted := append(slices.Clone(entity), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	infos := []keyTransRecipientInfo{}
+	for _, c := range recipients {
+		public, ok := c.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return Part{}, fmt.Errorf("the certificate of '%s' has a %T rather than an RSA key", c.Subject.CommonName, c.PublicKey)
+		}
+		encryptedKey, err := rsa.EncryptPKCS1v15(rand.Reader, public, key)
+		if err != nil {
+			return Part{}, err
+		}
+		infos = append(infos, keyTransRecipientInfo{
+			Version:                0,
+			Rid:                    issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: c.RawIssuer}, SerialNumber: c.SerialNumber},
+			KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue},
+			EncryptedKey:           encryptedKey,
+		})
+	}
+	parameters, err := asn1.Marshal(iv)
+	if err != nil {
+		return Part{}, err
+	}
+	ed, err := asn1.Marshal(envelopedData{
+		Version:        0,
+		RecipientInfos: infos,
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: parameters}},
+			EncryptedContent:           encrypted,
+		},
+	})
+	if err != nil {
+		return Part{}, err
+	}
+	der, err := asn1.Marshal(contentInfo{ContentType: oidEnvelopedData, Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: ed}})
+	if err != nil {
+		return Part{}, err
+	}
+
+	encryptedPart := binary("application/pkcs7-mime", "attachment", "smime.p7m", "", inMemory(der))
+	encryptedPart.header.Set("Content-Type", mime.FormatMediaType("application/pkcs7-mime", map[string]string{"smime-type": "enveloped-data", "name": "smime.p7m"}))
+	return encryptedPart, nil
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Mailbox as per RFC 8621 section 2, of which only the properties that the client sets are
+// included, where a nil ParentId makes it a top-level mailbox.
+type Mailbox struct {
+	Name         string  `json:"name"`
+	ParentId     *string `json:"parentId"`
+	Role         string  `json:"role,omitempty"`
+	SortOrder    uint    `json:"sortOrder"`
+	IsSubscribed bool    `json:"isSubscribed"`
+}
+
+// EmailAddress as per RFC 8621 section 4.1.2.3.
+type EmailAddress struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email"`
+}
+
+// EmailBodyPart as per RFC 8621 section 4.1.4, of which only the properties that are used to
+// create emails are included.
+type EmailBodyPart struct {
+	PartId      string          `json:"partId,omitempty"`
+	BlobId      string          `json:"blobId,omitempty"`
+	Size        uint            `json:"size,omitempty"`
+	Name        string          `json:"name,omitempty"`
+	Type        string          `json:"type,omitempty"`
+	Charset     string          `json:"charset,omitempty"`
+	Disposition string          `json:"disposition,omitempty"`
+	Cid         string          `json:"cid,omitempty"`
+	Language    []string        `json:"language,omitempty"`
+	SubParts    []EmailBodyPart `json:"subParts,omitempty"`
+}
+
+// EmailBodyValue as per RFC 8621 section 4.1.4.
+type EmailBodyValue struct {
+	Value             string `json:"value"`
+	IsEncodingProblem bool   `json:"isEncodingProblem,omitempty"`
+	IsTruncated       bool   `json:"isTruncated,omitempty"`
+}
+
+// EmailImport as per RFC 8621 section 4.8, which creates an email from a message that was
+// uploaded as a blob.
+type EmailImport struct {
+	BlobId     string          `json:"blobId"`
+	MailboxIds map[string]bool `json:"mailboxIds"`
+	Keywords   map[string]bool `json:"keywords,omitempty"`
+	ReceivedAt *time.Time      `json:"receivedAt,omitempty"`
+}
+
+// Email as per RFC 8621 section 4.1.
+//
+// Headers holds the values of the "header:{name}" properties, by header name, which are
+// raw header values as they appear in the message.
+type Email struct {
+	Id          string                    `json:"id,omitempty"`
+	BlobId      string                    `json:"blobId,omitempty"`
+	ThreadId    string                    `json:"threadId,omitempty"`
+	MailboxIds  map[string]bool           `json:"mailboxIds,omitempty"`
+	Keywords    map[string]bool           `json:"keywords,omitempty"`
+	Size        uint                      `json:"size,omitempty"`
+	ReceivedAt  *time.Time                `json:"receivedAt,omitempty"`
+	MessageId   []string                  `json:"messageId,omitempty"`
+	InReplyTo   []string                  `json:"inReplyTo,omitempty"`
+	References  []string                  `json:"references,omitempty"`
+	Sender      []EmailAddress            `json:"sender,omitempty"`
+	From        []EmailAddress            `json:"from,omitempty"`
+	To          []EmailAddress            `json:"to,omitempty"`
+	Cc          []EmailAddress            `json:"cc,omitempty"`
+	Bcc         []EmailAddress            `json:"bcc,omitempty"`
+	ReplyTo     []EmailAddress            `json:"replyTo,omitempty"`
+	Subject     string                    `json:"subject,omitempty"`
+	SentAt      *time.Time                `json:"sentAt,omitempty"`
+	BodyValues  map[string]EmailBodyValue `json:"bodyValues,omitempty"`
+	TextBody    []EmailBodyPart           `json:"textBody,omitempty"`
+	HtmlBody    []EmailBodyPart           `json:"htmlBody,omitempty"`
+	Attachments []EmailBodyPart           `json:"attachments,omitempty"`
+	Headers     map[string]string         `json:"-"`
+}
+
+const headerPropertyPrefix = "header:"
+
+func (e Email) MarshalJSON() ([]byte, error) {
+	type plain Email
+	b, err := json.Marshal(plain(e))
+	if err != nil || len(e.Headers) == 0 {
+		return b, err
+	}
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for name, value := range e.Headers {
+		v, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		m[headerPropertyPrefix+name] = v
+	}
+	return json.Marshal(m)
+}
+
+func (e *Email) UnmarshalJSON(b []byte) error {
+	type plain Email
+	if err := json.Unmarshal(b, (*plain)(e)); err != nil {
+		return err
+	}
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	for property, v := range m {
+		if name, ok := strings.CutPrefix(property, headerPropertyPrefix); ok {
+			var value string
+			if err := json.Unmarshal(v, &value); err != nil {
+				// only the raw form is supported, other forms are not strings
+				continue
+			}
+			if e.Headers == nil {
+				e.Headers = map[string]string{}
+			}
+			e.Headers[name] = value
+		}
+	}
+	return nil
+}
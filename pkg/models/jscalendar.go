@@ -0,0 +1,188 @@
+package models
+
+// The JSCalendar objects as per RFC 8984, along with the JMAP for Calendars and JMAP for Tasks
+// properties of the CalendarEvent and the Task.
+
+const (
+	ProgressNeedsAction = "needs-action"
+	ProgressInProcess   = "in-process"
+	ProgressCompleted   = "completed"
+	ProgressFailed      = "failed"
+	ProgressCancelled   = "cancelled"
+)
+
+type CalendarEvent struct {
+	Id                     string                     `json:"id,omitempty"`
+	CalendarIds            map[string]bool            `json:"calendarIds,omitempty"`
+	IsDraft                bool                       `json:"isDraft"`
+	Uid                    string                     `json:"uid"`
+	ProdId                 string                     `json:"prodId,omitempty"`
+	Sequence               uint                       `json:"sequence"`
+	Title                  string                     `json:"title,omitempty"`
+	Description            string                     `json:"description,omitempty"`
+	DescriptionContentType string                     `json:"descriptionContentType,omitempty"`
+	Start                  string                     `json:"start"`
+	Duration               string                     `json:"duration,omitempty"`
+	TimeZone               string                     `json:"timeZone,omitempty"`
+	ShowWithoutTime        bool                       `json:"showWithoutTime"`
+	Status                 string                     `json:"status,omitempty"`
+	FreeBusyStatus         string                     `json:"freeBusyStatus,omitempty"`
+	Privacy                string                     `json:"privacy,omitempty"`
+	Locale                 string                     `json:"locale,omitempty"`
+	Keywords               map[string]bool            `json:"keywords,omitempty"`
+	Categories             map[string]bool            `json:"categories,omitempty"`
+	Color                  string                     `json:"color,omitempty"`
+	Links                  map[string]Link            `json:"links,omitempty"`
+	Locations              map[string]Location        `json:"locations,omitempty"`
+	VirtualLocations       map[string]VirtualLocation `json:"virtualLocations,omitempty"`
+	RecurrenceRules        []RecurrenceRule           `json:"recurrenceRules,omitempty"`
+	ReplyTo                map[string]string          `json:"replyTo,omitempty"`
+	SentBy                 string                     `json:"sentBy,omitempty"`
+	Participants           map[string]Participant     `json:"participants,omitempty"`
+	Alerts                 map[string]Alert           `json:"alerts,omitempty"`
+	MayInviteSelf          bool                       `json:"mayInviteSelf"`
+	MayInviteOthers        bool                       `json:"mayInviteOthers"`
+	HideAttendees          bool                       `json:"hideAttendees"`
+}
+
+func (e CalendarEvent) MarshalJSON() ([]byte, error) {
+	type plain CalendarEvent
+	return typed("Event", plain(e))
+}
+
+type Task struct {
+	Id                     string                 `json:"id,omitempty"`
+	TaskListIds            map[string]bool        `json:"taskListIds,omitempty"`
+	Uid                    string                 `json:"uid"`
+	ProdId                 string                 `json:"prodId,omitempty"`
+	Sequence               uint                   `json:"sequence"`
+	Title                  string                 `json:"title,omitempty"`
+	Description            string                 `json:"description,omitempty"`
+	DescriptionContentType string                 `json:"descriptionContentType,omitempty"`
+	Start                  string                 `json:"start,omitempty"`
+	Due                    string                 `json:"due,omitempty"`
+	EstimatedDuration      string                 `json:"estimatedDuration,omitempty"`
+	TimeZone               string                 `json:"timeZone,omitempty"`
+	ShowWithoutTime        bool                   `json:"showWithoutTime"`
+	PercentComplete        uint                   `json:"percentComplete"`
+	Progress               string                 `json:"progress,omitempty"`
+	Priority               int                    `json:"priority"`
+	Privacy                string                 `json:"privacy,omitempty"`
+	Locale                 string                 `json:"locale,omitempty"`
+	Keywords               map[string]bool        `json:"keywords,omitempty"`
+	Categories             map[string]bool        `json:"categories,omitempty"`
+	Color                  string                 `json:"color,omitempty"`
+	Links                  map[string]Link        `json:"links,omitempty"`
+	Participants           map[string]Participant `json:"participants,omitempty"`
+	Alerts                 map[string]Alert       `json:"alerts,omitempty"`
+}
+
+func (t Task) MarshalJSON() ([]byte, error) {
+	type plain Task
+	return typed("Task", plain(t))
+}
+
+type Link struct {
+	Href        string `json:"href"`
+	ContentType string `json:"contentType,omitempty"`
+	Size        uint   `json:"size,omitempty"`
+	Rel         string `json:"rel,omitempty"`
+	Display     string `json:"display,omitempty"`
+	Title       string `json:"title,omitempty"`
+}
+
+func (l Link) MarshalJSON() ([]byte, error) {
+	type plain Link
+	return typed("Link", plain(l))
+}
+
+type Location struct {
+	Name          string          `json:"name,omitempty"`
+	Description   string          `json:"description,omitempty"`
+	LocationTypes map[string]bool `json:"locationTypes,omitempty"`
+	Coordinates   string          `json:"coordinates,omitempty"`
+	TimeZone      string          `json:"timeZone,omitempty"`
+	Links         map[string]Link `json:"links,omitempty"`
+}
+
+func (l Location) MarshalJSON() ([]byte, error) {
+	type plain Location
+	return typed("Location", plain(l))
+}
+
+type VirtualLocation struct {
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Uri         string          `json:"uri"`
+	Features    map[string]bool `json:"features,omitempty"`
+}
+
+func (l VirtualLocation) MarshalJSON() ([]byte, error) {
+	type plain VirtualLocation
+	return typed("VirtualLocation", plain(l))
+}
+
+type RecurrenceRule struct {
+	Frequency      string `json:"frequency"`
+	Interval       uint   `json:"interval,omitempty"`
+	Rscale         string `json:"rscale,omitempty"`
+	Skip           string `json:"skip,omitempty"`
+	FirstDayOfWeek string `json:"firstDayOfWeek,omitempty"`
+	Count          uint   `json:"count,omitempty"`
+	Until          string `json:"until,omitempty"`
+}
+
+func (r RecurrenceRule) MarshalJSON() ([]byte, error) {
+	type plain RecurrenceRule
+	return typed("RecurrenceRule", plain(r))
+}
+
+type Participant struct {
+	Name                 string            `json:"name,omitempty"`
+	Email                string            `json:"email,omitempty"`
+	Description          string            `json:"description,omitempty"`
+	SendTo               map[string]string `json:"sendTo,omitempty"`
+	Kind                 string            `json:"kind,omitempty"`
+	Roles                map[string]bool   `json:"roles,omitempty"`
+	LocationId           string            `json:"locationId,omitempty"`
+	Language             string            `json:"language,omitempty"`
+	ParticipationStatus  string            `json:"participationStatus,omitempty"`
+	ParticipationComment string            `json:"participationComment,omitempty"`
+	ExpectReply          bool              `json:"expectReply,omitempty"`
+	ScheduleAgent        string            `json:"scheduleAgent,omitempty"`
+	ScheduleSequence     uint              `json:"scheduleSequence,omitempty"`
+	ScheduleStatus       []string          `json:"scheduleStatus,omitempty"`
+	ScheduleUpdated      string            `json:"scheduleUpdated,omitempty"`
+	SentBy               string            `json:"sentBy,omitempty"`
+	InvitedBy            string            `json:"invitedBy,omitempty"`
+	ScheduleId           string            `json:"scheduleId,omitempty"`
+	Links                map[string]Link   `json:"links,omitempty"`
+	// only for tasks
+	Progress        string `json:"progress,omitempty"`
+	PercentComplete uint   `json:"percentComplete,omitempty"`
+}
+
+func (p Participant) MarshalJSON() ([]byte, error) {
+	type plain Participant
+	return typed("Participant", plain(p))
+}
+
+type OffsetTrigger struct {
+	Offset     string `json:"offset"`
+	RelativeTo string `json:"relativeTo,omitempty"`
+}
+
+func (t OffsetTrigger) MarshalJSON() ([]byte, error) {
+	type plain OffsetTrigger
+	return typed("OffsetTrigger", plain(t))
+}
+
+type Alert struct {
+	Trigger OffsetTrigger `json:"trigger"`
+	Action  string        `json:"action,omitempty"`
+}
+
+func (a Alert) MarshalJSON() ([]byte, error) {
+	type plain Alert
+	return typed("Alert", plain(a))
+}
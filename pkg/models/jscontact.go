@@ -0,0 +1,216 @@
+package models
+
+// The JSContact objects as per RFC 9553, along with the JMAP for Contacts properties of a
+// ContactCard as per RFC 9610.
+
+const (
+	CardVersion = "1.0"
+
+	CardKindIndividual = "individual"
+	CardKindGroup      = "group"
+	CardKindOrg        = "org"
+)
+
+type ContactCard struct {
+	Id                 string                   `json:"id,omitempty"`
+	AddressBookIds     map[string]bool          `json:"addressBookIds,omitempty"`
+	Version            string                   `json:"version"`
+	Uid                string                   `json:"uid,omitempty"`
+	ProdId             string                   `json:"prodId,omitempty"`
+	Language           string                   `json:"language,omitempty"`
+	Kind               string                   `json:"kind,omitempty"`
+	Name               *Name                    `json:"name,omitempty"`
+	Nicknames          map[string]Nickname      `json:"nicknames,omitempty"`
+	Emails             map[string]ContactEmail  `json:"emails,omitempty"`
+	Phones             map[string]Phone         `json:"phones,omitempty"`
+	Addresses          map[string]Address       `json:"addresses,omitempty"`
+	OnlineServices     map[string]OnlineService `json:"onlineServices,omitempty"`
+	PreferredLanguages map[string]LanguagePref  `json:"preferredLanguages,omitempty"`
+	Organizations      map[string]Organization  `json:"organizations,omitempty"`
+	Titles             map[string]Title         `json:"titles,omitempty"`
+	CryptoKeys         map[string]CryptoKey     `json:"cryptoKeys,omitempty"`
+	Media              map[string]Media         `json:"media,omitempty"`
+	Links              map[string]ContactLink   `json:"links,omitempty"`
+}
+
+func (c ContactCard) MarshalJSON() ([]byte, error) {
+	type plain ContactCard
+	return typed("Card", plain(c))
+}
+
+type NameComponent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+func (c NameComponent) MarshalJSON() ([]byte, error) {
+	type plain NameComponent
+	return typed("NameComponent", plain(c))
+}
+
+type Name struct {
+	Components       []NameComponent `json:"components,omitempty"`
+	IsOrdered        bool            `json:"isOrdered,omitempty"`
+	DefaultSeparator string          `json:"defaultSeparator,omitempty"`
+	Full             string          `json:"full,omitempty"`
+}
+
+func (n Name) MarshalJSON() ([]byte, error) {
+	type plain Name
+	return typed("Name", plain(n))
+}
+
+type Nickname struct {
+	Name     string          `json:"name"`
+	Contexts map[string]bool `json:"contexts,omitempty"`
+	Pref     uint            `json:"pref,omitempty"`
+}
+
+func (n Nickname) MarshalJSON() ([]byte, error) {
+	type plain Nickname
+	return typed("Nickname", plain(n))
+}
+
+// ContactEmail is the EmailAddress of JSContact, which is not to be confused with the one of
+// JMAP Mail.
+type ContactEmail struct {
+	Address  string          `json:"address"`
+	Contexts map[string]bool `json:"contexts,omitempty"`
+	Pref     uint            `json:"pref,omitempty"`
+	Label    string          `json:"label,omitempty"`
+}
+
+func (e ContactEmail) MarshalJSON() ([]byte, error) {
+	type plain ContactEmail
+	return typed("EmailAddress", plain(e))
+}
+
+type Phone struct {
+	Number   string          `json:"number"`
+	Features map[string]bool `json:"features,omitempty"`
+	Contexts map[string]bool `json:"contexts,omitempty"`
+	Pref     uint            `json:"pref,omitempty"`
+	Label    string          `json:"label,omitempty"`
+}
+
+func (p Phone) MarshalJSON() ([]byte, error) {
+	type plain Phone
+	return typed("Phone", plain(p))
+}
+
+type AddressComponent struct {
+	Kind     string `json:"kind"`
+	Value    string `json:"value"`
+	Phonetic string `json:"phonetic,omitempty"`
+}
+
+func (c AddressComponent) MarshalJSON() ([]byte, error) {
+	type plain AddressComponent
+	return typed("AddressComponent", plain(c))
+}
+
+type Address struct {
+	Components       []AddressComponent `json:"components,omitempty"`
+	IsOrdered        bool               `json:"isOrdered,omitempty"`
+	CountryCode      string             `json:"countryCode,omitempty"`
+	Coordinates      string             `json:"coordinates,omitempty"`
+	TimeZone         string             `json:"timeZone,omitempty"`
+	Contexts         map[string]bool    `json:"contexts,omitempty"`
+	Full             string             `json:"full,omitempty"`
+	DefaultSeparator string             `json:"defaultSeparator,omitempty"`
+	Pref             uint               `json:"pref,omitempty"`
+}
+
+func (a Address) MarshalJSON() ([]byte, error) {
+	type plain Address
+	return typed("Address", plain(a))
+}
+
+type OnlineService struct {
+	Service  string          `json:"service,omitempty"`
+	Uri      string          `json:"uri,omitempty"`
+	User     string          `json:"user,omitempty"`
+	Contexts map[string]bool `json:"contexts,omitempty"`
+	Pref     uint            `json:"pref,omitempty"`
+	Label    string          `json:"label,omitempty"`
+}
+
+func (s OnlineService) MarshalJSON() ([]byte, error) {
+	type plain OnlineService
+	return typed("OnlineService", plain(s))
+}
+
+type LanguagePref struct {
+	Language string          `json:"language"`
+	Contexts map[string]bool `json:"contexts,omitempty"`
+	Pref     uint            `json:"pref,omitempty"`
+}
+
+func (l LanguagePref) MarshalJSON() ([]byte, error) {
+	type plain LanguagePref
+	return typed("LanguagePref", plain(l))
+}
+
+type Organization struct {
+	Name     string          `json:"name,omitempty"`
+	Contexts map[string]bool `json:"contexts,omitempty"`
+}
+
+func (o Organization) MarshalJSON() ([]byte, error) {
+	type plain Organization
+	return typed("Organization", plain(o))
+}
+
+type Title struct {
+	Name           string `json:"name"`
+	Kind           string `json:"kind,omitempty"`
+	OrganizationId string `json:"organizationId,omitempty"`
+}
+
+func (t Title) MarshalJSON() ([]byte, error) {
+	type plain Title
+	return typed("Title", plain(t))
+}
+
+// CryptoKey holds the public key of a contact, typically as a data: URI.
+type CryptoKey struct {
+	Uri       string          `json:"uri"`
+	MediaType string          `json:"mediaType,omitempty"`
+	Contexts  map[string]bool `json:"contexts,omitempty"`
+	Pref      uint            `json:"pref,omitempty"`
+	Label     string          `json:"label,omitempty"`
+}
+
+func (k CryptoKey) MarshalJSON() ([]byte, error) {
+	type plain CryptoKey
+	return typed("CryptoKey", plain(k))
+}
+
+type Media struct {
+	Kind      string          `json:"kind"`
+	Uri       string          `json:"uri"`
+	MediaType string          `json:"mediaType,omitempty"`
+	Contexts  map[string]bool `json:"contexts,omitempty"`
+	Pref      uint            `json:"pref,omitempty"`
+	Label     string          `json:"label,omitempty"`
+}
+
+func (m Media) MarshalJSON() ([]byte, error) {
+	type plain Media
+	return typed("Media", plain(m))
+}
+
+// ContactLink is the Link of JSContact, which is not to be confused with the one of JSCalendar.
+type ContactLink struct {
+	Kind      string          `json:"kind,omitempty"`
+	Uri       string          `json:"uri"`
+	MediaType string          `json:"mediaType,omitempty"`
+	Contexts  map[string]bool `json:"contexts,omitempty"`
+	Pref      uint            `json:"pref,omitempty"`
+	Label     string          `json:"label,omitempty"`
+}
+
+func (l ContactLink) MarshalJSON() ([]byte, error) {
+	type plain ContactLink
+	return typed("Link", plain(l))
+}
@@ -0,0 +1,25 @@
+// Package models holds the JMAP Mail (RFC 8621), JSContact (RFC 9553) and JSCalendar (RFC 8984)
+// objects that we create on the server.
+//
+// The JSContact and JSCalendar objects marshal their @type themselves, as it is fixed for each
+// of them.
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// typed marshals v, which must marshal to a JSON object, with the given @type in front of
+// its other properties.
+func typed(t string, v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	prefix := `{"@type":` + strconv.Quote(t)
+	if string(b) == "{}" {
+		return []byte(prefix + "}"), nil
+	}
+	return append([]byte(prefix+","), b[1:]...), nil
+}
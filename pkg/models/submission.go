@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Identity as per RFC 8621 section 6, of which only the properties that the client sets are
+// included, besides its id.
+type Identity struct {
+	Id            string         `json:"id,omitempty"`
+	Name          string         `json:"name"`
+	Email         string         `json:"email"`
+	ReplyTo       []EmailAddress `json:"replyTo,omitempty"`
+	Bcc           []EmailAddress `json:"bcc,omitempty"`
+	TextSignature string         `json:"textSignature,omitempty"`
+	HtmlSignature string         `json:"htmlSignature,omitempty"`
+}
+
+// EmailSubmission as per RFC 8621 section 7, of which only the properties that are used to
+// submit emails are included.
+type EmailSubmission struct {
+	Id             string                    `json:"id,omitempty"`
+	IdentityId     string                    `json:"identityId"`
+	EmailId        string                    `json:"emailId"`
+	Envelope       *Envelope                 `json:"envelope,omitempty"`
+	SendAt         *time.Time                `json:"sendAt,omitempty"`
+	UndoStatus     string                    `json:"undoStatus,omitempty"`
+	DeliveryStatus map[string]DeliveryStatus `json:"deliveryStatus,omitempty"`
+}
+
+// Envelope as per RFC 8621 section 7, which is derived from the headers of the email when
+// it is not given.
+type Envelope struct {
+	MailFrom EnvelopeAddress   `json:"mailFrom"`
+	RcptTo   []EnvelopeAddress `json:"rcptTo"`
+}
+
+type EnvelopeAddress struct {
+	Email      string         `json:"email"`
+	Parameters map[string]any `json:"parameters,omitempty"`
+}
+
+type DeliveryStatus struct {
+	SmtpReply string `json:"smtpReply"`
+	Delivered string `json:"delivered"`
+	Displayed string `json:"displayed"`
+}
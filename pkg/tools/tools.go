@@ -80,3 +80,17 @@ func PickRandoms1[T any](s ...T) []T {
 func PickLanguage() string {
 	return PickRandom("en-US", "en-GB", "en-AU")
 }
+
+// FormatBytes formats a number of bytes with a binary unit, e.g. "1.5 MiB".
+func FormatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}